@@ -669,6 +669,21 @@ func (d *Data) NewMutationID() uint64 {
 	return repo.newMutationID()
 }
 
+// NewMutationIDs reserves n consecutive mutation IDs for the data's repo and returns
+// the first one.  This allows a group of mutations to be identified by a single range.
+func (d *Data) NewMutationIDs(n uint64) uint64 {
+	if manager == nil {
+		dvid.Criticalf("New mutation IDs requested for data %q but manager not initialized!\n", d.DataName())
+		return 0
+	}
+	repo, err := manager.repoFromUUID(d.RootUUID())
+	if err != nil {
+		dvid.Criticalf("New mutation IDs requested for data %q but no repo associated with root %s\n", d.DataName(), d.RootUUID())
+		return 0
+	}
+	return repo.newMutationIDs(n)
+}
+
 // ---- dvid.DataSetter implementation ----
 
 func (d *Data) SetInstanceID(id dvid.InstanceID) {
@@ -2516,6 +2516,11 @@ func (r *repoT) getMutationID() (mutID uint64) {
 }
 
 func (r *repoT) newMutationID() (mutID uint64) {
+	return r.newMutationIDs(1)
+}
+
+// newMutationIDs reserves n consecutive mutation IDs and returns the first one.
+func (r *repoT) newMutationIDs(n uint64) (mutID uint64) {
 	if manager == nil || manager.store == nil {
 		dvid.Criticalf("Bad new mutation ID request.  Manager or store nil.\n")
 		return
@@ -2527,9 +2532,9 @@ func (r *repoT) newMutationID() (mutID uint64) {
 	var ctx storage.MetadataContext
 	r.mutMu.Lock()
 	mutID = r.mutCurID
-	r.mutCurID++
+	r.mutCurID += n
 	if r.mutCurID >= r.mutSavedID {
-		r.mutSavedID += StrideMutationID
+		r.mutSavedID = r.mutCurID + StrideMutationID
 		mutdata := make([]byte, 8)
 		binary.LittleEndian.PutUint64(mutdata, r.mutSavedID)
 		tk := storage.NewTKey(mutidKey, r.id.Bytes())
@@ -64,6 +64,15 @@ $ dvid repo <UUID> new annotation <data name> <settings...>
     UUID           Hexadecimal string with enough characters to uniquely identify a version node.
     data name      Name of data to create, e.g., "synapses"
     settings       Configuration settings in "key=value" format separated by spaces.
+
+    Configuration Settings (case-insensitive keys)
+
+	IndexedProps	Comma-separated element property names, e.g., "status,user", that are 
+					indexed by value.  A filter with an equality test on an indexed property,
+					e.g., "status=done AND conf>0.8", can then be answered by all-elements 
+					without scanning every block.  Properties added to existing data are
+					indexed from then on, but since earlier elements are missing from their
+					indices, filters on them always scan every block.
 	
 $ dvid node <UUID> <data name> reload <settings...>
 
@@ -79,6 +88,18 @@ $ dvid node <UUID> <data name> reload <settings...>
 	inmemory 	"false": (default "true") use in-memory reload, which assumes the server
 					has enough memory to hold all annotations in memory.
 
+$ dvid node <UUID> <data name> export-precomputed <directory>
+
+	Asynchronously exports all annotations to the given directory on the server in the 
+	Neuroglancer precomputed annotation format.  The directory layout is the same as the
+	precomputed endpoint below and can be served by any static file server.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of annotation data, e.g., "synapses".
+    directory     Directory path on the server where precomputed files will be written.
+
     ------------------
 
 HTTP API (Level 2 REST):
@@ -149,6 +170,17 @@ POST <api URL>/node/<UUID>/<data name>/tags?<options>
 Note: For the following URL endpoints that return and accept POSTed JSON values, see the JSON format
 at end of this documentation.
 
+Note: The label, tag, roi, elements, and all-elements GET endpoints accept a "filter" query
+string that only returns elements whose properties satisfy a predicate.  A predicate is a list
+of comparisons joined by " AND " and " OR ", where AND binds more tightly than OR, e.g.,
+
+	filter=conf>0.8 AND user!=auto OR status=done
+
+Each comparison is <property><op><value> where op is one of =, !=, <, <=, >, >=.  Values are
+compared as numbers if both the property and the value are numbers, else as strings.  Elements
+missing a property only satisfy != comparisons on that property.  Remember to URL encode the
+filter, e.g., "filter=conf%3E0.8%20AND%20user!%3Dauto".
+
 GET <api URL>/node/<UUID>/<data name>/label/<label>[?<options>]
 
 	Returns all point annotations within the given label as an array of elements.
@@ -158,6 +190,7 @@ GET <api URL>/node/<UUID>/<data name>/label/<label>[?<options>]
 	GET Query-string Option:
 
 	relationships   Set to true to return all relationships for each annotation.
+	filter          Only return elements satisfying the given property predicate.
 
 	Example:
 
@@ -173,6 +206,7 @@ GET <api URL>/node/<UUID>/<data name>/tag/<tag>[?<options>]
 	GET Query-string Option:
 
 	relationships   Set to true to return all relationships for each annotation.
+	filter          Only return elements satisfying the given property predicate.
 
 	Example:
 
@@ -196,7 +230,7 @@ DELETE <api URL>/node/<UUID>/<data name>/element/<coord>[?<options>]
 	kafkalog    Set to "off" if you don't want this mutation logged to kafka.
 
 
-GET <api URL>/node/<UUID>/<data name>/roi/<ROI specification>
+GET <api URL>/node/<UUID>/<data name>/roi/<ROI specification>[?<options>]
 
 	Returns all point annotations within the ROI.  The ROI specification must be specified
 	using a string of format "roiname,uuid".  If just "roiname" is specified without
@@ -205,7 +239,65 @@ GET <api URL>/node/<UUID>/<data name>/roi/<ROI specification>
 
 	The returned point annotations will be an array of elements.
 
-GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>
+	GET Query-string Option:
+
+	filter          Only return elements satisfying the given property predicate.
+
+GET <api URL>/node/<UUID>/<data name>/precomputed/<key>
+
+	Serves annotations read-only in the Neuroglancer precomputed annotation format, so 
+	Neuroglancer can view them using a source like:
+
+	precomputed://http://foo.com/api/node/83af/synapses/precomputed
+
+	Each element is a point annotation with a "kind" enum property, e.g., "PreSyn", and an 
+	annotation ID packed from its position, which must be non-negative and less than 2^21 
+	along each axis.  The following keys are served:
+
+	info                                 Precomputed info JSON.  The bounds and the spatial
+	                                       limit come from stored block extents, which only
+	                                       grow, so they can exceed the current annotations
+	                                       after deletions.
+	spatial0/<x>_<y>_<z>                 Annotations in the given annotation block.
+	by_id/<id>                           Annotation with the given ID.
+	relationships/body/<label>           Annotations within the given body.
+	relationships/partner/<label>        Annotations pointed to by relationships of the 
+	                                       given body's annotations, e.g., the PSDs of a 
+	                                       body's T-bars.
+
+	Relationships are only available if the annotations are synced with labels.
+
+POST <api URL>/node/<UUID>/<data name>/connectivity[?<options>]
+
+	Returns weighted body-to-body connections computed from the PreSynTo and PostSynTo 
+	relationships of synaptic elements.  Each end of a relationship is mapped to its current
+	body using the synced labels, e.g., the synced labelmap's current mapping, and each 
+	unique presynaptic to postsynaptic pair counts once toward its connection's weight.
+
+	The POSTed JSON gives either a list of bodies or an ROI specification:
+
+	{ "bodies": [23, 101, 3005] }
+
+	{ "roi": "roiname,uuid" }
+
+	If bodies are given, only connections between the given bodies are returned.  If an ROI
+	is given, all connections with at least one synaptic element in the ROI are returned.  
+	As with the roi endpoint, the UUID of the request is used if not in the ROI specification.
+
+	The returned JSON is a list of connections sorted by decreasing weight:
+
+	[
+		{ "PreBody": 23, "PostBody": 101, "Weight": 12 },
+		{ "PreBody": 101, "PostBody": 3005, "Weight": 3 },
+		...
+	]
+
+	POST Query-string Options:
+
+	synapses   Set to true to add a "Synapses" list to each connection giving the "Pre" and 
+	             "Post" positions of each synapse.
+
+GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>[?<options>]
 
 	Returns all point annotations within subvolume of given size with upper left corner
 	at given offset.  The size and offset should be voxels separated by underscore, e.g.,
@@ -213,6 +305,97 @@ GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>
 
 	The returned point annotations will be an array of elements with relationships.
 
+	GET Query-string Option:
+
+	filter          Only return elements satisfying the given property predicate.
+
+GET <api URL>/node/<UUID>/<data name>/nearest/<coord>[?<options>]
+
+	Returns the point annotations nearest to the given coordinate, e.g., "300_410_2050", as an
+	array of elements sorted by increasing distance.  Each element has an additional 
+	"Distance" property giving its Euclidean distance in voxels from the coordinate.  Blocks 
+	of elements are searched outward from the coordinate so the query is fast if the nearest 
+	elements are close.  The search extends at most 16 blocks from the block containing the
+	coordinate.  If it stops at that limit, only elements closer than any unsearched voxel 
+	are returned, so fewer than k elements may be returned.
+
+	GET Query-string Options:
+
+	k               Number of nearest elements to return.  Default is 1.
+	maxdist         Only return elements within this distance in voxels.  Setting this
+	                  speeds queries in sparse regions.
+	kind            Only return elements of this kind, e.g., "PreSyn".
+	relationships   Set to true to return all relationships for each annotation.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/synapses/nearest/300_410_2050?k=20&kind=PreSyn
+
+GET <api URL>/node/<UUID>/<data name>/within/<coord>/<radius>[?<options>]
+
+	Returns all point annotations within the given radius in voxels of the coordinate as an
+	array of elements sorted by increasing distance.  As with the nearest endpoint, each 
+	element has a "Distance" property.
+
+	GET Query-string Options:
+
+	kind            Only return elements of this kind, e.g., "PreSyn".
+	relationships   Set to true to return all relationships for each annotation.
+
+POST <api URL>/node/<UUID>/<data name>/import?format=<format>[&<options>]
+
+	Streams elements in the POSTed body into storage in batches, so very large imports don't
+	need to fit in memory.  Unlike the elements endpoint, elements at the same position are 
+	merged with each other and with stored elements: tags and relationships are added, 
+	properties are overwritten, and the kind is replaced if known.  If an error occurs, 
+	elements in batches before the error remain stored.
+
+	The format can be "ndjson", where each line is an element's JSON as for the elements 
+	endpoint, or "csv", where the first row is a header giving column names and each 
+	following row gives an element.  CSV columns are mapped to element fields using the
+	options below.  By default, columns named x, y, z, kind, tags and rels are used, which
+	matches the CSV from the export endpoint.
+
+	POST Query-string Options:
+
+	format       "csv" or "ndjson"
+	kafkalog     Set to "off" if you don't want this mutation logged to kafka.
+
+	CSV Mapping Options:
+
+	pos          Column names of x, y and z coordinates.  Default "x,y,z".
+	kind         Column name of element kind, e.g., "PreSyn".  Default "kind".
+	defaultkind  Kind for rows without a kind value, e.g., "PostSyn".  Default "Unknown".
+	tags         Column name of tags separated by semicolons.  Default "tags".
+	rels         Column name of relationships separated by semicolons, each given as 
+	               <relationship>:<x>_<y>_<z>, e.g., "PreSynTo:20_30_40".  Default "rels".
+	props        Column names stored as properties using the column name as key, e.g., 
+	               "confidence,model".  Empty values are not stored.
+	partner      Column names of x, y and z coordinates of a partner element, adding a
+	               relationship from each row's element to the partner.
+	partnerrel   Relationship to the partner.  Default is "PreSynTo" for PreSyn, "PostSynTo"
+	               for PostSyn, and "GroupedWith" for others.
+	partnerkind  If set, a partner element of this kind with the reciprocal relationship 
+	               is also added.
+
+	Example for a CSV of synaptic connections with columns pre_x, pre_y, pre_z, post_x, 
+	post_y, post_z and confidence:
+
+	POST http://foo.com/api/node/83af/synapses/import?format=csv&pos=pre_x,pre_y,pre_z&defaultkind=PreSyn&partner=post_x,post_y,post_z&partnerkind=PostSyn&props=confidence
+
+GET <api URL>/node/<UUID>/<data name>/export[?<options>]
+
+	Streams all elements in block order without loading them all into memory.  The "ndjson"
+	format gives one element's JSON with relationships per line.  The "csv" format gives a 
+	header row followed by columns x, y, z, kind, tags (separated by semicolons) and rels 
+	(<relationship>:<x>_<y>_<z> separated by semicolons), followed by any requested 
+	property columns.
+
+	GET Query-string Options:
+
+	format       "csv" or "ndjson".  Default "ndjson".
+	props        Property keys to add as CSV columns, e.g., "confidence,model".
+
 POST <api URL>/node/<UUID>/<data name>/elements[?<options>]
 
 	Adds or modifies point annotations.  The POSTed content is an array of elements.
@@ -256,7 +439,7 @@ GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>
 		...
 	}
 
-GET <api URL>/node/<UUID>/<data name>/all-elements
+GET <api URL>/node/<UUID>/<data name>/all-elements[?<options>]
 
 	Returns all point annotations in the entire data instance, which could exceed data
 	response sizes (set by server) if too many elements are present.  This should be
@@ -264,6 +447,13 @@ GET <api URL>/node/<UUID>/<data name>/all-elements
 
 	The returned stream of data is the same as /blocks endpoint.
 
+	GET Query-string Option:
+
+	filter          Only return elements satisfying the given property predicate.  Blocks
+	                  without matching elements are omitted.  If the filter requires equality
+	                  on an IndexedProps property set when the data was created, only blocks
+	                  in that index are read.
+
 
 POST <api URL>/node/<UUID>/<data name>/blocks[?<options>]
 
@@ -518,6 +708,41 @@ func (r RelationType) MarshalJSON() ([]byte, error) {
 	}
 }
 
+func (r RelationType) String() string {
+	switch r {
+	case UnknownRel:
+		return "UnknownRelationship"
+	case PostSynTo:
+		return "PostSynTo"
+	case PreSynTo:
+		return "PreSynTo"
+	case ConvergentTo:
+		return "ConvergentTo"
+	case GroupedWith:
+		return "GroupedWith"
+	default:
+		return fmt.Sprintf("Unknown relation type: %d", r)
+	}
+}
+
+// StringToRelationType converts a string to a RelationType.
+func StringToRelationType(s string) (RelationType, error) {
+	switch s {
+	case "UnknownRelationship":
+		return UnknownRel, nil
+	case "PostSynTo":
+		return PostSynTo, nil
+	case "PreSynTo":
+		return PreSynTo, nil
+	case "ConvergentTo":
+		return ConvergentTo, nil
+	case "GroupedWith":
+		return GroupedWith, nil
+	default:
+		return UnknownRel, fmt.Errorf("unknown relationship type %q", s)
+	}
+}
+
 func (r *RelationType) UnmarshalJSON(b []byte) error {
 	switch string(b) {
 	case `"UnknownRelationship"`:
@@ -950,9 +1175,49 @@ func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.
 		Data:       basedata,
 		Properties: Properties{},
 	}
+	if err := data.setIndexedProps(c); err != nil {
+		return nil, err
+	}
+	data.CompleteIndexedProps = append([]string{}, data.IndexedProps...)
 	return data, nil
 }
 
+// setIndexedProps sets the indexed properties from an "IndexedProps" setting of
+// comma-separated property names.
+func (d *Data) setIndexedProps(c dvid.Config) error {
+	propsStr, found, err := c.GetString("IndexedProps")
+	if err != nil || !found {
+		return err
+	}
+	d.IndexedProps = nil
+	for _, prop := range strings.Split(propsStr, ",") {
+		if prop = strings.TrimSpace(prop); prop != "" {
+			d.IndexedProps = append(d.IndexedProps, prop)
+		}
+	}
+	return nil
+}
+
+// ModifyConfig sets indexed properties in addition to the standard data settings.  Only
+// properties indexed since the data was created remain complete, since elements stored
+// before a property is added aren't in its index.
+func (d *Data) ModifyConfig(config dvid.Config) error {
+	if err := d.setIndexedProps(config); err != nil {
+		return err
+	}
+	var complete []string
+	for _, prop := range d.CompleteIndexedProps {
+		for _, indexed := range d.IndexedProps {
+			if prop == indexed {
+				complete = append(complete, prop)
+				break
+			}
+		}
+	}
+	d.CompleteIndexedProps = complete
+	return d.Data.ModifyConfig(config)
+}
+
 // --- Annotation Datatype -----
 
 type Type struct {
@@ -1078,7 +1343,7 @@ type tagDeltaT struct {
 	erase map[string]struct{} // points to erase
 }
 
-func addTagDelta(newBlockE, curBlockE Elements, tagDelta map[Tag]tagDeltaT) {
+func (d *Data) addTagDelta(newBlockE, curBlockE Elements, tagDelta map[Tag]tagDeltaT) {
 	if len(newBlockE) == 0 {
 		return
 	}
@@ -1087,7 +1352,7 @@ func addTagDelta(newBlockE, curBlockE Elements, tagDelta map[Tag]tagDeltaT) {
 		zyx := string(newElem.Pos.ToZYXBytes())
 		elemsByPoint[zyx] = newElem.ElementNR
 		// add every new point -- could check to see if exactly same but costs computation
-		for _, tag := range newElem.Tags {
+		for _, tag := range d.indexTags(newElem.ElementNR) {
 			td, found := tagDelta[tag]
 			if found {
 				td.add = append(td.add, newElem.ElementNR)
@@ -1103,16 +1368,13 @@ func addTagDelta(newBlockE, curBlockE Elements, tagDelta map[Tag]tagDeltaT) {
 		if !found {
 			continue
 		}
-		removed := curElem.Tags.Removed(newElem.Tags)
+		removed := d.indexTags(curElem.ElementNR).Removed(d.indexTags(newElem))
 		for _, tag := range removed {
-			td, found := tagDelta[tag]
-			if found {
-				td.erase[zyx] = struct{}{}
-			} else {
-				td.erase = map[string]struct{}{
-					zyx: struct{}{},
-				}
+			td := tagDelta[tag]
+			if td.erase == nil {
+				td.erase = make(map[string]struct{})
 			}
+			td.erase[zyx] = struct{}{}
 			tagDelta[tag] = td
 		}
 		delete(elemsByPoint, zyx)
@@ -1121,7 +1383,12 @@ func addTagDelta(newBlockE, curBlockE Elements, tagDelta map[Tag]tagDeltaT) {
 
 // Properties are additional properties for data beyond those in standard datastore.Data.
 type Properties struct {
-	// Currently unused since block sizes are either default or taken from synced labelblk.
+	// IndexedProps are element property names with a secondary index of elements by value.
+	IndexedProps []string
+
+	// CompleteIndexedProps are the IndexedProps indexed since the data was created, so their
+	// indices hold all elements and can be used to answer queries.
+	CompleteIndexedProps []string
 }
 
 // Data instance of labelvol, label sparse volumes.
@@ -1141,6 +1408,10 @@ type Data struct {
 
 	denormOngoing bool // true if we are doing denormalizations so avoid ops on them.
 
+	// Cached in-memory extents of stored element blocks for each version.
+	extents   map[dvid.VersionID]blockExtents
+	extentsMu sync.Mutex
+
 	sync.RWMutex // For CAS ops.  TODO: Make more specific (e.g., point locks) for efficiency.
 }
 
@@ -1283,7 +1554,7 @@ func (d *Data) getExpandedElements(ctx *datastore.VersionedCtx, tk storage.TKey)
 func (d *Data) deleteElementInTags(ctx *datastore.VersionedCtx, batch storage.Batch, pt dvid.Point3d, tags []Tag) error {
 	for _, tag := range tags {
 		// Get the elements in tag.
-		tk, err := NewTagTKey(tag)
+		tk, err := indexTKey(tag)
 		if err != nil {
 			return err
 		}
@@ -1401,7 +1672,7 @@ func (d *Data) deleteElementInRelationships(ctx *datastore.VersionedCtx, batch s
 func (d *Data) moveElementInTags(ctx *datastore.VersionedCtx, batch storage.Batch, from, to dvid.Point3d, tags []Tag) error {
 	for _, tag := range tags {
 		// Get the elements in tag.
-		tk, err := NewTagTKey(tag)
+		tk, err := indexTKey(tag)
 		if err != nil {
 			return err
 		}
@@ -1523,22 +1794,23 @@ func (d *Data) moveElementInRelationships(ctx *datastore.VersionedCtx, batch sto
 	return nil
 }
 
-func (d *Data) modifyElements(ctx *datastore.VersionedCtx, batch storage.Batch, tk storage.TKey, toAdd Elements) error {
+func (d *Data) modifyElements(ctx *datastore.VersionedCtx, batch storage.Batch, tk storage.TKey, toAdd Elements) (numElems int, err error) {
 	storeE, err := getElements(ctx, tk)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if storeE != nil {
 		storeE.add(toAdd)
 	} else {
 		storeE = toAdd
 	}
-	return putBatchElements(batch, tk, storeE)
+	return len(storeE), putBatchElements(batch, tk, storeE)
 }
 
 // stores synaptic elements arranged by block, replacing any
 // elements at same position.
 func (d *Data) storeBlockElements(ctx *datastore.VersionedCtx, batch storage.Batch, be map[dvid.IZYXString]Elements) error {
+	blockElems := make(map[dvid.ChunkPoint3d]int, len(be))
 	for izyxStr, elems := range be {
 		bcoord, err := izyxStr.ToChunkPoint3d()
 		if err != nil {
@@ -1546,11 +1818,13 @@ func (d *Data) storeBlockElements(ctx *datastore.VersionedCtx, batch storage.Bat
 		}
 		// Modify the block annotations
 		tk := NewBlockTKey(bcoord)
-		if err := d.modifyElements(ctx, batch, tk, elems); err != nil {
+		numElems, err := d.modifyElements(ctx, batch, tk, elems)
+		if err != nil {
 			return err
 		}
+		blockElems[bcoord] = numElems
 	}
-	return nil
+	return d.extendBlockExtents(ctx, blockElems)
 }
 
 // returns label elements with relationships for block elements, using
@@ -1766,11 +2040,11 @@ func (d *Data) storeLabelElements(ctx *datastore.VersionedCtx, batch storage.Bat
 // elements at same position.
 func (d *Data) storeTagElements(ctx *datastore.VersionedCtx, batch storage.Batch, te map[Tag]Elements) error {
 	for tag, elems := range te {
-		tk, err := NewTagTKey(tag)
+		tk, err := indexTKey(tag)
 		if err != nil {
 			return err
 		}
-		if err := d.modifyElements(ctx, batch, tk, elems); err != nil {
+		if _, err := d.modifyElements(ctx, batch, tk, elems); err != nil {
 			return err
 		}
 	}
@@ -1779,7 +2053,7 @@ func (d *Data) storeTagElements(ctx *datastore.VersionedCtx, batch storage.Batch
 
 func (d *Data) modifyTagElements(ctx *datastore.VersionedCtx, batch storage.Batch, tagDelta map[Tag]tagDeltaT) error {
 	for tag, td := range tagDelta {
-		tk, err := NewTagTKey(tag)
+		tk, err := indexTKey(tag)
 		if err != nil {
 			return err
 		}
@@ -1859,8 +2133,9 @@ func (d *Data) ProcessLabelAnnotations(v dvid.VersionID, f func(label uint64, el
 	return nil
 }
 
-// GetLabelJSON returns JSON for synapse elements in a given label.
-func (d *Data) GetLabelJSON(ctx *datastore.VersionedCtx, label uint64, addRels bool) ([]byte, error) {
+// GetLabelJSON returns JSON for synapse elements in a given label.  If filter is non-nil,
+// only elements matching the filter are returned.
+func (d *Data) GetLabelJSON(ctx *datastore.VersionedCtx, label uint64, addRels bool, filter *ElementFilter) ([]byte, error) {
 	// d.RLock()
 	// defer d.RUnlock()
 
@@ -1870,17 +2145,18 @@ func (d *Data) GetLabelJSON(ctx *datastore.VersionedCtx, label uint64, addRels b
 		if err != nil {
 			return nil, err
 		}
-		return json.Marshal(elems)
+		return json.Marshal(filter.FilterElements(elems))
 	}
 	elems, err := getElementsNR(ctx, tk)
 	if err != nil {
 		return nil, err
 	}
-	return json.Marshal(elems)
+	return json.Marshal(filter.FilterElementsNR(elems))
 }
 
-// GetTagJSON returns JSON for synapse elements in a given tag.
-func (d *Data) GetTagJSON(ctx *datastore.VersionedCtx, tag Tag, addRels bool) (jsonBytes []byte, err error) {
+// GetTagJSON returns JSON for synapse elements in a given tag.  If filter is non-nil,
+// only elements matching the filter are returned.
+func (d *Data) GetTagJSON(ctx *datastore.VersionedCtx, tag Tag, addRels bool, filter *ElementFilter) (jsonBytes []byte, err error) {
 	// d.RLock()
 	// defer d.RUnlock()
 
@@ -1891,9 +2167,15 @@ func (d *Data) GetTagJSON(ctx *datastore.VersionedCtx, tag Tag, addRels bool) (j
 	}
 	var elems interface{}
 	if addRels {
-		elems, err = d.getExpandedElements(ctx, tk)
+		var expanded Elements
+		if expanded, err = d.getExpandedElements(ctx, tk); err == nil {
+			elems = filter.FilterElements(expanded)
+		}
 	} else {
-		elems, err = getElementsNR(ctx, tk)
+		var elemsNR ElementsNR
+		if elemsNR, err = getElementsNR(ctx, tk); err == nil {
+			elems = filter.FilterElementsNR(elemsNR)
+		}
 	}
 	if err == nil {
 		jsonBytes, err = json.Marshal(elems)
@@ -1901,8 +2183,9 @@ func (d *Data) GetTagJSON(ctx *datastore.VersionedCtx, tag Tag, addRels bool) (j
 	return
 }
 
-// StreamAll returns all elements for this data instance.
-func (d *Data) StreamAll(ctx *datastore.VersionedCtx, w http.ResponseWriter) error {
+// StreamAll returns all elements for this data instance.  If filter is non-nil, only
+// elements matching the filter are returned and blocks without matching elements are omitted.
+func (d *Data) StreamAll(ctx *datastore.VersionedCtx, w http.ResponseWriter, filter *ElementFilter) error {
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return err
@@ -1916,14 +2199,7 @@ func (d *Data) StreamAll(ctx *datastore.VersionedCtx, w http.ResponseWriter) err
 		return err
 	}
 	numBlocks := 0
-	err = store.ProcessRange(ctx, minTKey, maxTKey, nil, func(chunk *storage.Chunk) error {
-		bcoord, err := DecodeBlockTKey(chunk.K)
-		if err != nil {
-			return err
-		}
-		if len(chunk.V) == 0 {
-			return nil
-		}
+	writeBlock := func(bcoord dvid.ChunkPoint3d, data []byte) error {
 		s := fmt.Sprintf(`"%d,%d,%d":`, bcoord[0], bcoord[1], bcoord[2])
 		if numBlocks > 0 {
 			s = "," + s
@@ -1931,14 +2207,74 @@ func (d *Data) StreamAll(ctx *datastore.VersionedCtx, w http.ResponseWriter) err
 		if _, err := w.Write([]byte(s)); err != nil {
 			return err
 		}
-		if _, err := w.Write(chunk.V); err != nil {
+		if _, err := w.Write(data); err != nil {
 			return err
 		}
 		numBlocks++
 		return nil
-	})
-	if err != nil {
-		return err
+	}
+	writeElements := func(bcoord dvid.ChunkPoint3d, elems Elements) error {
+		if elems = filter.FilterElements(elems); len(elems) == 0 {
+			return nil
+		}
+		data, err := json.Marshal(elems)
+		if err != nil {
+			return err
+		}
+		return writeBlock(bcoord, data)
+	}
+
+	if key, value, found := filter.indexedClause(d.CompleteIndexedProps); found {
+		// only read the blocks holding elements in the property index.
+		tk, err := NewPropIndexTKey(key, value)
+		if err != nil {
+			return err
+		}
+		elems, err := d.getExpandedElements(ctx, tk)
+		if err != nil {
+			return err
+		}
+		blockSize := d.blockSize()
+		blockE := make(map[dvid.IZYXString]Elements)
+		for _, elem := range elems {
+			izyxStr := elem.Pos.ToBlockIZYXString(blockSize)
+			blockE[izyxStr] = append(blockE[izyxStr], elem)
+		}
+		izyxStrs := make([]string, 0, len(blockE))
+		for izyxStr := range blockE {
+			izyxStrs = append(izyxStrs, string(izyxStr))
+		}
+		sort.Strings(izyxStrs)
+		for _, izyxStr := range izyxStrs {
+			bcoord, err := dvid.IZYXString(izyxStr).ToChunkPoint3d()
+			if err != nil {
+				return err
+			}
+			if err := writeElements(bcoord, blockE[dvid.IZYXString(izyxStr)]); err != nil {
+				return err
+			}
+		}
+	} else {
+		err = store.ProcessRange(ctx, minTKey, maxTKey, nil, func(chunk *storage.Chunk) error {
+			bcoord, err := DecodeBlockTKey(chunk.K)
+			if err != nil {
+				return err
+			}
+			if len(chunk.V) == 0 {
+				return nil
+			}
+			if filter == nil {
+				return writeBlock(bcoord, chunk.V)
+			}
+			var elems Elements
+			if err := json.Unmarshal(chunk.V, &elems); err != nil {
+				return err
+			}
+			return writeElements(bcoord, elems)
+		})
+		if err != nil {
+			return err
+		}
 	}
 	if _, err := w.Write([]byte("}")); err != nil {
 		return err
@@ -2124,6 +2460,7 @@ func (d *Data) StoreBlocks(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bo
 	batch := batcher.NewBatch(ctx)
 
 	var blockX, blockY, blockZ int32
+	blockElems := make(map[dvid.ChunkPoint3d]int, len(blocks))
 	for key, elems := range blocks {
 		_, err := fmt.Sscanf(key, "%d,%d,%d", &blockX, &blockY, &blockZ)
 		if err != nil {
@@ -2134,6 +2471,10 @@ func (d *Data) StoreBlocks(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bo
 		if err := putBatchElements(batch, tk, elems); err != nil {
 			return 0, err
 		}
+		blockElems[blockCoord] = len(elems)
+	}
+	if err := d.extendBlockExtents(ctx, blockElems); err != nil {
+		return 0, err
 	}
 
 	if !kafkaOff {
@@ -2180,7 +2521,13 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 	// defer d.Unlock()
 
 	dvid.Infof("%d annotation elements received via POST\n", len(elems))
+	return d.storeElements(ctx, elems, jsonBytes, kafkaOff)
+}
 
+// storeElements stores elements, replacing any at the same positions, and updates the
+// label and tag denormalizations.  The JSON of the elements is logged to kafka unless
+// kafkaOff is true.
+func (d *Data) storeElements(ctx *datastore.VersionedCtx, elems Elements, jsonBytes []byte, kafkaOff bool) error {
 	blockSize := d.blockSize()
 	addToBlock := make(map[dvid.IZYXString]Elements)
 	tagDelta := make(map[Tag]tagDeltaT)
@@ -2207,7 +2554,7 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 		if err != nil {
 			return err
 		}
-		addTagDelta(elems, curBlockE, tagDelta)
+		d.addTagDelta(elems, curBlockE, tagDelta)
 	}
 
 	// Do modifications under a batch.
@@ -2306,7 +2653,7 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 	}
 
 	// Delete element in any tags
-	if err := d.deleteElementInTags(ctx, batch, deleted.Pos, deleted.Tags); err != nil {
+	if err := d.deleteElementInTags(ctx, batch, deleted.Pos, d.indexTags(deleted.ElementNR)); err != nil {
 		return err
 	}
 
@@ -2388,6 +2735,9 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 		if err := putBatchElements(batch, toTk, toElems); err != nil {
 			return err
 		}
+		if err := d.extendBlockExtents(ctx, map[dvid.ChunkPoint3d]int{toCoord: len(toElems)}); err != nil {
+			return err
+		}
 	}
 
 	if err := batch.Commit(); err != nil {
@@ -2422,7 +2772,7 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 	}
 
 	// Move element in any tags
-	if err := d.moveElementInTags(ctx, batch, from, to, moved.Tags); err != nil {
+	if err := d.moveElementInTags(ctx, batch, from, to, d.indexTags(moved.ElementNR)); err != nil {
 		return err
 	}
 
@@ -2489,6 +2839,12 @@ func (d *Data) deleteDenormalizations(ctx *datastore.VersionedCtx) error {
 		return fmt.Errorf("unable to delete tag denormalization for annotations %q: %v", d.DataName(), err)
 	}
 	timedLog.Infof("Finished deletion of tag kv denormalizations for annotation %q", d.DataName())
+
+	minPropTKey := storage.MinTKey(keyPropIndex)
+	maxPropTKey := storage.MaxTKey(keyPropIndex)
+	if err := store.DeleteRange(ctx, minPropTKey, maxPropTKey); err != nil {
+		return fmt.Errorf("unable to delete property indices for annotations %q: %v", d.DataName(), err)
+	}
 	return nil
 }
 
@@ -2568,8 +2924,8 @@ func (d *Data) resyncInMemory(ctx *datastore.VersionedCtx, check bool) {
 				totElemErrs++
 			}
 			// Add to Tag elements
-			if len(elem.Tags) > 0 {
-				for _, tag := range elem.Tags {
+			if tags := d.indexTags(elem.ElementNR); len(tags) > 0 {
+				for _, tag := range tags {
 					te := tagE[tag]
 					te = append(te, elem.ElementNR)
 					totTagE++
@@ -2638,7 +2994,7 @@ func (d *Data) resyncInMemory(ctx *datastore.VersionedCtx, check bool) {
 		ch <- denormElems{tk: NewLabelTKey(label), elems: elems}
 	}
 	for tag, elems := range tagE {
-		tk, err := NewTagTKey(tag)
+		tk, err := indexTKey(tag)
 		if err != nil {
 			dvid.Errorf("problem with tag key tkey for tag %q: %v\n", tag, err)
 			atomic.AddInt64(&numErrs, 1)
@@ -2722,8 +3078,8 @@ func (d *Data) resyncLowMemory(ctx *datastore.VersionedCtx) {
 				deleteElems[i] = struct{}{}
 			}
 			// Append to tags if present
-			if len(elem.Tags) > 0 {
-				for _, tag := range elem.Tags {
+			if tags := d.indexTags(elem.ElementNR); len(tags) > 0 {
+				for _, tag := range tags {
 					te := tagE[tag]
 					te = append(te, elem)
 					numTagE++
@@ -2884,6 +3240,25 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 		reply.Text = fmt.Sprintf("Asynchronously checking and restoring label and tag denormalizations for annotation %q\n", d.DataName())
 		return nil
 
+	case "export-precomputed":
+		if len(req.Command) < 5 {
+			return fmt.Errorf("poorly formatted export-precomputed command.  See command-line help")
+		}
+		var uuidStr, dataName, cmdStr, dir string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &dir)
+
+		_, v, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := d.ExportPrecomputed(v, dir); err != nil {
+				dvid.Errorf("Cannot export annotation %q @ node %s to precomputed %q: %v\n", dataName, uuidStr, dir, err)
+			}
+		}()
+		reply.Text = fmt.Sprintf("Asynchronously exporting annotation %q, uuid %s to precomputed directory %q (errors will be printed in server log) ...\n", d.DataName(), uuidStr, dir)
+		return nil
+
 	default:
 		return fmt.Errorf("unknown command.  Data type %q [%s] does not support %q command",
 			d.DataName(), d.TypeName(), req.TypeCommand())
@@ -3005,7 +3380,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 		queryStrings := r.URL.Query()
-		jsonBytes, err := d.GetLabelJSON(ctx, label, queryStrings.Get("relationships") == "true")
+		filter, err := elementFilterFromQuery(queryStrings)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := d.GetLabelJSON(ctx, label, queryStrings.Get("relationships") == "true", filter)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -3028,7 +3408,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		tag := Tag(parts[4])
 		queryStrings := r.URL.Query()
-		jsonBytes, err := d.GetTagJSON(ctx, tag, queryStrings.Get("relationships") == "true")
+		filter, err := elementFilterFromQuery(queryStrings)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := d.GetTagJSON(ctx, tag, queryStrings.Get("relationships") == "true", filter)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -3040,6 +3425,120 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: get synaptic elements for tag %s (%s)", r.Method, tag, r.URL)
 
+	case "precomputed":
+		// GET <api URL>/node/<UUID>/<data name>/precomputed/info
+		// GET <api URL>/node/<UUID>/<data name>/precomputed/spatial0/<x>_<y>_<z>
+		// GET <api URL>/node/<UUID>/<data name>/precomputed/by_id/<id>
+		// GET <api URL>/node/<UUID>/<data name>/precomputed/relationships/<relationship>/<label>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'precomputed' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Must include precomputed info, spatial0, by_id or relationships after 'precomputed' endpoint.")
+			return
+		}
+		var data []byte
+		var err error
+		switch parts[4] {
+		case "info":
+			var info *precomputedInfo
+			if info, err = d.getPrecomputedInfo(ctx); err == nil {
+				w.Header().Set("Content-type", "application/json")
+				data, err = json.Marshal(info)
+			}
+		case precomputedSpatialKey:
+			if len(parts) < 6 {
+				server.BadRequest(w, r, "Must include chunk coordinate after %q", parts[4])
+				return
+			}
+			var cell dvid.Point3d
+			if cell, err = dvid.StringToPoint3d(parts[5], "_"); err == nil {
+				w.Header().Set("Content-type", "application/octet-stream")
+				data, err = d.getPrecomputedSpatial(ctx, dvid.ChunkPoint3d(cell))
+			}
+		case precomputedByIDKey:
+			if len(parts) < 6 {
+				server.BadRequest(w, r, "Must include annotation ID after %q", parts[4])
+				return
+			}
+			var id uint64
+			if id, err = strconv.ParseUint(parts[5], 10, 64); err == nil {
+				if data, err = d.getPrecomputedByID(ctx, id); err == nil && data == nil {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-type", "application/octet-stream")
+			}
+		case precomputedRelsKey:
+			if len(parts) < 7 {
+				server.BadRequest(w, r, "Must include relationship and label after %q", parts[4])
+				return
+			}
+			var label uint64
+			if label, err = strconv.ParseUint(parts[6], 10, 64); err == nil {
+				w.Header().Set("Content-type", "application/octet-stream")
+				data, err = d.getPrecomputedRelationship(ctx, parts[5], label)
+			}
+		default:
+			err = fmt.Errorf("unknown precomputed annotation key %q", parts[4])
+		}
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(data); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: precomputed %s (%s)", r.Method, strings.Join(parts[4:], "/"), r.URL)
+
+	case "connectivity":
+		// POST <api URL>/node/<UUID>/<data name>/connectivity
+		if action != "post" {
+			server.BadRequest(w, r, "Only POST action is available on 'connectivity' endpoint.")
+			return
+		}
+		var spec struct {
+			Bodies []uint64 `json:"bodies"`
+			ROI    string   `json:"roi"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			server.BadRequest(w, r, "bad JSON for connectivity request: %v", err)
+			return
+		}
+		q := ConnectivityQuery{
+			Bodies:   spec.Bodies,
+			Synapses: r.URL.Query().Get("synapses") == "true",
+		}
+		if len(spec.Bodies) == 0 && spec.ROI != "" {
+			switch len(strings.Split(spec.ROI, ",")) {
+			case 1:
+				q.ROI = storage.FilterSpec("roi:" + spec.ROI + "," + string(uuid))
+			case 2:
+				q.ROI = storage.FilterSpec("roi:" + spec.ROI)
+			default:
+				server.BadRequest(w, r, "Bad ROI specification: %q", spec.ROI)
+				return
+			}
+		}
+		conns, err := d.GetConnectivity(ctx, q)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(conns)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d connections for %d bodies, roi %q (%s)", r.Method, len(conns), len(spec.Bodies), spec.ROI, r.URL)
+
 	case "roi":
 		switch action {
 		case "get":
@@ -3060,11 +3559,17 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, "Bad ROI specification: %q", parts[4])
 				return
 			}
+			filter, err := elementFilterFromQuery(r.URL.Query())
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
 			elems, err := d.GetROISynapses(ctx, storage.FilterSpec(roiSpec))
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			elems = filter.FilterElements(elems)
 			w.Header().Set("Content-type", "application/json")
 			jsonBytes, err := json.Marshal(elems)
 			if err != nil {
@@ -3082,6 +3587,64 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 
+	case "import":
+		// POST <api URL>/node/<UUID>/<data name>/import?format=csv|ndjson
+		if action != "post" {
+			server.BadRequest(w, r, "Only POST action is available on 'import' endpoint.")
+			return
+		}
+		queryStrings := r.URL.Query()
+		kafkaOff := queryStrings.Get("kafkalog") == "off"
+		var numElems int
+		var err error
+		switch format := queryStrings.Get("format"); format {
+		case "csv":
+			var mapping CSVMapping
+			if mapping, err = csvMappingFromQuery(queryStrings); err == nil {
+				numElems, err = d.ImportCSV(ctx, r.Body, mapping, kafkaOff)
+			}
+		case "ndjson":
+			numElems, err = d.ImportNDJSON(ctx, r.Body, kafkaOff)
+		default:
+			err = fmt.Errorf("import format must be csv or ndjson, got %q", format)
+		}
+		if err != nil {
+			server.BadRequest(w, r, "import stopped after %d elements: %v", numElems, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: imported %d elements (%s)", r.Method, numElems, r.URL)
+
+	case "export":
+		// GET <api URL>/node/<UUID>/<data name>/export?format=csv|ndjson
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'export' endpoint.")
+			return
+		}
+		queryStrings := r.URL.Query()
+		format := queryStrings.Get("format")
+		if format == "" {
+			format = "ndjson"
+		}
+		var props []string
+		if propsStr := queryStrings.Get("props"); propsStr != "" {
+			props = strings.Split(propsStr, ",")
+		}
+		switch format {
+		case "csv":
+			w.Header().Set("Content-type", "text/csv")
+		case "ndjson":
+			w.Header().Set("Content-type", "application/x-ndjson")
+		default:
+			server.BadRequest(w, r, "export format must be csv or ndjson, got %q", format)
+			return
+		}
+		numElems, err := d.StreamExport(ctx, w, format, props)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: exported %d elements as %s (%s)", r.Method, numElems, format, r.URL)
+
 	case "all-elements":
 		switch action {
 		case "get":
@@ -3090,8 +3653,13 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, "Do not expect additional parameters after 'all-elements' in GET request")
 				return
 			}
+			filter, err := elementFilterFromQuery(r.URL.Query())
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
 			w.Header().Set("Content-type", "application/json")
-			if err := d.StreamAll(ctx, w); err != nil {
+			if err := d.StreamAll(ctx, w, filter); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
@@ -3152,11 +3720,17 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
+			filter, err := elementFilterFromQuery(r.URL.Query())
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
 			elems, err := d.GetRegionSynapses(ctx, ext3d)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			elems = filter.FilterElements(elems)
 			w.Header().Set("Content-type", "application/json")
 			jsonBytes, err := json.Marshal(elems)
 			if err != nil {
@@ -3180,6 +3754,77 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 
+	case "nearest", "within":
+		// GET <api URL>/node/<UUID>/<data name>/nearest/<coord>
+		// GET <api URL>/node/<UUID>/<data name>/within/<coord>/<radius>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on %q endpoint.", parts[3])
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Must include coordinate after %q endpoint.", parts[3])
+			return
+		}
+		pt, err := dvid.StringToPoint3d(parts[4], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		queryStrings := r.URL.Query()
+		q := NearQuery{
+			Center:        pt,
+			MaxDist:       -1,
+			Relationships: queryStrings.Get("relationships") == "true",
+		}
+		if parts[3] == "nearest" {
+			q.K = 1
+			if kStr := queryStrings.Get("k"); kStr != "" {
+				if q.K, err = strconv.Atoi(kStr); err != nil || q.K <= 0 {
+					server.BadRequest(w, r, "bad k %q for nearest elements query", kStr)
+					return
+				}
+			}
+			if distStr := queryStrings.Get("maxdist"); distStr != "" {
+				if q.MaxDist, err = strconv.ParseFloat(distStr, 64); err != nil || q.MaxDist < 0 {
+					server.BadRequest(w, r, "bad maxdist %q for nearest elements query", distStr)
+					return
+				}
+			}
+		} else {
+			if len(parts) < 6 {
+				server.BadRequest(w, r, "Must include radius after coordinate in 'within' endpoint.")
+				return
+			}
+			if q.MaxDist, err = strconv.ParseFloat(parts[5], 64); err != nil || q.MaxDist < 0 {
+				server.BadRequest(w, r, "bad radius %q for within query", parts[5])
+				return
+			}
+		}
+		if kindStr := queryStrings.Get("kind"); kindStr != "" {
+			q.Kind = StringToElementType(kindStr)
+			if q.Kind == UnknownElem && kindStr != "Unknown" {
+				server.BadRequest(w, r, "unknown element kind %q", kindStr)
+				return
+			}
+			q.Filtered = true
+		}
+		elems, err := d.GetNearElements(ctx, q)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(elems)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d synaptic elements %s %s (%s)", r.Method, len(elems), parts[3], pt, r.URL)
+
 	case "element":
 		// DELETE <api URL>/node/<UUID>/<data name>/element/<coord>
 		if action != "delete" {
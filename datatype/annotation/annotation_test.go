@@ -5,7 +5,11 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
@@ -13,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/labelmap"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 )
@@ -921,6 +926,303 @@ func TestPostBlocksAndAll(t *testing.T) {
 	}
 }
 
+func testNearResponse(t *testing.T, expected []dvid.Point3d, withRels bool, format string, args ...interface{}) {
+	url := fmt.Sprintf(format, args...)
+	returnValue := server.TestHTTP(t, "GET", url, nil)
+	var got NearElements
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatalf("error unmarshaling response from %s: %v\n", url, err)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d elements from %s, got %d: %v\n", len(expected), url, len(got), got)
+	}
+	for i, pt := range expected {
+		if !got[i].Pos.Equals(pt) {
+			t.Fatalf("expected element %d from %s to be at %s, got %v\n", i, url, pt, got[i])
+		}
+		if i > 0 && got[i].Distance < got[i-1].Distance {
+			t.Fatalf("elements from %s not sorted by distance: %v\n", url, got)
+		}
+		if withRels != (len(got[i].Rels) != 0) {
+			t.Fatalf("bad relationships for element %d from %s: %v\n", i, url, got[i])
+		}
+	}
+}
+
+func TestNearElements(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+
+	config := dvid.NewConfig()
+	config.Set("BlockSize", "64,64,64")
+	dataservice, err := datastore.NewData(uuid, syntype, "mysynapses", config)
+	if err != nil {
+		t.Fatalf("Error creating new data instance: %v\n", err)
+	}
+	data, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Returned new data instance is not synapse.Data\n")
+	}
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url1 := fmt.Sprintf("%snode/%s/%s/elements", server.WebAPIPath, uuid, data.DataName())
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(testJSON)))
+
+	// default is the single nearest element.
+	testNearResponse(t, []dvid.Point3d{{120, 65, 100}}, false, "%snode/%s/%s/nearest/100_60_95", server.WebAPIPath, uuid, data.DataName())
+
+	testNearResponse(t, []dvid.Point3d{{120, 65, 100}, {88, 47, 80}, {126, 67, 98}}, true,
+		"%snode/%s/%s/nearest/100_60_95?k=3&relationships=true", server.WebAPIPath, uuid, data.DataName())
+
+	// nearest element across blocks and filtered by kind.
+	testNearResponse(t, []dvid.Point3d{{127, 63, 99}, {15, 27, 35}}, false,
+		"%snode/%s/%s/nearest/100_60_95?k=5&kind=PreSyn", server.WebAPIPath, uuid, data.DataName())
+	testNearResponse(t, []dvid.Point3d{{15, 27, 35}}, false,
+		"%snode/%s/%s/nearest/0_0_0?kind=PreSyn", server.WebAPIPath, uuid, data.DataName())
+
+	testNearResponse(t, []dvid.Point3d{{120, 65, 100}}, false,
+		"%snode/%s/%s/nearest/100_60_95?k=3&maxdist=22", server.WebAPIPath, uuid, data.DataName())
+	testNearResponse(t, []dvid.Point3d{}, false,
+		"%snode/%s/%s/nearest/500_500_500?maxdist=100", server.WebAPIPath, uuid, data.DataName())
+
+	testNearResponse(t, []dvid.Point3d{{120, 65, 100}, {88, 47, 80}}, false,
+		"%snode/%s/%s/within/100_60_95/25", server.WebAPIPath, uuid, data.DataName())
+	testNearResponse(t, []dvid.Point3d{{127, 63, 99}}, false,
+		"%snode/%s/%s/within/100_60_95/30?kind=PreSyn", server.WebAPIPath, uuid, data.DataName())
+
+	// search stops at the shell limit and drops elements that might not be nearest.
+	testNearResponse(t, []dvid.Point3d{}, false,
+		"%snode/%s/%s/nearest/1920_60_95", server.WebAPIPath, uuid, data.DataName())
+
+	// storing an element beyond the block extents expands them.
+	farJSON, err := json.Marshal(Elements{{ElementNR: ElementNR{Pos: dvid.Point3d{1900, 60, 95}, Kind: PostSyn}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(farJSON)))
+	testNearResponse(t, []dvid.Point3d{{1900, 60, 95}}, false,
+		"%snode/%s/%s/nearest/1920_60_95", server.WebAPIPath, uuid, data.DataName())
+	ext, err := data.getBlockExtents(datastore.NewVersionedCtx(data, v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ext.found || ext.MaxBlock[0] != 29 {
+		t.Fatalf("bad block extents after storing far element: %v\n", ext)
+	}
+
+	badURL := fmt.Sprintf("%snode/%s/%s/nearest/100_60_95?kind=Foo", server.WebAPIPath, uuid, data.DataName())
+	server.TestBadHTTP(t, "GET", badURL, nil)
+	badURL = fmt.Sprintf("%snode/%s/%s/within/100_60_95", server.WebAPIPath, uuid, data.DataName())
+	server.TestBadHTTP(t, "GET", badURL, nil)
+}
+
+func TestBulkImportExport(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestInstance(t, uuid, "annotation", "copied", config)
+
+	// import synaptic connections with one row per T-bar to PSD pair.
+	connCSV := `pre_x,pre_y,pre_z,post_x,post_y,post_z,confidence
+15,27,35,20,30,40,0.9
+15,27,35,14,25,37,0.8
+`
+	importURL := fmt.Sprintf("%snode/%s/mysynapses/import?format=csv&pos=pre_x,pre_y,pre_z&defaultkind=PreSyn&partner=post_x,post_y,post_z&partnerkind=PostSyn&props=confidence", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", importURL, strings.NewReader(connCSV))
+
+	// add a tag and another PSD to the T-bar via ndjson.
+	importURL = fmt.Sprintf("%snode/%s/mysynapses/import?format=ndjson", server.WebAPIPath, uuid)
+	ndjson := `{"Pos":[15,27,35],"Kind":"PreSyn","Tags":["Synapse1"],"Rels":[{"Rel":"PreSynTo","To":[33,30,31]}]}
+{"Pos":[33,30,31],"Kind":"PostSyn","Rels":[{"Rel":"PostSynTo","To":[15,27,35]}]}
+`
+	server.TestHTTP(t, "POST", importURL, strings.NewReader(ndjson))
+
+	expected := Elements{
+		{
+			ElementNR{
+				Pos:  dvid.Point3d{15, 27, 35},
+				Kind: PreSyn,
+				Tags: []Tag{"Synapse1"},
+				Prop: map[string]string{"confidence": "0.8"},
+			},
+			[]Relationship{{Rel: PreSynTo, To: dvid.Point3d{20, 30, 40}}, {Rel: PreSynTo, To: dvid.Point3d{14, 25, 37}}, {Rel: PreSynTo, To: dvid.Point3d{33, 30, 31}}},
+		},
+		{
+			ElementNR{Pos: dvid.Point3d{20, 30, 40}, Kind: PostSyn},
+			[]Relationship{{Rel: PostSynTo, To: dvid.Point3d{15, 27, 35}}},
+		},
+		{
+			ElementNR{Pos: dvid.Point3d{14, 25, 37}, Kind: PostSyn},
+			[]Relationship{{Rel: PostSynTo, To: dvid.Point3d{15, 27, 35}}},
+		},
+		{
+			ElementNR{Pos: dvid.Point3d{33, 30, 31}, Kind: PostSyn},
+			[]Relationship{{Rel: PostSynTo, To: dvid.Point3d{15, 27, 35}}},
+		},
+	}
+	testResponse(t, expected, "%snode/%s/mysynapses/elements/1000_1000_1000/0_0_0", server.WebAPIPath, uuid)
+	testResponse(t, getTag("Synapse1", expected), "%snode/%s/mysynapses/tag/Synapse1?relationships=true", server.WebAPIPath, uuid)
+
+	exportURL := fmt.Sprintf("%snode/%s/mysynapses/export", server.WebAPIPath, uuid)
+	lines := strings.Split(strings.TrimSpace(string(server.TestHTTP(t, "GET", exportURL, nil))), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d ndjson lines, got %d: %v\n", len(expected), len(lines), lines)
+	}
+	var exported Elements
+	for _, line := range lines {
+		var elem Element
+		if err := json.Unmarshal([]byte(line), &elem); err != nil {
+			t.Fatalf("bad ndjson line %q: %v\n", line, err)
+		}
+		exported = append(exported, elem)
+	}
+	if !reflect.DeepEqual(expected.Normalize(), exported.Normalize()) {
+		t.Fatalf("bad ndjson export:\nGot: %v\nExpected: %v\n", exported, expected)
+	}
+
+	// CSV export can be imported with default mapping.
+	exportCSV := server.TestHTTP(t, "GET", exportURL+"?format=csv&props=confidence", nil)
+	if !strings.HasPrefix(string(exportCSV), "x,y,z,kind,tags,rels,confidence\n") {
+		t.Fatalf("bad CSV export header: %s\n", exportCSV)
+	}
+	if !strings.Contains(string(exportCSV), "15,27,35,PreSyn,Synapse1,") || !strings.Contains(string(exportCSV), ",0.8\n") {
+		t.Fatalf("bad CSV export: %s\n", exportCSV)
+	}
+	importURL = fmt.Sprintf("%snode/%s/copied/import?format=csv&props=confidence", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", importURL, bytes.NewReader(exportCSV))
+	testResponse(t, expected, "%snode/%s/copied/elements/1000_1000_1000/0_0_0", server.WebAPIPath, uuid)
+
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/copied/import", server.WebAPIPath, uuid), strings.NewReader(connCSV))
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/copied/import?format=csv", server.WebAPIPath, uuid), strings.NewReader(connCSV))
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/copied/import?format=csv&defaultkind=Foo", server.WebAPIPath, uuid), bytes.NewReader(exportCSV))
+	server.TestBadHTTP(t, "GET", exportURL+"?format=xml", nil)
+}
+
+func testAllElements(t *testing.T, expected Elements, url string) {
+	var blocks map[string]Elements
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &blocks); err != nil {
+		t.Fatal(err)
+	}
+	got := Elements{}
+	for _, elems := range blocks {
+		if len(elems) == 0 {
+			t.Fatalf("got empty block for %s: %v\n", url, blocks)
+		}
+		got = append(got, elems...)
+	}
+	if expected == nil {
+		expected = Elements{}
+	}
+	if !reflect.DeepEqual(expected.Normalize(), got.Normalize()) {
+		_, fn, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected for %s [%s:%d]:\n%v\nGot:\n%v\n", url, fn, line, expected.Normalize(), got.Normalize())
+	}
+}
+
+func TestFilteredQueries(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("IndexedProps", "status")
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+
+	elemA := Element{
+		ElementNR{
+			Pos:  dvid.Point3d{15, 27, 35},
+			Kind: PreSyn,
+			Tags: []Tag{"Synapse1"},
+			Prop: map[string]string{"conf": "0.9", "user": "alice", "status": "done"},
+		},
+		[]Relationship{{Rel: PreSynTo, To: dvid.Point3d{20, 30, 40}}, {Rel: PreSynTo, To: dvid.Point3d{14, 25, 37}}},
+	}
+	elemB := Element{
+		ElementNR{
+			Pos:  dvid.Point3d{20, 30, 40},
+			Kind: PostSyn,
+			Tags: []Tag{"Synapse1"},
+			Prop: map[string]string{"conf": "0.5", "user": "auto", "status": "todo"},
+		},
+		[]Relationship{{Rel: PostSynTo, To: dvid.Point3d{15, 27, 35}}},
+	}
+	elemC := Element{
+		ElementNR{
+			Pos:  dvid.Point3d{14, 25, 37},
+			Kind: PostSyn,
+			Tags: []Tag{"Synapse1"},
+			Prop: map[string]string{"conf": "0.95", "user": "auto", "status": "done"},
+		},
+		[]Relationship{{Rel: PostSynTo, To: dvid.Point3d{15, 27, 35}}},
+	}
+	elemD := Element{
+		ElementNR{
+			Pos:  dvid.Point3d{127, 63, 99},
+			Kind: PreSyn,
+			Prop: map[string]string{"conf": "0.85", "user": "bob"},
+		},
+		[]Relationship{},
+	}
+	testJSON, err := json.Marshal(Elements{elemA, elemB, elemC, elemD})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elementsURL := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", elementsURL, bytes.NewBuffer(testJSON))
+
+	filterURL := func(endpoint, filter string) string {
+		return fmt.Sprintf("%snode/%s/mysynapses/%s?filter=%s", server.WebAPIPath, uuid, endpoint, url.QueryEscape(filter))
+	}
+	testResponse(t, Elements{elemA, elemD}, filterURL("elements/1000_1000_1000/0_0_0", "conf>0.8 AND user!=auto"))
+	testResponse(t, Elements{elemB, elemD}, filterURL("elements/1000_1000_1000/0_0_0", "conf<0.6 OR user=bob"))
+	testResponse(t, Elements{elemD}, filterURL("elements/1000_1000_1000/0_0_0", "status!=done AND status!=todo"))
+	testResponse(t, Elements{elemA, elemC}, filterURL("tag/Synapse1", "status=done")+"&relationships=true")
+	testResponse(t, Elements{}, filterURL("tag/Synapse1", "user=bob"))
+
+	// all-elements uses the status index for equality on status.
+	testAllElements(t, Elements{elemA, elemC}, filterURL("all-elements", "status=done"))
+	testAllElements(t, Elements{elemC}, filterURL("all-elements", "status=done AND conf>=0.95"))
+	testAllElements(t, Elements{elemD}, filterURL("all-elements", "user=bob"))
+
+	// changing a property should move the element between indexed values.
+	elemC.Prop["status"] = "todo"
+	testJSON, err = json.Marshal(Elements{elemC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestHTTP(t, "POST", elementsURL, bytes.NewBuffer(testJSON))
+	testAllElements(t, Elements{elemA}, filterURL("all-elements", "status=done"))
+	testAllElements(t, Elements{elemB, elemC}, filterURL("all-elements", "status=todo"))
+
+	// deleting an element should remove it from the index.
+	delURL := fmt.Sprintf("%snode/%s/mysynapses/element/15_27_35", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delURL, nil)
+	testAllElements(t, nil, filterURL("all-elements", "status=done"))
+
+	// a property indexed after elements are stored should not use its incomplete index.
+	configURL := fmt.Sprintf("%snode/%s/mysynapses", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "PUT", configURL, bytes.NewBufferString(`{"IndexedProps": "status,user"}`))
+	testAllElements(t, Elements{elemB, elemC}, filterURL("all-elements", "user=auto"))
+	testAllElements(t, Elements{elemB, elemC}, filterURL("all-elements", "status=todo"))
+
+	server.TestBadHTTP(t, "GET", filterURL("all-elements", "conf"), nil)
+	server.TestBadHTTP(t, "GET", filterURL("tag/Synapse1", "=done"), nil)
+}
+
 func TestPropChange(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -1771,6 +2073,290 @@ func TestMappedLabels(t *testing.T) {
 	testMappedLabels(t, uuid, "mylabelmap", "mylabelmap")
 }
 
+func testConnectivity(t *testing.T, expected Connections, reqJSON, url string) {
+	returnValue := server.TestHTTP(t, "POST", url, strings.NewReader(reqJSON))
+	var got Connections
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatalf("error unmarshaling connectivity response from %s: %v\n", url, err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		gotJSON, _ := json.Marshal(got)
+		expectedJSON, _ := json.Marshal(expected)
+		t.Fatalf("bad connectivity for %s from %s:\nGot: %s\nExpected: %s\n", reqJSON, url, gotJSON, expectedJSON)
+	}
+}
+
+func TestConnectivity(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(string(testJSON)))
+
+	// synapses onto background are not counted.
+	connURL := fmt.Sprintf("%snode/%s/mysynapses/connectivity", server.WebAPIPath, uuid)
+	expected := Connections{
+		{PreBody: 1, PostBody: 2, Weight: 1},
+		{PreBody: 1, PostBody: 3, Weight: 1},
+		{PreBody: 3, PostBody: 4, Weight: 1},
+	}
+	testConnectivity(t, expected, `{"bodies": [1, 2, 3, 4]}`, connURL)
+	testConnectivity(t, expected[:1], `{"bodies": [1, 2]}`, connURL)
+	testConnectivity(t, Connections{}, `{"bodies": [4]}`, connURL)
+
+	// ROI covers blocks with body 1 T-bar and two of its PSDs.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", config)
+	roiURL := fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", roiURL, strings.NewReader(`[[1, 0, 0, 1]]`))
+	testConnectivity(t, expected[:2], `{"roi": "myroi"}`, connURL)
+
+	server.TestBadHTTP(t, "POST", connURL, strings.NewReader(`{}`))
+	server.TestBadHTTP(t, "GET", connURL, nil)
+
+	// merge body 3 into 2 and make sure connections follow the current mapping.
+	testMerge := mergeJSON(`[2, 3]`)
+	testMerge.send(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mylabelmap"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of synapses: %v\n", err)
+	}
+	expected = Connections{
+		{
+			PreBody:  1,
+			PostBody: 2,
+			Weight:   2,
+			Synapses: []ConnectionSynapse{
+				{Pre: dvid.Point3d{15, 27, 35}, Post: dvid.Point3d{14, 25, 37}},
+				{Pre: dvid.Point3d{15, 27, 35}, Post: dvid.Point3d{20, 30, 40}},
+			},
+		},
+		{
+			PreBody:  2,
+			PostBody: 4,
+			Weight:   1,
+			Synapses: []ConnectionSynapse{
+				{Pre: dvid.Point3d{127, 63, 99}, Post: dvid.Point3d{88, 47, 80}},
+			},
+		},
+	}
+	testConnectivity(t, expected, `{"bodies": [1, 2, 4]}`, connURL+"?synapses=true")
+}
+
+// decodePrecomputedMultiple returns the positions, kinds and ids of encoded annotations.
+func decodePrecomputedMultiple(t *testing.T, data []byte) ([]dvid.Point3d, []ElementType, []uint64) {
+	if len(data) < 8 {
+		t.Fatalf("precomputed annotations too short: %d bytes\n", len(data))
+	}
+	n := int(binary.LittleEndian.Uint64(data[0:8]))
+	if len(data) != 8+n*24 {
+		t.Fatalf("expected %d bytes for %d precomputed annotations, got %d\n", 8+n*24, n, len(data))
+	}
+	pts := make([]dvid.Point3d, n)
+	kinds := make([]ElementType, n)
+	ids := make([]uint64, n)
+	var floats [3]float32
+	for i := 0; i < n; i++ {
+		rec := data[8+i*16 : 8+(i+1)*16]
+		if err := binary.Read(bytes.NewReader(rec[:12]), binary.LittleEndian, &floats); err != nil {
+			t.Fatal(err)
+		}
+		pts[i] = dvid.Point3d{int32(floats[0]), int32(floats[1]), int32(floats[2])}
+		kinds[i] = ElementType(rec[12])
+		ids[i] = binary.LittleEndian.Uint64(data[8+n*16+i*8:])
+	}
+	return pts, kinds, ids
+}
+
+func TestPrecomputed(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(string(testJSON)))
+
+	baseURL := fmt.Sprintf("%snode/%s/mysynapses/precomputed", server.WebAPIPath, uuid)
+	var info precomputedInfo
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", baseURL+"/info", nil), &info); err != nil {
+		t.Fatalf("couldn't decode precomputed info: %v\n", err)
+	}
+	if info.AnnotationType != "point" || len(info.Relationships) != 2 || len(info.Spatial) != 1 {
+		t.Fatalf("bad precomputed info: %v\n", info)
+	}
+	if info.Spatial[0].GridShape != [3]int32{4, 3, 4} || info.UpperBound != [3]int32{128, 96, 128} {
+		t.Fatalf("bad precomputed spatial index: %v\n", info)
+	}
+	if info.Spatial[0].Limit != 3 {
+		t.Fatalf("expected limit 3 for precomputed spatial index, got %d\n", info.Spatial[0].Limit)
+	}
+
+	pts, kinds, ids := decodePrecomputedMultiple(t, server.TestHTTP(t, "GET", baseURL+"/spatial0/0_0_1", nil))
+	expected := []dvid.Point3d{{15, 27, 35}, {20, 30, 40}, {14, 25, 37}}
+	if len(pts) != len(expected) {
+		t.Fatalf("expected %d annotations in spatial chunk, got %v\n", len(expected), pts)
+	}
+	for _, pt := range expected {
+		var found bool
+		for i := range pts {
+			if pts[i].Equals(pt) {
+				found = true
+				id, err := precomputedID(pt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ids[i] != id {
+					t.Fatalf("bad precomputed id for %s: %d\n", pt, ids[i])
+				}
+				if pt.Equals(dvid.Point3d{15, 27, 35}) && kinds[i] != PreSyn {
+					t.Fatalf("expected PreSyn kind for %s, got %s\n", pt, kinds[i])
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("expected %s in spatial chunk, got %v\n", pt, pts)
+		}
+	}
+	pts, _, _ = decodePrecomputedMultiple(t, server.TestHTTP(t, "GET", baseURL+"/spatial0/0_2_0", nil))
+	if len(pts) != 0 {
+		t.Fatalf("expected empty spatial chunk, got %v\n", pts)
+	}
+
+	// single annotation has its body and partner bodies, where 33_30_31 is background.
+	id, err := precomputedID(dvid.Point3d{15, 27, 35})
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := server.TestHTTP(t, "GET", fmt.Sprintf("%s/by_id/%d", baseURL, id), nil)
+	var expectedSingle bytes.Buffer
+	binary.Write(&expectedSingle, binary.LittleEndian, []float32{15, 27, 35})
+	expectedSingle.Write([]byte{byte(PreSyn), 0, 0, 0})
+	binary.Write(&expectedSingle, binary.LittleEndian, uint32(1))
+	binary.Write(&expectedSingle, binary.LittleEndian, uint64(1))
+	binary.Write(&expectedSingle, binary.LittleEndian, uint32(2))
+	binary.Write(&expectedSingle, binary.LittleEndian, []uint64{2, 3})
+	if !bytes.Equal(single, expectedSingle.Bytes()) {
+		t.Fatalf("bad precomputed annotation by id:\nGot: %v\nExpected: %v\n", single, expectedSingle.Bytes())
+	}
+	missingID, _ := precomputedID(dvid.Point3d{1, 2, 3})
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%s/by_id/%d", baseURL, missingID), nil)
+
+	pts, _, _ = decodePrecomputedMultiple(t, server.TestHTTP(t, "GET", baseURL+"/relationships/body/3", nil))
+	if len(pts) != 2 {
+		t.Fatalf("expected 2 annotations in body 3, got %v\n", pts)
+	}
+	pts, _, _ = decodePrecomputedMultiple(t, server.TestHTTP(t, "GET", baseURL+"/relationships/partner/1", nil))
+	if len(pts) != 3 {
+		t.Fatalf("expected 3 partner annotations of body 1, got %v\n", pts)
+	}
+	server.TestBadHTTP(t, "GET", baseURL+"/relationships/foo/1", nil)
+
+	// export should match what's served.
+	dataservice, err := datastore.GetDataByUUIDName(uuid, "mysynapses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := dataservice.(*Data)
+	dir, err := ioutil.TempDir("", "precomputed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := data.ExportPrecomputed(v, dir); err != nil {
+		t.Fatalf("error exporting precomputed annotations: %v\n", err)
+	}
+	for _, key := range []string{"info", "spatial0/0_0_1", fmt.Sprintf("by_id/%d", id), "relationships/body/3", "relationships/partner/1"} {
+		exported, err := ioutil.ReadFile(filepath.Join(dir, key))
+		if err != nil {
+			t.Fatalf("couldn't read exported precomputed %q: %v\n", key, err)
+		}
+		if served := server.TestHTTP(t, "GET", baseURL+"/"+key, nil); !bytes.Equal(exported, served) {
+			t.Fatalf("exported precomputed %q differs from served:\nExported: %v\nServed: %v\n", key, exported, served)
+		}
+	}
+}
+
+func TestRenumberedLabels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	// Create testbed volume and data instances
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url1 := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(testJSON)))
+
+	// Renumber bodies 1-4 to labels just above the max label.
+	dataservice, err := datastore.GetDataByUUIDName(uuid, "mylabelmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lmdata, ok := dataservice.(*labelmap.Data)
+	if !ok {
+		t.Fatalf("Can't convert dataservice %v into labelmap.Data\n", dataservice)
+	}
+	mapping, err := lmdata.RenumberBodies(v, 0, false, nil)
+	if err != nil {
+		t.Fatalf("error renumbering bodies: %v\n", err)
+	}
+	if len(mapping) != 4 || mapping[1] <= 4 {
+		t.Fatalf("expected bodies 1-4 renumbered above max label, got %v\n", mapping)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of synapses: %v\n", err)
+	}
+
+	testResponseLabel(t, nil, "%snode/%s/mysynapses/label/1?relationships=true", server.WebAPIPath, uuid)
+	testResponseLabel(t, expectedLabel1, "%snode/%s/mysynapses/label/%d?relationships=true", server.WebAPIPath, uuid, mapping[1])
+	testResponseLabel(t, expectedLabel2, "%snode/%s/mysynapses/label/%d?relationships=true", server.WebAPIPath, uuid, mapping[2])
+	testResponseLabel(t, expectedLabel3, "%snode/%s/mysynapses/label/%d?relationships=true", server.WebAPIPath, uuid, mapping[3])
+	testResponseLabel(t, expectedLabel4, "%snode/%s/mysynapses/label/%d?relationships=true", server.WebAPIPath, uuid, mapping[4])
+}
+
 func TestSupervoxelSplit(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -0,0 +1,470 @@
+/*
+	This file supports streaming bulk import and export of elements as CSV or newline-delimited
+	JSON.  Imports are stored in batches and elements at the same position, whether within
+	the import or already stored, are merged so one row per relationship can be imported.
+*/
+
+package annotation
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// importBatchSize is the number of imported elements held in memory before storing.
+const importBatchSize = 100000
+
+// CSVMapping gives the CSV columns used for element fields on import.  Position columns
+// are required while other columns are optional.
+type CSVMapping struct {
+	Pos         [3]string   // x, y, z column names
+	Kind        string      // column with element kind
+	DefaultKind ElementType // kind for rows without a kind column or value
+	Tags        string      // column with tags separated by semicolons
+	Rels        string      // column with relationships as "<rel>:<x>_<y>_<z>" separated by semicolons
+	Props       []string    // columns stored as properties under the column name
+
+	// Partner x, y, z column names for a relationship from each row's element.  If
+	// PartnerKind is set, a partner element with the reciprocal relationship is also added.
+	Partner     [3]string
+	PartnerRel  RelationType
+	PartnerKind ElementType
+}
+
+// DefaultCSVMapping returns the mapping for CSV written by export.
+func DefaultCSVMapping() CSVMapping {
+	return CSVMapping{
+		Pos:  [3]string{"x", "y", "z"},
+		Kind: "kind",
+		Tags: "tags",
+		Rels: "rels",
+	}
+}
+
+// csvMappingFromQuery returns the default CSV mapping modified by query string options.
+func csvMappingFromQuery(query url.Values) (CSVMapping, error) {
+	mapping := DefaultCSVMapping()
+	var err error
+	if posStr := query.Get("pos"); posStr != "" {
+		cols := strings.Split(posStr, ",")
+		if len(cols) != 3 {
+			return mapping, fmt.Errorf("pos option %q must give 3 column names", posStr)
+		}
+		copy(mapping.Pos[:], cols)
+	}
+	if partnerStr := query.Get("partner"); partnerStr != "" {
+		cols := strings.Split(partnerStr, ",")
+		if len(cols) != 3 {
+			return mapping, fmt.Errorf("partner option %q must give 3 column names", partnerStr)
+		}
+		copy(mapping.Partner[:], cols)
+	}
+	if col := query.Get("kind"); col != "" {
+		mapping.Kind = col
+	}
+	if col := query.Get("tags"); col != "" {
+		mapping.Tags = col
+	}
+	if col := query.Get("rels"); col != "" {
+		mapping.Rels = col
+	}
+	if propsStr := query.Get("props"); propsStr != "" {
+		mapping.Props = strings.Split(propsStr, ",")
+	}
+	if kindStr := query.Get("defaultkind"); kindStr != "" {
+		if mapping.DefaultKind, err = parseKind(kindStr); err != nil {
+			return mapping, err
+		}
+	}
+	if kindStr := query.Get("partnerkind"); kindStr != "" {
+		if mapping.PartnerKind, err = parseKind(kindStr); err != nil {
+			return mapping, err
+		}
+	}
+	if relStr := query.Get("partnerrel"); relStr != "" {
+		if mapping.PartnerRel, err = StringToRelationType(relStr); err != nil {
+			return mapping, err
+		}
+	}
+	return mapping, nil
+}
+
+// kindName returns the name of an element kind as used in JSON.
+func kindName(kind ElementType) string {
+	if kind == UnknownElem {
+		return "Unknown"
+	}
+	return kind.String()
+}
+
+// parseKind returns the element kind for a name, accepting "Unknown" for UnknownElem.
+func parseKind(s string) (ElementType, error) {
+	kind := StringToElementType(s)
+	if kind == UnknownElem && s != "Unknown" {
+		return UnknownElem, fmt.Errorf("unknown element kind %q", s)
+	}
+	return kind, nil
+}
+
+// defaultRelation returns the relationship from an element of the given kind to its partner.
+func defaultRelation(kind ElementType) RelationType {
+	switch kind {
+	case PreSyn:
+		return PreSynTo
+	case PostSyn:
+		return PostSynTo
+	default:
+		return GroupedWith
+	}
+}
+
+// mergeElement adds the tags, properties and relationships of elem into cur, using elem's
+// kind if known.
+func mergeElement(cur *Element, elem Element) {
+	if elem.Kind != UnknownElem {
+		cur.Kind = elem.Kind
+	}
+	for _, tag := range elem.Tags {
+		var found bool
+		for _, curTag := range cur.Tags {
+			if curTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cur.Tags = append(cur.Tags, tag)
+		}
+	}
+	if len(elem.Prop) != 0 && cur.Prop == nil {
+		cur.Prop = make(map[string]string, len(elem.Prop))
+	}
+	for key, value := range elem.Prop {
+		cur.Prop[key] = value
+	}
+	for _, rel := range elem.Rels {
+		var found bool
+		for _, curRel := range cur.Rels {
+			if curRel.Rel == rel.Rel && curRel.To.Equals(rel.To) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cur.Rels = append(cur.Rels, rel)
+		}
+	}
+}
+
+// importBatch accumulates imported elements, merging those at the same position.
+type importBatch struct {
+	elems map[dvid.Point3d]*Element
+	total int
+}
+
+func (b *importBatch) add(elem Element) {
+	if cur, found := b.elems[elem.Pos]; found {
+		mergeElement(cur, elem)
+		return
+	}
+	b.elems[elem.Pos] = elem.Copy()
+}
+
+// flushImport merges the batch with stored elements and stores them.
+func (d *Data) flushImport(ctx *datastore.VersionedCtx, b *importBatch, kafkaOff bool) error {
+	if len(b.elems) == 0 {
+		return nil
+	}
+	blockSize := d.blockSize()
+	blockElems := make(map[dvid.IZYXString]Elements)
+	for _, elem := range b.elems {
+		izyx := elem.Pos.ToBlockIZYXString(blockSize)
+		blockElems[izyx] = append(blockElems[izyx], *elem)
+	}
+	elems := make(Elements, 0, len(b.elems))
+	for izyx, newElems := range blockElems {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return err
+		}
+		curElems, err := getElements(ctx, NewBlockTKey(bcoord))
+		if err != nil {
+			return err
+		}
+		curByPos := make(map[dvid.Point3d]Element, len(curElems))
+		for _, elem := range curElems {
+			curByPos[elem.Pos] = elem
+		}
+		for _, elem := range newElems {
+			if cur, found := curByPos[elem.Pos]; found {
+				merged := cur.Copy()
+				mergeElement(merged, elem)
+				elem = *merged
+			}
+			elems = append(elems, elem)
+		}
+	}
+	var jsonBytes []byte
+	if !kafkaOff {
+		var err error
+		if jsonBytes, err = json.Marshal(elems); err != nil {
+			return err
+		}
+	}
+	if err := d.storeElements(ctx, elems, jsonBytes, kafkaOff); err != nil {
+		return err
+	}
+	b.total += len(b.elems)
+	b.elems = make(map[dvid.Point3d]*Element, importBatchSize)
+	return nil
+}
+
+// ImportCSV streams elements from CSV with a header row, storing them in batches, and
+// returns the number of elements stored.  Each row gives an element, and rows with the same
+// position are merged.
+func (d *Data) ImportCSV(ctx *datastore.VersionedCtx, r io.Reader, mapping CSVMapping, kafkaOff bool) (int, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read CSV header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	column := func(name string, required bool) (int, error) {
+		if i, found := columns[name]; found {
+			return i, nil
+		}
+		if required {
+			return -1, fmt.Errorf("CSV header has no %q column", name)
+		}
+		return -1, nil
+	}
+	var posCols, partnerCols [3]int
+	for dim := 0; dim < 3; dim++ {
+		if posCols[dim], err = column(mapping.Pos[dim], true); err != nil {
+			return 0, err
+		}
+		partnerCols[dim] = -1
+		if mapping.Partner[dim] != "" {
+			if partnerCols[dim], err = column(mapping.Partner[dim], true); err != nil {
+				return 0, err
+			}
+		}
+	}
+	kindCol, _ := column(mapping.Kind, false)
+	tagsCol, _ := column(mapping.Tags, false)
+	relsCol, _ := column(mapping.Rels, false)
+	propCols := make([]int, len(mapping.Props))
+	for i, name := range mapping.Props {
+		if propCols[i], err = column(name, true); err != nil {
+			return 0, err
+		}
+	}
+
+	batch := &importBatch{elems: make(map[dvid.Point3d]*Element, importBatchSize)}
+	parsePoint := func(record []string, cols [3]int) (pt dvid.Point3d, err error) {
+		for dim := 0; dim < 3; dim++ {
+			var coord int64
+			if coord, err = strconv.ParseInt(strings.TrimSpace(record[cols[dim]]), 10, 32); err != nil {
+				return
+			}
+			pt[dim] = int32(coord)
+		}
+		return
+	}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return batch.total, err
+		}
+		var elem Element
+		if elem.Pos, err = parsePoint(record, posCols); err != nil {
+			return batch.total, fmt.Errorf("bad position on CSV line %d: %v", line, err)
+		}
+		elem.Kind = mapping.DefaultKind
+		if kindCol >= 0 && record[kindCol] != "" {
+			if elem.Kind, err = parseKind(record[kindCol]); err != nil {
+				return batch.total, fmt.Errorf("CSV line %d: %v", line, err)
+			}
+		}
+		if tagsCol >= 0 && record[tagsCol] != "" {
+			for _, tag := range strings.Split(record[tagsCol], ";") {
+				elem.Tags = append(elem.Tags, Tag(tag))
+			}
+		}
+		for i, col := range propCols {
+			if record[col] == "" {
+				continue
+			}
+			if elem.Prop == nil {
+				elem.Prop = make(map[string]string, len(propCols))
+			}
+			elem.Prop[mapping.Props[i]] = record[col]
+		}
+		if relsCol >= 0 && record[relsCol] != "" {
+			for _, relStr := range strings.Split(record[relsCol], ";") {
+				relParts := strings.Split(relStr, ":")
+				if len(relParts) != 2 {
+					return batch.total, fmt.Errorf("bad relationship %q on CSV line %d", relStr, line)
+				}
+				var rel Relationship
+				if rel.Rel, err = StringToRelationType(relParts[0]); err != nil {
+					return batch.total, fmt.Errorf("CSV line %d: %v", line, err)
+				}
+				if rel.To, err = dvid.StringToPoint3d(relParts[1], "_"); err != nil {
+					return batch.total, fmt.Errorf("bad relationship %q on CSV line %d: %v", relStr, line, err)
+				}
+				elem.Rels = append(elem.Rels, rel)
+			}
+		}
+		if partnerCols[0] >= 0 {
+			partnerPos, err := parsePoint(record, partnerCols)
+			if err != nil {
+				return batch.total, fmt.Errorf("bad partner position on CSV line %d: %v", line, err)
+			}
+			rel := mapping.PartnerRel
+			if rel == UnknownRel {
+				rel = defaultRelation(elem.Kind)
+			}
+			elem.Rels = append(elem.Rels, Relationship{Rel: rel, To: partnerPos})
+			if mapping.PartnerKind != UnknownElem {
+				partner := Element{
+					ElementNR: ElementNR{Pos: partnerPos, Kind: mapping.PartnerKind},
+					Rels:      Relationships{{Rel: defaultRelation(mapping.PartnerKind), To: elem.Pos}},
+				}
+				batch.add(partner)
+			}
+		}
+		batch.add(elem)
+		if len(batch.elems) >= importBatchSize {
+			if err := d.flushImport(ctx, batch, kafkaOff); err != nil {
+				return batch.total, err
+			}
+		}
+	}
+	if err := d.flushImport(ctx, batch, kafkaOff); err != nil {
+		return batch.total, err
+	}
+	return batch.total, nil
+}
+
+// ImportNDJSON streams elements from newline-delimited JSON, one element per line, storing
+// them in batches and returning the number of elements stored.  Elements at the same position
+// are merged.
+func (d *Data) ImportNDJSON(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bool) (int, error) {
+	decoder := json.NewDecoder(r)
+	batch := &importBatch{elems: make(map[dvid.Point3d]*Element, importBatchSize)}
+	for {
+		var elem Element
+		if err := decoder.Decode(&elem); err == io.EOF {
+			break
+		} else if err != nil {
+			return batch.total, fmt.Errorf("bad element JSON after %d elements: %v", batch.total+len(batch.elems), err)
+		}
+		batch.add(elem)
+		if len(batch.elems) >= importBatchSize {
+			if err := d.flushImport(ctx, batch, kafkaOff); err != nil {
+				return batch.total, err
+			}
+		}
+	}
+	if err := d.flushImport(ctx, batch, kafkaOff); err != nil {
+		return batch.total, err
+	}
+	return batch.total, nil
+}
+
+// StreamExport writes all elements block by block as "csv" or "ndjson".  CSV has columns
+// x, y, z, kind, tags, rels followed by the given property columns, which can be read by
+// ImportCSV using the default mapping.
+func (d *Data) StreamExport(ctx *datastore.VersionedCtx, w io.Writer, format string, props []string) (int, error) {
+	if format != "csv" && format != "ndjson" {
+		return 0, fmt.Errorf("unknown export format %q, must be csv or ndjson", format)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	var cw *csv.Writer
+	if format == "csv" {
+		cw = csv.NewWriter(bw)
+		if err := cw.Write(append([]string{"x", "y", "z", "kind", "tags", "rels"}, props...)); err != nil {
+			return 0, err
+		}
+	}
+	var numElems int
+	record := make([]string, 6+len(props))
+	begTKey, endTKey := BlockTKeyRange()
+	err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		var elems Elements
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return err
+		}
+		sort.Sort(elems)
+		for _, elem := range elems {
+			numElems++
+			if cw == nil {
+				line, err := json.Marshal(elem)
+				if err != nil {
+					return err
+				}
+				if _, err := bw.Write(append(line, '\n')); err != nil {
+					return err
+				}
+				continue
+			}
+			for dim := 0; dim < 3; dim++ {
+				record[dim] = strconv.Itoa(int(elem.Pos[dim]))
+			}
+			record[3] = kindName(elem.Kind)
+			tags := make([]string, len(elem.Tags))
+			for i, tag := range elem.Tags {
+				tags[i] = string(tag)
+			}
+			record[4] = strings.Join(tags, ";")
+			rels := make([]string, len(elem.Rels))
+			for i, rel := range elem.Rels {
+				rels[i] = fmt.Sprintf("%s:%d_%d_%d", rel.Rel, rel.To[0], rel.To[1], rel.To[2])
+			}
+			record[5] = strings.Join(rels, ";")
+			for i, prop := range props {
+				record[6+i] = elem.Prop[prop]
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return numElems, err
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return numElems, err
+		}
+	}
+	return numElems, bw.Flush()
+}
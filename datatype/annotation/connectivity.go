@@ -0,0 +1,178 @@
+/*
+	This file supports body-to-body connectivity computed from synaptic relationships, with
+	each endpoint of a PreSynTo or PostSynTo relationship mapped to its current body through
+	the synced labels.
+*/
+
+package annotation
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ConnectionSynapse gives the presynaptic and postsynaptic positions of a connection.
+type ConnectionSynapse struct {
+	Pre  dvid.Point3d
+	Post dvid.Point3d
+}
+
+// Connection is a weighted edge from a presynaptic body to a postsynaptic body, where the
+// weight is the number of presynaptic to postsynaptic element pairs.
+type Connection struct {
+	PreBody  uint64
+	PostBody uint64
+	Weight   int
+	Synapses []ConnectionSynapse `json:",omitempty"`
+}
+
+// Connections is a list of edges sorted by decreasing weight.
+type Connections []*Connection
+
+func (c Connections) Len() int {
+	return len(c)
+}
+
+func (c Connections) Less(i, j int) bool {
+	if c[i].Weight != c[j].Weight {
+		return c[i].Weight > c[j].Weight
+	}
+	if c[i].PreBody != c[j].PreBody {
+		return c[i].PreBody < c[j].PreBody
+	}
+	return c[i].PostBody < c[j].PostBody
+}
+
+func (c Connections) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+// ConnectivityQuery specifies the synapses used for a connectivity computation.  If Bodies
+// is non-empty, only connections between the given bodies are returned.  Otherwise, all
+// connections with at least one synaptic element within the ROI are returned.
+type ConnectivityQuery struct {
+	Bodies   []uint64
+	ROI      storage.FilterSpec
+	Synapses bool // if true, include the positions of each connection's synapses
+}
+
+// pointBodies returns the current body at each point using the synced labels.
+func (d *Data) pointBodies(v dvid.VersionID, pts []dvid.Point3d) ([]uint64, error) {
+	labelData := d.getSyncedLabels()
+	if labelData == nil {
+		return nil, fmt.Errorf("annotation %q needs to be synced with labels to compute connectivity", d.DataName())
+	}
+	if labelPointData, ok := labelData.(labelPointType); ok {
+		return labelPointData.GetLabelPoints(v, pts, 0, false)
+	}
+	bodies := make([]uint64, len(pts))
+	for i, pt := range pts {
+		label, err := labelData.GetLabelAtPoint(v, pt)
+		if err != nil {
+			return nil, err
+		}
+		bodies[i] = label
+	}
+	return bodies, nil
+}
+
+// GetConnectivity returns the weighted connections between bodies given by synapses selected
+// by the query.
+func (d *Data) GetConnectivity(ctx *datastore.VersionedCtx, q ConnectivityQuery) (Connections, error) {
+	var elems Elements
+	if len(q.Bodies) != 0 {
+		for _, label := range q.Bodies {
+			labelElems, err := d.getExpandedElements(ctx, NewLabelTKey(label))
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, labelElems...)
+		}
+	} else if q.ROI != "" {
+		var err error
+		if elems, err = d.GetROISynapses(ctx, q.ROI); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("connectivity for annotation %q requires bodies or an ROI", d.DataName())
+	}
+
+	// collect unique pre -> post pairs since a synapse can be reached from either element.
+	synapses := make(map[ConnectionSynapse]struct{})
+	for _, elem := range elems {
+		for _, rel := range elem.Rels {
+			switch {
+			case elem.Kind == PreSyn && rel.Rel == PreSynTo:
+				synapses[ConnectionSynapse{Pre: elem.Pos, Post: rel.To}] = struct{}{}
+			case elem.Kind == PostSyn && rel.Rel == PostSynTo:
+				synapses[ConnectionSynapse{Pre: rel.To, Post: elem.Pos}] = struct{}{}
+			}
+		}
+	}
+	ptIndex := make(map[dvid.Point3d]int)
+	var pts []dvid.Point3d
+	for syn := range synapses {
+		for _, pt := range []dvid.Point3d{syn.Pre, syn.Post} {
+			if _, found := ptIndex[pt]; !found {
+				ptIndex[pt] = len(pts)
+				pts = append(pts, pt)
+			}
+		}
+	}
+	if len(pts) == 0 {
+		return Connections{}, nil
+	}
+	bodies, err := d.pointBodies(ctx.VersionID(), pts)
+	if err != nil {
+		return nil, err
+	}
+
+	var bodySet map[uint64]struct{}
+	if len(q.Bodies) != 0 {
+		bodySet = make(map[uint64]struct{}, len(q.Bodies))
+		for _, label := range q.Bodies {
+			bodySet[label] = struct{}{}
+		}
+	}
+	edges := make(map[[2]uint64]*Connection)
+	for syn := range synapses {
+		preBody, postBody := bodies[ptIndex[syn.Pre]], bodies[ptIndex[syn.Post]]
+		if preBody == 0 || postBody == 0 {
+			continue
+		}
+		if bodySet != nil {
+			_, preFound := bodySet[preBody]
+			_, postFound := bodySet[postBody]
+			if !preFound || !postFound {
+				continue
+			}
+		}
+		key := [2]uint64{preBody, postBody}
+		edge, found := edges[key]
+		if !found {
+			edge = &Connection{PreBody: preBody, PostBody: postBody}
+			edges[key] = edge
+		}
+		edge.Weight++
+		if q.Synapses {
+			edge.Synapses = append(edge.Synapses, syn)
+		}
+	}
+
+	conns := make(Connections, 0, len(edges))
+	for _, edge := range edges {
+		sort.Slice(edge.Synapses, func(i, j int) bool {
+			if !edge.Synapses[i].Pre.Equals(edge.Synapses[j].Pre) {
+				return edge.Synapses[i].Pre.Less(edge.Synapses[j].Pre)
+			}
+			return edge.Synapses[i].Post.Less(edge.Synapses[j].Post)
+		})
+		conns = append(conns, edge)
+	}
+	sort.Sort(conns)
+	return conns, nil
+}
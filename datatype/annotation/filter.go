@@ -0,0 +1,231 @@
+/*
+	This file supports filtering elements by their properties using simple predicates, e.g.,
+	"conf>0.8 AND user!=auto", and secondary indices of elements by property value.
+
+	Property indices are maintained along with tag denormalizations by treating each indexed
+	property value as an internal tag that is stored under its own key class.
+*/
+
+package annotation
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// filterOps are the comparison operators with two character operators first so they
+// are matched before their one character prefixes.
+var filterOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// filterClause compares an element property to a value.
+type filterClause struct {
+	key   string
+	op    string
+	value string
+	num   float64
+	isNum bool
+}
+
+func parseFilterClause(s string) (filterClause, error) {
+	var c filterClause
+	pos := strings.IndexAny(s, "!<>=")
+	if pos <= 0 {
+		return c, fmt.Errorf("filter clause %q must be <property><op><value> with op one of %v", s, filterOps)
+	}
+	for _, op := range filterOps {
+		if strings.HasPrefix(s[pos:], op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return c, fmt.Errorf("bad operator in filter clause %q, must be one of %v", s, filterOps)
+	}
+	c.key = strings.TrimSpace(s[:pos])
+	c.value = strings.TrimSpace(s[pos+len(c.op):])
+	if c.key == "" {
+		return c, fmt.Errorf("filter clause %q has no property name", s)
+	}
+	if num, err := strconv.ParseFloat(c.value, 64); err == nil {
+		c.num, c.isNum = num, true
+	}
+	return c, nil
+}
+
+// matches returns true if the element's property satisfies the clause.  Values are
+// compared as numbers if both parse as numbers, otherwise as strings.  A missing property
+// only satisfies "!=".
+func (c filterClause) matches(elem ElementNR) bool {
+	value, found := elem.Prop[c.key]
+	if !found {
+		return c.op == "!="
+	}
+	var cmp int
+	if num, err := strconv.ParseFloat(value, 64); err == nil && c.isNum {
+		switch {
+		case num < c.num:
+			cmp = -1
+		case num > c.num:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(value, c.value)
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// ElementFilter is a predicate on element properties made of clauses joined by AND and OR,
+// where AND binds more tightly than OR.
+type ElementFilter struct {
+	terms [][]filterClause // OR of AND terms
+}
+
+// ParseElementFilter parses a filter like "conf>0.8 AND user!=auto OR status=done".
+func ParseElementFilter(s string) (*ElementFilter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("empty element filter")
+	}
+	f := new(ElementFilter)
+	for _, termStr := range strings.Split(s, " OR ") {
+		var term []filterClause
+		for _, clauseStr := range strings.Split(termStr, " AND ") {
+			c, err := parseFilterClause(strings.TrimSpace(clauseStr))
+			if err != nil {
+				return nil, err
+			}
+			term = append(term, c)
+		}
+		f.terms = append(f.terms, term)
+	}
+	return f, nil
+}
+
+// elementFilterFromQuery returns the filter given by a "filter" query string or nil if
+// there is none.
+func elementFilterFromQuery(query url.Values) (*ElementFilter, error) {
+	filterStr := query.Get("filter")
+	if filterStr == "" {
+		return nil, nil
+	}
+	return ParseElementFilter(filterStr)
+}
+
+// Matches returns true if the element satisfies the filter.  A nil filter matches all.
+func (f *ElementFilter) Matches(elem ElementNR) bool {
+	if f == nil {
+		return true
+	}
+	for _, term := range f.terms {
+		matched := true
+		for _, c := range term {
+			if !c.matches(elem) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterElements returns the elements satisfying the filter.
+func (f *ElementFilter) FilterElements(elems Elements) Elements {
+	if f == nil {
+		return elems
+	}
+	filtered := Elements{}
+	for _, elem := range elems {
+		if f.Matches(elem.ElementNR) {
+			filtered = append(filtered, elem)
+		}
+	}
+	return filtered
+}
+
+// FilterElementsNR returns the elements satisfying the filter.
+func (f *ElementFilter) FilterElementsNR(elems ElementsNR) ElementsNR {
+	if f == nil {
+		return elems
+	}
+	filtered := ElementsNR{}
+	for _, elem := range elems {
+		if f.Matches(elem) {
+			filtered = append(filtered, elem)
+		}
+	}
+	return filtered
+}
+
+// indexedClause returns an equality clause on an indexed property that every matching
+// element must satisfy, so the property index can be used to find candidates.
+func (f *ElementFilter) indexedClause(indexed []string) (key, value string, found bool) {
+	if f == nil || len(f.terms) != 1 {
+		return
+	}
+	for _, c := range f.terms[0] {
+		if c.op != "=" {
+			continue
+		}
+		for _, prop := range indexed {
+			if c.key == prop {
+				return c.key, c.value, true
+			}
+		}
+	}
+	return
+}
+
+// propIndexTag returns the internal tag used to maintain the index of a property value.
+// Internal tags start with a 0 byte to distinguish them from user tags.
+func propIndexTag(key, value string) Tag {
+	return Tag("\x00" + key + "\x00" + value)
+}
+
+// indexTKey returns the key for a user tag or an internal property index tag.
+func indexTKey(tag Tag) (storage.TKey, error) {
+	if !strings.HasPrefix(string(tag), "\x00") {
+		return NewTagTKey(tag)
+	}
+	parts := strings.SplitN(string(tag[1:]), "\x00", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("bad property index tag %q", tag)
+	}
+	return NewPropIndexTKey(parts[0], parts[1])
+}
+
+// indexTags returns the element's tags plus internal tags for any indexed properties.
+func (d *Data) indexTags(elem ElementNR) Tags {
+	if len(d.IndexedProps) == 0 {
+		return elem.Tags
+	}
+	tags := elem.Tags
+	for _, key := range d.IndexedProps {
+		if value, found := elem.Prop[key]; found {
+			if len(tags) == len(elem.Tags) {
+				tags = append(Tags{}, elem.Tags...)
+			}
+			tags = append(tags, propIndexTag(key, value))
+		}
+	}
+	return tags
+}
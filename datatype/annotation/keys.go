@@ -28,6 +28,14 @@ const (
 
 	// key is block coordinate.  value is serialization of synaptic elements.
 	keyBlock = 72
+
+	// key is property name and value.  value is serialization of synaptic elements with that
+	// property value.
+	keyPropIndex = 73
+
+	// key is constant.  value is the min and max block coordinates of stored element blocks
+	// and the maximum number of elements in a block.
+	keyBlockExtents = 74
 )
 
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
@@ -40,6 +48,10 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "annotation label key"
 	case keyBlock:
 		return "annotation block coord key"
+	case keyPropIndex:
+		return "annotation property index key"
+	case keyBlockExtents:
+		return "annotation block extents key"
 	default:
 	}
 	return "unknown annotation key"
@@ -69,6 +81,16 @@ func DecodeTagTKey(tk storage.TKey) (Tag, error) {
 	return Tag(ibytes[:sz]), nil
 }
 
+// NewPropIndexTKey returns a TKey for elements with the given property value.
+func NewPropIndexTKey(key, value string) (storage.TKey, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty property name not permitted")
+	}
+	ibytes := append([]byte(key), 0)
+	ibytes = append(ibytes, []byte(value)...)
+	return storage.NewTKey(keyPropIndex, append(ibytes, 0)), nil
+}
+
 func NewLabelTKey(label uint64) storage.TKey {
 	buf := make([]byte, 8)
 	binary.BigEndian.PutUint64(buf, label)
@@ -107,3 +129,8 @@ func DecodeBlockTKey(tk storage.TKey) (pt dvid.ChunkPoint3d, err error) {
 	pt = dvid.ChunkPoint3d(idx)
 	return
 }
+
+// NewBlockExtentsTKey returns the TKey for the extents of stored element blocks.
+func NewBlockExtentsTKey() storage.TKey {
+	return storage.NewTKey(keyBlockExtents, nil)
+}
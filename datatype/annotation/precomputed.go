@@ -0,0 +1,508 @@
+/*
+	This file supports the Neuroglancer precomputed annotation format, either served read-only
+	over HTTP or exported to a directory.  Each element is a point annotation with a "kind"
+	enum property.  Annotation IDs are packed from element positions so any annotation can be
+	found without a separate index, and the spatial index uses the annotation blocks.
+
+	Two relationships are supported when labels are synced: "body" relates an element to the
+	body containing it, and "partner" relates an element to the bodies of elements it points
+	to via its relationships.  The partner index for a body is made of the elements pointed to
+	by that body's elements, which matches the per-element partners when relationships are
+	reciprocal, as with PreSynTo and PostSynTo.
+*/
+
+package annotation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/labelmap"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Element coordinates must be non-negative and fit within 21 bits to be packed into an ID.
+const precomputedCoordBits = 21
+
+const (
+	precomputedSpatialKey = "spatial0"
+	precomputedByIDKey    = "by_id"
+	precomputedRelsKey    = "relationships"
+)
+
+// precomputedRelationships are the relationship ids in their order of encoding.
+var precomputedRelationships = []string{"body", "partner"}
+
+// precomputedID packs an element position into a precomputed annotation ID.
+func precomputedID(pt dvid.Point3d) (uint64, error) {
+	var id uint64
+	for dim := 2; dim >= 0; dim-- {
+		if pt[dim] < 0 || pt[dim] >= 1<<precomputedCoordBits {
+			return 0, fmt.Errorf("element at %s cannot be given a precomputed annotation ID, coordinates must be in [0, %d)", pt, 1<<precomputedCoordBits)
+		}
+		id = id<<precomputedCoordBits | uint64(pt[dim])
+	}
+	return id, nil
+}
+
+// precomputedPoint returns the element position for a precomputed annotation ID.
+func precomputedPoint(id uint64) (dvid.Point3d, error) {
+	if id >= 1<<(3*precomputedCoordBits) {
+		return dvid.Point3d{}, fmt.Errorf("bad precomputed annotation ID %d", id)
+	}
+	var pt dvid.Point3d
+	mask := uint64(1)<<precomputedCoordBits - 1
+	for dim := 0; dim < 3; dim++ {
+		pt[dim] = int32(id & mask)
+		id >>= precomputedCoordBits
+	}
+	return pt, nil
+}
+
+type precomputedKey struct {
+	ID  string `json:"id,omitempty"`
+	Key string `json:"key"`
+}
+
+type precomputedProperty struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	EnumValues  []uint8  `json:"enum_values,omitempty"`
+	EnumLabels  []string `json:"enum_labels,omitempty"`
+}
+
+type precomputedSpatial struct {
+	Key       string   `json:"key"`
+	GridShape [3]int32 `json:"grid_shape"`
+	ChunkSize [3]int32 `json:"chunk_size"`
+	Limit     int      `json:"limit"`
+}
+
+type precomputedInfo struct {
+	Type           string                   `json:"@type"`
+	Dimensions     map[string][]interface{} `json:"dimensions"`
+	LowerBound     [3]int32                 `json:"lower_bound"`
+	UpperBound     [3]int32                 `json:"upper_bound"`
+	AnnotationType string                   `json:"annotation_type"`
+	Properties     []precomputedProperty    `json:"properties"`
+	Relationships  []precomputedKey         `json:"relationships"`
+	ByID           precomputedKey           `json:"by_id"`
+	Spatial        []precomputedSpatial     `json:"spatial"`
+}
+
+// metersPerUnit returns the size in meters of DVID voxel units or 0 if unknown.
+func metersPerUnit(units string) float64 {
+	switch strings.ToLower(units) {
+	case "nanometers", "nanometer", "nm":
+		return 1e-9
+	case "micrometers", "micrometer", "microns", "um":
+		return 1e-6
+	case "millimeters", "millimeter", "mm":
+		return 1e-3
+	case "meters", "meter", "m":
+		return 1
+	case "angstroms", "angstrom":
+		return 1e-10
+	}
+	return 0
+}
+
+// precomputedDimensions returns the voxel size in meters, using the resolution of synced
+// labelmap data if available.
+func (d *Data) precomputedDimensions() map[string][]interface{} {
+	dims := make(map[string][]interface{}, 3)
+	var res [3]float64
+	for dim := 0; dim < 3; dim++ {
+		res[dim] = float64(DefaultRes) * metersPerUnit(DefaultUnits)
+	}
+	if lm, ok := d.getSyncedLabels().(*labelmap.Data); ok {
+		voxelSize, units := lm.Properties.VoxelSize, lm.Properties.VoxelUnits
+		for dim := 0; dim < 3 && dim < len(voxelSize) && dim < len(units); dim++ {
+			if scale := metersPerUnit(units[dim]); scale != 0 {
+				res[dim] = float64(voxelSize[dim]) * scale
+			}
+		}
+	}
+	for dim, axis := range []string{"x", "y", "z"} {
+		dims[axis] = []interface{}{res[dim], "m"}
+	}
+	return dims
+}
+
+// getPrecomputedInfo returns the info for the precomputed annotations, using the stored
+// block extents for the bounds and the maximum number of elements in a block.
+func (d *Data) getPrecomputedInfo(ctx *datastore.VersionedCtx) (*precomputedInfo, error) {
+	ext, err := d.getBlockExtents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var maxBlock dvid.ChunkPoint3d
+	if ext.found {
+		for dim := 0; dim < 3; dim++ {
+			if ext.MinBlock[dim] < 0 {
+				return nil, fmt.Errorf("annotation blocks extend to negative block coordinate %s, which can't be used for precomputed annotations", ext.MinBlock)
+			}
+		}
+		maxBlock = ext.MaxBlock
+	}
+	limit := int(ext.MaxElements)
+
+	blockSize := d.blockSize()
+	info := &precomputedInfo{
+		Type:           "neuroglancer_annotations_v1",
+		Dimensions:     d.precomputedDimensions(),
+		AnnotationType: "point",
+		Properties: []precomputedProperty{
+			{
+				ID:          "kind",
+				Type:        "uint8",
+				Description: "DVID element kind",
+				EnumValues:  []uint8{uint8(UnknownElem), uint8(PostSyn), uint8(PreSyn), uint8(Gap), uint8(Note)},
+				EnumLabels:  []string{kindName(UnknownElem), kindName(PostSyn), kindName(PreSyn), kindName(Gap), kindName(Note)},
+			},
+		},
+		Relationships: []precomputedKey{},
+		ByID:          precomputedKey{Key: precomputedByIDKey},
+	}
+	spatial := precomputedSpatial{
+		Key:       precomputedSpatialKey,
+		ChunkSize: [3]int32{blockSize[0], blockSize[1], blockSize[2]},
+		Limit:     limit,
+	}
+	for dim := 0; dim < 3; dim++ {
+		spatial.GridShape[dim] = maxBlock[dim] + 1
+		info.UpperBound[dim] = (maxBlock[dim] + 1) * blockSize[dim]
+	}
+	info.Spatial = []precomputedSpatial{spatial}
+	if d.getSyncedLabels() != nil {
+		for _, rel := range precomputedRelationships {
+			info.Relationships = append(info.Relationships, precomputedKey{ID: rel, Key: precomputedRelsKey + "/" + rel})
+		}
+	}
+	return info, nil
+}
+
+// writePrecomputedPoint writes the point geometry and kind property padded to 4 bytes.
+func writePrecomputedPoint(buf *bytes.Buffer, elem ElementNR) {
+	for dim := 0; dim < 3; dim++ {
+		binary.Write(buf, binary.LittleEndian, float32(elem.Pos[dim]))
+	}
+	buf.Write([]byte{byte(elem.Kind), 0, 0, 0})
+}
+
+// encodePrecomputedMultiple returns the encoding of a list of annotations used for spatial
+// index chunks and relationship indices.
+func encodePrecomputedMultiple(elems ElementsNR) ([]byte, error) {
+	sort.Sort(elems)
+	ids := make([]uint64, len(elems))
+	for i, elem := range elems {
+		var err error
+		if ids[i], err = precomputedID(elem.Pos); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(len(elems)))
+	for _, elem := range elems {
+		writePrecomputedPoint(&buf, elem)
+	}
+	binary.Write(&buf, binary.LittleEndian, ids)
+	return buf.Bytes(), nil
+}
+
+// encodePrecomputedSingle returns the encoding of a single annotation with its related
+// segments for each relationship.
+func encodePrecomputedSingle(elem ElementNR, related [][]uint64) []byte {
+	var buf bytes.Buffer
+	writePrecomputedPoint(&buf, elem)
+	for _, ids := range related {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(ids)))
+		binary.Write(&buf, binary.LittleEndian, ids)
+	}
+	return buf.Bytes()
+}
+
+// elementsNR returns the elements without relationships.
+func (elems Elements) elementsNR() ElementsNR {
+	elemsNR := make(ElementsNR, len(elems))
+	for i, elem := range elems {
+		elemsNR[i] = elem.ElementNR
+	}
+	return elemsNR
+}
+
+// relatedBodies returns the body and sorted partner bodies of each element given the bodies
+// at the element positions and the targets of their relationships.
+func relatedBodies(elems Elements, bodyAt map[dvid.Point3d]uint64) [][][]uint64 {
+	related := make([][][]uint64, len(elems))
+	for i, elem := range elems {
+		var bodyIDs []uint64
+		if body := bodyAt[elem.Pos]; body != 0 {
+			bodyIDs = []uint64{body}
+		}
+		partnerSet := make(map[uint64]struct{})
+		for _, rel := range elem.Rels {
+			if body := bodyAt[rel.To]; body != 0 {
+				partnerSet[body] = struct{}{}
+			}
+		}
+		partners := make([]uint64, 0, len(partnerSet))
+		for body := range partnerSet {
+			partners = append(partners, body)
+		}
+		sort.Slice(partners, func(i, j int) bool { return partners[i] < partners[j] })
+		related[i] = [][]uint64{bodyIDs, partners}
+	}
+	return related
+}
+
+// elementBodies returns the bodies at the positions and relationship targets of elements.
+func (d *Data) elementBodies(v dvid.VersionID, elems Elements) (map[dvid.Point3d]uint64, error) {
+	bodyAt := make(map[dvid.Point3d]uint64)
+	var pts []dvid.Point3d
+	for _, elem := range elems {
+		for _, pt := range append([]dvid.Point3d{elem.Pos}, elem.Rels.targets()...) {
+			if _, found := bodyAt[pt]; !found {
+				bodyAt[pt] = 0
+				pts = append(pts, pt)
+			}
+		}
+	}
+	if len(pts) == 0 {
+		return bodyAt, nil
+	}
+	bodies, err := d.pointBodies(v, pts)
+	if err != nil {
+		return nil, err
+	}
+	for i, pt := range pts {
+		bodyAt[pt] = bodies[i]
+	}
+	return bodyAt, nil
+}
+
+// targets returns the positions pointed to by relationships.
+func (r Relationships) targets() []dvid.Point3d {
+	pts := make([]dvid.Point3d, len(r))
+	for i, rel := range r {
+		pts[i] = rel.To
+	}
+	return pts
+}
+
+// getElementsAt returns the stored elements at the given positions, ignoring positions
+// without an element.
+func (d *Data) getElementsAt(ctx *datastore.VersionedCtx, pts []dvid.Point3d) (ElementsNR, error) {
+	blockSize := d.blockSize()
+	blockPts := make(map[dvid.IZYXString]map[dvid.Point3d]struct{})
+	for _, pt := range pts {
+		izyx := pt.ToBlockIZYXString(blockSize)
+		if _, found := blockPts[izyx]; !found {
+			blockPts[izyx] = make(map[dvid.Point3d]struct{})
+		}
+		blockPts[izyx][pt] = struct{}{}
+	}
+	var found ElementsNR
+	for izyx, ptSet := range blockPts {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		blockElems, err := getElementsNR(ctx, NewBlockTKey(bcoord))
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range blockElems {
+			if _, wanted := ptSet[elem.Pos]; wanted {
+				found = append(found, elem)
+				delete(ptSet, elem.Pos)
+			}
+		}
+	}
+	return found, nil
+}
+
+// getPrecomputedSpatial returns the encoded annotations of a spatial index chunk, which is
+// an annotation block.
+func (d *Data) getPrecomputedSpatial(ctx *datastore.VersionedCtx, bcoord dvid.ChunkPoint3d) ([]byte, error) {
+	elems, err := getElementsNR(ctx, NewBlockTKey(bcoord))
+	if err != nil {
+		return nil, err
+	}
+	return encodePrecomputedMultiple(elems)
+}
+
+// getPrecomputedByID returns the encoded annotation with the given ID or nil if not found.
+func (d *Data) getPrecomputedByID(ctx *datastore.VersionedCtx, id uint64) ([]byte, error) {
+	pt, err := precomputedPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	bcoord, err := pt.ToBlockIZYXString(d.blockSize()).ToChunkPoint3d()
+	if err != nil {
+		return nil, err
+	}
+	blockElems, err := getElements(ctx, NewBlockTKey(bcoord))
+	if err != nil {
+		return nil, err
+	}
+	for _, elem := range blockElems {
+		if !elem.Pos.Equals(pt) {
+			continue
+		}
+		if d.getSyncedLabels() == nil {
+			return encodePrecomputedSingle(elem.ElementNR, nil), nil
+		}
+		elems := Elements{elem}
+		bodyAt, err := d.elementBodies(ctx.VersionID(), elems)
+		if err != nil {
+			return nil, err
+		}
+		return encodePrecomputedSingle(elem.ElementNR, relatedBodies(elems, bodyAt)[0]), nil
+	}
+	return nil, nil
+}
+
+// getPrecomputedRelationship returns the encoded annotations related to a body.
+func (d *Data) getPrecomputedRelationship(ctx *datastore.VersionedCtx, rel string, label uint64) ([]byte, error) {
+	if d.getSyncedLabels() == nil {
+		return nil, fmt.Errorf("annotation %q needs to be synced with labels for precomputed relationships", d.DataName())
+	}
+	var elems ElementsNR
+	switch rel {
+	case "body":
+		var err error
+		if elems, err = getElementsNR(ctx, NewLabelTKey(label)); err != nil {
+			return nil, err
+		}
+	case "partner":
+		bodyElems, err := d.getExpandedElements(ctx, NewLabelTKey(label))
+		if err != nil {
+			return nil, err
+		}
+		var targets []dvid.Point3d
+		for _, elem := range bodyElems {
+			targets = append(targets, elem.Rels.targets()...)
+		}
+		if elems, err = d.getElementsAt(ctx, targets); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown precomputed relationship %q, must be one of %v", rel, precomputedRelationships)
+	}
+	return encodePrecomputedMultiple(elems)
+}
+
+// ExportPrecomputed writes all annotations to a directory in the Neuroglancer precomputed
+// annotation format, including relationship indices if labels are synced.
+func (d *Data) ExportPrecomputed(v dvid.VersionID, dir string) error {
+	timedLog := dvid.NewTimeLog()
+	ctx := datastore.NewVersionedCtx(d, v)
+	info, err := d.getPrecomputedInfo(ctx)
+	if err != nil {
+		return err
+	}
+	for _, subdir := range []string{precomputedSpatialKey, precomputedByIDKey} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			return err
+		}
+	}
+	for _, rel := range info.Relationships {
+		if err := os.MkdirAll(filepath.Join(dir, rel.Key), 0755); err != nil {
+			return err
+		}
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "info"), infoJSON, 0644); err != nil {
+		return err
+	}
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	withRels := len(info.Relationships) != 0
+	bodies := make(map[uint64]struct{})
+	var numElems int
+	begTKey, endTKey := BlockTKeyRange()
+	err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
+		bcoord, err := DecodeBlockTKey(chunk.K)
+		if err != nil {
+			return err
+		}
+		var elems Elements
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return err
+		}
+		if len(elems) == 0 {
+			return nil
+		}
+		data, err := encodePrecomputedMultiple(elems.elementsNR())
+		if err != nil {
+			return err
+		}
+		cell := fmt.Sprintf("%d_%d_%d", bcoord[0], bcoord[1], bcoord[2])
+		if err := ioutil.WriteFile(filepath.Join(dir, precomputedSpatialKey, cell), data, 0644); err != nil {
+			return err
+		}
+		var related [][][]uint64
+		if withRels {
+			bodyAt, err := d.elementBodies(v, elems)
+			if err != nil {
+				return err
+			}
+			related = relatedBodies(elems, bodyAt)
+		}
+		for i, elem := range elems {
+			id, err := precomputedID(elem.Pos)
+			if err != nil {
+				return err
+			}
+			var elemRelated [][]uint64
+			if withRels {
+				elemRelated = related[i]
+				for _, body := range related[i][0] {
+					bodies[body] = struct{}{}
+				}
+			}
+			data := encodePrecomputedSingle(elem.ElementNR, elemRelated)
+			if err := ioutil.WriteFile(filepath.Join(dir, precomputedByIDKey, fmt.Sprintf("%d", id)), data, 0644); err != nil {
+				return err
+			}
+		}
+		numElems += len(elems)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// partners of a body are pointed to by the body's elements, so only bodies with elements
+	// have non-empty relationship indices.
+	for body := range bodies {
+		for _, rel := range info.Relationships {
+			data, err := d.getPrecomputedRelationship(ctx, rel.ID, body)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, rel.Key, fmt.Sprintf("%d", body)), data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	timedLog.Infof("Exported %d elements and %d bodies of annotation %q to precomputed directory %q", numElems, len(bodies), d.DataName(), dir)
+	return nil
+}
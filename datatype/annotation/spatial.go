@@ -0,0 +1,370 @@
+/*
+	This file supports nearest neighbor and radius queries of point annotations by searching
+	block-indexed elements in shells of blocks around a query point.
+*/
+
+package annotation
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// NearElement is an element with its distance in voxels from a query point.
+type NearElement struct {
+	ElementNR
+	Rels     Relationships `json:",omitempty"`
+	Distance float64
+}
+
+// NearElements is a slice of elements sorted by distance from a query point.
+type NearElements []NearElement
+
+func (elems NearElements) Len() int {
+	return len(elems)
+}
+
+// Less orders by distance with ties broken by position.
+func (elems NearElements) Less(i, j int) bool {
+	if elems[i].Distance != elems[j].Distance {
+		return elems[i].Distance < elems[j].Distance
+	}
+	return elems[i].Pos.Less(elems[j].Pos)
+}
+
+func (elems NearElements) Swap(i, j int) {
+	elems[i], elems[j] = elems[j], elems[i]
+}
+
+// NearQuery specifies a search for elements around a point.
+type NearQuery struct {
+	Center        dvid.Point3d
+	K             int         // if > 0, return only the K nearest elements
+	MaxDist       float64     // if >= 0, only return elements within this distance
+	Kind          ElementType // if Filtered, only return elements of this kind
+	Filtered      bool
+	Relationships bool // if true, include relationships of elements
+}
+
+// MaxNearestShells is the maximum number of shells of blocks around the query point that
+// are searched for the nearest elements.
+const MaxNearestShells = 16
+
+// blockExtents gives the block coordinate bounds of stored element blocks and the maximum
+// number of elements stored in a block.  Both only grow as blocks are stored, so they may
+// reflect elements that were later deleted.
+type blockExtents struct {
+	MinBlock    dvid.ChunkPoint3d
+	MaxBlock    dvid.ChunkPoint3d
+	MaxElements uint32
+	found       bool // false if no blocks are stored
+}
+
+func (ext *blockExtents) extend(bcoord dvid.ChunkPoint3d, numElems int) (changed bool) {
+	if uint32(numElems) > ext.MaxElements {
+		ext.MaxElements = uint32(numElems)
+		changed = true
+	}
+	if !ext.found {
+		ext.MinBlock, ext.MaxBlock, ext.found = bcoord, bcoord, true
+		return true
+	}
+	for dim := 0; dim < 3; dim++ {
+		if bcoord[dim] < ext.MinBlock[dim] {
+			ext.MinBlock[dim] = bcoord[dim]
+			changed = true
+		}
+		if bcoord[dim] > ext.MaxBlock[dim] {
+			ext.MaxBlock[dim] = bcoord[dim]
+			changed = true
+		}
+	}
+	return
+}
+
+func (ext blockExtents) serialize() []byte {
+	minIdx := dvid.IndexZYX(ext.MinBlock)
+	maxIdx := dvid.IndexZYX(ext.MaxBlock)
+	b := append(minIdx.Bytes(), maxIdx.Bytes()...)
+	var maxElems [4]byte
+	binary.LittleEndian.PutUint32(maxElems[:], ext.MaxElements)
+	return append(b, maxElems[:]...)
+}
+
+func (ext *blockExtents) deserialize(b []byte) error {
+	if len(b) != 2*dvid.IndexZYXSize+4 {
+		return fmt.Errorf("bad block extents value of %d bytes", len(b))
+	}
+	var minIdx, maxIdx dvid.IndexZYX
+	if err := minIdx.IndexFromBytes(b[:dvid.IndexZYXSize]); err != nil {
+		return err
+	}
+	if err := maxIdx.IndexFromBytes(b[dvid.IndexZYXSize : 2*dvid.IndexZYXSize]); err != nil {
+		return err
+	}
+	ext.MinBlock, ext.MaxBlock, ext.found = dvid.ChunkPoint3d(minIdx), dvid.ChunkPoint3d(maxIdx), true
+	ext.MaxElements = binary.LittleEndian.Uint32(b[2*dvid.IndexZYXSize:])
+	return nil
+}
+
+// scanBlockExtents computes the block extents by reading all blocks, which is only needed
+// for data stored before block extents were kept in metadata.
+func scanBlockExtents(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB) (ext blockExtents, err error) {
+	begTKey, endTKey := BlockTKeyRange()
+	err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
+		bcoord, err := DecodeBlockTKey(chunk.K)
+		if err != nil {
+			return err
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return fmt.Errorf("bad elements in block %s: %v", bcoord, err)
+		}
+		ext.extend(bcoord, len(elems))
+		return nil
+	})
+	return
+}
+
+// returns the block extents for the version, which the caller must hold extentsMu to call.
+func (d *Data) getBlockExtentsLocked(ctx *datastore.VersionedCtx) (ext blockExtents, err error) {
+	if ext, found := d.extents[ctx.VersionID()]; found {
+		return ext, nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return
+	}
+	val, err := store.Get(ctx, NewBlockExtentsTKey())
+	if err != nil {
+		return
+	}
+	if val != nil {
+		if err = ext.deserialize(val); err != nil {
+			return
+		}
+	} else {
+		if ext, err = scanBlockExtents(ctx, store); err != nil {
+			return
+		}
+		if ext.found {
+			if err = store.Put(ctx, NewBlockExtentsTKey(), ext.serialize()); err != nil {
+				return
+			}
+		}
+	}
+	if d.extents == nil {
+		d.extents = make(map[dvid.VersionID]blockExtents)
+	}
+	d.extents[ctx.VersionID()] = ext
+	return
+}
+
+// getBlockExtents returns the extents of stored element blocks for the version.
+func (d *Data) getBlockExtents(ctx *datastore.VersionedCtx) (blockExtents, error) {
+	d.extentsMu.Lock()
+	defer d.extentsMu.Unlock()
+	return d.getBlockExtentsLocked(ctx)
+}
+
+// extendBlockExtents expands the stored block extents of the version to include the
+// given blocks and their number of stored elements.
+func (d *Data) extendBlockExtents(ctx *datastore.VersionedCtx, blockElems map[dvid.ChunkPoint3d]int) error {
+	d.extentsMu.Lock()
+	defer d.extentsMu.Unlock()
+
+	ext, err := d.getBlockExtentsLocked(ctx)
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for bcoord, numElems := range blockElems {
+		if ext.extend(bcoord, numElems) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, NewBlockExtentsTKey(), ext.serialize()); err != nil {
+		return err
+	}
+	d.extents[ctx.VersionID()] = ext
+	return nil
+}
+
+// GetNearElements returns elements around a point sorted by increasing distance.  If
+// K is set, blocks are searched in shells of increasing block distance from the point
+// until the K nearest elements are found, no unsearched block can hold an element
+// within MaxDist, or MaxNearestShells shells have been searched.  If the shell limit
+// stops the search, only elements closer than any unsearched voxel are returned.
+// Without K, all blocks within MaxDist are searched.
+func (d *Data) GetNearElements(ctx *datastore.VersionedCtx, q NearQuery) (NearElements, error) {
+	if q.K <= 0 && q.MaxDist < 0 {
+		return nil, fmt.Errorf("search for elements near %s must be limited by count or distance", q.Center)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := d.getBlockExtents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ext.found {
+		return NearElements{}, nil
+	}
+	blockSize := d.blockSize()
+	var centerBlock dvid.ChunkPoint3d
+	minSize := blockSize[0]
+	for dim := 0; dim < 3; dim++ {
+		centerBlock[dim] = q.Center[dim] / blockSize[dim]
+		if q.Center[dim] < 0 && q.Center[dim]%blockSize[dim] != 0 {
+			centerBlock[dim]--
+		}
+		if blockSize[dim] < minSize {
+			minSize = blockSize[dim]
+		}
+	}
+
+	// Shells past the stored block extents hold no elements, and a block in shell r
+	// is at least (r-1) blocks away from the point.
+	var maxShell int32
+	for dim := 0; dim < 3; dim++ {
+		if dist := centerBlock[dim] - ext.MinBlock[dim]; dist > maxShell {
+			maxShell = dist
+		}
+		if dist := ext.MaxBlock[dim] - centerBlock[dim]; dist > maxShell {
+			maxShell = dist
+		}
+	}
+	if q.MaxDist >= 0 {
+		if distShell := int32(q.MaxDist/float64(minSize)) + 1; distShell < maxShell {
+			maxShell = distShell
+		}
+	}
+	var capped bool
+	if q.K > 0 && maxShell > MaxNearestShells {
+		maxShell = MaxNearestShells
+		capped = true
+	}
+
+	near := NearElements{}
+	addBlock := func(chunk *storage.Chunk) error {
+		var blockElems Elements
+		if err := json.Unmarshal(chunk.V, &blockElems); err != nil {
+			return err
+		}
+		for _, elem := range blockElems {
+			if q.Filtered && elem.Kind != q.Kind {
+				continue
+			}
+			var sumSq float64
+			for dim := 0; dim < 3; dim++ {
+				diff := float64(elem.Pos[dim] - q.Center[dim])
+				sumSq += diff * diff
+			}
+			dist := math.Sqrt(sumSq)
+			if q.MaxDist >= 0 && dist > q.MaxDist {
+				continue
+			}
+			nearElem := NearElement{ElementNR: elem.ElementNR, Distance: dist}
+			if q.Relationships {
+				nearElem.Rels = elem.Rels
+			}
+			near = append(near, nearElem)
+		}
+		return nil
+	}
+	processRow := func(y, z, x0, x1 int32) error {
+		if y < ext.MinBlock[1] || y > ext.MaxBlock[1] || z < ext.MinBlock[2] || z > ext.MaxBlock[2] {
+			return nil
+		}
+		if x0 < ext.MinBlock[0] {
+			x0 = ext.MinBlock[0]
+		}
+		if x1 > ext.MaxBlock[0] {
+			x1 = ext.MaxBlock[0]
+		}
+		if x0 > x1 {
+			return nil
+		}
+		begTKey := NewBlockTKey(dvid.ChunkPoint3d{x0, y, z})
+		endTKey := NewBlockTKey(dvid.ChunkPoint3d{x1, y, z})
+		return store.ProcessRange(ctx, begTKey, endTKey, nil, addBlock)
+	}
+	// returns the distance from the point to the nearest voxel outside shell r.
+	shellBound := func(r int32) float64 {
+		bound := math.MaxFloat64
+		for dim := 0; dim < 3; dim++ {
+			below := q.Center[dim] - ((centerBlock[dim]-r)*blockSize[dim] - 1)
+			above := (centerBlock[dim]+r+1)*blockSize[dim] - q.Center[dim]
+			bound = math.Min(bound, math.Min(float64(below), float64(above)))
+		}
+		return bound
+	}
+
+	// Without a count limit, read each row of blocks within the distance once.
+	if q.K <= 0 {
+		for z := centerBlock[2] - maxShell; z <= centerBlock[2]+maxShell; z++ {
+			for y := centerBlock[1] - maxShell; y <= centerBlock[1]+maxShell; y++ {
+				if err := processRow(y, z, centerBlock[0]-maxShell, centerBlock[0]+maxShell); err != nil {
+					return nil, err
+				}
+			}
+		}
+		sort.Sort(near)
+		return near, nil
+	}
+
+	var complete bool
+	for r := int32(0); r <= maxShell; r++ {
+		x0, x1 := centerBlock[0]-r, centerBlock[0]+r
+		for z := centerBlock[2] - r; z <= centerBlock[2]+r; z++ {
+			for y := centerBlock[1] - r; y <= centerBlock[1]+r; y++ {
+				if r == 0 || z == centerBlock[2]-r || z == centerBlock[2]+r || y == centerBlock[1]-r || y == centerBlock[1]+r {
+					if err := processRow(y, z, x0, x1); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				if err := processRow(y, z, x0, x0); err != nil {
+					return nil, err
+				}
+				if err := processRow(y, z, x1, x1); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(near) < q.K {
+			continue
+		}
+		// stop if no voxel outside the searched blocks can be closer than the kth element.
+		sort.Sort(near)
+		if near[q.K-1].Distance <= shellBound(r) {
+			complete = true
+			break
+		}
+	}
+	sort.Sort(near)
+	if capped && !complete {
+		bound := shellBound(maxShell)
+		i := sort.Search(len(near), func(i int) bool { return near[i].Distance > bound })
+		near = near[:i]
+	}
+	if len(near) > q.K {
+		near = near[:q.K]
+	}
+	return near, nil
+}
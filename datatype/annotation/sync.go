@@ -210,6 +210,11 @@ func (d *Data) GetSyncSubs(synced dvid.Data) (subs datastore.SyncSubs, err error
 				Notify: d.DataUUID(),
 				Ch:     d.syncCh,
 			},
+			datastore.SyncSub{
+				Event:  datastore.SyncEvent{synced.DataUUID(), labels.RenumberEvent},
+				Notify: d.DataUUID(),
+				Ch:     d.syncCh,
+			},
 		}
 	default:
 		err = fmt.Errorf("unable to sync %s with %s since datatype %q is not supported", d.DataName(), synced.DataName(), synced.TypeName())
@@ -341,6 +346,14 @@ func (d *Data) handleSyncMessage(ctx *datastore.VersionedCtx, msg datastore.Sync
 		}
 		mutID = delta.MutID
 
+	case labels.DeltaRenumber:
+		err := d.renumberLabels(batcher, msg.Version, delta)
+		if err != nil {
+			diagnostic = fmt.Sprintf("error on renumbering labels for data %s: %v", d.DataName(), err)
+			successful = false
+		}
+		mutID = delta.MutID
+
 	default:
 		diagnostic = fmt.Sprintf("critical error - unexpected delta: %v\n", msg)
 		successful = false
@@ -625,6 +638,71 @@ func (d *Data) mergeLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, op
 	return nil
 }
 
+// renumberLabels moves the elements of each renumbered label to its new label.  All old
+// label elements are read before any are written since new labels may reuse old ones.
+func (d *Data) renumberLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, delta labels.DeltaRenumber) error {
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	timedLog := dvid.NewTimeLog()
+	ctx := datastore.NewVersionedCtx(d, v)
+	batch := batcher.NewBatch(ctx)
+
+	newLabels := make(labels.Set, len(delta.Mapping))
+	for _, newLabel := range delta.Mapping {
+		newLabels[newLabel] = struct{}{}
+	}
+	renumbered := make(map[uint64]ElementsNR)
+	var mod DeltaModifyElements
+	for oldLabel, newLabel := range delta.Mapping {
+		tk := NewLabelTKey(oldLabel)
+		elems, err := getElementsNR(ctx, tk)
+		if err != nil {
+			return fmt.Errorf("unable to get annotation elements for instance %q, label %d in syncRenumber: %v", d.DataName(), oldLabel, err)
+		}
+		if len(elems) == 0 {
+			continue
+		}
+		if _, reused := newLabels[oldLabel]; !reused {
+			batch.Delete(tk)
+		}
+		renumbered[newLabel] = elems
+
+		// for labelsz.
+		for _, elem := range elems {
+			mod.Add = append(mod.Add, ElementPos{Label: newLabel, Kind: elem.Kind, Pos: elem.Pos})
+			mod.Del = append(mod.Del, ElementPos{Label: oldLabel, Kind: elem.Kind, Pos: elem.Pos})
+		}
+	}
+	for newLabel := range newLabels {
+		tk := NewLabelTKey(newLabel)
+		elems, found := renumbered[newLabel]
+		if !found {
+			if _, reused := delta.Mapping[newLabel]; reused {
+				batch.Delete(tk) // elements of old label were moved and nothing replaces them.
+			}
+			continue
+		}
+		val, err := json.Marshal(elems)
+		if err != nil {
+			return fmt.Errorf("couldn't serialize annotation elements in instance %q: %v", d.DataName(), err)
+		}
+		batch.Put(tk, val)
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("unable to commit renumber for instance %q: %v", d.DataName(), err)
+	}
+
+	// Notify any subscribers of label annotation changes.
+	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
+	msg := datastore.SyncMessage{Event: ModifyElementsEvent, Version: ctx.VersionID(), Delta: mod}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Criticalf("unable to notify subscribers of event %s: %v\n", evt, err)
+	}
+	timedLog.Infof("Renumbered %d labels with elements for annotation %q", len(renumbered), d.DataName())
+	return nil
+}
+
 func (d *Data) cleaveLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, op labels.CleaveOp) error {
 	// d.Lock()
 	// defer d.Unlock()
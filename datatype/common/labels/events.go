@@ -65,6 +65,15 @@ type SplitSupervoxelOp struct {
 	Split            dvid.BlockRLEs
 }
 
+// PaintOp describes the painting of a label into a set of voxels.
+type PaintOp struct {
+	MutID       uint64
+	Label       uint64
+	RLEs        dvid.RLEs
+	Supervoxels Set // supervoxels with overwritten voxels plus the painted label
+	Bodies      Set // bodies of those supervoxels just before the paint
+}
+
 // Affinity represents a float value associated with a two-tuple of labels.
 type Affinity struct {
 	Label1 uint64
@@ -169,6 +178,13 @@ type DeltaSplitEnd struct {
 	NewLabel uint64
 }
 
+// DeltaRenumber is the data sent during a RenumberEvent and gives the new label for
+// each renumbered body.
+type DeltaRenumber struct {
+	MutID   uint64
+	Mapping map[uint64]uint64
+}
+
 // DeltaSparsevol describes a change to an existing label.
 type DeltaSparsevol struct {
 	Label uint64
@@ -196,4 +212,5 @@ const (
 	SupervoxelSplitStartEvent = "SV_SPLIT_START"
 	SupervoxelSplitEvent      = "SV_SPLIT"
 	SupervoxelSplitEndEvent   = "SV_SPLIT_END"
+	RenumberEvent             = "RENUMBER"
 )
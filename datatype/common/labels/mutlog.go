@@ -106,6 +106,28 @@ func LogCleave(d dvid.Data, v dvid.VersionID, op CleaveOp) error {
 	return log.Append(d.DataUUID(), uuid, msg)
 }
 
+// LogPaint logs the painting of a label into a set of voxels.
+func LogPaint(d dvid.Data, v dvid.VersionID, op PaintOp) error {
+	uuid, err := datastore.UUIDFromVersion(v)
+	if err != nil {
+		return err
+	}
+	logable, ok := d.(storage.LogWritable)
+	if !ok {
+		return nil // skip logging
+	}
+	log := logable.GetWriteLog()
+	if log == nil {
+		return nil
+	}
+	data, err := serializePaint(op)
+	if err != nil {
+		return err
+	}
+	msg := storage.LogMessage{EntryType: proto.PaintOpType, Data: data}
+	return log.Append(d.DataUUID(), uuid, msg)
+}
+
 // LogMapping logs the mapping of supervoxels to a label.
 func LogMapping(d dvid.Data, v dvid.VersionID, op MappingOp) error {
 	uuid, err := datastore.UUIDFromVersion(v)
@@ -284,6 +306,29 @@ func serializeCleave(op CleaveOp) (serialization []byte, err error) {
 	return pop.Marshal()
 }
 
+func serializePaint(op PaintOp) (serialization []byte, err error) {
+	rlesBytes, err := op.RLEs.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	supervoxels := make([]uint64, 0, len(op.Supervoxels))
+	for supervoxel := range op.Supervoxels {
+		supervoxels = append(supervoxels, supervoxel)
+	}
+	bodies := make([]uint64, 0, len(op.Bodies))
+	for label := range op.Bodies {
+		bodies = append(bodies, label)
+	}
+	pop := &proto.PaintOp{
+		Mutid:       op.MutID,
+		Label:       op.Label,
+		Rles:        rlesBytes,
+		Supervoxels: supervoxels,
+		Bodies:      bodies,
+	}
+	return pop.Marshal()
+}
+
 func serializeAffinity(aff Affinity) (serialization []byte, err error) {
 	pop := &proto.Affinity{
 		Label1: aff.Label1,
@@ -22,6 +22,7 @@
 		SVCount
 		LabelIndex
 		LabelIndices
+		PaintOp
 */
 package proto
 
@@ -460,6 +461,53 @@ func (m *LabelIndices) GetIndices() []*LabelIndex {
 	return nil
 }
 
+type PaintOp struct {
+	Mutid       uint64   `protobuf:"varint,1,opt,name=mutid,proto3" json:"mutid,omitempty"`
+	Label       uint64   `protobuf:"varint,2,opt,name=label,proto3" json:"label,omitempty"`
+	Rles        []byte   `protobuf:"bytes,3,opt,name=rles,proto3" json:"rles,omitempty"`
+	Supervoxels []uint64 `protobuf:"varint,4,rep,packed,name=supervoxels" json:"supervoxels,omitempty"`
+	Bodies      []uint64 `protobuf:"varint,5,rep,packed,name=bodies" json:"bodies,omitempty"`
+}
+
+func (m *PaintOp) Reset()                    { *m = PaintOp{} }
+func (*PaintOp) ProtoMessage()               {}
+func (*PaintOp) Descriptor() ([]byte, []int) { return fileDescriptorLabelops, []int{14} }
+
+func (m *PaintOp) GetMutid() uint64 {
+	if m != nil {
+		return m.Mutid
+	}
+	return 0
+}
+
+func (m *PaintOp) GetLabel() uint64 {
+	if m != nil {
+		return m.Label
+	}
+	return 0
+}
+
+func (m *PaintOp) GetRles() []byte {
+	if m != nil {
+		return m.Rles
+	}
+	return nil
+}
+
+func (m *PaintOp) GetSupervoxels() []uint64 {
+	if m != nil {
+		return m.Supervoxels
+	}
+	return nil
+}
+
+func (m *PaintOp) GetBodies() []uint64 {
+	if m != nil {
+		return m.Bodies
+	}
+	return nil
+}
+
 func init() {
 	proto1.RegisterType((*MergeOp)(nil), "proto.MergeOp")
 	proto1.RegisterType((*CleaveOp)(nil), "proto.CleaveOp")
@@ -475,6 +523,7 @@ func init() {
 	proto1.RegisterType((*SVCount)(nil), "proto.SVCount")
 	proto1.RegisterType((*LabelIndex)(nil), "proto.LabelIndex")
 	proto1.RegisterType((*LabelIndices)(nil), "proto.LabelIndices")
+	proto1.RegisterType((*PaintOp)(nil), "proto.PaintOp")
 }
 func (this *MergeOp) Equal(that interface{}) bool {
 	if that == nil {
@@ -942,6 +991,52 @@ func (this *LabelIndices) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *PaintOp) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*PaintOp)
+	if !ok {
+		that2, ok := that.(PaintOp)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.Mutid != that1.Mutid {
+		return false
+	}
+	if this.Label != that1.Label {
+		return false
+	}
+	if !bytes.Equal(this.Rles, that1.Rles) {
+		return false
+	}
+	if len(this.Supervoxels) != len(that1.Supervoxels) {
+		return false
+	}
+	for i := range this.Supervoxels {
+		if this.Supervoxels[i] != that1.Supervoxels[i] {
+			return false
+		}
+	}
+	if len(this.Bodies) != len(that1.Bodies) {
+		return false
+	}
+	for i := range this.Bodies {
+		if this.Bodies[i] != that1.Bodies[i] {
+			return false
+		}
+	}
+	return true
+}
 func (this *MergeOp) GoString() string {
 	if this == nil {
 		return "nil"
@@ -1159,6 +1254,20 @@ func (this *LabelIndices) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *PaintOp) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 9)
+	s = append(s, "&proto.PaintOp{")
+	s = append(s, "Mutid: "+fmt.Sprintf("%#v", this.Mutid)+",\n")
+	s = append(s, "Label: "+fmt.Sprintf("%#v", this.Label)+",\n")
+	s = append(s, "Rles: "+fmt.Sprintf("%#v", this.Rles)+",\n")
+	s = append(s, "Supervoxels: "+fmt.Sprintf("%#v", this.Supervoxels)+",\n")
+	s = append(s, "Bodies: "+fmt.Sprintf("%#v", this.Bodies)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func valueToGoStringLabelops(v interface{}, typ string) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -1768,6 +1877,74 @@ func (m *LabelIndices) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func (m *PaintOp) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *PaintOp) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Mutid != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(m.Mutid))
+	}
+	if m.Label != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(m.Label))
+	}
+	if len(m.Rles) > 0 {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(len(m.Rles)))
+		i += copy(dAtA[i:], m.Rles)
+	}
+	if len(m.Supervoxels) > 0 {
+		dAtA14 := make([]byte, len(m.Supervoxels)*10)
+		var j13 int
+		for _, num := range m.Supervoxels {
+			for num >= 1<<7 {
+				dAtA14[j13] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j13++
+			}
+			dAtA14[j13] = uint8(num)
+			j13++
+		}
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(j13))
+		i += copy(dAtA[i:], dAtA14[:j13])
+	}
+	if len(m.Bodies) > 0 {
+		dAtA16 := make([]byte, len(m.Bodies)*10)
+		var j15 int
+		for _, num := range m.Bodies {
+			for num >= 1<<7 {
+				dAtA16[j15] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j15++
+			}
+			dAtA16[j15] = uint8(num)
+			j15++
+		}
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(j15))
+		i += copy(dAtA[i:], dAtA16[:j15])
+	}
+	return i, nil
+}
+
 func encodeVarintLabelops(dAtA []byte, offset int, v uint64) int {
 	for v >= 1<<7 {
 		dAtA[offset] = uint8(v&0x7f | 0x80)
@@ -2040,6 +2217,36 @@ func (m *LabelIndices) Size() (n int) {
 	return n
 }
 
+func (m *PaintOp) Size() (n int) {
+	var l int
+	_ = l
+	if m.Mutid != 0 {
+		n += 1 + sovLabelops(uint64(m.Mutid))
+	}
+	if m.Label != 0 {
+		n += 1 + sovLabelops(uint64(m.Label))
+	}
+	l = len(m.Rles)
+	if l > 0 {
+		n += 1 + l + sovLabelops(uint64(l))
+	}
+	if len(m.Supervoxels) > 0 {
+		l = 0
+		for _, e := range m.Supervoxels {
+			l += sovLabelops(uint64(e))
+		}
+		n += 1 + sovLabelops(uint64(l)) + l
+	}
+	if len(m.Bodies) > 0 {
+		l = 0
+		for _, e := range m.Bodies {
+			l += sovLabelops(uint64(e))
+		}
+		n += 1 + sovLabelops(uint64(l)) + l
+	}
+	return n
+}
+
 func sovLabelops(x uint64) (n int) {
 	for {
 		n++
@@ -2258,6 +2465,20 @@ func (this *LabelIndices) String() string {
 	}, "")
 	return s
 }
+func (this *PaintOp) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&PaintOp{`,
+		`Mutid:` + fmt.Sprintf("%v", this.Mutid) + `,`,
+		`Label:` + fmt.Sprintf("%v", this.Label) + `,`,
+		`Rles:` + fmt.Sprintf("%v", this.Rles) + `,`,
+		`Supervoxels:` + fmt.Sprintf("%v", this.Supervoxels) + `,`,
+		`Bodies:` + fmt.Sprintf("%v", this.Bodies) + `,`,
+		`}`,
+	}, "")
+	return s
+}
 func valueToStringLabelops(v interface{}) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -4331,6 +4552,249 @@ func (m *LabelIndices) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *PaintOp) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowLabelops
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PaintOp: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PaintOp: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Mutid", wireType)
+			}
+			m.Mutid = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Mutid |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Label", wireType)
+			}
+			m.Label = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Label |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rles", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Rles = append(m.Rles[:0], dAtA[iNdEx:postIndex]...)
+			if m.Rles == nil {
+				m.Rles = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType == 0 {
+				var v uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowLabelops
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.Supervoxels = append(m.Supervoxels, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowLabelops
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= (int(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthLabelops
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowLabelops
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= (uint64(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.Supervoxels = append(m.Supervoxels, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Supervoxels", wireType)
+			}
+		case 5:
+			if wireType == 0 {
+				var v uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowLabelops
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.Bodies = append(m.Bodies, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowLabelops
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= (int(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthLabelops
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowLabelops
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= (uint64(b) & 0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.Bodies = append(m.Bodies, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Bodies", wireType)
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipLabelops(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipLabelops(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -4439,53 +4903,54 @@ var (
 func init() { proto1.RegisterFile("labelops.proto", fileDescriptorLabelops) }
 
 var fileDescriptorLabelops = []byte{
-	// 759 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0x4d, 0x4f, 0xdb, 0x4a,
-	0x14, 0x8d, 0xf3, 0x9d, 0x9b, 0x04, 0xc1, 0x08, 0x3d, 0x59, 0xd1, 0x7b, 0x7e, 0x96, 0x55, 0xa9,
-	0x91, 0x8a, 0x22, 0x35, 0x15, 0x12, 0xd0, 0x15, 0xd0, 0x2e, 0x10, 0x8d, 0xa8, 0x0c, 0x74, 0x8b,
-	0x9c, 0x78, 0x88, 0x46, 0xf8, 0x63, 0xe4, 0x19, 0xa7, 0xb0, 0xeb, 0xaa, 0x9b, 0x6e, 0x2a, 0xf5,
-	0x4f, 0x74, 0xd5, 0xdf, 0xd1, 0x25, 0xcb, 0x2e, 0x4b, 0xba, 0xe9, 0x92, 0x9f, 0x50, 0xcd, 0x87,
-	0x8d, 0x53, 0x28, 0x15, 0x1b, 0x67, 0xce, 0xbd, 0xe7, 0xde, 0x7b, 0x7c, 0x7c, 0x27, 0xb0, 0x14,
-	0x78, 0x63, 0x1c, 0xc4, 0x94, 0x0d, 0x68, 0x12, 0xf3, 0x18, 0xd5, 0xe4, 0x8f, 0x73, 0x00, 0x8d,
-	0x11, 0x4e, 0xa6, 0xf8, 0x80, 0xa2, 0x55, 0xa8, 0x85, 0x29, 0x27, 0xbe, 0x69, 0xd8, 0x46, 0xbf,
-	0xea, 0x2a, 0x80, 0xfe, 0x81, 0x3a, 0xf7, 0x92, 0x29, 0xe6, 0x66, 0x59, 0x86, 0x35, 0x12, 0xf1,
-	0x50, 0x14, 0xfa, 0x66, 0xc5, 0xae, 0x88, 0xb8, 0x42, 0xce, 0x0c, 0x9a, 0xbb, 0x01, 0xf6, 0x66,
-	0x0f, 0xef, 0xe8, 0x40, 0x67, 0x22, 0x2b, 0x7d, 0x29, 0xd5, 0xac, 0xc8, 0xec, 0x42, 0x0c, 0x99,
-	0xd0, 0xd0, 0xd8, 0xac, 0xca, 0xb1, 0x19, 0x74, 0x8e, 0xa1, 0x35, 0xf2, 0x28, 0x25, 0xd1, 0xf4,
-	0xbe, 0xc1, 0xa1, 0x47, 0x29, 0xf6, 0xb3, 0xc1, 0x0a, 0xa1, 0x1e, 0x34, 0xe3, 0x84, 0x4c, 0x49,
-	0xe4, 0x05, 0xfa, 0x65, 0x72, 0xec, 0x6c, 0x01, 0xe4, 0x6d, 0x19, 0x5a, 0x83, 0x66, 0xa8, 0x10,
-	0x33, 0x0d, 0xbb, 0xd2, 0x6f, 0x0f, 0x97, 0x95, 0x9d, 0x83, 0x9c, 0xe4, 0xe6, 0x0c, 0xe7, 0x7d,
-	0x19, 0x1a, 0x87, 0x34, 0x20, 0xfc, 0xc1, 0x56, 0xf4, 0xa0, 0x19, 0xe1, 0xb7, 0x45, 0x1b, 0x72,
-	0x2c, 0x6a, 0x26, 0xb1, 0x97, 0x30, 0x6c, 0x56, 0x6d, 0xa3, 0xdf, 0x74, 0x35, 0x42, 0x08, 0xaa,
-	0x49, 0x80, 0x99, 0x59, 0xb3, 0x8d, 0x7e, 0xc7, 0x95, 0x67, 0xb4, 0x01, 0x4d, 0x36, 0x63, 0x42,
-	0x02, 0x33, 0xeb, 0x52, 0xef, 0xbf, 0x5a, 0xaf, 0xd6, 0x35, 0x38, 0xd4, 0xe9, 0x97, 0x11, 0x4f,
-	0x2e, 0xdc, 0x9c, 0xdd, 0xdb, 0x87, 0xee, 0x42, 0x0a, 0x2d, 0x43, 0xe5, 0x0c, 0x5f, 0x68, 0xf9,
-	0xe2, 0x88, 0x1e, 0x41, 0x6d, 0xe6, 0x05, 0x29, 0x96, 0xda, 0xdb, 0xc3, 0xa5, 0xac, 0xf3, 0x1b,
-	0xd9, 0xdb, 0x55, 0xc9, 0xad, 0xf2, 0x86, 0xe1, 0xec, 0x43, 0x43, 0x47, 0x91, 0x05, 0x20, 0xbb,
-	0xaa, 0x77, 0x53, 0xdd, 0x0a, 0x11, 0x64, 0x43, 0x3b, 0xc1, 0xa1, 0x47, 0x22, 0x45, 0x50, 0xb6,
-	0x14, 0x43, 0xce, 0x07, 0x03, 0x56, 0x0e, 0x53, 0x8a, 0x93, 0x59, 0x7c, 0x8e, 0x83, 0xfb, 0xfd,
-	0x15, 0xd3, 0x72, 0xaa, 0x6e, 0x56, 0x88, 0xfc, 0xa6, 0xa6, 0xf2, 0x37, 0x35, 0xd5, 0xdb, 0x6a,
-	0x36, 0xa1, 0x7d, 0x40, 0x77, 0xe3, 0x90, 0x06, 0x98, 0x63, 0xff, 0x0f, 0x32, 0x56, 0xa1, 0xc6,
-	0xb8, 0x37, 0x55, 0x4e, 0xb5, 0x5c, 0x05, 0x9c, 0xd7, 0xd0, 0xdc, 0x3e, 0x3d, 0x25, 0x11, 0xe1,
-	0x17, 0xe2, 0xa3, 0xca, 0x7e, 0x4f, 0x75, 0xa1, 0x46, 0x79, 0x7c, 0x98, 0x2d, 0x88, 0x42, 0xa2,
-	0xa3, 0xf2, 0x5e, 0x68, 0x2e, 0x6b, 0xaf, 0x9d, 0x17, 0x00, 0xba, 0x23, 0xc1, 0x2c, 0xaf, 0x55,
-	0xab, 0x9a, 0xd5, 0x32, 0xf1, 0xd2, 0x5e, 0xce, 0x32, 0xcb, 0x76, 0xa5, 0x5f, 0x76, 0x0b, 0x11,
-	0xe7, 0x93, 0x01, 0xdd, 0x4c, 0xd8, 0x91, 0x37, 0x0e, 0x30, 0x5a, 0x87, 0x1a, 0x17, 0x07, 0xbd,
-	0xf3, 0xff, 0xeb, 0x2f, 0xbd, 0x40, 0x1a, 0xc8, 0xa7, 0x5a, 0x23, 0xc5, 0xee, 0xed, 0x03, 0xdc,
-	0x04, 0xef, 0x58, 0xa0, 0xc7, 0x8b, 0x0b, 0xb4, 0xb2, 0xd8, 0x96, 0x60, 0x56, 0xdc, 0xa1, 0x73,
-	0xb1, 0x43, 0xbb, 0x71, 0x1a, 0x71, 0x34, 0x14, 0x37, 0x20, 0x8d, 0x78, 0x76, 0x07, 0x7b, 0xf9,
-	0xe6, 0xc9, 0xfc, 0x40, 0x3e, 0xf5, 0x46, 0x6b, 0x66, 0x6f, 0x13, 0xda, 0x85, 0xf0, 0x1d, 0x62,
-	0x56, 0x8b, 0x62, 0xba, 0xc5, 0xc9, 0x5f, 0xca, 0x00, 0xaf, 0x84, 0x75, 0x7b, 0x91, 0x8f, 0xcf,
-	0xd1, 0x3a, 0xd4, 0xc7, 0x41, 0x3c, 0x39, 0xcb, 0xa6, 0xff, 0xa7, 0xa7, 0xdf, 0x50, 0x06, 0x3b,
-	0x32, 0xaf, 0x05, 0x28, 0xb2, 0xe8, 0x5f, 0x5c, 0x69, 0x05, 0x90, 0x05, 0xed, 0xc0, 0x63, 0xfc,
-	0x24, 0x4c, 0xf9, 0x09, 0xf1, 0xf5, 0x06, 0xb6, 0x44, 0x68, 0x94, 0xf2, 0x3d, 0x1f, 0x39, 0xd0,
-	0x55, 0xf9, 0xd8, 0x3f, 0xe1, 0x24, 0x54, 0x77, 0xbe, 0xe5, 0xca, 0xa2, 0x51, 0xec, 0x1f, 0x91,
-	0x10, 0x2f, 0x70, 0x52, 0x86, 0x13, 0xf9, 0x0f, 0x70, 0xc3, 0x39, 0x66, 0x38, 0x41, 0x36, 0x74,
-	0x72, 0x8e, 0x47, 0xa9, 0x59, 0x97, 0x14, 0xd0, 0x94, 0x6d, 0x4a, 0x7b, 0x7b, 0xd0, 0x2e, 0xc8,
-	0x7e, 0xc8, 0x75, 0x97, 0xbe, 0x16, 0x0d, 0x7b, 0x0e, 0x9d, 0xcc, 0x0c, 0x32, 0xc1, 0x0c, 0x3d,
-	0x81, 0x06, 0x51, 0x47, 0x6d, 0xd9, 0xca, 0x2d, 0xcb, 0xdc, 0x8c, 0xb1, 0xb3, 0x76, 0x79, 0x65,
-	0x95, 0xbe, 0x5d, 0x59, 0xa5, 0xeb, 0x2b, 0xcb, 0x78, 0x37, 0xb7, 0x8c, 0xcf, 0x73, 0xcb, 0xf8,
-	0x3a, 0xb7, 0x8c, 0xcb, 0xb9, 0x65, 0x7c, 0x9f, 0x5b, 0xc6, 0xcf, 0xb9, 0x55, 0xba, 0x9e, 0x5b,
-	0xc6, 0xc7, 0x1f, 0x56, 0x69, 0x5c, 0x97, 0x8d, 0x9e, 0xfd, 0x0a, 0x00, 0x00, 0xff, 0xff, 0xc5,
-	0x62, 0xdc, 0x21, 0xde, 0x06, 0x00, 0x00,
+	// 784 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x95, 0x55, 0x4d, 0x6b, 0x13, 0x41,
+	0x18, 0xee, 0xe6, 0x3b, 0x6f, 0x12, 0x69, 0x87, 0x22, 0x4b, 0xd0, 0x58, 0x16, 0xc1, 0x82, 0x25,
+	0x60, 0x44, 0xa8, 0xf5, 0xd4, 0x56, 0x0f, 0xa5, 0x86, 0x96, 0x6d, 0xeb, 0xb5, 0x6c, 0xb2, 0xd3,
+	0xb0, 0x74, 0xbf, 0xd8, 0x9d, 0xc4, 0xf6, 0x26, 0x08, 0x5e, 0xbc, 0x08, 0xfe, 0x09, 0x4f, 0xfe,
+	0x0e, 0x8f, 0x3d, 0x7a, 0xb4, 0xf5, 0xe2, 0xd1, 0x9f, 0xe0, 0x3b, 0x1f, 0xbb, 0x99, 0xd8, 0x58,
+	0xe9, 0x61, 0x36, 0xf3, 0x3e, 0xf3, 0xcc, 0x3b, 0xcf, 0x3e, 0xfb, 0xbe, 0x13, 0xb8, 0xe3, 0x3b,
+	0x03, 0xea, 0x47, 0x71, 0xda, 0x8d, 0x93, 0x88, 0x45, 0xa4, 0x2c, 0x7e, 0xac, 0x3d, 0xa8, 0xf6,
+	0x69, 0x32, 0xa2, 0x7b, 0x31, 0x59, 0x86, 0x72, 0x30, 0x66, 0x9e, 0x6b, 0x1a, 0x2b, 0xc6, 0x6a,
+	0xc9, 0x96, 0x01, 0xb9, 0x0b, 0x15, 0xe6, 0x20, 0x81, 0x99, 0x05, 0x01, 0xab, 0x88, 0xe3, 0x01,
+	0xdf, 0xe8, 0x9a, 0xc5, 0x95, 0x22, 0xc7, 0x65, 0x64, 0x4d, 0xa0, 0xb6, 0xed, 0x53, 0x67, 0x72,
+	0xfb, 0x8c, 0x16, 0x34, 0x87, 0x62, 0xa7, 0x2b, 0xa4, 0x62, 0x5e, 0xbe, 0x3a, 0x83, 0x11, 0x13,
+	0xaa, 0x2a, 0x36, 0x4b, 0xe2, 0xd8, 0x2c, 0xb4, 0x8e, 0xa0, 0xde, 0x77, 0xe2, 0xd8, 0x0b, 0x47,
+	0x37, 0x1d, 0x1c, 0x20, 0x05, 0xf7, 0xaa, 0x83, 0x65, 0x44, 0xda, 0x50, 0x8b, 0x12, 0x6f, 0xe4,
+	0x85, 0x8e, 0xaf, 0x5e, 0x26, 0x8f, 0xad, 0x0d, 0x80, 0x3c, 0x6d, 0x4a, 0xd6, 0xa0, 0x16, 0xc8,
+	0x28, 0xc5, 0xd4, 0xc5, 0xd5, 0x46, 0x6f, 0x51, 0xda, 0xd9, 0xcd, 0x49, 0x76, 0xce, 0xb0, 0x3e,
+	0x14, 0xa0, 0x7a, 0x10, 0xfb, 0x1e, 0xbb, 0xb5, 0x15, 0xa8, 0x28, 0xa4, 0x6f, 0x75, 0x1b, 0xf2,
+	0x98, 0xef, 0x19, 0x46, 0x4e, 0x92, 0x52, 0x74, 0xc0, 0x58, 0xad, 0xd9, 0x2a, 0x22, 0x04, 0x4a,
+	0x89, 0x4f, 0x53, 0xb3, 0x8c, 0x68, 0xd3, 0x16, 0x73, 0xb2, 0x0e, 0xb5, 0x74, 0x92, 0x72, 0x09,
+	0xa9, 0x59, 0x11, 0x7a, 0xef, 0x29, 0xbd, 0x4a, 0x57, 0xf7, 0x40, 0x2d, 0xbf, 0x0a, 0x59, 0x72,
+	0x6e, 0xe7, 0xec, 0xf6, 0x2e, 0xb4, 0x66, 0x96, 0xc8, 0x22, 0x14, 0x4f, 0xe9, 0xb9, 0x92, 0xcf,
+	0xa7, 0xe4, 0x21, 0x94, 0x27, 0x8e, 0x3f, 0xa6, 0x42, 0x7b, 0xa3, 0x77, 0x27, 0xcb, 0xfc, 0x46,
+	0xe4, 0xb6, 0xe5, 0xe2, 0x46, 0x61, 0xdd, 0xb0, 0x76, 0xd1, 0x07, 0x89, 0x92, 0x0e, 0x80, 0xc8,
+	0x2a, 0xdf, 0x4d, 0x66, 0xd3, 0x10, 0xb2, 0x02, 0x8d, 0x84, 0x06, 0x8e, 0x17, 0x4a, 0x82, 0xb4,
+	0x45, 0x87, 0xac, 0x8f, 0x06, 0x2c, 0x1d, 0x8c, 0x63, 0x9a, 0x4c, 0xa2, 0x33, 0xea, 0xdf, 0xec,
+	0x2f, 0x3f, 0x2d, 0xa7, 0xaa, 0x64, 0x1a, 0xf2, 0x97, 0x9a, 0xe2, 0xff, 0xd4, 0x94, 0xae, 0xab,
+	0x79, 0x0e, 0x8d, 0xbd, 0x78, 0x3b, 0x0a, 0x62, 0x9f, 0x32, 0x2c, 0xa5, 0xf9, 0x32, 0x10, 0x4d,
+	0x99, 0x33, 0x92, 0x4e, 0xd5, 0x6d, 0x19, 0x58, 0xfb, 0x50, 0xdb, 0x3c, 0x39, 0xf1, 0x42, 0x8f,
+	0x9d, 0xf3, 0x8f, 0x2a, 0xf2, 0x3d, 0x51, 0x1b, 0x55, 0x94, 0xe3, 0xbd, 0xac, 0x40, 0x64, 0xc4,
+	0x33, 0x4a, 0xef, 0xb9, 0xe6, 0x82, 0xf2, 0xda, 0x7a, 0x09, 0xa0, 0x32, 0x7a, 0xf8, 0xf1, 0xb3,
+	0xbd, 0xb2, 0x54, 0xb3, 0xbd, 0x29, 0x7f, 0x69, 0x27, 0x67, 0x61, 0xde, 0x22, 0x26, 0xd0, 0x10,
+	0xeb, 0xb3, 0x01, 0xad, 0x4c, 0xd8, 0xa1, 0x33, 0xf0, 0x29, 0x79, 0x06, 0x65, 0xc6, 0x27, 0xaa,
+	0xe6, 0x1f, 0xa8, 0x2f, 0x3d, 0x43, 0xea, 0x8a, 0xa7, 0x2c, 0x23, 0xc9, 0xc6, 0x1a, 0x82, 0x29,
+	0x38, 0xa7, 0x80, 0x1e, 0xcd, 0x16, 0xd0, 0xd2, 0x6c, 0x5a, 0x94, 0xa2, 0xd7, 0xd0, 0x19, 0xaf,
+	0xa1, 0xed, 0x68, 0x1c, 0x32, 0xd2, 0xe3, 0x1d, 0x80, 0x93, 0xac, 0x07, 0xdb, 0x79, 0xe5, 0x89,
+	0xf5, 0xae, 0x78, 0xaa, 0x8a, 0x56, 0xcc, 0x36, 0x7e, 0x27, 0x0d, 0x9e, 0x23, 0x66, 0x59, 0x17,
+	0xd3, 0xd2, 0x4f, 0xfe, 0x5a, 0x00, 0x78, 0xcd, 0xad, 0xdb, 0x09, 0x5d, 0x7a, 0x86, 0x66, 0x54,
+	0x06, 0x7e, 0x34, 0x3c, 0xcd, 0x4e, 0xbf, 0xaf, 0x4e, 0x9f, 0x52, 0xba, 0x5b, 0x62, 0x5d, 0x09,
+	0x90, 0x64, 0x9e, 0x5f, 0x2f, 0x69, 0x19, 0xe0, 0xb7, 0x68, 0xf8, 0x4e, 0xca, 0x8e, 0xb1, 0x4e,
+	0x8e, 0x3d, 0x57, 0x55, 0x60, 0x9d, 0x43, 0xfd, 0x31, 0xdb, 0x71, 0xf1, 0x4e, 0x6c, 0xc9, 0xf5,
+	0xc8, 0x3d, 0x66, 0x5e, 0x20, 0x7b, 0xbe, 0x6e, 0x8b, 0x4d, 0xfd, 0xc8, 0x3d, 0x44, 0x68, 0x86,
+	0x33, 0x4e, 0x69, 0x22, 0x6e, 0x80, 0x29, 0xe7, 0x08, 0x21, 0x2c, 0xe4, 0x66, 0xce, 0xc1, 0xeb,
+	0x09, 0x2f, 0x03, 0x4e, 0x01, 0x45, 0xd9, 0x8c, 0xe3, 0xf6, 0x0e, 0x34, 0x34, 0xd9, 0xb7, 0x69,
+	0x77, 0xe1, 0xab, 0x6e, 0xd8, 0x0b, 0x68, 0x66, 0x66, 0x78, 0x43, 0x2c, 0xc4, 0xc7, 0x50, 0xf5,
+	0xe4, 0x54, 0x59, 0xb6, 0x74, 0xcd, 0x32, 0x3b, 0x63, 0x58, 0xef, 0x0d, 0xa8, 0xee, 0x63, 0x7b,
+	0xfd, 0xbb, 0xa9, 0xe7, 0x3b, 0x99, 0x5d, 0x7f, 0x45, 0xed, 0xfa, 0xc3, 0xf6, 0x9d, 0x36, 0x7b,
+	0xaa, 0xfe, 0x31, 0x74, 0x88, 0xf7, 0xc8, 0x20, 0x72, 0x3d, 0x71, 0x6d, 0x8a, 0x1e, 0x91, 0xd1,
+	0xd6, 0xda, 0xc5, 0x65, 0x67, 0xe1, 0x3b, 0x8e, 0xdf, 0x97, 0x1d, 0xe3, 0xdd, 0x55, 0xc7, 0xf8,
+	0x82, 0xe3, 0x1b, 0x8e, 0x0b, 0x1c, 0x3f, 0x70, 0xfc, 0xba, 0xc2, 0x35, 0xfc, 0xfd, 0xf4, 0xb3,
+	0xb3, 0x30, 0xa8, 0x88, 0xd7, 0x79, 0xfa, 0x07, 0x3c, 0x80, 0xb5, 0x96, 0x64, 0x07, 0x00, 0x00,
 }
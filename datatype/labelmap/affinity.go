@@ -0,0 +1,271 @@
+/*
+	This file supports merge suggestions from supervoxel pair affinities.  Affinities are
+	stored per supervoxel so candidates for a body can be found through its supervoxels,
+	and accept/reject decisions are stored under both supervoxels of a pair so the decided
+	partners of a supervoxel are read with one range scan and aren't suggested again in
+	this or descendant versions.
+*/
+
+package labelmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// only one affinity load at a time since each does read-modify-write of supervoxel affinities.
+var affinityMu sync.Mutex
+
+// MergeCandidate is a body suggested for merging with a query body.  The affinity is the
+// highest of all undecided supervoxel pairs between the two bodies.
+type MergeCandidate struct {
+	Body              uint64
+	Affinity          float32
+	Supervoxel        uint64 // supervoxel of query body in highest affinity pair
+	PartnerSupervoxel uint64 // supervoxel of candidate body in highest affinity pair
+	Pairs             int    // number of undecided supervoxel pairs between the bodies
+}
+
+// MergeDecision records whether a proposed merge of a supervoxel pair was accepted or rejected.
+type MergeDecision struct {
+	Supervoxel1 uint64
+	Supervoxel2 uint64
+	Decision    string // "accept" or "reject"
+	User        string `json:",omitempty"`
+	Time        string `json:",omitempty"`
+}
+
+func (d *Data) getAffinities(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, supervoxel uint64) (map[uint64]float32, error) {
+	data, err := store.Get(ctx, NewSupervoxelAffinitiesTKey(supervoxel))
+	if err != nil {
+		return nil, err
+	}
+	affs := make(map[uint64]float32)
+	if len(data) == 0 {
+		return affs, nil
+	}
+	var paffs proto.Affinities
+	if err := paffs.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("bad affinities for supervoxel %d in data %q: %v", supervoxel, d.DataName(), err)
+	}
+	if len(paffs.Labels) != len(paffs.Affinities) {
+		return nil, fmt.Errorf("affinities for supervoxel %d in data %q have %d labels and %d values", supervoxel, d.DataName(), len(paffs.Labels), len(paffs.Affinities))
+	}
+	for i, partner := range paffs.Labels {
+		affs[partner] = paffs.Affinities[i]
+	}
+	return affs, nil
+}
+
+func (d *Data) putAffinities(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, supervoxel uint64, affs map[uint64]float32) error {
+	var paffs proto.Affinities
+	paffs.Labels = make([]uint64, 0, len(affs))
+	for partner := range affs {
+		paffs.Labels = append(paffs.Labels, partner)
+	}
+	sort.Slice(paffs.Labels, func(i, j int) bool { return paffs.Labels[i] < paffs.Labels[j] })
+	paffs.Affinities = make([]float32, len(paffs.Labels))
+	for i, partner := range paffs.Labels {
+		paffs.Affinities[i] = affs[partner]
+	}
+	data, err := paffs.Marshal()
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, NewSupervoxelAffinitiesTKey(supervoxel), data)
+}
+
+// PutAffinities stores the affinities of supervoxel pairs, replacing any previous affinity
+// for a pair.  Affinities are symmetric so each pair is stored under both supervoxels.
+func (d *Data) PutAffinities(v dvid.VersionID, affs []labels.Affinity) error {
+	updates := make(map[uint64]map[uint64]float32)
+	for _, aff := range affs {
+		if aff.Label1 == 0 || aff.Label2 == 0 || aff.Label1 == aff.Label2 {
+			return fmt.Errorf("bad affinity pair (%d, %d): supervoxels must be different and non-zero", aff.Label1, aff.Label2)
+		}
+		for _, pair := range [][2]uint64{{aff.Label1, aff.Label2}, {aff.Label2, aff.Label1}} {
+			partners, found := updates[pair[0]]
+			if !found {
+				partners = make(map[uint64]float32)
+				updates[pair[0]] = partners
+			}
+			partners[pair[1]] = aff.Value
+		}
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+
+	affinityMu.Lock()
+	defer affinityMu.Unlock()
+
+	for supervoxel, partners := range updates {
+		stored, err := d.getAffinities(ctx, store, supervoxel)
+		if err != nil {
+			return err
+		}
+		for partner, value := range partners {
+			stored[partner] = value
+		}
+		if err := d.putAffinities(ctx, store, supervoxel, stored); err != nil {
+			return err
+		}
+	}
+	for _, aff := range affs {
+		if err := labels.LogAffinity(d, v, aff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutMergeDecisions records accept or reject decisions for supervoxel pairs so they are
+// no longer suggested as merge candidates.
+func (d *Data) PutMergeDecisions(v dvid.VersionID, decisions []MergeDecision, info dvid.ModInfo) error {
+	for _, decision := range decisions {
+		if decision.Supervoxel1 == 0 || decision.Supervoxel2 == 0 || decision.Supervoxel1 == decision.Supervoxel2 {
+			return fmt.Errorf("bad merge decision pair (%d, %d): supervoxels must be different and non-zero", decision.Supervoxel1, decision.Supervoxel2)
+		}
+		if decision.Decision != "accept" && decision.Decision != "reject" {
+			return fmt.Errorf("merge decision for pair (%d, %d) must be \"accept\" or \"reject\", not %q", decision.Supervoxel1, decision.Supervoxel2, decision.Decision)
+		}
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	for _, decision := range decisions {
+		decision.User = info.User
+		decision.Time = info.Time
+		data, err := json.Marshal(decision)
+		if err != nil {
+			return err
+		}
+		if err := store.Put(ctx, NewMergeDecisionTKey(decision.Supervoxel1, decision.Supervoxel2), data); err != nil {
+			return err
+		}
+		if err := store.Put(ctx, NewMergeDecisionTKey(decision.Supervoxel2, decision.Supervoxel1), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getDecidedPartners returns the supervoxels with a recorded merge decision for the given
+// supervoxel using a single range scan.
+func (d *Data) getDecidedPartners(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, supervoxel uint64) (labels.Set, error) {
+	begTKey, endTKey := MergeDecisionTKeyRange(supervoxel)
+	tkeys, err := store.KeysInRange(ctx, begTKey, endTKey)
+	if err != nil {
+		return nil, err
+	}
+	decided := make(labels.Set, len(tkeys))
+	for _, tk := range tkeys {
+		_, partner, err := DecodeMergeDecisionTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		decided[partner] = struct{}{}
+	}
+	return decided, nil
+}
+
+// GetMergeCandidates returns up to n bodies with the highest affinity to the given body,
+// using the current supervoxel mappings and skipping supervoxel pairs with recorded
+// decisions or affinities below minAffinity.  If n is 0, all candidates are returned.
+// Returns nil if the body is not found.
+func (d *Data) GetMergeCandidates(v dvid.VersionID, label uint64, n int, minAffinity float32) ([]MergeCandidate, error) {
+	supervoxels, err := d.GetSupervoxels(v, label)
+	if err != nil {
+		return nil, err
+	}
+	if supervoxels == nil {
+		return nil, nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+
+	type svPair struct {
+		supervoxel, partner uint64
+		value               float32
+	}
+	var pairs []svPair
+	var partners []uint64
+	for supervoxel := range supervoxels {
+		affs, err := d.getAffinities(ctx, store, supervoxel)
+		if err != nil {
+			return nil, err
+		}
+		if len(affs) == 0 {
+			continue
+		}
+		decided, err := d.getDecidedPartners(ctx, store, supervoxel)
+		if err != nil {
+			return nil, err
+		}
+		for partner, value := range affs {
+			if _, inBody := supervoxels[partner]; inBody || value < minAffinity {
+				continue
+			}
+			if _, isDecided := decided[partner]; isDecided {
+				continue
+			}
+			pairs = append(pairs, svPair{supervoxel, partner, value})
+			partners = append(partners, partner)
+		}
+	}
+	svm, err := getMapping(d, v)
+	if err != nil {
+		return nil, err
+	}
+	bodies, _, err := svm.MappedLabels(v, partners)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make(map[uint64]*MergeCandidate)
+	for i, pair := range pairs {
+		body := bodies[i]
+		if body == 0 || body == label {
+			continue
+		}
+		candidate, found := candidates[body]
+		if !found {
+			candidate = &MergeCandidate{Body: body}
+			candidates[body] = candidate
+		}
+		candidate.Pairs++
+		if !found || pair.value > candidate.Affinity {
+			candidate.Affinity = pair.value
+			candidate.Supervoxel = pair.supervoxel
+			candidate.PartnerSupervoxel = pair.partner
+		}
+	}
+	result := make([]MergeCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		result = append(result, *candidate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Affinity != result[j].Affinity {
+			return result[i].Affinity > result[j].Affinity
+		}
+		return result[i].Body < result[j].Body
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result, nil
+}
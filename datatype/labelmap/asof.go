@@ -0,0 +1,213 @@
+/*
+	This file supports reads of labels and mappings as of a given mutation ID within a
+	version.  The state is reconstructed by replaying the logged mapping ops of the version
+	up to that mutation on top of the mapping of ancestor versions.  Voxels painted after
+	that mutation can't be reconstructed since their prior labels aren't logged.
+*/
+
+package labelmap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// asofState holds the mutation log of a version needed to reconstruct the mapping as of
+// a given mutation ID.
+type asofState struct {
+	v    dvid.VersionID
+	asof uint64
+	muts []loggedMutation
+
+	// supervoxels created by splits after the asof mutation, mapped to the supervoxel
+	// they were split from.
+	unsplit map[uint64]uint64
+
+	// voxels painted after the asof mutation, keyed by the paint mutation ID.
+	painted map[uint64]dvid.RLEs
+}
+
+func (d *Data) getAsofState(v dvid.VersionID, asof uint64) (*asofState, error) {
+	muts, err := d.readMutationLog(v)
+	if err != nil {
+		return nil, err
+	}
+	s := &asofState{
+		v:       v,
+		asof:    asof,
+		muts:    muts,
+		unsplit: make(map[uint64]uint64),
+		painted: make(map[uint64]dvid.RLEs),
+	}
+	for _, mut := range muts {
+		if mut.mutID <= asof {
+			continue
+		}
+		switch {
+		case mut.svsplit != nil:
+			s.unsplit[mut.svsplit.Splitlabel] = mut.svsplit.Supervoxel
+			s.unsplit[mut.svsplit.Remainlabel] = mut.svsplit.Supervoxel
+		case mut.split != nil:
+			for orig, svsplit := range mut.split.Svsplits {
+				s.unsplit[svsplit.Splitlabel] = orig
+				s.unsplit[svsplit.Remainlabel] = orig
+			}
+		case mut.paint != nil:
+			var rles dvid.RLEs
+			if err := rles.UnmarshalBinary(mut.paint.Rles); err != nil {
+				return nil, fmt.Errorf("unable to decode logged paint of mutation %d: %v", mut.mutID, err)
+			}
+			s.painted[mut.mutID] = rles
+		}
+	}
+	return s, nil
+}
+
+// originalSupervoxel returns the supervoxel existing as of the asof mutation that contains
+// the given current supervoxel.
+func (s *asofState) originalSupervoxel(supervoxel uint64) uint64 {
+	for i := 0; i <= len(s.unsplit); i++ {
+		orig, found := s.unsplit[supervoxel]
+		if !found {
+			break
+		}
+		supervoxel = orig
+	}
+	return supervoxel
+}
+
+// checkPainted returns an error if any of the given points at the given scale covers a voxel
+// painted after the asof mutation.
+func (s *asofState) checkPainted(pts []dvid.Point3d, scale uint8) error {
+	size := int32(1) << scale
+	for mutID, rles := range s.painted {
+		for _, pt := range pts {
+			minPt := dvid.Point3d{pt[0] * size, pt[1] * size, pt[2] * size}
+			maxPt := dvid.Point3d{minPt[0] + size - 1, minPt[1] + size - 1, minPt[2] + size - 1}
+			for _, rle := range rles {
+				start := rle.StartPt()
+				if start[1] < minPt[1] || start[1] > maxPt[1] || start[2] < minPt[2] || start[2] > maxPt[2] {
+					continue
+				}
+				if start[0] <= maxPt[0] && start[0]+rle.Length()-1 >= minPt[0] {
+					return fmt.Errorf("voxels at %s were painted by mutation %d after mutation %d and their prior labels are unknown", pt, mutID, s.asof)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// asofMappedLabels returns the body label of each supervoxel as of the asof mutation.
+// Supervoxels that did not exist at that time are mapped to 0.
+func (d *Data) asofMappedLabels(s *asofState, supervoxels []uint64) ([]uint64, error) {
+	svset := make(labels.Set, len(supervoxels))
+	for _, supervoxel := range supervoxels {
+		if supervoxel != 0 {
+			svset[supervoxel] = struct{}{}
+		}
+	}
+	labelmap, err := d.premutationLabels(s.v, s.muts, s.asof+1, svset)
+	if err != nil {
+		return nil, err
+	}
+	mapped := make([]uint64, len(supervoxels))
+	for i, supervoxel := range supervoxels {
+		if _, created := s.unsplit[supervoxel]; !created {
+			mapped[i] = labelmap[supervoxel]
+		}
+	}
+	return mapped, nil
+}
+
+// GetMappedLabelsAsOf returns the body label of each supervoxel as of the given mutation ID
+// in version v.  Supervoxels that did not exist at that time are mapped to 0.
+func (d *Data) GetMappedLabelsAsOf(v dvid.VersionID, asof uint64, supervoxels []uint64) ([]uint64, error) {
+	s, err := d.getAsofState(v, asof)
+	if err != nil {
+		return nil, err
+	}
+	return d.asofMappedLabels(s, supervoxels)
+}
+
+// GetLabelPointsAsOf returns the labels at the given points as of the given mutation ID in
+// version v.  If isSupervoxel is true, the supervoxels as of that mutation are returned.
+// An error is returned if any point was painted after that mutation.
+func (d *Data) GetLabelPointsAsOf(v dvid.VersionID, pts []dvid.Point3d, scale uint8, isSupervoxel bool, asof uint64) ([]uint64, error) {
+	s, err := d.getAsofState(v, asof)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPainted(pts, scale); err != nil {
+		return nil, err
+	}
+	supervoxels, err := d.GetLabelPoints(v, pts, scale, true)
+	if err != nil {
+		return nil, err
+	}
+	for i, supervoxel := range supervoxels {
+		supervoxels[i] = s.originalSupervoxel(supervoxel)
+	}
+	if isSupervoxel {
+		return supervoxels, nil
+	}
+	return d.asofMappedLabels(s, supervoxels)
+}
+
+// GetSupervoxelsAsOf returns the supervoxels of a body as of the given mutation ID in
+// version v.  Candidates are the current supervoxels of the body and all supervoxels
+// touched by later mutations, which are kept if they mapped to the body at that time.
+func (d *Data) GetSupervoxelsAsOf(v dvid.VersionID, asof uint64, label uint64) (labels.Set, error) {
+	s, err := d.getAsofState(v, asof)
+	if err != nil {
+		return nil, err
+	}
+	current, err := d.indexedSupervoxels(v, label)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make(labels.Set, len(current))
+	for supervoxel := range current {
+		candidates[s.originalSupervoxel(supervoxel)] = struct{}{}
+	}
+	for _, mut := range s.muts {
+		if mut.mutID <= asof {
+			continue
+		}
+		for supervoxel := range mut.supervoxels {
+			candidates[s.originalSupervoxel(supervoxel)] = struct{}{}
+		}
+	}
+	svlist := make([]uint64, 0, len(candidates))
+	for supervoxel := range candidates {
+		svlist = append(svlist, supervoxel)
+	}
+	mapped, err := d.asofMappedLabels(s, svlist)
+	if err != nil {
+		return nil, err
+	}
+	supervoxels := make(labels.Set)
+	for i, supervoxel := range svlist {
+		if mapped[i] == label {
+			supervoxels[supervoxel] = struct{}{}
+		}
+	}
+	return supervoxels, nil
+}
+
+// getAsOf returns the mutation ID of an "asof" query string if present.
+func getAsOf(queryStrings url.Values) (asof uint64, found bool, err error) {
+	asofStr := queryStrings.Get("asof")
+	if asofStr == "" {
+		return
+	}
+	if asof, err = strconv.ParseUint(asofStr, 10, 64); err != nil {
+		return
+	}
+	found = true
+	return
+}
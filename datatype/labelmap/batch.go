@@ -0,0 +1,517 @@
+/*
+	This file supports atomic batches of merge, cleave and supervoxel split mutations.  All
+	operations in a batch are validated against the current label state before any is applied,
+	and if an operation fails during application, the already applied operations of the batch
+	are reversed via the undo machinery.  Other label mutations are blocked while a batch is
+	applied, and the kafka, sync and stream events of the batch are only sent once all its
+	operations have been applied.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// BatchMutation is one operation within a mutation batch.  The fields used depend on
+// the Action, which is "merge", "cleave" or "split-supervoxel".
+type BatchMutation struct {
+	Action string
+
+	// merge of Labels into Target
+	Target uint64
+	Labels []uint64
+
+	// cleave of Supervoxels from Label into CleavedLabel, which is chosen if zero.
+	Label        uint64
+	CleavedLabel uint64
+	Supervoxels  []uint64
+
+	// split of Supervoxel where SplitLabel and RemainLabel are chosen if zero.  The Split
+	// sparse volume uses the binary RLE format of the "split-supervoxel" endpoint.
+	Supervoxel  uint64
+	SplitLabel  uint64
+	RemainLabel uint64
+	Split       []byte
+
+	split dvid.RLEs
+}
+
+// BatchResult gives the mutation ID and any new labels for an operation in a mutation batch.
+type BatchResult struct {
+	Action           string
+	MutationID       uint64
+	CleavedLabel     uint64 `json:",omitempty"`
+	SplitSupervoxel  uint64 `json:",omitempty"`
+	RemainSupervoxel uint64 `json:",omitempty"`
+}
+
+// deferredEvents holds the kafka messages, sync notifications, stream publications and JSON
+// mutation log entries of mutations so they can be sent after all mutations of a batch are
+// applied or dropped if the batch is rolled back.  A nil *deferredEvents sends immediately.
+type deferredEvents struct {
+	sends []func()
+}
+
+func (e *deferredEvents) add(send func()) {
+	e.sends = append(e.sends, send)
+}
+
+// send sends all deferred events in the order they were added.
+func (e *deferredEvents) send() {
+	for _, send := range e.sends {
+		send()
+	}
+	e.sends = nil
+}
+
+func (e *deferredEvents) produceKafkaMsg(d *Data, msg []byte) error {
+	if e == nil {
+		return d.ProduceKafkaMsg(msg)
+	}
+	e.add(func() {
+		if err := d.ProduceKafkaMsg(msg); err != nil {
+			dvid.Errorf("can't send deferred mutation message for %q to kafka: %v\n", d.DataName(), err)
+		}
+	})
+	return nil
+}
+
+func (e *deferredEvents) notifySubscribers(evt datastore.SyncEvent, msg datastore.SyncMessage) error {
+	if e == nil {
+		return datastore.NotifySubscribers(evt, msg)
+	}
+	e.add(func() {
+		if err := datastore.NotifySubscribers(evt, msg); err != nil {
+			dvid.Errorf("can't notify subscribers for deferred event %v: %v\n", evt, err)
+		}
+	})
+	return nil
+}
+
+func (e *deferredEvents) publishMutation(d *Data, v dvid.VersionID, action string, mutID uint64, user string, msg []byte, bodies ...uint64) {
+	if e == nil {
+		d.publishMutation(v, action, mutID, user, msg, bodies...)
+		return
+	}
+	e.add(func() {
+		d.publishMutation(v, action, mutID, user, msg, bodies...)
+	})
+}
+
+func (e *deferredEvents) logJSONMutation(d *Data, versionuuid dvid.UUID, msg []byte) {
+	logMutation := func() {
+		if err := server.LogJSONMutation(versionuuid, d.DataUUID(), msg); err != nil {
+			dvid.Criticalf("can't log mutation to data %q, version %s: %s\n", d.DataName(), versionuuid, msg)
+		}
+	}
+	if e == nil {
+		logMutation()
+	} else {
+		e.add(logMutation)
+	}
+}
+
+// batchState tracks the supervoxels of bodies as a batch of operations is validated,
+// loading label indices from the store as bodies are first referenced.
+type batchState struct {
+	d       *Data
+	v       dvid.VersionID
+	mapping *SVMap
+
+	bodies map[uint64]labels.Set // a nil set means the body doesn't exist
+	svBody map[uint64]uint64     // a zero body means the supervoxel was split
+	svSize map[uint64]uint64
+
+	touched labels.Set // bodies referenced by operations, checked for leases
+
+	// Labels to be chosen are given placeholder labels during validation so no labels are
+	// allocated for a rejected batch.  Requested labels only update the max label after
+	// validation.
+	placeholders    []*uint64
+	nextPlaceholder uint64
+	requested       []uint64
+}
+
+// newLabel returns a requested label after checking it or, if the requested label is zero,
+// a placeholder label to be replaced by a new label after the whole batch is validated.
+func (s *batchState) newLabel(requested uint64, isSupervoxel bool, label *uint64) error {
+	if requested != 0 {
+		if err := s.checkNewLabel(requested, isSupervoxel); err != nil {
+			return err
+		}
+		s.requested = append(s.requested, requested)
+		*label = requested
+		return nil
+	}
+	for {
+		s.nextPlaceholder--
+		_, isBody := s.bodies[s.nextPlaceholder]
+		_, isSupervoxel := s.svBody[s.nextPlaceholder]
+		if !isBody && !isSupervoxel {
+			break
+		}
+	}
+	*label = s.nextPlaceholder
+	s.placeholders = append(s.placeholders, label)
+	return nil
+}
+
+// allocateLabels replaces placeholder labels with new labels and updates the max label with
+// any requested labels.
+func (s *batchState) allocateLabels() error {
+	for _, label := range s.requested {
+		if _, err := s.d.updateMaxLabel(s.v, label); err != nil {
+			return err
+		}
+	}
+	if len(s.placeholders) == 0 {
+		return nil
+	}
+	begin, _, err := s.d.newLabels(s.v, uint64(len(s.placeholders)))
+	if err != nil {
+		return err
+	}
+	for i, label := range s.placeholders {
+		*label = begin + uint64(i)
+	}
+	return nil
+}
+
+func (s *batchState) getBody(label uint64) (labels.Set, error) {
+	if svs, found := s.bodies[label]; found {
+		return svs, nil
+	}
+	idx, err := GetLabelIndex(s.d, s.v, label, false)
+	if err != nil {
+		return nil, err
+	}
+	var svs labels.Set
+	if idx != nil && len(idx.Blocks) != 0 {
+		svs = idx.GetSupervoxels()
+		for sv, count := range idx.GetSupervoxelCounts() {
+			s.svBody[sv] = label
+			s.svSize[sv] = count
+		}
+	}
+	s.bodies[label] = svs
+	return svs, nil
+}
+
+func (s *batchState) getSupervoxelBody(sv uint64) (uint64, error) {
+	if label, found := s.svBody[sv]; found {
+		if label == 0 {
+			return 0, fmt.Errorf("supervoxel %d was split earlier in the batch", sv)
+		}
+		return label, nil
+	}
+	label := sv
+	if mapped, found := s.mapping.MappedLabel(s.v, sv); found {
+		if mapped == 0 {
+			return 0, fmt.Errorf("supervoxel %d has been split and doesn't exist anymore", sv)
+		}
+		label = mapped
+	}
+	svs, err := s.getBody(label)
+	if err != nil {
+		return 0, err
+	}
+	if _, found := svs[sv]; !found {
+		return 0, fmt.Errorf("supervoxel %d does not exist", sv)
+	}
+	return label, nil
+}
+
+// checkNewLabel makes sure a requested label isn't a current body or, for supervoxel labels,
+// a current supervoxel.
+func (s *batchState) checkNewLabel(label uint64, isSupervoxel bool) error {
+	svs, err := s.getBody(label)
+	if err != nil {
+		return err
+	}
+	if len(svs) != 0 {
+		return fmt.Errorf("label %d already exists", label)
+	}
+	if _, found := s.svBody[label]; found && isSupervoxel {
+		return fmt.Errorf("label %d is already used for a supervoxel", label)
+	}
+	return nil
+}
+
+func (s *batchState) validateMerge(op *BatchMutation) error {
+	if op.Target == 0 || len(op.Labels) == 0 {
+		return fmt.Errorf("merge requires non-zero Target and at least one label in Labels")
+	}
+	targetSVs, err := s.getBody(op.Target)
+	if err != nil {
+		return err
+	}
+	s.touched[op.Target] = struct{}{}
+	if len(targetSVs) == 0 {
+		return fmt.Errorf("can't merge into a non-existent label %d", op.Target)
+	}
+	merged := make(labels.Set, len(op.Labels))
+	for _, label := range op.Labels {
+		if label == 0 || label == op.Target {
+			return fmt.Errorf("can't merge label %d into label %d", label, op.Target)
+		}
+		if _, found := merged[label]; found {
+			return fmt.Errorf("label %d is given more than once in merge", label)
+		}
+		svs, err := s.getBody(label)
+		if err != nil {
+			return err
+		}
+		if len(svs) == 0 {
+			return fmt.Errorf("can't merge non-existent label %d", label)
+		}
+		merged[label] = struct{}{}
+		s.touched[label] = struct{}{}
+	}
+	for label := range merged {
+		for sv := range s.bodies[label] {
+			targetSVs[sv] = struct{}{}
+			s.svBody[sv] = op.Target
+		}
+		s.bodies[label] = nil
+	}
+	return nil
+}
+
+func (s *batchState) validateCleave(op *BatchMutation) error {
+	if op.Label == 0 || len(op.Supervoxels) == 0 {
+		return fmt.Errorf("cleave requires non-zero Label and at least one supervoxel in Supervoxels")
+	}
+	svs, err := s.getBody(op.Label)
+	if err != nil {
+		return err
+	}
+	if len(svs) == 0 {
+		return fmt.Errorf("cannot cleave non-existent label %d", op.Label)
+	}
+	s.touched[op.Label] = struct{}{}
+	cleaved := make(labels.Set, len(op.Supervoxels))
+	for _, sv := range op.Supervoxels {
+		if _, found := svs[sv]; !found {
+			return fmt.Errorf("cannot cleave supervoxel %d, which does not exist in label %d", sv, op.Label)
+		}
+		cleaved[sv] = struct{}{}
+	}
+	if len(cleaved) == len(svs) {
+		return fmt.Errorf("cannot cleave all supervoxels from the label %d", op.Label)
+	}
+	if err := s.newLabel(op.CleavedLabel, false, &op.CleavedLabel); err != nil {
+		return err
+	}
+	for sv := range cleaved {
+		delete(svs, sv)
+		s.svBody[sv] = op.CleavedLabel
+	}
+	s.bodies[op.CleavedLabel] = cleaved
+	return nil
+}
+
+func (s *batchState) validateSupervoxelSplit(op *BatchMutation) error {
+	if op.Supervoxel == 0 || len(op.Split) == 0 {
+		return fmt.Errorf("split-supervoxel requires non-zero Supervoxel and a Split sparse volume")
+	}
+	label, err := s.getSupervoxelBody(op.Supervoxel)
+	if err != nil {
+		return err
+	}
+	s.touched[label] = struct{}{}
+	if op.split, err = dvid.ReadRLEs(bytes.NewBuffer(op.Split)); err != nil {
+		return fmt.Errorf("bad split sparse volume for supervoxel %d: %v", op.Supervoxel, err)
+	}
+	splitSize, _ := op.split.Stats()
+	svSize := s.svSize[op.Supervoxel]
+	if splitSize > svSize {
+		return fmt.Errorf("split volume of %d > %d of supervoxel %d", splitSize, svSize, op.Supervoxel)
+	}
+	if op.SplitLabel != 0 && op.SplitLabel == op.RemainLabel {
+		return fmt.Errorf("split and remain labels must differ, got %d for both", op.SplitLabel)
+	}
+	for _, newLabel := range []*uint64{&op.SplitLabel, &op.RemainLabel} {
+		if err := s.newLabel(*newLabel, true, newLabel); err != nil {
+			return err
+		}
+	}
+	svs := s.bodies[label]
+	delete(svs, op.Supervoxel)
+	svs[op.SplitLabel] = struct{}{}
+	svs[op.RemainLabel] = struct{}{}
+	s.svBody[op.Supervoxel] = 0
+	s.svBody[op.SplitLabel] = label
+	s.svBody[op.RemainLabel] = label
+	s.svSize[op.SplitLabel] = splitSize
+	s.svSize[op.RemainLabel] = svSize - splitSize
+	return nil
+}
+
+// validateBatch checks all operations of a batch in order, simulating the effect of each
+// operation on the bodies, and checks that no body referenced by the operations is leased by
+// a user other than the given user.  Only if all are valid are new labels assigned for any
+// labels not specified in the operations.
+func (d *Data) validateBatch(v dvid.VersionID, ops []BatchMutation, user string) error {
+	mapping, err := getMapping(d, v)
+	if err != nil {
+		return err
+	}
+	s := batchState{
+		d:       d,
+		v:       v,
+		mapping: mapping,
+		bodies:  make(map[uint64]labels.Set),
+		svBody:  make(map[uint64]uint64),
+		svSize:  make(map[uint64]uint64),
+		touched: make(labels.Set),
+
+		nextPlaceholder: math.MaxUint64,
+	}
+	for i := range ops {
+		op := &ops[i]
+		switch op.Action {
+		case "merge":
+			err = s.validateMerge(op)
+		case "cleave":
+			err = s.validateCleave(op)
+		case "split-supervoxel":
+			err = s.validateSupervoxelSplit(op)
+		default:
+			err = fmt.Errorf("unknown action %q", op.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("batch operation %d (%s): %v", i, op.Action, err)
+		}
+	}
+
+	// placeholders count down from the max label so bodies created by the batch are skipped.
+	bodies := make([]uint64, 0, len(s.touched))
+	for label := range s.touched {
+		if label < s.nextPlaceholder {
+			bodies = append(bodies, label)
+		}
+	}
+	if err := d.checkBodyLeases(v, user, bodies...); err != nil {
+		return err
+	}
+	return s.allocateLabels()
+}
+
+// ApplyMutationBatch validates a batch of merge, cleave and supervoxel split operations and
+// then applies them in order using a contiguous range of mutation IDs.  If any operation
+// fails, the operations already applied are reversed so either all or none of the batch
+// changes the label indices, mapping and blocks.  Since the reversal uses the mutation log,
+// a batch is refused if the data has no mutation log.  The batch is refused with a
+// LeaseConflictError if any body referenced by its operations is leased by another user.
+// No other label mutation can run while the batch is applied, and events for the batch are
+// only sent after all operations succeed.
+func (d *Data) ApplyMutationBatch(v dvid.VersionID, ops []BatchMutation, info dvid.ModInfo) (results []BatchResult, err error) {
+	if len(ops) == 0 {
+		err = fmt.Errorf("no operations given in mutation batch")
+		return
+	}
+	if err = d.checkMutationLog(); err != nil {
+		return
+	}
+	undoMu.Lock()
+	defer undoMu.Unlock()
+
+	d.mutationMu.Lock()
+	defer d.mutationMu.Unlock()
+
+	timedLog := dvid.NewTimeLog()
+	if err = d.validateBatch(v, ops, info.User); err != nil {
+		return
+	}
+
+	firstID := d.NewMutationIDs(uint64(len(ops)))
+	evts := new(deferredEvents)
+	results = make([]BatchResult, len(ops))
+	for i, op := range ops {
+		mutID := firstID + uint64(i)
+		results[i] = BatchResult{Action: op.Action, MutationID: mutID}
+		switch op.Action {
+		case "merge":
+			mergeOp := labels.MergeOp{Target: op.Target, Merged: make(labels.Set, len(op.Labels))}
+			for _, label := range op.Labels {
+				mergeOp.Merged[label] = struct{}{}
+			}
+			err = d.mergeLabels(v, mergeOp, mutID, info, evts)
+		case "cleave":
+			results[i].CleavedLabel = op.CleavedLabel
+			err = d.cleaveLabel(v, mutID, op.Label, op.CleavedLabel, op.Supervoxels, info, evts)
+		case "split-supervoxel":
+			results[i].SplitSupervoxel = op.SplitLabel
+			results[i].RemainSupervoxel = op.RemainLabel
+			err = d.splitSupervoxel(v, mutID, op.Supervoxel, op.SplitLabel, op.RemainLabel, op.split, info, true, evts)
+		}
+		if err != nil {
+			// events of the applied operations and their reversals are dropped since
+			// neither is visible outside the batch.
+			err = fmt.Errorf("batch operation %d (%s) failed: %v", i, op.Action, err)
+			if rollbackErr := d.rollbackBatch(v, firstID, len(ops), i, info, evts); rollbackErr != nil {
+				err = fmt.Errorf("%v; rollback of prior operations failed: %v", err, rollbackErr)
+			}
+			results = nil
+			return
+		}
+	}
+
+	evts.send()
+	mutIDs := make([]uint64, len(ops))
+	for i := range mutIDs {
+		mutIDs[i] = firstID + uint64(i)
+	}
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":      "mutations-batch",
+		"MutationIDs": mutIDs,
+		"UUID":        string(versionuuid),
+		"Timestamp":   time.Now().String(),
+	}
+	if info.User != "" {
+		msginfo["User"] = info.User
+	}
+	if info.App != "" {
+		msginfo["App"] = info.App
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending mutations-batch op to kafka: %v\n", err)
+	}
+	timedLog.Infof("Applied batch of %d mutations (ids %d-%d) for data %q", len(ops), firstID, firstID+uint64(len(ops))-1, d.DataName())
+	return
+}
+
+// rollbackBatch reverses the first numApplied operations of a batch in reverse order.
+// Mutations of the batch and the reversals themselves are not considered conflicts, and
+// leases aren't checked since they were checked before the batch was applied.
+// The caller must hold the write lock on mutationMu so no other mutation can conflict.
+func (d *Data) rollbackBatch(v dvid.VersionID, firstID uint64, numOps, numApplied int, info dvid.ModInfo, evts *deferredEvents) error {
+	ignore := make(map[uint64]struct{}, numOps)
+	for i := 0; i < numOps; i++ {
+		ignore[firstID+uint64(i)] = struct{}{}
+	}
+	for i := numApplied - 1; i >= 0; i-- {
+		mutID := firstID + uint64(i)
+		undoIDs, err := d.undoMutation(v, mutID, ignore, false, info, evts)
+		if err != nil {
+			return fmt.Errorf("unable to reverse mutation %d: %v", mutID, err)
+		}
+		for _, undoID := range undoIDs {
+			ignore[undoID] = struct{}{}
+		}
+	}
+	dvid.Infof("Rolled back %d applied operations of failed mutation batch starting at mutation %d\n", numApplied, firstID)
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+	This file supports voxel-precise bounding boxes, centroids, and anchor points of bodies.
+	The label index gives the blocks of a body so only the blocks on the faces of the
+	block bounding box and the block with the most voxels need to be read.
+*/
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// BodyBBox gives the extent and representative points of a body.  The Centroid is
+// computed from per-block voxel counts using block centers, while the Anchor is a voxel
+// guaranteed to be within the body.
+type BodyBBox struct {
+	Label    uint64
+	Voxels   uint64
+	MinVoxel dvid.Point3d
+	MaxVoxel dvid.Point3d
+	Centroid [3]float64
+	Anchor   dvid.Point3d
+}
+
+// GetBodyBBox returns the bounding box, centroid, and anchor point of a body, or nil if the
+// label is not found.  If isSupervoxel is true, the label is interpreted as a supervoxel id.
+func (d *Data) GetBodyBBox(ctx *datastore.VersionedCtx, label uint64, isSupervoxel bool) (*BodyBBox, error) {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't compute bounding box because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	idx, err := GetLabelIndex(d, ctx.VersionID(), label, isSupervoxel)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	var supervoxels labels.Set
+	if isSupervoxel {
+		if idx, err = idx.LimitToSupervoxel(label); err != nil {
+			return nil, err
+		}
+		if idx == nil || len(idx.Blocks) == 0 {
+			return nil, nil
+		}
+		supervoxels = labels.Set{label: struct{}{}}
+	} else {
+		supervoxels = idx.GetSupervoxels()
+	}
+
+	// get block bounds, block-weighted centroid, and block with most voxels.
+	bbox := &BodyBBox{Label: label}
+	zyxs := make([]uint64, 0, len(idx.Blocks))
+	for zyx := range idx.Blocks {
+		zyxs = append(zyxs, zyx)
+	}
+	sort.Slice(zyxs, func(i, j int) bool { return zyxs[i] < zyxs[j] })
+	var minBlock, maxBlock dvid.Point3d
+	var anchorZYX uint64
+	var anchorCount uint64
+	var sums [3]float64
+	for i, zyx := range zyxs {
+		var count uint64
+		if svc := idx.Blocks[zyx]; svc != nil {
+			for _, n := range svc.Counts {
+				count += uint64(n)
+			}
+		}
+		x, y, z := labels.DecodeBlockIndex(zyx)
+		bcoord := dvid.Point3d{x, y, z}
+		for dim := 0; dim < 3; dim++ {
+			if i == 0 || bcoord[dim] < minBlock[dim] {
+				minBlock[dim] = bcoord[dim]
+			}
+			if i == 0 || bcoord[dim] > maxBlock[dim] {
+				maxBlock[dim] = bcoord[dim]
+			}
+			center := float64(bcoord[dim]*blockSize[dim]) + float64(blockSize[dim]-1)/2
+			sums[dim] += center * float64(count)
+		}
+		if count > anchorCount {
+			anchorZYX, anchorCount = zyx, count
+		}
+		bbox.Voxels += count
+	}
+	if bbox.Voxels == 0 {
+		return nil, nil
+	}
+	for dim := 0; dim < 3; dim++ {
+		bbox.Centroid[dim] = sums[dim] / float64(bbox.Voxels)
+	}
+
+	// refine bounding box using blocks on the faces of the block bounds.
+	for dim := 0; dim < 3; dim++ {
+		bbox.MinVoxel[dim] = (maxBlock[dim]+1)*blockSize[dim] - 1
+		bbox.MaxVoxel[dim] = minBlock[dim] * blockSize[dim]
+	}
+	var anchorFound bool
+	for _, zyx := range zyxs {
+		x, y, z := labels.DecodeBlockIndex(zyx)
+		bcoord := dvid.Point3d{x, y, z}
+		var boundary bool
+		for dim := 0; dim < 3; dim++ {
+			if bcoord[dim] == minBlock[dim] || bcoord[dim] == maxBlock[dim] {
+				boundary = true
+			}
+		}
+		isAnchor := zyx == anchorZYX
+		if !boundary && !isAnchor {
+			continue
+		}
+		pb, err := d.getLabelBlock(ctx, 0, labels.BlockIndexToIZYXString(zyx))
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			return nil, fmt.Errorf("label %d index has block %s that is not stored", label, bcoord)
+		}
+		data, _ := pb.Block.MakeLabelVolume()
+		offset := dvid.Point3d{x * blockSize[0], y * blockSize[1], z * blockSize[2]}
+		var inBlock []dvid.Point3d
+		var i int
+		for vz := int32(0); vz < blockSize[2]; vz++ {
+			for vy := int32(0); vy < blockSize[1]; vy++ {
+				for vx := int32(0); vx < blockSize[0]; vx++ {
+					sv := binary.LittleEndian.Uint64(data[i : i+8])
+					i += 8
+					if _, found := supervoxels[sv]; !found {
+						continue
+					}
+					pt := dvid.Point3d{offset[0] + vx, offset[1] + vy, offset[2] + vz}
+					for dim := 0; dim < 3; dim++ {
+						if pt[dim] < bbox.MinVoxel[dim] {
+							bbox.MinVoxel[dim] = pt[dim]
+						}
+						if pt[dim] > bbox.MaxVoxel[dim] {
+							bbox.MaxVoxel[dim] = pt[dim]
+						}
+					}
+					if isAnchor {
+						inBlock = append(inBlock, pt)
+					}
+				}
+			}
+		}
+		if isAnchor && len(inBlock) != 0 {
+			bbox.Anchor = nearestVoxel(inBlock)
+			anchorFound = true
+		}
+	}
+	if !anchorFound {
+		return nil, fmt.Errorf("label %d index has voxels in block %s not found in stored block", label, labels.BlockIndexToIZYXString(anchorZYX))
+	}
+	return bbox, nil
+}
+
+// nearestVoxel returns the voxel closest to the mean of the given voxels.
+func nearestVoxel(pts []dvid.Point3d) dvid.Point3d {
+	var mean [3]float64
+	for _, pt := range pts {
+		for dim := 0; dim < 3; dim++ {
+			mean[dim] += float64(pt[dim])
+		}
+	}
+	for dim := 0; dim < 3; dim++ {
+		mean[dim] /= float64(len(pts))
+	}
+	var nearest dvid.Point3d
+	minDist := -1.0
+	for _, pt := range pts {
+		var dist float64
+		for dim := 0; dim < 3; dim++ {
+			delta := float64(pt[dim]) - mean[dim]
+			dist += delta * delta
+		}
+		if minDist < 0 || dist < minDist {
+			nearest, minDist = pt, dist
+		}
+	}
+	return nearest
+}
+
+// GetBodyBBoxes returns the bounding boxes of the given labels, with nil for labels that
+// are not found.
+func (d *Data) GetBodyBBoxes(ctx *datastore.VersionedCtx, lbls []uint64, isSupervoxel bool) ([]*BodyBBox, error) {
+	bboxes := make([]*BodyBBox, len(lbls))
+	for i, label := range lbls {
+		if label == 0 {
+			continue
+		}
+		bbox, err := d.GetBodyBBox(ctx, label, isSupervoxel)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get bounding box of label %d: %v", label, err)
+		}
+		bboxes[i] = bbox
+	}
+	return bboxes, nil
+}
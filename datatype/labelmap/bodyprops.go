@@ -0,0 +1,311 @@
+/*
+	This file supports per-body JSON properties, e.g., status, owner or notes, that are kept
+	with the label and follow body mutations.  On merge, properties are combined using the
+	instance's BodyPropsMerge rule, and undoing the merge restores the properties each body
+	had before it.  Cleaved or split bodies get a copy of the original body's properties,
+	and renumbered bodies keep their properties under the new label.
+*/
+
+package labelmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// Rules for combining body properties on merge.
+const (
+	// BodyPropsKeepTarget keeps only the merge target's properties.  This is the default.
+	BodyPropsKeepTarget = "target"
+
+	// BodyPropsUnion adds properties of merged bodies not present in the target, with the
+	// target's values taking precedence followed by larger bodies.
+	BodyPropsUnion = "union"
+
+	// BodyPropsKeepLarger keeps the properties of the body with the most voxels.
+	BodyPropsKeepLarger = "larger"
+)
+
+// BodyProps is a set of JSON properties for a body.
+type BodyProps map[string]json.RawMessage
+
+// only one read-modify-write of body properties at a time.
+var bodyPropsMu sync.Mutex
+
+func checkBodyPropsMerge(rule string) error {
+	switch rule {
+	case "", BodyPropsKeepTarget, BodyPropsUnion, BodyPropsKeepLarger:
+		return nil
+	default:
+		return fmt.Errorf("unknown body properties merge rule %q, must be %q, %q or %q", rule, BodyPropsKeepTarget, BodyPropsUnion, BodyPropsKeepLarger)
+	}
+}
+
+// GetBodyProps returns the properties of a body or nil if it has none.
+func (d *Data) GetBodyProps(v dvid.VersionID, label uint64) (BodyProps, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Get(datastore.NewVersionedCtx(d, v), NewBodyPropsTKey(label))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var props BodyProps
+	if err := json.Unmarshal(data, &props); err != nil {
+		return nil, fmt.Errorf("bad properties for body %d in data %q: %v", label, d.DataName(), err)
+	}
+	return props, nil
+}
+
+// PutBodyProps replaces the properties of a body.  Empty properties are deleted.
+func (d *Data) PutBodyProps(v dvid.VersionID, label uint64, props BodyProps) error {
+	bodyPropsMu.Lock()
+	defer bodyPropsMu.Unlock()
+	return d.putBodyProps(v, label, props)
+}
+
+func (d *Data) putBodyProps(v dvid.VersionID, label uint64, props BodyProps) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	if len(props) == 0 {
+		return store.Delete(ctx, NewBodyPropsTKey(label))
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, NewBodyPropsTKey(label), data)
+}
+
+// mergeBodyProps combines the properties of merged bodies into the target using the
+// instance's merge rule and deletes the merged bodies' properties.  The properties before
+// the merge are kept in the undo record of the merge mutation so they can be restored if
+// the merge is undone.  It must be called before the label indices of the merged bodies
+// are combined.
+func (d *Data) mergeBodyProps(v dvid.VersionID, mutID, target uint64, merged []uint64) error {
+	bodyPropsMu.Lock()
+	defer bodyPropsMu.Unlock()
+
+	targetProps, err := d.GetBodyProps(v, target)
+	if err != nil {
+		return err
+	}
+	mergedProps := make(map[uint64]BodyProps, len(merged))
+	for _, label := range merged {
+		props, err := d.GetBodyProps(v, label)
+		if err != nil {
+			return err
+		}
+		if props != nil {
+			mergedProps[label] = props
+		}
+	}
+	if targetProps != nil || len(mergedProps) != 0 {
+		prior := make(map[uint64]BodyProps, len(merged)+1)
+		prior[target] = targetProps
+		for _, label := range merged {
+			prior[label] = mergedProps[label]
+		}
+		rec := &undoRecord{MutID: mutID, Action: "merge", BodyProps: prior}
+		if err := d.putUndoRecord(v, rec); err != nil {
+			return err
+		}
+	}
+	if len(mergedProps) == 0 {
+		return nil
+	}
+
+	// order merged bodies by decreasing size so larger bodies take precedence.
+	ordered := []uint64{target}
+	for label := range mergedProps {
+		ordered = append(ordered, label)
+	}
+	labelSizes, err := GetLabelSizes(d, v, ordered, false)
+	if err != nil {
+		return err
+	}
+	sizes := make(map[uint64]uint64, len(ordered))
+	for i, label := range ordered {
+		sizes[label] = labelSizes[i]
+	}
+	ordered = ordered[1:]
+	sort.Slice(ordered, func(i, j int) bool {
+		if sizes[ordered[i]] != sizes[ordered[j]] {
+			return sizes[ordered[i]] > sizes[ordered[j]]
+		}
+		return ordered[i] < ordered[j]
+	})
+
+	props := targetProps
+	switch d.BodyPropsMerge {
+	case BodyPropsUnion:
+		if props == nil {
+			props = make(BodyProps)
+		}
+		for _, label := range ordered {
+			for key, value := range mergedProps[label] {
+				if _, found := props[key]; !found {
+					props[key] = value
+				}
+			}
+		}
+	case BodyPropsKeepLarger:
+		if largest := ordered[0]; sizes[largest] > sizes[target] {
+			props = mergedProps[largest]
+		}
+	}
+	if err := d.putBodyProps(v, target, props); err != nil {
+		return err
+	}
+	for label := range mergedProps {
+		if err := d.putBodyProps(v, label, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBodyProps replaces the properties of bodies with recorded properties, deleting
+// the properties of bodies recorded without any.
+func (d *Data) restoreBodyProps(v dvid.VersionID, recorded map[uint64]BodyProps) error {
+	bodyPropsMu.Lock()
+	defer bodyPropsMu.Unlock()
+
+	for label, props := range recorded {
+		if err := d.putBodyProps(v, label, props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBodyProps gives a body split off from another a copy of the original's properties.
+func (d *Data) copyBodyProps(v dvid.VersionID, from, to uint64) error {
+	bodyPropsMu.Lock()
+	defer bodyPropsMu.Unlock()
+
+	props, err := d.GetBodyProps(v, from)
+	if err != nil || props == nil {
+		return err
+	}
+	return d.putBodyProps(v, to, props)
+}
+
+// renumberBodyProps moves the properties of renumbered bodies to their new labels.
+func (d *Data) renumberBodyProps(v dvid.VersionID, mapping map[uint64]uint64) error {
+	bodyPropsMu.Lock()
+	defer bodyPropsMu.Unlock()
+
+	moved := make(map[uint64]BodyProps)
+	for oldLabel, newLabel := range mapping {
+		props, err := d.GetBodyProps(v, oldLabel)
+		if err != nil {
+			return err
+		}
+		if props != nil {
+			moved[newLabel] = props
+			if err := d.putBodyProps(v, oldLabel, nil); err != nil {
+				return err
+			}
+		}
+	}
+	for newLabel, props := range moved {
+		if err := d.putBodyProps(v, newLabel, props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Data) handleBodyProps(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET  <api URL>/node/<UUID>/<data name>/body-props
+	// GET  <api URL>/node/<UUID>/<data name>/body-props/<label>
+	// POST <api URL>/node/<UUID>/<data name>/body-props/<label>
+	timedLog := dvid.NewTimeLog()
+	v := ctx.VersionID()
+	action := strings.ToLower(r.Method)
+
+	if len(parts) < 5 {
+		if action != "get" {
+			server.BadRequest(w, r, "batch body-props query must be a GET request")
+			return
+		}
+		var labelList []uint64
+		if err := json.NewDecoder(r.Body).Decode(&labelList); err != nil {
+			server.BadRequest(w, r, "bad JSON list of labels for body-props query: %v", err)
+			return
+		}
+		propsList := make([]BodyProps, len(labelList))
+		for i, label := range labelList {
+			props, err := d.GetBodyProps(v, label)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			propsList[i] = props
+		}
+		w.Header().Set("Content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(propsList); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP GET body properties of %d labels (%s)", len(labelList), r.URL)
+		return
+	}
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot have body properties")
+		return
+	}
+	switch action {
+	case "get":
+		props, err := d.GetBodyProps(v, label)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if props == nil {
+			props = BodyProps{}
+		}
+		w.Header().Set("Content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(props); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	case "post":
+		var props BodyProps
+		if err := json.NewDecoder(r.Body).Decode(&props); err != nil {
+			server.BadRequest(w, r, "body-props POST requires a JSON object: %v", err)
+			return
+		}
+		if err := d.PutBodyProps(v, label, props); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	default:
+		server.BadRequest(w, r, "body-props endpoint only supports GET and POST")
+		return
+	}
+	timedLog.Infof("HTTP %s body properties of label %d (%s)", r.Method, label, r.URL)
+}
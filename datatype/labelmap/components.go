@@ -0,0 +1,323 @@
+/*
+	This file supports finding the 26-connected components of a body and splitting off
+	disconnected fragments by cleaving their supervoxels.
+*/
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// LabelComponent is a 26-connected component of a body at a given scale.
+type LabelComponent struct {
+	Voxels      uint64
+	MinVoxel    dvid.Point3d
+	MaxVoxel    dvid.Point3d
+	Supervoxels []uint64
+}
+
+// ComponentCleave describes a fragment cleaved off a body when splitting components.
+type ComponentCleave struct {
+	CleavedLabel uint64
+	MutationID   uint64
+	Voxels       uint64
+	Supervoxels  []uint64
+}
+
+// MaxComponentBlocks is the maximum number of blocks of a body at the requested scale for
+// which components are found, since all voxels of the body are held in memory.
+const MaxComponentBlocks = 256
+
+type compBlock struct {
+	svs  []uint64 // supervoxels of the body within the block
+	lbls []uint32 // 1 + index into svs for each voxel or 0 if not part of body
+	comp []int32  // component of each voxel or -1 if unassigned
+}
+
+// compVolume holds the voxels of a body in blocks for connected component labeling.
+type compVolume struct {
+	blockSize dvid.Point3d
+	blocks    map[dvid.ChunkPoint3d]*compBlock
+}
+
+func (cv *compVolume) addBlock(bcoord dvid.ChunkPoint3d, block *labels.Block, supervoxels labels.Set) {
+	data, size := block.MakeLabelVolume()
+	numVoxels := int(size.Prod())
+	cb := &compBlock{
+		lbls: make([]uint32, numVoxels),
+		comp: make([]int32, numVoxels),
+	}
+	svIndex := make(map[uint64]uint32)
+	for i := 0; i < numVoxels; i++ {
+		cb.comp[i] = -1
+		sv := binary.LittleEndian.Uint64(data[i*8 : i*8+8])
+		if _, in := supervoxels[sv]; !in {
+			continue
+		}
+		index, found := svIndex[sv]
+		if !found {
+			cb.svs = append(cb.svs, sv)
+			index = uint32(len(cb.svs))
+			svIndex[sv] = index
+		}
+		cb.lbls[i] = index
+	}
+	if len(cb.svs) != 0 {
+		cv.blocks[bcoord] = cb
+	}
+}
+
+func (cv *compVolume) locate(pt dvid.Point3d) (*compBlock, int) {
+	bcoord := dvid.ChunkPoint3d{floorDiv(pt[0], cv.blockSize[0]), floorDiv(pt[1], cv.blockSize[1]), floorDiv(pt[2], cv.blockSize[2])}
+	cb, found := cv.blocks[bcoord]
+	if !found {
+		return nil, 0
+	}
+	bx, by, bz := pt[0]-bcoord[0]*cv.blockSize[0], pt[1]-bcoord[1]*cv.blockSize[1], pt[2]-bcoord[2]*cv.blockSize[2]
+	return cb, int((bz*cv.blockSize[1]+by)*cv.blockSize[0] + bx)
+}
+
+// label flood fills all 26-connected components in a deterministic order.
+func (cv *compVolume) label() []LabelComponent {
+	bcoords := make([]dvid.ChunkPoint3d, 0, len(cv.blocks))
+	for bcoord := range cv.blocks {
+		bcoords = append(bcoords, bcoord)
+	}
+	sort.Slice(bcoords, func(i, j int) bool {
+		a, b := bcoords[i], bcoords[j]
+		if a[2] != b[2] {
+			return a[2] < b[2]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+	var components []LabelComponent
+	var stack []dvid.Point3d
+	for _, bcoord := range bcoords {
+		cb := cv.blocks[bcoord]
+		x0, y0, z0 := bcoord[0]*cv.blockSize[0], bcoord[1]*cv.blockSize[1], bcoord[2]*cv.blockSize[2]
+		var i int
+		for z := int32(0); z < cv.blockSize[2]; z++ {
+			for y := int32(0); y < cv.blockSize[1]; y++ {
+				for x := int32(0); x < cv.blockSize[0]; x++ {
+					if cb.lbls[i] == 0 || cb.comp[i] >= 0 {
+						i++
+						continue
+					}
+					compID := int32(len(components))
+					seed := dvid.Point3d{x0 + x, y0 + y, z0 + z}
+					comp := LabelComponent{MinVoxel: seed, MaxVoxel: seed}
+					svs := make(labels.Set)
+					cb.comp[i] = compID
+					stack = append(stack[:0], seed)
+					for len(stack) > 0 {
+						pt := stack[len(stack)-1]
+						stack = stack[:len(stack)-1]
+						ptBlock, pos := cv.locate(pt)
+						svs[ptBlock.svs[ptBlock.lbls[pos]-1]] = struct{}{}
+						comp.Voxels++
+						for dim := 0; dim < 3; dim++ {
+							if pt[dim] < comp.MinVoxel[dim] {
+								comp.MinVoxel[dim] = pt[dim]
+							}
+							if pt[dim] > comp.MaxVoxel[dim] {
+								comp.MaxVoxel[dim] = pt[dim]
+							}
+						}
+						for _, offset := range skelNbrOffsets {
+							nbr := dvid.Point3d{pt[0] + offset[0], pt[1] + offset[1], pt[2] + offset[2]}
+							nbrBlock, nbrPos := cv.locate(nbr)
+							if nbrBlock == nil || nbrBlock.lbls[nbrPos] == 0 || nbrBlock.comp[nbrPos] >= 0 {
+								continue
+							}
+							nbrBlock.comp[nbrPos] = compID
+							stack = append(stack, nbr)
+						}
+					}
+					comp.Supervoxels = make([]uint64, 0, len(svs))
+					for sv := range svs {
+						comp.Supervoxels = append(comp.Supervoxels, sv)
+					}
+					sort.Slice(comp.Supervoxels, func(i, j int) bool { return comp.Supervoxels[i] < comp.Supervoxels[j] })
+					components = append(components, comp)
+					i++
+				}
+			}
+		}
+	}
+	return components
+}
+
+// GetComponents returns the 26-connected components of a body at the given scale sorted by
+// decreasing voxel count, or nil if the body is not found.  An error is returned if the body
+// has more than MaxComponentBlocks blocks at the scale.
+func (d *Data) GetComponents(ctx *datastore.VersionedCtx, label uint64, scale uint8) ([]LabelComponent, error) {
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("scale %d exceeds maximum down-resolution level %d", scale, d.MaxDownresLevel)
+	}
+	timedLog := dvid.NewTimeLog()
+	idx, supervoxels, err := d.getLabelSupervoxels(ctx.VersionID(), label, false)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return nil, nil
+	}
+	blocks, err := idx.GetProcessedBlockIndices(scale, dvid.Bounds{})
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) > MaxComponentBlocks {
+		return nil, fmt.Errorf("label %d has %d blocks at scale %d, more than the %d blocks allowed for components; use a coarser scale", label, len(blocks), scale, MaxComponentBlocks)
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't find components because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	cv := &compVolume{
+		blockSize: blockSize,
+		blocks:    make(map[dvid.ChunkPoint3d]*compBlock),
+	}
+	for _, izyx := range blocks {
+		pb, err := d.getLabelBlock(ctx, scale, izyx)
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			continue
+		}
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		cv.addBlock(bcoord, &(pb.Block), supervoxels)
+	}
+	components := cv.label()
+	sort.SliceStable(components, func(i, j int) bool { return components[i].Voxels > components[j].Voxels })
+	timedLog.Infof("Found %d components of label %d at scale %d in %d blocks", len(components), label, scale, len(cv.blocks))
+	return components, nil
+}
+
+// SplitComponents cleaves all but the largest component of a body into new labels.  Since
+// cleaves operate on supervoxels, components that share a supervoxel are cleaved together.
+// Returns the cleaves in order of decreasing fragment size.  If a cleave fails, the cleaves
+// already applied are undone so the body is left unchanged, which requires the mutation log
+// of the data.  The split is refused with a LeaseConflictError if the body is leased by
+// another user.
+func (d *Data) SplitComponents(v dvid.VersionID, label uint64, scale uint8, info dvid.ModInfo) ([]ComponentCleave, error) {
+	if err := d.checkMutationLog(); err != nil {
+		return nil, err
+	}
+	undoMu.Lock()
+	defer undoMu.Unlock()
+
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	if err := d.checkBodyLeases(v, info.User, label); err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	components, err := d.GetComponents(ctx, label, scale)
+	if err != nil {
+		return nil, err
+	}
+	if components == nil {
+		return nil, fmt.Errorf("label %d not found", label)
+	}
+
+	// group components sharing supervoxels via union-find.
+	parent := make([]int, len(components))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	svComp := make(map[uint64]int)
+	for i, comp := range components {
+		for _, sv := range comp.Supervoxels {
+			if j, found := svComp[sv]; found {
+				parent[find(i)] = find(j)
+			} else {
+				svComp[sv] = i
+			}
+		}
+	}
+	groups := make(map[int]*ComponentCleave)
+	var roots []int
+	for i, comp := range components {
+		root := find(i)
+		group, found := groups[root]
+		if !found {
+			group = new(ComponentCleave)
+			groups[root] = group
+			roots = append(roots, root)
+		}
+		group.Voxels += comp.Voxels
+	}
+	for sv, i := range svComp {
+		group := groups[find(i)]
+		group.Supervoxels = append(group.Supervoxels, sv)
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return groups[roots[i]].Voxels > groups[roots[j]].Voxels })
+
+	if len(roots) < 2 {
+		return nil, nil
+	}
+	var cleaves []ComponentCleave
+	for _, root := range roots[1:] {
+		group := groups[root]
+		sort.Slice(group.Supervoxels, func(i, j int) bool { return group.Supervoxels[i] < group.Supervoxels[j] })
+		if group.CleavedLabel, err = d.newLabel(v); err != nil {
+			return nil, d.rollbackComponentSplit(v, label, cleaves, 0, err, info)
+		}
+		group.MutationID = d.NewMutationID()
+		if err = d.cleaveLabel(v, group.MutationID, label, group.CleavedLabel, group.Supervoxels, info, nil); err != nil {
+			err = fmt.Errorf("unable to cleave component with supervoxels %v from label %d: %v", group.Supervoxels, label, err)
+			return nil, d.rollbackComponentSplit(v, label, cleaves, group.MutationID, err, info)
+		}
+		cleaves = append(cleaves, *group)
+	}
+	dvid.Infof("Split %d disconnected fragments from label %d at scale %d\n", len(cleaves), label, scale)
+	return cleaves, nil
+}
+
+// rollbackComponentSplit undoes the applied cleaves of a failed component split in reverse
+// order and returns the cause of the failure along with any error reversing the cleaves.
+// The mutation ID of the failed cleave, if any, is ignored when checking for conflicts.
+func (d *Data) rollbackComponentSplit(v dvid.VersionID, label uint64, cleaves []ComponentCleave, failedID uint64, cause error, info dvid.ModInfo) error {
+	ignore := make(map[uint64]struct{}, len(cleaves)+1)
+	if failedID != 0 {
+		ignore[failedID] = struct{}{}
+	}
+	for _, cleave := range cleaves {
+		ignore[cleave.MutationID] = struct{}{}
+	}
+	for i := len(cleaves) - 1; i >= 0; i-- {
+		undoIDs, err := d.undoMutation(v, cleaves[i].MutationID, ignore, false, info, nil)
+		if err != nil {
+			return fmt.Errorf("%v; unable to reverse cleave mutation %d of label %d: %v", cause, cleaves[i].MutationID, label, err)
+		}
+		for _, undoID := range undoIDs {
+			ignore[undoID] = struct{}{}
+		}
+	}
+	if len(cleaves) != 0 {
+		dvid.Infof("Undid %d cleaves of label %d after failed split of components\n", len(cleaves), label)
+	}
+	return cause
+}
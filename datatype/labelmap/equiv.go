@@ -675,3 +675,43 @@ func addSupervoxelSplitToMapping(d dvid.Data, v dvid.VersionID, op labels.SplitS
 	}
 	return labels.LogMapping(d, v, mapOp)
 }
+
+// adds the reversal of supervoxel splits into the equivalence map, where origSV maps
+// each split-generated supervoxel back to the supervoxel it came from, and logs
+// the changed mappings.
+func addUnsplitToMapping(d dvid.Data, v dvid.VersionID, mutID, label uint64, origSV map[uint64]uint64) error {
+	m, err := getMapping(d, v)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	vid, err := m.createShortVersion(v)
+	if err != nil {
+		m.Unlock()
+		return err
+	}
+	deleteSupervoxels := make(labels.Set, len(origSV))
+	restoreSupervoxels := make(labels.Set)
+	for supervoxel, orig := range origSV {
+		deleteSupervoxels[supervoxel] = struct{}{}
+		restoreSupervoxels[orig] = struct{}{}
+		m.setMapping(vid, supervoxel, 0)
+		m.setMapping(vid, orig, label)
+	}
+	m.Unlock()
+
+	mapOp := labels.MappingOp{
+		MutID:    mutID,
+		Mapped:   0,
+		Original: deleteSupervoxels,
+	}
+	if err := labels.LogMapping(d, v, mapOp); err != nil {
+		return fmt.Errorf("unable to log the mapping of deleted supervoxels %s: %v", deleteSupervoxels, err)
+	}
+	mapOp = labels.MappingOp{
+		MutID:    mutID,
+		Mapped:   label,
+		Original: restoreSupervoxels,
+	}
+	return labels.LogMapping(d, v, mapOp)
+}
@@ -7,6 +7,7 @@ package labelmap
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
@@ -29,6 +30,19 @@ const (
 	// key = label.  value = datatype/common/proto/AffinityTable serialization
 	keyAffinities = 188
 
+	// key = mutation ID.  value = JSON of undo/redo record for that mutation.
+	keyUndo = 189
+
+	// key = supervoxel + partner supervoxel, stored for both orders of a pair.  value = JSON
+	// of merge decision for that pair.
+	keyMergeDecision = 190
+
+	// key = label.  value = JSON object of body properties.
+	keyBodyProps = 191
+
+	// key = supervoxel.  value = datatype/common/proto/Affinities serialization
+	keySupervoxelAffinities = 192
+
 	// Used to store max label on commit for each version of the instance.
 	keyLabelMax = 237
 
@@ -48,6 +62,14 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "labelmap label index key"
 	case keyAffinities:
 		return "labelmap affinities key"
+	case keyUndo:
+		return "labelmap undo record key"
+	case keyMergeDecision:
+		return "labelmap merge decision key"
+	case keyBodyProps:
+		return "labelmap body properties key"
+	case keySupervoxelAffinities:
+		return "labelmap supervoxel affinities key"
 	case keyLabelMax:
 		return "labelmap label max key"
 	case keyRepoLabelMax:
@@ -129,3 +151,53 @@ func DecodeAffinitiesTKey(tk storage.TKey) (label uint64, err error) {
 	label = binary.BigEndian.Uint64(ibytes[0:8])
 	return
 }
+
+// NewUndoTKey returns a TKey corresponding to the undo record of a mutation.
+func NewUndoTKey(mutID uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, mutID)
+	return storage.NewTKey(keyUndo, buf)
+}
+
+// NewMergeDecisionTKey returns a TKey corresponding to the merge decision for a
+// supervoxel and a partner supervoxel.
+func NewMergeDecisionTKey(supervoxel, partner uint64) storage.TKey {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], supervoxel)
+	binary.BigEndian.PutUint64(buf[8:16], partner)
+	return storage.NewTKey(keyMergeDecision, buf)
+}
+
+// MergeDecisionTKeyRange returns the range of TKeys for all merge decisions of a supervoxel.
+func MergeDecisionTKeyRange(supervoxel uint64) (begTKey, endTKey storage.TKey) {
+	return NewMergeDecisionTKey(supervoxel, 0), NewMergeDecisionTKey(supervoxel, math.MaxUint64)
+}
+
+// DecodeMergeDecisionTKey parses a TKey and returns the supervoxel and partner supervoxel.
+func DecodeMergeDecisionTKey(tk storage.TKey) (supervoxel, partner uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyMergeDecision)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 16 {
+		err = fmt.Errorf("bad labelmap merge decision key of %d bytes: %v", len(ibytes), ibytes)
+		return
+	}
+	supervoxel = binary.BigEndian.Uint64(ibytes[0:8])
+	partner = binary.BigEndian.Uint64(ibytes[8:16])
+	return
+}
+
+// NewBodyPropsTKey returns a TKey corresponding to the JSON properties of a body.
+func NewBodyPropsTKey(label uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, label)
+	return storage.NewTKey(keyBodyProps, buf)
+}
+
+// NewSupervoxelAffinitiesTKey returns a TKey corresponding to a supervoxel's affinities.
+func NewSupervoxelAffinitiesTKey(supervoxel uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, supervoxel)
+	return storage.NewTKey(keySupervoxelAffinities, buf)
+}
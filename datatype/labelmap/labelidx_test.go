@@ -392,3 +392,109 @@ func TestIngest2(t *testing.T) {
 	apiStr = fmt.Sprintf("%snode/%s/labels/blocks?noindexing=true", server.WebAPIPath, uuid)
 	server.TestBadHTTP(t, "POST", apiStr, &buf)
 }
+
+func TestVerifyIndices(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{10, 10, 10}, 10)
+	vol.addSubvol(dvid.Point3d{20, 0, 0}, dvid.Point3d{10, 10, 10}, 20)
+	vol.addSubvol(dvid.Point3d{40, 0, 0}, dvid.Point3d{5, 10, 10}, 30)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[20, 30]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := d.VerifyIndices(v, false)
+	if err != nil {
+		t.Fatalf("error verifying indices: %v\n", err)
+	}
+	if result.Blocks == 0 || result.Indices != 2 || len(result.Discrepancies) != 0 {
+		t.Fatalf("expected consistent indices for 2 bodies, got %v\n", result)
+	}
+
+	// corrupt a count in body 10, drop the index of body 20, and add an orphaned index.
+	idx, err := GetLabelIndex(d, v, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zyx := labels.EncodeBlockIndex(0, 0, 0)
+	idx.Blocks[zyx].Counts[10] += 5
+	if err := PutLabelIndex(d, v, 10, idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteLabelIndex(d, v, 20); err != nil {
+		t.Fatal(err)
+	}
+	orphan := new(labels.Index)
+	orphan.Blocks = map[uint64]*proto.SVCount{
+		labels.EncodeBlockIndex(1, 1, 1): {Counts: map[uint64]uint32{999: 100}},
+	}
+	if err := PutLabelIndex(d, v, 999, orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = d.VerifyIndices(v, false)
+	if err != nil {
+		t.Fatalf("error verifying indices: %v\n", err)
+	}
+	expected := []IndexDiscrepancy{
+		{Label: 10, Problem: "counts", StoredVoxels: 1005, ActualVoxels: 1000, StoredBlocks: 1, ActualBlocks: 1, BadBlocks: 1},
+		{Label: 20, Problem: "missing", ActualVoxels: 1500, ActualBlocks: 2, BadBlocks: 2},
+		{Label: 999, Problem: "orphaned", StoredVoxels: 100, StoredBlocks: 1, BadBlocks: 1},
+	}
+	if len(result.Discrepancies) != len(expected) {
+		t.Fatalf("expected %d discrepancies, got %v\n", len(expected), result.Discrepancies)
+	}
+	for i, disc := range result.Discrepancies {
+		if disc != expected[i] {
+			t.Fatalf("expected discrepancy %v, got %v\n", expected[i], disc)
+		}
+	}
+	if size, err := GetLabelSize(d, v, 20, false); err != nil || size != 0 {
+		t.Fatalf("expected verification without repair to leave body 20 unindexed, got size %d: %v\n", size, err)
+	}
+
+	result, err = d.VerifyIndices(v, true)
+	if err != nil {
+		t.Fatalf("error repairing indices: %v\n", err)
+	}
+	for _, disc := range result.Discrepancies {
+		if !disc.Repaired {
+			t.Fatalf("expected discrepancy to be repaired: %v\n", disc)
+		}
+	}
+	result, err = d.VerifyIndices(v, false)
+	if err != nil {
+		t.Fatalf("error verifying indices: %v\n", err)
+	}
+	if len(result.Discrepancies) != 0 {
+		t.Fatalf("expected no discrepancies after repair, got %v\n", result.Discrepancies)
+	}
+	for label, expectedSize := range map[uint64]uint64{10: 1000, 20: 1500, 999: 0} {
+		size, err := GetLabelSize(d, v, label, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != expectedSize {
+			t.Fatalf("expected label %d to have %d voxels after repair, got %d\n", label, expectedSize, size)
+		}
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/datatype/common/proto"
 	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/datatype/keyvalue"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -88,6 +89,8 @@ $ dvid repo <UUID> new labelmap <data name> <settings...>
     VoxelUnits      Resolution units (default: "nanometers")
 	IndexedLabels   "false" if no sparse volume support is required (default "true")
 	MaxDownresLevel  The maximum down-res level supported.  Each down-res is factor of 2.
+	BodyPropsMerge  How body properties are combined on merge: "target", "union" or "larger"
+	                  (default "target").  See the body-props endpoint.
 
 $ dvid node <UUID> <data name> load <offset> <image glob> <settings...>
 
@@ -150,6 +153,104 @@ $ dvid node <UUID> <data name> dump <dump type> <file path>
 	data name     Name of data to add.
 	dump type     One of "svcount", "mappings", or "indices".
 	file path     Absolute path to a writable file that the dvid server has write privileges to.
+
+$ dvid node <UUID> <data name> renumber <keyvalue name> [start=<label>] [reuse=true]
+
+	Compacts the body label space of a version by renumbering all bodies into the dense range
+	of labels beginning at the start label in order of their current labels.  By default,
+	renumbering starts just above the maximum label so no label is reused.
+	Label indices are rewritten under the new labels and every supervoxel is mapped to its
+	new body label, so supervoxel ids and voxel blocks are unchanged.  The renumbering is
+	logged as mapping operations under a single mutation ID, body locks are moved to the new
+	labels, and synced annotation instances (and labelsz instances synced to them) relabel
+	their elements.  The old-to-new table is stored in the given keyvalue instance with one
+	key per renumbered body, where the key is the old label and the value is the new label.
+
+	A start at or below the maximum label reuses labels and requires "reuse=true".  Reuse is
+	only allowed if the start is no larger than the smallest body label.  Reused labels can
+	match supervoxel ids of other bodies and labels in earlier mutation logs, kafka messages,
+	and diff or as-of queries, where they referred to different bodies.
+
+	Renumbering is done asynchronously and all other label mutations of the instance wait
+	until it completes, so it's best done on a newly created child version.
+
+    Example: 
+
+    $ dvid node 3f8c segmentation renumber renumbering start=1 reuse=true
+
+    Arguments:
+
+    UUID            Hexadecimal string with enough characters to uniquely identify a version node.
+	data name       Name of labelmap data.
+	keyvalue name   Name of keyvalue instance that will store the old-to-new label table.
+	start           First label of the renumbered range.  Defaults to the max label + 1.
+	reuse           If true, allows a start at or below the max label.
+	
+$ dvid node <UUID> <data name> verify-indices [repair]
+
+	Scans all scale 0 blocks, recomputes the per-block supervoxel counts of every body using
+	the current supervoxel mappings, and compares them to the stored label indices.  The reply
+	is a JSON report of the discrepancies:
+
+	{
+		"Blocks": <# scanned blocks>,
+		"Indices": <# stored label indices>,
+		"Discrepancies": [
+			{
+				"Label": <body label>,
+				"Problem": <"missing", "orphaned", or "counts">,
+				"StoredVoxels": <# voxels in stored index>,
+				"ActualVoxels": <# voxels in blocks>,
+				"StoredBlocks": <# blocks in stored index>,
+				"ActualBlocks": <# blocks with voxels>,
+				"BadBlocks": <# blocks with differing supervoxel counts>,
+				"Repaired": <true if index was rewritten>
+			},
+			...
+		]
+	}
+
+	A "missing" body has voxels but no stored index, an "orphaned" index has no voxels in the
+	blocks, and "counts" indicates supervoxel counts that differ in one or more blocks.  If
+	"repair" is given, inconsistent indices are rewritten from the block contents and orphaned
+	indices are deleted.  Other label mutations wait until a repair completes, but verification
+	without repair should be done on a version without concurrent mutations.
+
+    Example: 
+
+    $ dvid node 3f8c segmentation verify-indices repair
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of labelmap data.
+	repair        If given, rewrites inconsistent label indices.
+	
+$ dvid node <UUID> <data name> export-zarr <dir> [scale] [roi] [mapped=true]
+
+	Asynchronously exports the segmentation of a version into an OME-Zarr (v0.4) multiscale
+	group at the given directory on the server's file system.  Each scale 0 through the given
+	scale (default is the maximum down-resolution level) is written as a ZYX uint64 array
+	"s<scale>" with one gzip-compressed chunk per stored block.  Chunks with only zero labels
+	are omitted since 0 is the fill value.  The arrays start at an origin that is aligned to
+	the blocks of the coarsest exported scale, and the origin is recorded as an OME-Zarr
+	translation in the voxel units of the data.
+
+	If an ROI is given, voxels outside the ROI are exported as 0.  At lower scales, a voxel
+	is within the ROI if its first scale 0 voxel is within the ROI.  By default supervoxels
+	are exported, while "mapped=true" exports body labels using the version's mappings.
+
+    Example: 
+
+    $ dvid node 3f8c segmentation export-zarr /data/export/seg.zarr 3 myroi mapped=true
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+	data name     Name of labelmap data.
+	dir           Absolute path to a directory that the dvid server has write privileges to.
+	scale         Maximum scale to export.
+	roi           Name of roi instance that limits exported voxels.
 	
 	
     ------------------
@@ -173,6 +274,8 @@ HTTP API (Level 2 REST):
     OPTIONAL "VoxelUnits"       Resolution units (default: "nanometers")
 	OPTIONAL "IndexedLabels"    "false" if no sparse volume support is required (default "true")
 	OPTIONAL "MaxDownresLevel"  The maximum down-res level supported.  Each down-res is factor of 2.
+	OPTIONAL "BodyPropsMerge"   How body properties are combined on merge: "target", "union" or
+	                             "larger" (default "target").  See the body-props endpoint.
 	
 
 GET  <api URL>/node/<UUID>/<data name>/help
@@ -220,7 +323,8 @@ POST <api URL>/node/<UUID>/<data name>/sync?<options>
     the server.  If annotations already exist, these are currently not synced.
 
     The labelmap data type accepts syncs to labelvol data instances.  It also accepts syncs to
-	labelmap instances for multiscale.
+	labelmap instances for multiscale.  It also accepts syncs to keyvalue data instances, which
+	are used to store skeletons computed via the "skeleton" endpoint.
 
     Query-string Options:
 
@@ -458,6 +562,29 @@ GET  <api URL>/node/<UUID>/<data name>/pseudocolor/<dims>/<size>/<offset>[?query
                     are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
                     status code is returned.
 
+GET <api URL>/node/<UUID>/<data name>/precomputed/info
+GET <api URL>/node/<UUID>/<data name>/precomputed/<scale>/<x0-x1_y0-y1_z0-z1>[?queryopts]
+
+	Read-only Neuroglancer precomputed segmentation source, so Neuroglancer can display
+	this data using the source "precomputed://<api URL>/node/<UUID>/<data name>/precomputed".
+	
+	The "info" request returns the precomputed metadata JSON with one scale per down-resolution
+	level, where each scale key is the scale number, the chunk size is the block size, and the
+	volume bounds are those of the stored extents.
+
+	The chunk request returns the labels in the chunk spanning voxels x0 to x1 (exclusive) in X,
+	and similarly for Y and Z, at the given scale.  Data is returned in the "compressed_segmentation"
+	encoding with 8x8x8 compression blocks.
+
+    Arguments:
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+    scale         A number from 0 up to MaxDownresLevel.
+
+    Query-string Options:
+
+	supervoxels   If "true", returns unmapped supervoxels, disregarding any kind of merges.
+
 GET <api URL>/node/<UUID>/<data name>/label/<coord>[?queryopts]
 
 	Returns JSON for the label at the given coordinate:
@@ -473,6 +600,10 @@ GET <api URL>/node/<UUID>/<data name>/label/<coord>[?queryopts]
 	supervoxels   If "true", returns unmapped supervoxel label, disregarding any kind of merges.
     scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
 	                of previous level.  Level 0 is the highest resolution.
+    asof          If given a mutation ID, returns the label as of that mutation in this version.
+	                Supervoxels split after that mutation are reported as the original supervoxel.
+	                Voxels painted after that mutation return an error since their prior
+	                labels aren't logged.
 
 GET <api URL>/node/<UUID>/<data name>/labels[?queryopts]
 
@@ -494,6 +625,10 @@ GET <api URL>/node/<UUID>/<data name>/labels[?queryopts]
     scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
 	                of previous level.  Level 0 is the highest resolution.
     hash          MD5 hash of request body content in hexidecimal string format.
+    asof          If given a mutation ID, returns the labels as of that mutation in this version.
+	                Supervoxels split after that mutation are reported as the original supervoxel.
+	                Voxels painted after that mutation return an error since their prior
+	                labels aren't logged.
 
 GET <api URL>/node/<UUID>/<data name>/history/<label>/<from UUID>/<to UUID>
 
@@ -506,6 +641,34 @@ GET <api URL>/node/<UUID>/<data name>/history/<label>/<from UUID>/<to UUID>
 	from UUID     The UUID of the earlier version in time range.
 	to UUID       The UUID of the later version in time range.
 
+GET <api URL>/node/<UUID>/<data name>/diff/<from UUID>/<to UUID>
+
+	Returns JSON describing the bodies that were created, deleted, or modified between the
+	two versions, where <from UUID> must be an ancestor of <to UUID>.  The mutation logs of
+	the versions after <from UUID> up to and including <to UUID> determine the bodies that
+	were touched, and the supervoxels of each such body are compared using its label index
+	at each version.  Bodies with the same supervoxels in both versions are not listed unless
+	they were painted, which changes voxels without changing supervoxels.
+
+		[
+			{
+				"Label": <label>,
+				"ChangeType": <"created", "deleted", or "modified">,
+				"MutationIDs": [<mutation id 1>, <mutation id 2>, ...],
+				"AddedSupervoxels": [<supervoxel 1>, ...],
+				"RemovedSupervoxels": [<supervoxel 1>, ...]
+			},
+			...
+		]
+
+	The list is sorted by label, and the supervoxel lists are omitted if empty.
+
+    Arguments:
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+	from UUID     The UUID of the earlier version.
+	to UUID       The UUID of the later version.
+
 
 GET <api URL>/node/<UUID>/<data name>/mapping[?queryopts]
 
@@ -529,6 +692,9 @@ GET <api URL>/node/<UUID>/<data name>/mapping[?queryopts]
 	nolookup      if "true", dvid won't verify that a supervoxel actually exists by looking up
 	                the label indices.  Only use this if supervoxels were known to exist at some time.
     hash          MD5 hash of request body content in hexidecimal string format.
+    asof          If given a mutation ID, returns the mapping as of that mutation in this version
+	                by replaying the version's logged mappings up to that mutation.  Supervoxels
+	                that did not exist at that time are mapped to 0.  No label index lookup is done.
 
 GET <api URL>/node/<UUID>/<data name>/supervoxel-splits
 
@@ -771,7 +937,7 @@ GET <api URL>/node/<UUID>/<data name>/lastmod/<label>
     data name     Name of labelmap instance.
     label     	  A 64-bit integer label id
 
-GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>
+GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>[?asof=<mutation id>]
 
 	Returns JSON for the supervoxels that have been agglomerated into the given label:
 
@@ -784,6 +950,11 @@ GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>
     data name     Name of labelmap instance.
     label     	  A 64-bit integer label id
 
+    Query-string Options:
+
+    asof          If given a mutation ID, returns the supervoxels of the label as of that mutation
+	                in this version by replaying the version's logged mappings up to that mutation.
+
 GET <api URL>/node/<UUID>/<data name>/size/<label>[?supervoxels=true]
 
 	Returns the size in voxels for the given label (or supervoxel) in JSON:
@@ -839,6 +1010,137 @@ GET  <api URL>/node/<UUID>/<data name>/sparsevol-size/<label>[?supervoxels=true]
 
 	supervoxels   If "true", interprets the given label as a supervoxel id, not a possibly merged label.
 
+GET  <api URL>/node/<UUID>/<data name>/bbox/<label>[?supervoxels=true]
+
+	Returns JSON giving the voxel-precise bounding box, centroid, and an anchor point of a body:
+
+	{
+		"Label": 23,
+		"Voxels": 231387,
+		"MinVoxel": [3, 17, 23],
+		"MaxVoxel": [1709, 1265, 4850],
+		"Centroid": [812.4, 533.9, 2231.7],
+		"Anchor": [801, 540, 2207]
+	}
+
+	Unlike sparsevol-size, the bounding box is accurate to the voxel.  It is computed from the
+	label index with only the blocks on the faces of the block bounding box being read.  The
+	centroid is computed from per-block voxel counts using block centers so it is accurate to
+	about a block.  The anchor is a voxel guaranteed to be within the body, chosen within the
+	block holding the most voxels of the body.
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	supervoxels   If "true", interprets the given label as a supervoxel id, not a possibly merged label.
+
+POST <api URL>/node/<UUID>/<data name>/bboxes[?supervoxels=true]
+
+	Batch version of bbox.  Expects a JSON list of labels in the POST body, e.g., "[23, 9871]",
+	and returns a JSON list of the bbox objects above in the same order, with null for labels
+	that do not exist.
+
+    Query-string Options:
+
+	supervoxels   If "true", interprets the given labels as supervoxel ids, not possibly merged labels.
+
+GET  <api URL>/node/<UUID>/<data name>/stats/<label>[?scale=N]
+
+	Returns JSON with size and shape statistics for a body:
+
+	{
+		"Label": 23,
+		"Voxels": 231387,
+		"SurfaceArea": 52810,
+		"MinVoxel": [3, 17, 23],
+		"MaxVoxel": [1709, 1265, 4850],
+		"NumBlocks": 1081,
+		"NumSupervoxels": 12,
+		"Scale": 0
+	}
+
+	The surface area is the number of voxel faces on the boundary of the body, where faces 
+	shared by adjacent voxels of the body are not counted.  It requires reading all blocks of
+	the body, so it can be computed at a lower resolution scale for speed.  In that case the
+	surface area is still given in scale 0 voxel face units but is an approximation.  The
+	voxel count, voxel-precise bounding box (see bbox), block count and supervoxel count are 
+	always computed at scale 0.
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	scale         Scale used to compute surface area.  Default is 0.
+
+POST <api URL>/node/<UUID>/<data name>/stats[?queryopts]
+
+	Batch version of stats.  Expects a JSON list of labels in the POST body, e.g., "[23, 9871]",
+	and returns a JSON list of the stats objects above.  Without sorting, the list is in the 
+	same order as the labels with null for labels that do not exist.  If sorted, labels that
+	do not exist are omitted.
+
+    Query-string Options:
+
+	scale         Scale used to compute surface area.  Default is 0.
+	sort          Sorts the returned stats in descending order of "voxels", "surface",
+	                "blocks" or "supervoxels".
+	n             If sorted, returns only the first n stats.
+
+POST <api URL>/node/<UUID>/<data name>/affinities
+
+	Bulk loads affinities of supervoxel pairs for use in merge suggestions.  Expects a JSON
+	list of supervoxel pairs and their affinity:
+
+	[
+		{"Label1": <supervoxel id>, "Label2": <supervoxel id>, "Value": <float32 affinity>},
+		...
+	]
+
+	Affinities are symmetric and replace any previously loaded affinity for the same pair.
+	Loaded affinities are visible in this version and its descendants.
+
+GET  <api URL>/node/<UUID>/<data name>/merge-candidates/<label>[?queryopts]
+
+	Returns JSON of the bodies with the highest affinity to the given body, in order of
+	decreasing affinity.  Supervoxel affinities are mapped to bodies through the current
+	supervoxel mappings, and supervoxel pairs with a recorded merge decision are skipped.
+	The affinity of a candidate is the highest of its supervoxel pairs with the body:
+
+	[
+		{
+			"Body": 23,
+			"Affinity": 0.93,
+			"Supervoxel": <supervoxel of given body in highest pair>,
+			"PartnerSupervoxel": <supervoxel of candidate body in highest pair>,
+			"Pairs": <# undecided supervoxel pairs between the bodies>
+		},
+		...
+	]
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	n             Maximum number of candidates to return (default 10).  Use 0 for all candidates.
+	minaffinity   Skips supervoxel pairs with affinity below this value.
+
+POST <api URL>/node/<UUID>/<data name>/merge-decisions[?queryopts]
+
+	Records accept or reject decisions for proposed merges of supervoxel pairs, so decided
+	pairs are no longer returned as merge candidates in this version and its descendants.
+	Recording a decision does not merge any bodies.  Expects a JSON list of decisions:
+
+	[
+		{"Supervoxel1": <supervoxel id>, "Supervoxel2": <supervoxel id>, "Decision": "reject"},
+		{"Supervoxel1": <supervoxel id>, "Supervoxel2": <supervoxel id>, "Decision": "accept"},
+		...
+	]
+
+    Query-string Options:
+
+	u             User name that made the decisions.
+
 GET  <api URL>/node/<UUID>/<data name>/sparsevol/<label>?<options>
 
 	Returns a sparse volume with voxels of the given label in encoded RLE format.  The returned
@@ -942,6 +1244,127 @@ HEAD <api URL>/node/<UUID>/<data name>/sparsevol/<label>[?supervoxels=true]
 
 	supervoxels   If "true", interprets the given label as a supervoxel id, not a possibly merged label.
 
+GET <api URL>/node/<UUID>/<data name>/mesh/<label>?<options>
+
+	Returns a triangle mesh of the given label computed on-the-fly via marching cubes over the
+	label blocks listed in the label's index.  Vertices lie on the boundary between voxels
+	of the label and other voxels, and are in physical units, i.e., voxel coordinates at scale 0
+	multiplied by the instance's voxel size.
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	format       One of the following:
+	               "ngmesh" (default) - legacy neuroglancer mesh format, little-endian:
+	                   uint32 # vertices, then float32 x, y, z for each vertex, then
+	                   uint32 vertex indices for each triangle.
+	               "obj" - Wavefront OBJ text format.
+	               "drc" - Draco mesh format readable by any Draco decoder.  The mesh is
+	                   encoded without compression, so it is about the size of an ngmesh.
+	scale        A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2
+	               resolution of previous level.  Level 0 is the highest resolution.
+	supervoxels  If "true", interprets the given label as a supervoxel id.
+	smoothing    Number of Laplacian smoothing iterations applied to the mesh.  Default 0.
+	decimation   Fraction in (0, 1] of vertices to keep via vertex clustering.  Default 1.
+
+GET <api URL>/node/<UUID>/<data name>/skeleton/<label>?<options>
+
+	Returns a skeleton of the given label in SWC format, computed on-the-fly by topology-preserving
+	thinning of the label's sparse volume.  Each SWC line gives a node as "id type x y z radius parent"
+	where coordinates and radii are in scale 0 voxel units.  Each connected component of the label
+	is a separate tree rooted at its node of largest radius, with root parent set to -1.
+	Since the label's voxels are held in memory, an error is returned if the label has more
+	than 256 blocks at the requested scale, in which case a coarser scale should be used.
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	scale        A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2
+	               resolution of previous level.  Level 0 is the highest resolution.  Skeletonizing
+	               at lower resolution is much faster for large bodies.
+	supervoxels  If "true", interprets the given label as a supervoxel id.
+	store        If "true", the SWC is also stored in a synced keyvalue instance under the
+	               key "<label>_swc".  See the "sync" endpoint.
+
+GET <api URL>/node/<UUID>/<data name>/neighbors/<label>?<options>
+
+	Returns the labels adjacent to the given label and the number of voxel faces in contact,
+	i.e., the number of 6-connected voxel pairs where one voxel is in the given label and the
+	other is in the adjacent label.  Neighbors are sorted by decreasing contact.  Example:
+
+	{ "label": 23, "neighbors": [ { "label": 17, "contact": 1240 }, { "label": 8, "contact": 37 } ] }
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	scale        A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2
+	               resolution of previous level.  Contact is measured at the given scale.
+	supervoxels  If "true", interprets the given label as a supervoxel id and returns
+	               adjacent supervoxels.  Otherwise adjacent bodies are returned.
+
+GET <api URL>/node/<UUID>/<data name>/contact/<label1>/<label2>?<options>
+
+	Returns the interface between two labels as a sparse volume in the legacy RLE format
+	described for the "sparsevol" endpoint.  The interface is composed of the voxels in either
+	label that are 6-connected to a voxel of the other label.
+
+	Returns a status code 404 (Not Found) if either label does not exist or the labels
+	are not in contact.
+
+    Query-string Options:
+
+	scale        A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2
+	               resolution of previous level.  Returned voxel coordinates are at this scale.
+	supervoxels  If "true", interprets the given labels as supervoxel ids.
+
+GET <api URL>/node/<UUID>/<data name>/components/<label>?<options>
+
+	Returns the 26-connected components of a body sorted by decreasing voxel count.  Each
+	component gives its voxel count, its bounding box and the supervoxels within it.  A body
+	with more than one component is disconnected at the given scale.  Since all voxels of the
+	body are held in memory, bodies with more than 256 blocks at the scale are refused and 
+	should be requested at a coarser scale.  Example:
+
+	[
+		{ "Voxels": 20350, "MinVoxel": [10, 20, 30], "MaxVoxel": [95, 120, 64], "Supervoxels": [7, 12] },
+		{ "Voxels": 512, "MinVoxel": [200, 20, 30], "MaxVoxel": [207, 27, 37], "Supervoxels": [8] }
+	]
+
+	Returns a status code 404 (Not Found) if label does not exist.
+
+    Query-string Options:
+
+	scale        A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2
+	               resolution of previous level.  Voxel counts and coordinates are at this scale.
+
+POST <api URL>/node/<UUID>/<data name>/components/<label>/split?<options>
+
+	Splits off disconnected fragments of a body.  All components except the largest are
+	cleaved into new labels using the same process as the "cleave" endpoint, so each fragment
+	gets its own mutation ID and cleave log entry.  Since cleaves move whole supervoxels,
+	components sharing a supervoxel are cleaved together and a body whose components all
+	share supervoxels is left unchanged.  If any cleave fails, the cleaves already applied
+	are undone and an error is returned.  Since the undo uses the mutation log, the split is
+	refused if the instance has no mutation log.  Returns the cleaves in order of decreasing
+	size:
+
+	[
+		{ "CleavedLabel": 23, "MutationID": 1027, "Voxels": 512, "Supervoxels": [8] },
+		...
+	]
+
+	Returns a status code 409 (Conflict) if the body is locked by another user.
+
+    Query-string Options:
+
+	scale        A number from 0 up to MaxDownresLevel used to find components.  Fragments
+	               connected only at finer resolution may be split at coarser scales.
+	u            User name that performed the split.
+	app          Application that performed the split.
+
 GET <api URL>/node/<UUID>/<data name>/sparsevol-by-point/<coord>[?supervoxels=true]
 
 	Returns a sparse volume with voxels that pass through a given voxel.
@@ -1157,8 +1580,11 @@ POST <api URL>/node/<UUID>/<data name>/split-supervoxel/<supervoxel>?<options>
 	remain  Label id that should be used for remaining (unsplit) voxels.
 	downres Defaults to "true" where all lower-res scales will be computed.
 	          Use "false" if you plan on supplying lower-res scales via POST /blocks.
+	scale   If given and non-zero, the POSTed sparse volume is a mask at this scale.  The mask
+	          is upsampled to scale 0 and only the supervoxel's voxels within the mask are split.
+	          The upsampled split is what's stored under the "Split" reference.
 
-POST <api URL>/node/<UUID>/<data name>/split/<label>
+POST <api URL>/node/<UUID>/<data name>/split/<label>[?scale=N]
 
 	Splits a portion of a label's voxels into a new supervoxel with a new label.  
 	Returns the following JSON:
@@ -1216,6 +1642,219 @@ POST <api URL>/node/<UUID>/<data name>/split/<label>
 			"UUID": <UUID on which split was done>
 		}
 
+	POST Query-string Options:
+
+	scale   If given and non-zero, the POSTed sparse volume is a mask at this scale.  The mask
+	          is upsampled to scale 0 and only the label's voxels within the mask are split, so
+	          the mask need not be a subset of the label.
+
+POST <api URL>/node/<UUID>/<data name>/paint?label=<label>[&format=json]
+
+	Paints the given label into a sparse set of voxels, leaving all other voxels of the
+	affected blocks untouched.  Unlike POSTs to the "raw" endpoint, only the painted voxels
+	are written so concurrent edits to neighboring voxels are preserved.  Label indices, the
+	max label and lower resolution scales are updated as for other voxel writes.  The label
+	is written as a supervoxel, so painting an existing supervoxel adds voxels to its body.
+	Returns the following JSON:
+
+		{
+			"MutationID": <unique id for mutation>,
+			"Voxels": <number of painted voxels>
+		}
+
+	By default, the POSTed body is a binary sparse volume in the RLE format described for
+	the "split" endpoint above and returned by the "sparsevol" endpoint.  If "format=json",
+	the POSTed body lists voxels and spheres (all voxels within radius of a center voxel):
+
+		{
+			"Voxels": [[x1, y1, z1], [x2, y2, z2], ...],
+			"Spheres": [{"Center": [x, y, z], "Radius": 5}, ...]
+		}
+
+	If any body with painted voxels or the body of the label is locked by another user via
+	the "lock" endpoint, the paint is refused with a conflict error (status 409).
+
+	The paint is recorded in the mutation log along with the painted supervoxels and their
+	bodies, so the "undo" endpoint treats it as a later mutation of those bodies and the
+	"diff" and "history" endpoints report it.  A paint itself can't be undone.
+
+	Kafka JSON message generated by this request:
+		{
+			"Action": "paint",
+			"Label": <painted label>,
+			"Voxels": <number of painted voxels>,
+			"Blocks": <number of modified blocks>,
+			"MutationID": <unique id for mutation>
+			"UUID": <UUID on which paint was done>
+		}
+
+	After completion of the paint op, a "paint-complete" message is published.
+
+    Query-string Options:
+
+	label        The label to paint.  Label 0 is protected background and cannot be painted.
+	format       If "json", the POSTed body is JSON voxels and spheres.
+	u            User name that performed the paint.
+	app          Application that performed the paint.
+
+POST <api URL>/node/<UUID>/<data name>/undo/<mutation id>
+
+	Reverses a merge, cleave, split or supervoxel split given its mutation ID.  The mutation
+	must have been done in this version (UUID) and the reversal is done by applying inverse
+	mutations, each of which gets its own mutation ID and is processed like any other
+	mutation by syncs and the mutation log:
+
+		merge:             the supervoxels of each merged label are cleaved back into that label.
+		cleave:            the cleaved label is merged back into the original label.
+		split:             split supervoxels are rejoined and the split label is merged back.
+		split-supervoxel:  the split and remain supervoxels are rejoined into the original.
+
+	If a later mutation touched any of the bodies or supervoxels involved in the mutation, 
+	or any of the bodies is locked by another user, the undo is refused with a conflict 
+	error (status 409).  Returns JSON:
+
+		{
+			"MutationID": <undone mutation id>,
+			"UndoMutationIDs": [<mutation id of inverse op 1>, ...]
+		}
+
+	Kafka JSON message generated by this request after the inverse mutations complete:
+		{ 
+			"Action": "undo",
+			"MutationID": <undone mutation id>,
+			"MutationIDs": [<mutation id of inverse op 1>, ...],
+			"UUID": <UUID on which undo was done>
+		}
+
+	Reversal of splits also generates "unsplit-supervoxels" and "unsplit-supervoxels-complete"
+	Kafka messages with "Target" label and "Supervoxels" mapping from split to original supervoxels.
+
+POST <api URL>/node/<UUID>/<data name>/redo/<mutation id>
+
+	Reapplies a mutation that was reversed via the "undo" endpoint, given the original 
+	mutation ID.  A merge or cleave is redone with the same labels, and a supervoxel split 
+	is redone with the same supervoxel ids.  A split is redone using its logged sparse 
+	volume, so the new body and split supervoxels receive new labels.  If mutations other
+	than the undo touched the same bodies or supervoxels, or any of the bodies is locked by
+	another user, the redo is refused with a conflict error (status 409).  Returns JSON:
+
+		{
+			"MutationID": <redone mutation id>,
+			"RedoMutationIDs": [<mutation id of redo>]
+		}
+
+	A "redo" Kafka message analogous to the "undo" message above is generated.
+
+POST <api URL>/node/<UUID>/<data name>/mutations-batch
+
+	Atomically applies a list of merge, cleave and supervoxel split operations.  All operations
+	are validated in order against the current label state, with each operation seeing the
+	effects of the prior ones, before any operation is applied.  The operations are then applied
+	in order using a contiguous range of mutation IDs.  If an operation fails while being applied,
+	the prior operations of the batch are reversed as with the "undo" endpoint so either all or
+	none of the batch changes the label indices, mapping and blocks.  Since the reversal uses
+	the mutation log, the batch is refused if the instance has no mutation log.  Other merge,
+	cleave, split, paint, undo and redo requests wait until the batch completes, and new labels
+	are only allocated once the whole batch is validated.  If any body referenced by the operations is 
+	locked by another user, the whole batch is refused with a conflict error (status 409).
+	The POSTed JSON is a list of operations:
+
+		[
+			{"Action": "merge", "Target": <label>, "Labels": [<label 1>, <label 2>, ...]},
+			{"Action": "cleave", "Label": <label>, "Supervoxels": [<sv 1>, <sv 2>, ...], "CleavedLabel": <label>},
+			{"Action": "split-supervoxel", "Supervoxel": <sv>, "Split": <base64 sparse volume>,
+			 "SplitLabel": <label>, "RemainLabel": <label>}
+		]
+
+	The "CleavedLabel", "SplitLabel" and "RemainLabel" fields are optional and new labels are 
+	chosen if they are omitted.  The "Split" field is the base64 encoding of a binary sparse 
+	volume in the format described for the "split-supervoxel" endpoint.  Returns JSON:
+
+		{
+			"MutationIDs": [<mutation id of op 1>, <mutation id of op 2>, ...],
+			"Results": [
+				{"Action": "merge", "MutationID": <mutation id>},
+				{"Action": "cleave", "MutationID": <mutation id>, "CleavedLabel": <label>},
+				{"Action": "split-supervoxel", "MutationID": <mutation id>, 
+				 "SplitSupervoxel": <label>, "RemainSupervoxel": <label>}
+			]
+		}
+
+	Each operation generates its usual Kafka messages, syncs and mutation stream events, but
+	these are only sent after all operations are applied and are dropped if the batch is 
+	reversed.  After the operations' messages, the following JSON message is published:
+		{ 
+			"Action": "mutations-batch",
+			"MutationIDs": [<mutation id of op 1>, <mutation id of op 2>, ...],
+			"UUID": <UUID on which batch was done>
+		}
+
+POST   <api URL>/node/<UUID>/<data name>/lock/<label>?u=<user>[&ttl=<seconds>]
+DELETE <api URL>/node/<UUID>/<data name>/lock/<label>?u=<user>
+
+	Checks out (POST) or releases (DELETE) a lease on a body for the given user.  While a
+	body is leased, "merge", "cleave", "split", "split-supervoxel", "paint", "undo", "redo"
+	and "mutations-batch" requests touching that body by any other user are refused with a
+	conflict error (status 409).  A batch is refused before any of its operations is
+	applied.  Leases apply only to the given version, are held in memory and do not survive
+	a server restart.  A POST by the user holding the lease renews it.  A POST or DELETE on
+	a body leased by another user returns a conflict error (status 409).  The POST returns
+	JSON:
+
+		{
+			"Label": <label>,
+			"User": <user>,
+			"Expires": <time in RFC 3339 format>
+		}
+
+	When a leased body is merged into another body, its lease is released and transferred
+	to the merge target if the target has no lease of its own.
+
+	Query-string Options:
+
+	u             User holding the lease.  Required.
+	ttl           Time-to-live of the lease in seconds.  Default is 3600.
+
+GET <api URL>/node/<UUID>/<data name>/locks
+
+	Returns JSON list of the current body leases for this version, sorted by label:
+
+		[
+			{"Label": <label>, "User": <user>, "Expires": <time in RFC 3339 format>},
+			...
+		]
+
+
+GET  <api URL>/node/<UUID>/<data name>/body-props/<label>
+POST <api URL>/node/<UUID>/<data name>/body-props/<label>
+
+	Retrieves (GET) or replaces (POST) the JSON properties of a body, e.g., status, owner or
+	notes.  The properties are a JSON object with arbitrary keys and values:
+
+		{"status": "Traced", "owner": "jane", "notes": ["soma near edge"]}
+
+	A GET on a body without properties returns an empty object.  POSTing an empty object
+	deletes the body's properties.  Unlike properties kept in a separate keyvalue instance,
+	these properties follow mutations of the body:
+
+	merge         Properties are combined using the instance's "BodyPropsMerge" setting:
+	                "target" (default) keeps only the target body's properties.
+	                "union" adds keys of merged bodies not present in the target, with
+	                  larger merged bodies taking precedence for conflicting keys.
+	                "larger" keeps the properties of the body with the most voxels.
+	              Properties of the merged bodies are deleted.
+	undo merge    Each body gets back the properties it had before the merge.
+	cleave/split  The new body gets a copy of the original body's properties.
+	renumber      Properties are moved to the new body labels.
+
+	The merge rule can be changed for an existing instance by POSTing JSON like 
+	{"BodyPropsMerge": "union"} to the data instance URL.
+
+GET <api URL>/node/<UUID>/<data name>/body-props
+
+	Batch query of body properties.  Expects a JSON list of labels in the GET body, e.g.,
+	"[23, 9871]", and returns a JSON list of the properties of each label in the same order,
+	with null for labels without properties.
 
 GET  <api URL>/node/<UUID>/<data name>/index/<label>
 POST <api URL>/node/<UUID>/<data name>/index/<label>
@@ -1299,6 +1938,34 @@ GET <api URL>/node/<UUID>/<data name>/mutations[?queryopts]
 				 is the requester's User ID (not necessarily the same as the
 				 User ID whose mutations are being requested).
 
+GET <api URL>/node/<UUID>/<data name>/mutations/stream[?queryopts]
+
+	Keeps the connection open and pushes each merge, cleave, split, split-supervoxel, paint,
+	renumber and undo of a split (action "unsplit-supervoxels") of the given version as it
+	is committed, so clients can invalidate caches without polling or a Kafka deployment.
+	Undo and redo of merges and cleaves are sent as the cleaves and merges that reverse
+	them.  Each mutation is described by the same JSON as the Kafka mutation log (see GET
+	/mutations above).  By default, the stream uses the Server-Sent Events format where the
+	event name is the mutation action and the event id is the mutation ID:
+
+		id: 1047
+		event: merge
+		data: {"Action":"merge","Target":23,"Labels":[87],...}
+
+	Only mutations made after the stream is opened are sent, and only for mutations
+	through this DVID server.  Idle streams receive a keep-alive comment (or an empty line
+	for JSON lines) every 30 seconds.  Streams are not subject to the server's HTTP write
+	timeout.  A client that falls more than 1000 mutations behind has its stream closed, so
+	clients should reconnect and refresh any cached state when a stream ends.
+
+	Query-string options:
+
+		bodies:  Comma-separated list of body labels.  Only mutations affecting at least one
+				 of the given bodies are sent, e.g., a merge whose target or merged labels
+				 are in the list.
+		userid:  Limit streamed mutations to the given User ID.
+		format:  "sse" (default) for Server-Sent Events or "jsonl" for chunked JSON lines.
+
 GET <api URL>/node/<UUID>/<data name>/mappings[?queryopts]
 
 	Streams space-delimited mappings for the given UUID, one mapping per line:
@@ -1517,12 +2184,19 @@ type Data struct {
 	// the higher level.
 	MaxDownresLevel uint8
 
+	// How body properties are combined on merge: "target" (default), "union" or "larger".
+	BodyPropsMerge string
+
 	updates  []uint32 // tracks updating to each scale of labelmap [0:MaxDownresLevel+1]
 	updateMu sync.RWMutex
 
 	mlMu sync.RWMutex // For atomic access of MaxLabel and MaxRepoLabel
 
 	voxelMu sync.Mutex // Only allow voxel-level label mutation ops sequentially.
+
+	// Label mutations hold a read lock while mutation batches and renumbering hold the
+	// write lock so no other mutation can change their bodies partway through.
+	mutationMu sync.RWMutex
 }
 
 // --- LogReadable interface ---
@@ -1653,9 +2327,20 @@ func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.
 	}
 	data.updates = make([]uint32, downresLevels+1)
 
+	propsMerge, found, err := c.GetString("BodyPropsMerge")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if err := checkBodyPropsMerge(propsMerge); err != nil {
+			return nil, err
+		}
+	}
+
 	data.MaxLabel = make(map[dvid.VersionID]uint64)
 	data.IndexedLabels = indexedLabels
 	data.MaxDownresLevel = downresLevels
+	data.BodyPropsMerge = propsMerge
 
 	data.Initialize()
 	return data, nil
@@ -1667,6 +2352,7 @@ type propsJSON struct {
 	MaxRepoLabel    uint64
 	IndexedLabels   bool
 	MaxDownresLevel uint8
+	BodyPropsMerge  string
 }
 
 func (d *Data) MarshalJSON() ([]byte, error) {
@@ -1681,6 +2367,7 @@ func (d *Data) MarshalJSON() ([]byte, error) {
 			MaxRepoLabel:    d.MaxRepoLabel,
 			IndexedLabels:   d.IndexedLabels,
 			MaxDownresLevel: d.MaxDownresLevel,
+			BodyPropsMerge:  d.BodyPropsMerge,
 		},
 	})
 }
@@ -1712,6 +2399,7 @@ func (d *Data) MarshalJSONExtents(ctx *datastore.VersionedCtx) ([]byte, error) {
 			MaxRepoLabel:    d.MaxRepoLabel,
 			IndexedLabels:   d.IndexedLabels,
 			MaxDownresLevel: d.MaxDownresLevel,
+			BodyPropsMerge:  d.BodyPropsMerge,
 		},
 		extentsJSON,
 	})
@@ -1731,6 +2419,9 @@ func (d *Data) GobDecode(b []byte) error {
 		dvid.Errorf("Decoding labelmap %q: no MaxDownresLevel, setting to 7", d.DataName())
 		d.MaxDownresLevel = 7
 	}
+	if err := dec.Decode(&(d.BodyPropsMerge)); err != nil {
+		d.BodyPropsMerge = ""
+	}
 	d.updates = make([]uint32, d.MaxDownresLevel+1)
 	return nil
 }
@@ -1747,6 +2438,9 @@ func (d *Data) GobEncode() ([]byte, error) {
 	if err := enc.Encode(d.MaxDownresLevel); err != nil {
 		return nil, err
 	}
+	if err := enc.Encode(d.BodyPropsMerge); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -1808,12 +2502,27 @@ func (d *Data) updateBlockMaxLabel(v dvid.VersionID, block *labels.Block) {
 	}
 }
 
-func (d *Data) Equals(d2 *Data) bool {
-	if !d.Data.Equals(d2.Data) {
-		return false
+// ModifyConfig handles the BodyPropsMerge setting and passes other settings to imageblk.
+func (d *Data) ModifyConfig(config dvid.Config) error {
+	propsMerge, found, err := config.GetString("BodyPropsMerge")
+	if err != nil {
+		return err
 	}
-	return true
-}
+	if found {
+		if err := checkBodyPropsMerge(propsMerge); err != nil {
+			return err
+		}
+		d.BodyPropsMerge = propsMerge
+	}
+	return d.Data.ModifyConfig(config)
+}
+
+func (d *Data) Equals(d2 *Data) bool {
+	if !d.Data.Equals(d2.Data) {
+		return false
+	}
+	return true
+}
 
 func (d *Data) persistMaxLabel(v dvid.VersionID) error {
 	store, err := datastore.GetOrderedKeyValueDB(d)
@@ -2838,6 +3547,119 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 		}
 		return nil
 
+	case "renumber":
+		if len(req.Command) < 5 {
+			return fmt.Errorf("poorly formatted renumber command.  See command-line help")
+		}
+		var uuidStr, dataName, cmdStr, kvName string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &kvName)
+
+		uuid, v, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		var start uint64
+		if startStr, found := req.Setting("start"); found {
+			if start, err = strconv.ParseUint(startStr, 10, 64); err != nil {
+				return fmt.Errorf("bad start label %q for renumber: %v", startStr, err)
+			}
+		}
+		var reuse bool
+		if reuseStr, found := req.Setting("reuse"); found {
+			if reuse, err = strconv.ParseBool(reuseStr); err != nil {
+				return fmt.Errorf("bad reuse setting %q for renumber: %v", reuseStr, err)
+			}
+		}
+		var kvdata *keyvalue.Data
+		if kvName != "" {
+			source, err := datastore.GetDataByUUIDName(uuid, dvid.InstanceName(kvName))
+			if err != nil {
+				return err
+			}
+			var ok bool
+			if kvdata, ok = source.(*keyvalue.Data); !ok {
+				return fmt.Errorf("instance %q is not a keyvalue instance for storing the renumbering table", kvName)
+			}
+		}
+		if err = datastore.AddToNodeLog(uuid, []string{req.Command.String()}); err != nil {
+			return err
+		}
+		go func() {
+			if _, err := d.RenumberBodies(v, start, reuse, kvdata); err != nil {
+				dvid.Errorf("Cannot renumber bodies of data %q @ node %s: %v\n", dataName, uuidStr, err)
+			}
+		}()
+		reply.Text = fmt.Sprintf("Asynchronously renumbering bodies for data %q, uuid %s (errors will be printed in server log) ...\n", d.DataName(), uuid)
+		return nil
+
+	case "export-zarr":
+		if len(req.Command) < 5 {
+			return fmt.Errorf("poorly formatted export-zarr command.  See command-line help")
+		}
+		var uuidStr, dataName, cmdStr, dir, scaleStr, roiName string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &dir, &scaleStr, &roiName)
+
+		_, v, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		opts := ZarrExportOptions{
+			MaxScale: d.MaxDownresLevel,
+			ROI:      dvid.InstanceName(roiName),
+		}
+		if scaleStr != "" {
+			scale, err := strconv.ParseUint(scaleStr, 10, 8)
+			if err != nil {
+				return fmt.Errorf("bad scale %q for export-zarr: %v", scaleStr, err)
+			}
+			if uint8(scale) > d.MaxDownresLevel {
+				return fmt.Errorf("scale %d exceeds maximum down-resolution level %d", scale, d.MaxDownresLevel)
+			}
+			opts.MaxScale = uint8(scale)
+		}
+		if mapped, found := req.Setting("mapped"); found && mapped == "true" {
+			opts.Mapped = true
+		}
+		go func() {
+			if err := d.ExportZarr(v, dir, opts); err != nil {
+				dvid.Errorf("Cannot export data %q @ node %s to zarr %q: %v\n", dataName, uuidStr, dir, err)
+			}
+		}()
+		reply.Text = fmt.Sprintf("Asynchronously exporting data %q, uuid %s scales 0-%d to zarr directory %q (errors will be printed in server log) ...\n", d.DataName(), uuidStr, opts.MaxScale, dir)
+		return nil
+
+	case "verify-indices":
+		var uuidStr, dataName, cmdStr, repairStr string
+		req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &repairStr)
+
+		var repair bool
+		switch repairStr {
+		case "":
+		case "repair":
+			repair = true
+		default:
+			return fmt.Errorf("unknown verify-indices option %q.  See command-line help", repairStr)
+		}
+		uuid, v, err := datastore.MatchingUUID(uuidStr)
+		if err != nil {
+			return err
+		}
+		if repair {
+			if err = datastore.AddToNodeLog(uuid, []string{req.Command.String()}); err != nil {
+				return err
+			}
+		}
+		result, err := d.VerifyIndices(v, repair)
+		if err != nil {
+			return err
+		}
+		jsonBytes, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		reply.Text = string(jsonBytes)
+		return nil
+
 	default:
 		return fmt.Errorf("unknown command.  Data type '%s' [%s] does not support '%s' command",
 			d.DataName(), d.TypeName(), req.TypeCommand())
@@ -3198,7 +4020,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	// Prevent use of APIs that require IndexedLabels when it is not set.
 	if !d.IndexedLabels {
 		switch parts[3] {
-		case "sparsevol", "sparsevol-by-point", "sparsevol-coarse", "maxlabel", "nextlabel", "split-supervoxel", "cleave", "merge":
+		case "sparsevol", "sparsevol-by-point", "sparsevol-coarse", "mesh", "skeleton", "neighbors", "contact", "components", "bbox", "bboxes", "stats", "merge-candidates", "maxlabel", "nextlabel", "split-supervoxel", "cleave", "merge", "paint", "undo", "redo", "mutations-batch", "lock", "locks", "diff":
 			server.BadRequest(w, r, "data %q is not label indexed (IndexedLabels=false): %q endpoint is not supported", d.DataName(), parts[3])
 			return
 		}
@@ -3344,6 +4166,42 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "sparsevols-coarse":
 		d.handleSparsevolsCoarse(ctx, w, r, parts)
 
+	case "precomputed":
+		d.handlePrecomputed(ctx, w, r, parts)
+
+	case "mesh":
+		d.handleMesh(ctx, w, r, parts)
+
+	case "skeleton":
+		d.handleSkeleton(ctx, w, r, parts)
+
+	case "neighbors":
+		d.handleNeighbors(ctx, w, r, parts)
+
+	case "contact":
+		d.handleContact(ctx, w, r, parts)
+
+	case "components":
+		d.handleComponents(ctx, w, r, parts)
+
+	case "bbox":
+		d.handleBBox(ctx, w, r, parts)
+
+	case "bboxes":
+		d.handleBBoxes(ctx, w, r)
+
+	case "stats":
+		d.handleStats(ctx, w, r, parts)
+
+	case "affinities":
+		d.handleAffinities(ctx, w, r)
+
+	case "merge-candidates":
+		d.handleMergeCandidates(ctx, w, r, parts)
+
+	case "merge-decisions":
+		d.handleMergeDecisions(ctx, w, r)
+
 	case "maxlabel":
 		d.handleMaxlabel(ctx, w, r, parts)
 
@@ -3362,6 +4220,27 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "merge":
 		d.handleMerge(ctx, w, r, parts)
 
+	case "paint":
+		d.handlePaint(ctx, w, r)
+
+	case "undo":
+		d.handleUndo(ctx, w, r, parts)
+
+	case "redo":
+		d.handleRedo(ctx, w, r, parts)
+
+	case "mutations-batch":
+		d.handleMutationsBatch(ctx, w, r)
+
+	case "lock":
+		d.handleLock(ctx, w, r, parts)
+
+	case "locks":
+		d.handleLocks(ctx, w, r)
+
+	case "body-props":
+		d.handleBodyProps(ctx, w, r, parts)
+
 	case "index":
 		d.handleIndex(ctx, w, r, parts)
 
@@ -3374,8 +4253,15 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "history":
 		d.handleHistory(ctx, w, r, parts)
 
+	case "diff":
+		d.handleDiff(ctx, w, r, parts)
+
 	case "mutations":
-		d.handleMutations(ctx, w, r)
+		if len(parts) > 4 && parts[4] == "stream" {
+			d.handleMutationsStream(ctx, w, r)
+		} else {
+			d.handleMutations(ctx, w, r)
+		}
 
 	default:
 		server.BadAPIRequest(w, r, d)
@@ -3405,8 +4291,18 @@ func (d *Data) handleLabel(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 		return
 	}
 	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+	asof, historical, err := getAsOf(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad asof specified: %v", err)
+		return
+	}
 
-	labels, err := d.GetLabelPoints(ctx.VersionID(), []dvid.Point3d{coord}, scale, isSupervoxel)
+	var labels []uint64
+	if historical {
+		labels, err = d.GetLabelPointsAsOf(ctx.VersionID(), []dvid.Point3d{coord}, scale, isSupervoxel, asof)
+	} else {
+		labels, err = d.GetLabelPoints(ctx.VersionID(), []dvid.Point3d{coord}, scale, isSupervoxel)
+	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
@@ -3438,6 +4334,11 @@ func (d *Data) handleLabels(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 		return
 	}
 	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+	asof, historical, err := getAsOf(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad asof specified: %v", err)
+		return
+	}
 	hash := queryStrings.Get("hash")
 	if err := checkContentHash(hash, data); err != nil {
 		server.BadRequest(w, r, err)
@@ -3448,7 +4349,12 @@ func (d *Data) handleLabels(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 		server.BadRequest(w, r, fmt.Sprintf("Bad labels request JSON: %v", err))
 		return
 	}
-	labels, err := d.GetLabelPoints(ctx.VersionID(), coords, scale, isSupervoxel)
+	var labels []uint64
+	if historical {
+		labels, err = d.GetLabelPointsAsOf(ctx.VersionID(), coords, scale, isSupervoxel, asof)
+	} else {
+		labels, err = d.GetLabelPoints(ctx.VersionID(), coords, scale, isSupervoxel)
+	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
@@ -3492,17 +4398,28 @@ func (d *Data) handleMapping(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 		server.BadRequest(w, r, fmt.Sprintf("Bad mapping request JSON: %v", err))
 		return
 	}
-	svmap, err := getMapping(d, ctx.VersionID())
+	asof, historical, err := getAsOf(queryStrings)
 	if err != nil {
-		server.BadRequest(w, r, "couldn't get mapping for data %q, version %d: %v", d.DataName(), ctx.VersionID(), err)
+		server.BadRequest(w, r, "bad asof specified: %v", err)
 		return
 	}
-	labels, found, err := svmap.MappedLabels(ctx.VersionID(), supervoxels)
+	var labels []uint64
+	var found []bool
+	if historical {
+		labels, err = d.GetMappedLabelsAsOf(ctx.VersionID(), asof, supervoxels)
+	} else {
+		var svmap *SVMap
+		if svmap, err = getMapping(d, ctx.VersionID()); err != nil {
+			server.BadRequest(w, r, "couldn't get mapping for data %q, version %d: %v", d.DataName(), ctx.VersionID(), err)
+			return
+		}
+		labels, found, err = svmap.MappedLabels(ctx.VersionID(), supervoxels)
+	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
-	if queryStrings.Get("nolookup") != "true" {
+	if !historical && queryStrings.Get("nolookup") != "true" {
 		labels, err = d.verifyMappings(ctx, supervoxels, labels, found)
 		if err != nil {
 			server.BadRequest(w, r, err)
@@ -3928,6 +4845,104 @@ func (d *Data) handleHistory(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 	timedLog.Infof("HTTP GET history (%s)", r.URL)
 }
 
+func (d *Data) handleDiff(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/diff/<from UUID>/<to UUID>
+	if len(parts) < 6 {
+		server.BadRequest(w, r, "ERROR: DVID requires 'from' UUID and 'to' UUID to follow 'diff' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for /diff endpoint")
+		return
+	}
+	fromUUID, _, err := datastore.MatchingUUID(parts[4])
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	toUUID, _, err := datastore.MatchingUUID(parts[5])
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	diffs, err := d.GetBodyDiff(fromUUID, toUUID)
+	if err != nil {
+		server.BadRequest(w, r, "unable to get body diff: %v", err)
+		return
+	}
+	if diffs == nil {
+		diffs = []BodyDiff{}
+	}
+	jsonBytes, err := json.Marshal(diffs)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP GET diff (%s)", r.URL)
+}
+
+func (d *Data) handlePrecomputed(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/precomputed/info
+	// GET <api URL>/node/<UUID>/<data name>/precomputed/<scale>/<x0-x1_y0-y1_z0-z1>
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for /precomputed endpoint")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires 'info' or scale and chunk to follow 'precomputed' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	if parts[4] == "info" {
+		info, err := d.getPrecomputedInfo(ctx)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(info)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+		timedLog.Infof("HTTP GET precomputed info (%s)", r.URL)
+		return
+	}
+	if len(parts) < 6 {
+		server.BadRequest(w, r, "ERROR: DVID requires chunk to follow scale in 'precomputed' command")
+		return
+	}
+	scale, err := strconv.ParseUint(parts[4], 10, 8)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale %q specified: %v", parts[4], err)
+		return
+	}
+	offset, size, err := parseChunkBounds(parts[5])
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	supervoxels := r.URL.Query().Get("supervoxels") == "true"
+	data, err := d.GetPrecomputedChunk(ctx.VersionID(), offset, size, uint8(scale), supervoxels)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/octet-stream")
+	if _, err = w.Write(data); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP GET precomputed chunk %s at scale %d (%s)", parts[5], scale, r.URL)
+}
+
 func (d *Data) handlePseudocolor(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
 	if len(parts) < 7 {
 		server.BadRequest(w, r, "'%s' must be followed by shape/size/offset", parts[3])
@@ -4164,8 +5179,18 @@ func (d *Data) handleSupervoxels(ctx *datastore.VersionedCtx, w http.ResponseWri
 		server.BadRequest(w, r, "Label 0 is protected background value and cannot be queried as body.\n")
 		return
 	}
+	asof, historical, err := getAsOf(r.URL.Query())
+	if err != nil {
+		server.BadRequest(w, r, "bad asof specified: %v", err)
+		return
+	}
 
-	supervoxels, err := d.GetSupervoxels(ctx.VersionID(), label)
+	var supervoxels labels.Set
+	if historical {
+		supervoxels, err = d.GetSupervoxelsAsOf(ctx.VersionID(), asof, label)
+	} else {
+		supervoxels, err = d.GetSupervoxels(ctx.VersionID(), label)
+	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
@@ -4457,92 +5482,664 @@ func (d *Data) handleSparsevol(ctx *datastore.VersionedCtx, w http.ResponseWrite
 	timedLog.Infof("HTTP %s: sparsevol on label %s (%s)", r.Method, parts[4], r.URL)
 }
 
-func (d *Data) handleSparsevolByPoint(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
-	// GET <api URL>/node/<UUID>/<data name>/sparsevol-by-point/<coord>
+func (d *Data) handleMesh(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/mesh/<label>
 	if len(parts) < 5 {
-		server.BadRequest(w, r, "ERROR: DVID requires coord to follow 'sparsevol-by-point' command")
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'mesh' command")
 		return
 	}
-	timedLog := dvid.NewTimeLog()
-
-	queryStrings := r.URL.Query()
-	scale, err := getScale(queryStrings)
-	if err != nil {
-		server.BadRequest(w, r, "bad scale specified: %v", err)
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "Unable to handle HTTP action %s on mesh endpoint", r.Method)
 		return
 	}
-	isSupervoxel := queryStrings.Get("supervoxels") == "true"
-
-	coord, err := dvid.StringToPoint(parts[4], "_")
+	label, err := strconv.ParseUint(parts[4], 10, 64)
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
-	label, err := d.GetLabelAtScaledPoint(ctx.VersionID(), coord, scale, isSupervoxel)
-	if err != nil {
-		server.BadRequest(w, r, err)
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be meshed.\n")
 		return
 	}
-	if label == 0 {
-		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
+	queryStrings := r.URL.Query()
+	var opts meshOptions
+	if opts.scale, err = getScale(queryStrings); err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
 		return
 	}
-	b, compression, err := d.getSparsevolOptions(r)
+	opts.isSupervoxel = queryStrings.Get("supervoxels") == "true"
+	if s := queryStrings.Get("smoothing"); s != "" {
+		if opts.smoothing, err = strconv.Atoi(s); err != nil || opts.smoothing < 0 {
+			server.BadRequest(w, r, "bad smoothing iterations specified: %q", s)
+			return
+		}
+	}
+	if s := queryStrings.Get("decimation"); s != "" {
+		if opts.decimation, err = strconv.ParseFloat(s, 64); err != nil || opts.decimation <= 0 || opts.decimation > 1 {
+			server.BadRequest(w, r, "bad decimation fraction specified, must be in (0, 1]: %q", s)
+			return
+		}
+	}
+	format := strings.ToLower(queryStrings.Get("format"))
+	switch format {
+	case "", "ngmesh", "obj", "drc":
+	default:
+		server.BadRequest(w, r, "unknown mesh format %q, must be ngmesh, obj or drc", format)
+		return
+	}
+
+	timedLog := dvid.NewTimeLog()
+	m, err := d.getMesh(ctx, label, opts)
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-type", "application/octet-stream")
-
-	format := svformatFromQueryString(r)
-	var found bool
+	if m == nil {
+		dvid.Infof("GET mesh on label %d was not found.\n", label)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	switch format {
-	case FormatLegacyRLE:
-		found, err = d.writeLegacyRLE(ctx, label, 0, b, compression, isSupervoxel, w)
-	case FormatBinaryBlocks:
-		found, err = d.writeBinaryBlocks(ctx, label, 0, b, compression, isSupervoxel, w)
-	case FormatStreamingRLE:
-		found, err = d.writeStreamingRLE(ctx, label, 0, b, compression, isSupervoxel, w)
+	case "obj":
+		w.Header().Set("Content-type", "text/plain")
+		err = m.writeOBJ(w)
+	case "drc":
+		w.Header().Set("Content-type", "application/octet-stream")
+		err = m.writeDraco(w)
+	default:
+		w.Header().Set("Content-type", "application/octet-stream")
+		err = m.writeNgMesh(w)
 	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
-	if !found {
-		w.WriteHeader(http.StatusNotFound)
-	}
-	timedLog.Infof("HTTP %s: sparsevol-by-point at %s (%s)", r.Method, parts[4], r.URL)
+	timedLog.Infof("HTTP %s: mesh on label %s (%s)", r.Method, parts[4], r.URL)
 }
 
-func (d *Data) handleSparsevolCoarse(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
-	// GET <api URL>/node/<UUID>/<data name>/sparsevol-coarse/<label>
+func (d *Data) handleSkeleton(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/skeleton/<label>
 	if len(parts) < 5 {
-		server.BadRequest(w, r, "DVID requires label ID to follow 'sparsevol-coarse' command")
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'skeleton' command")
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "Unable to handle HTTP action %s on skeleton endpoint", r.Method)
 		return
 	}
-	timedLog := dvid.NewTimeLog()
-
 	label, err := strconv.ParseUint(parts[4], 10, 64)
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
 	if label == 0 {
-		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be skeletonized.\n")
 		return
 	}
 	queryStrings := r.URL.Query()
-	isSupervoxel := queryStrings.Get("supervoxels") == "true"
-	var b dvid.Bounds
-	b.Voxel, err = dvid.OptionalBoundsFromQueryString(r)
+	scale, err := getScale(queryStrings)
 	if err != nil {
-		server.BadRequest(w, r, "Error parsing bounds from query string: %v\n", err)
+		server.BadRequest(w, r, "bad scale specified: %v", err)
 		return
 	}
-	blockSize, ok := d.BlockSize().(dvid.Point3d)
-	if !ok {
-		server.BadRequest(w, r, "Error: BlockSize for %s wasn't 3d", d.DataName())
+	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+	store := queryStrings.Get("store") == "true"
+	if store && d.getSyncedKeyvalue() == nil {
+		server.BadRequest(w, r, "cannot store skeleton since labelmap %q has no synced keyvalue instance", d.DataName())
+		return
+	}
+
+	timedLog := dvid.NewTimeLog()
+	swc, err := d.getSkeleton(ctx, label, scale, isSupervoxel)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if swc == nil {
+		dvid.Infof("GET skeleton on label %d was not found.\n", label)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if store {
+		if err := d.storeSkeleton(ctx.VersionID(), label, swc); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	}
+	w.Header().Set("Content-type", "text/plain")
+	if _, err := w.Write(swc); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP %s: skeleton on label %s (%s)", r.Method, parts[4], r.URL)
+}
+
+func (d *Data) handleNeighbors(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/neighbors/<label>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'neighbors' command")
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "Unable to handle HTTP action %s on neighbors endpoint", r.Method)
+		return
+	}
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used for neighbors.\n")
+		return
+	}
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+
+	timedLog := dvid.NewTimeLog()
+	neighbors, err := d.GetNeighbors(ctx.VersionID(), label, scale, isSupervoxel)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if neighbors == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	jsonBytes, err := json.Marshal(neighbors)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	fmt.Fprintf(w, `{"label": %d, "neighbors": %s}`, label, string(jsonBytes))
+
+	timedLog.Infof("HTTP GET neighbors of label %d: %d neighbors (%s)", label, len(neighbors), r.URL)
+}
+
+func (d *Data) handleContact(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/contact/<label1>/<label2>
+	if len(parts) < 6 {
+		server.BadRequest(w, r, "ERROR: DVID requires two labels to follow 'contact' command")
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "Unable to handle HTTP action %s on contact endpoint", r.Method)
+		return
+	}
+	label1, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	label2, err := strconv.ParseUint(parts[5], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label1 == 0 || label2 == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used for contact.\n")
+		return
+	}
+	if label1 == label2 {
+		server.BadRequest(w, r, "contact requires two different labels, got %d twice", label1)
+		return
+	}
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+
+	timedLog := dvid.NewTimeLog()
+	data, err := d.GetContactRLEs(ctx.VersionID(), label1, label2, scale, isSupervoxel)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if data == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", "application/octet-stream")
+	if _, err := w.Write(data); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP GET contact between labels %d and %d (%s)", label1, label2, r.URL)
+}
+
+func (d *Data) handleComponents(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/components/<label>
+	// POST <api URL>/node/<UUID>/<data name>/components/<label>/split
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'components' command")
+		return
+	}
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used for components.\n")
+		return
+	}
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+
+	timedLog := dvid.NewTimeLog()
+	var result interface{}
+	switch {
+	case len(parts) == 5 && strings.ToLower(r.Method) == "get":
+		components, err := d.GetComponents(ctx, label, scale)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if components == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		result = components
+	case len(parts) == 6 && parts[5] == "split" && strings.ToLower(r.Method) == "post":
+		cleaves, err := d.SplitComponents(ctx.VersionID(), label, scale, dvid.GetModInfo(r))
+		if err != nil {
+			writeLeaseError(w, r, err)
+			return
+		}
+		if cleaves == nil {
+			cleaves = []ComponentCleave{}
+		}
+		result = cleaves
+	default:
+		server.BadRequest(w, r, "components endpoint supports GET components/<label> and POST components/<label>/split")
+		return
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	if _, err := w.Write(jsonBytes); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP %s components of label %d (%s)", r.Method, label, r.URL)
+}
+
+func (d *Data) handleBBox(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/bbox/<label>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'bbox' command")
+		return
+	}
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used for bbox.\n")
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "DVID does not support %s on /bbox endpoint", r.Method)
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	isSupervoxel := r.URL.Query().Get("supervoxels") == "true"
+	bbox, err := d.GetBodyBBox(ctx, label, isSupervoxel)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if bbox == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	jsonBytes, err := json.Marshal(bbox)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	if _, err := w.Write(jsonBytes); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP GET bbox of label %d (%s)", label, r.URL)
+}
+
+func (d *Data) handleBBoxes(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/bboxes
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "DVID does not support %s on /bboxes endpoint", r.Method)
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "bad POSTed data for bboxes.  Should be JSON list of labels.")
+		return
+	}
+	var lbls []uint64
+	if err := json.Unmarshal(data, &lbls); err != nil {
+		server.BadRequest(w, r, "bad POSTed data for bboxes.  Should be JSON list of labels: %v", err)
+		return
+	}
+	isSupervoxel := r.URL.Query().Get("supervoxels") == "true"
+	bboxes, err := d.GetBodyBBoxes(ctx, lbls, isSupervoxel)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(bboxes)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	if _, err := w.Write(jsonBytes); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP POST bboxes of %d labels (%s)", len(lbls), r.URL)
+}
+
+func (d *Data) handleStats(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET  <api URL>/node/<UUID>/<data name>/stats/<label>
+	// POST <api URL>/node/<UUID>/<data name>/stats
+	timedLog := dvid.NewTimeLog()
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	var result interface{}
+	switch strings.ToLower(r.Method) {
+	case "get":
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'stats' command")
+			return
+		}
+		label, err := strconv.ParseUint(parts[4], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if label == 0 {
+			server.BadRequest(w, r, "Label 0 is protected background value and cannot be used for stats.\n")
+			return
+		}
+		stats, err := d.GetBodyStats(ctx, label, scale)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if stats == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		result = stats
+	case "post":
+		var lbls []uint64
+		if err := json.NewDecoder(r.Body).Decode(&lbls); err != nil {
+			server.BadRequest(w, r, "bad POSTed data for stats.  Should be JSON list of labels: %v", err)
+			return
+		}
+		stats, err := d.GetBodiesStats(ctx, lbls, scale)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if sortField := queryStrings.Get("sort"); sortField != "" {
+			found := stats[:0]
+			for _, s := range stats {
+				if s != nil {
+					found = append(found, s)
+				}
+			}
+			if err := sortBodyStats(found, sortField); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if nStr := queryStrings.Get("n"); nStr != "" {
+				n, err := strconv.Atoi(nStr)
+				if err != nil || n < 0 {
+					server.BadRequest(w, r, "bad n query string %q for stats", nStr)
+					return
+				}
+				if n < len(found) {
+					found = found[:n]
+				}
+			}
+			stats = found
+		}
+		result = stats
+	default:
+		server.BadRequest(w, r, "DVID does not support %s on /stats endpoint", r.Method)
+		return
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	if _, err := w.Write(jsonBytes); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP %s stats (%s)", r.Method, r.URL)
+}
+
+func (d *Data) handleAffinities(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/affinities
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "DVID does not support %s on /affinities endpoint", r.Method)
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "bad POSTed data for affinities.  Should be JSON list of supervoxel pair affinities.")
+		return
+	}
+	var affs []labels.Affinity
+	if err := json.Unmarshal(data, &affs); err != nil {
+		server.BadRequest(w, r, "bad POSTed data for affinities.  Should be JSON list of supervoxel pair affinities: %v", err)
+		return
+	}
+	if err := d.PutAffinities(ctx.VersionID(), affs); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP POST %d affinities (%s)", len(affs), r.URL)
+}
+
+func (d *Data) handleMergeCandidates(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/merge-candidates/<label>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'merge-candidates' command")
+		return
+	}
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot have merge candidates.\n")
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "DVID does not support %s on /merge-candidates endpoint", r.Method)
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	queryStrings := r.URL.Query()
+	n := 10
+	if nStr := queryStrings.Get("n"); nStr != "" {
+		if n, err = strconv.Atoi(nStr); err != nil || n < 0 {
+			server.BadRequest(w, r, "bad number of merge candidates %q", nStr)
+			return
+		}
+	}
+	minAffinity := float32(math.Inf(-1))
+	if minStr := queryStrings.Get("minaffinity"); minStr != "" {
+		minVal, err := strconv.ParseFloat(minStr, 32)
+		if err != nil {
+			server.BadRequest(w, r, "bad minaffinity %q: %v", minStr, err)
+			return
+		}
+		minAffinity = float32(minVal)
+	}
+	candidates, err := d.GetMergeCandidates(ctx.VersionID(), label, n, minAffinity)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if candidates == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	jsonBytes, err := json.Marshal(candidates)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	if _, err := w.Write(jsonBytes); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP GET %d merge candidates of label %d (%s)", len(candidates), label, r.URL)
+}
+
+func (d *Data) handleMergeDecisions(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/merge-decisions
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "DVID does not support %s on /merge-decisions endpoint", r.Method)
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "bad POSTed data for merge decisions.  Should be JSON list of decisions.")
+		return
+	}
+	var decisions []MergeDecision
+	if err := json.Unmarshal(data, &decisions); err != nil {
+		server.BadRequest(w, r, "bad POSTed data for merge decisions.  Should be JSON list of decisions: %v", err)
+		return
+	}
+	if err := d.PutMergeDecisions(ctx.VersionID(), decisions, dvid.GetModInfo(r)); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP POST %d merge decisions (%s)", len(decisions), r.URL)
+}
+
+func (d *Data) handleSparsevolByPoint(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/sparsevol-by-point/<coord>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires coord to follow 'sparsevol-by-point' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+
+	coord, err := dvid.StringToPoint(parts[4], "_")
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	label, err := d.GetLabelAtScaledPoint(ctx.VersionID(), coord, scale, isSupervoxel)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
+		return
+	}
+	b, compression, err := d.getSparsevolOptions(r)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/octet-stream")
+
+	format := svformatFromQueryString(r)
+	var found bool
+	switch format {
+	case FormatLegacyRLE:
+		found, err = d.writeLegacyRLE(ctx, label, 0, b, compression, isSupervoxel, w)
+	case FormatBinaryBlocks:
+		found, err = d.writeBinaryBlocks(ctx, label, 0, b, compression, isSupervoxel, w)
+	case FormatStreamingRLE:
+		found, err = d.writeStreamingRLE(ctx, label, 0, b, compression, isSupervoxel, w)
+	}
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	timedLog.Infof("HTTP %s: sparsevol-by-point at %s (%s)", r.Method, parts[4], r.URL)
+}
+
+func (d *Data) handleSparsevolCoarse(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/sparsevol-coarse/<label>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "DVID requires label ID to follow 'sparsevol-coarse' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
+		return
+	}
+	queryStrings := r.URL.Query()
+	isSupervoxel := queryStrings.Get("supervoxels") == "true"
+	var b dvid.Bounds
+	b.Voxel, err = dvid.OptionalBoundsFromQueryString(r)
+	if err != nil {
+		server.BadRequest(w, r, "Error parsing bounds from query string: %v\n", err)
+		return
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		server.BadRequest(w, r, "Error: BlockSize for %s wasn't 3d", d.DataName())
 		return
 	}
 	b.Block = b.Voxel.Divide(blockSize)
@@ -4719,7 +6316,11 @@ func (d *Data) handleSplitSupervoxel(ctx *datastore.VersionedCtx, w http.Respons
 	if queryStrings.Get("downres") == "false" {
 		downscale = false
 	}
-	var err error
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
 	var split, remain uint64
 	if splitStr != "" {
 		split, err = strconv.ParseUint(splitStr, 10, 64)
@@ -4748,9 +6349,13 @@ func (d *Data) handleSplitSupervoxel(ctx *datastore.VersionedCtx, w http.Respons
 		return
 	}
 	info := dvid.GetModInfo(r)
-	splitSupervoxel, remainSupervoxel, mutID, err := d.SplitSupervoxel(ctx.VersionID(), supervoxel, split, remain, r.Body, info, downscale)
+	splitSupervoxel, remainSupervoxel, mutID, err := d.SplitSupervoxel(ctx.VersionID(), supervoxel, split, remain, r.Body, scale, info, downscale)
 	if err != nil {
-		server.BadRequest(w, r, fmt.Sprintf("split supervoxel %d -> %d, %d: %v", supervoxel, splitSupervoxel, remainSupervoxel, err))
+		if _, conflict := err.(LeaseConflictError); conflict {
+			writeLeaseError(w, r, err)
+		} else {
+			server.BadRequest(w, r, fmt.Sprintf("split supervoxel %d -> %d, %d: %v", supervoxel, splitSupervoxel, remainSupervoxel, err))
+		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4783,7 +6388,7 @@ func (d *Data) handleCleave(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 	modInfo := dvid.GetModInfo(r)
 	cleaveLabel, mutID, err := d.CleaveLabel(ctx.VersionID(), label, modInfo, r.Body)
 	if err != nil {
-		server.BadRequest(w, r, err)
+		writeLeaseError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4813,10 +6418,19 @@ func (d *Data) handleSplit(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
 		return
 	}
+	scale, err := getScale(r.URL.Query())
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
 	info := dvid.GetModInfo(r)
-	toLabel, mutID, err := d.SplitLabels(ctx.VersionID(), fromLabel, r.Body, info)
+	toLabel, mutID, err := d.SplitLabels(ctx.VersionID(), fromLabel, r.Body, scale, info)
 	if err != nil {
-		server.BadRequest(w, r, fmt.Sprintf("split label %d: %v", fromLabel, err))
+		if _, conflict := err.(LeaseConflictError); conflict {
+			writeLeaseError(w, r, err)
+		} else {
+			server.BadRequest(w, r, fmt.Sprintf("split label %d: %v", fromLabel, err))
+		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4851,7 +6465,11 @@ func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 	info := dvid.GetModInfo(r)
 	mutID, err := d.MergeLabels(ctx.VersionID(), mergeOp, info)
 	if err != nil {
-		server.BadRequest(w, r, fmt.Sprintf("Error on merge: %v", err))
+		if _, conflict := err.(LeaseConflictError); conflict {
+			writeLeaseError(w, r, err)
+		} else {
+			server.BadRequest(w, r, fmt.Sprintf("Error on merge: %v", err))
+		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4860,6 +6478,261 @@ func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 	timedLog.Infof("HTTP merge request (%s)", r.URL)
 }
 
+func (d *Data) handlePaint(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/paint?label=<label>[&format=json]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Paint requests must be POST actions.")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	queryStrings := r.URL.Query()
+	label, err := strconv.ParseUint(queryStrings.Get("label"), 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, "paint requires a valid label query string: %v", err)
+		return
+	}
+	var rles dvid.RLEs
+	switch queryStrings.Get("format") {
+	case "":
+		if rles, err = dvid.ReadRLEs(r.Body); err != nil {
+			server.BadRequest(w, r, "bad sparse volume POSTed for paint: %v", err)
+			return
+		}
+	case "json":
+		var shapes PaintShapes
+		if err := json.NewDecoder(r.Body).Decode(&shapes); err != nil {
+			server.BadRequest(w, r, "bad JSON POSTed for paint: %v", err)
+			return
+		}
+		if rles, err = shapes.RLEs(); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	default:
+		server.BadRequest(w, r, "unknown paint format %q, must be json or omitted for sparse volume", queryStrings.Get("format"))
+		return
+	}
+	mutID, err := d.PaintLabel(ctx.VersionID(), label, rles, dvid.GetModInfo(r))
+	if err != nil {
+		writeLeaseError(w, r, err)
+		return
+	}
+	numVoxels, _ := rles.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"MutationID": %d, "Voxels": %d}`, mutID, numVoxels)
+
+	timedLog.Infof("HTTP paint of label %d, %d voxels (%s)", label, numVoxels, r.URL)
+}
+
+func (d *Data) handleUndo(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/undo/<mutation id>
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Undo requests must be POST actions.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires mutation ID to follow 'undo' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	mutID, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	info := dvid.GetModInfo(r)
+	undoIDs, err := d.UndoMutation(ctx.VersionID(), mutID, info)
+	if err != nil {
+		writeUndoRedoError(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(undoIDs)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"MutationID": %d, "UndoMutationIDs": %s}`, mutID, string(jsonBytes))
+
+	timedLog.Infof("HTTP undo of mutation %d request (%s)", mutID, r.URL)
+}
+
+func (d *Data) handleRedo(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/redo/<mutation id>
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Redo requests must be POST actions.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires mutation ID to follow 'redo' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	mutID, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	info := dvid.GetModInfo(r)
+	redoIDs, err := d.RedoMutation(ctx.VersionID(), mutID, info)
+	if err != nil {
+		writeUndoRedoError(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(redoIDs)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"MutationID": %d, "RedoMutationIDs": %s}`, mutID, string(jsonBytes))
+
+	timedLog.Infof("HTTP redo of mutation %d request (%s)", mutID, r.URL)
+}
+
+func (d *Data) handleMutationsBatch(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/mutations-batch
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Mutation batch requests must be POST actions.")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "Bad POSTed data for mutation batch.  Should be JSON.")
+		return
+	}
+	var ops []BatchMutation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Bad mutation batch JSON: %v", err))
+		return
+	}
+	info := dvid.GetModInfo(r)
+	results, err := d.ApplyMutationBatch(ctx.VersionID(), ops, info)
+	if err != nil {
+		if _, conflict := err.(LeaseConflictError); conflict {
+			writeLeaseError(w, r, err)
+		} else {
+			server.BadRequest(w, r, fmt.Sprintf("Error on mutation batch: %v", err))
+		}
+		return
+	}
+	resp := struct {
+		MutationIDs []uint64
+		Results     []BatchResult
+	}{
+		MutationIDs: make([]uint64, len(results)),
+		Results:     results,
+	}
+	for i, result := range results {
+		resp.MutationIDs[i] = result.MutationID
+	}
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP mutation batch of %d operations (%s)", len(ops), r.URL)
+}
+
+func (d *Data) handleLock(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/lock/<label>?u=<user>&ttl=<seconds>
+	// DELETE <api URL>/node/<UUID>/<data name>/lock/<label>?u=<user>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label to follow 'lock' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be locked\n")
+		return
+	}
+	info := dvid.GetModInfo(r)
+	switch strings.ToLower(r.Method) {
+	case "post":
+		var ttl time.Duration
+		if ttlStr := r.URL.Query().Get("ttl"); ttlStr != "" {
+			seconds, err := strconv.ParseUint(ttlStr, 10, 32)
+			if err != nil {
+				server.BadRequest(w, r, "bad ttl query string provided: %s", ttlStr)
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+		lease, err := d.LockBody(ctx.VersionID(), label, info.User, ttl)
+		if err != nil {
+			writeLeaseError(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(lease)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+	case "delete":
+		if err := d.UnlockBody(ctx.VersionID(), label, info.User); err != nil {
+			writeLeaseError(w, r, err)
+			return
+		}
+	default:
+		server.BadRequest(w, r, "lock endpoint only supports POST and DELETE")
+		return
+	}
+	timedLog.Infof("HTTP %s lock of label %d by user %q (%s)", r.Method, label, info.User, r.URL)
+}
+
+func (d *Data) handleLocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET <api URL>/node/<UUID>/<data name>/locks
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "locks endpoint only supports GET")
+		return
+	}
+	jsonBytes, err := json.Marshal(d.GetBodyLeases(ctx.VersionID()))
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
+
+// bodies locked by another user get a 409 status while all other errors are bad requests.
+func writeLeaseError(w http.ResponseWriter, r *http.Request, err error) {
+	if _, conflict := err.(LeaseConflictError); conflict {
+		dvid.Errorf("%s (%s)\n", err, r.URL)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	server.BadRequest(w, r, err)
+}
+
+// conflicts with later mutations or body leases get a 409 status while all other errors are
+// bad requests.
+func writeUndoRedoError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err.(type) {
+	case MutationConflictError, LeaseConflictError:
+		dvid.Errorf("%s (%s)\n", err, r.URL)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	server.BadRequest(w, r, err)
+}
+
 // --------- Other functions on labelmap Data -----------------
 
 // GetSupervoxelBlock returns a compressed supervoxel Block of the given block coordinate.
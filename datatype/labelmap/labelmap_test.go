@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -2109,3 +2110,988 @@ func TestLabels(t *testing.T) {
 func TestLabelsUnindexed(t *testing.T) {
 	testLabels(t, false)
 }
+
+// checkMesh verifies a mesh is closed with consistently oriented triangles and returns its volume.
+func checkMesh(t *testing.T, vertices [][3]float32, triangles [][3]uint32) float64 {
+	_, fn, line, _ := runtime.Caller(1)
+	edges := make(map[[2]uint32]int)
+	for _, tri := range triangles {
+		for i := 0; i < 3; i++ {
+			a, b := tri[i], tri[(i+1)%3]
+			if int(a) >= len(vertices) || int(b) >= len(vertices) {
+				t.Fatalf("triangle %v references bad vertex [%s:%d]\n", tri, fn, line)
+			}
+			edges[[2]uint32{a, b}]++
+		}
+	}
+	for edge, count := range edges {
+		if count != 1 || edges[[2]uint32{edge[1], edge[0]}] != 1 {
+			t.Fatalf("mesh edge %v not shared by exactly two oppositely oriented triangles [%s:%d]\n", edge, fn, line)
+		}
+	}
+	var volume float64
+	for _, tri := range triangles {
+		a, b, c := vertices[tri[0]], vertices[tri[1]], vertices[tri[2]]
+		volume += float64(a[0])*(float64(b[1])*float64(c[2])-float64(b[2])*float64(c[1])) +
+			float64(a[1])*(float64(b[2])*float64(c[0])-float64(b[0])*float64(c[2])) +
+			float64(a[2])*(float64(b[0])*float64(c[1])-float64(b[1])*float64(c[0]))
+	}
+	return volume / 6.0
+}
+
+func TestMarchingCubes(t *testing.T) {
+	// every cube case must produce a closed surface when surrounded by empty voxels.
+	for cube := 1; cube < 256; cube++ {
+		for _, tri := range mcTriangles[cube] {
+			for _, edge := range tri {
+				c0, c1 := mcEdges[edge][0], mcEdges[edge][1]
+				if (cube>>c0)&1 == (cube>>c1)&1 {
+					t.Fatalf("cube case %d has triangle on edge %d that doesn't cross the surface\n", cube, edge)
+				}
+			}
+		}
+		mv := newMeshVolume(dvid.Point3d{4, 4, 4})
+		mask := make([]byte, 8)
+		var numVoxels int
+		for corner, off := range mcCornerOff {
+			if cube&(1<<uint(corner)) != 0 {
+				i := ((off[2]+1)*4+off[1]+1)*4 + off[0] + 1
+				mask[i>>3] |= 1 << uint(i&7)
+				numVoxels++
+			}
+		}
+		mv.masks[dvid.ChunkPoint3d{0, 0, 0}] = mask
+		m := mv.marchingCubes()
+		volume := checkMesh(t, m.vertices, m.triangles)
+		if volume <= 0 || volume > float64(numVoxels) {
+			t.Fatalf("cube case %d with %d voxels has bad mesh volume %f\n", cube, numVoxels, volume)
+		}
+	}
+
+	// a box crossing block boundaries.
+	mv := newMeshVolume(dvid.Point3d{8, 8, 8})
+	blockMask := func(bcoord dvid.ChunkPoint3d) []byte {
+		mask := make([]byte, 64)
+		for z := int32(0); z < 8; z++ {
+			for y := int32(0); y < 8; y++ {
+				for x := int32(0); x < 8; x++ {
+					gx, gy, gz := bcoord[0]*8+x, bcoord[1]*8+y, bcoord[2]*8+z
+					if gx >= 3 && gx < 13 && gy >= 5 && gy < 11 && gz >= 2 && gz < 12 {
+						i := (z*8+y)*8 + x
+						mask[i>>3] |= 1 << uint(i&7)
+					}
+				}
+			}
+		}
+		return mask
+	}
+	for z := int32(0); z < 2; z++ {
+		for y := int32(0); y < 2; y++ {
+			for x := int32(0); x < 2; x++ {
+				bcoord := dvid.ChunkPoint3d{x, y, z}
+				mv.masks[bcoord] = blockMask(bcoord)
+			}
+		}
+	}
+	m := mv.marchingCubes()
+	volume := checkMesh(t, m.vertices, m.triangles)
+	if volume < 9*5*9 || volume > 10*6*10 {
+		t.Fatalf("box mesh has unexpected volume %f\n", volume)
+	}
+	m.smooth(3)
+	checkMesh(t, m.vertices, m.triangles)
+	numVertices := len(m.vertices)
+	m.decimate(0.25)
+	if len(m.vertices) >= numVertices {
+		t.Fatalf("decimation did not reduce %d vertices\n", numVertices)
+	}
+}
+
+// parseTestDraco reads a Draco mesh with sequential connectivity, uncompressed indices and
+// a raw float32 position attribute.
+func parseTestDraco(t *testing.T, data []byte) (vertices [][3]float32, triangles [][3]uint32) {
+	buf := bytes.NewBuffer(data)
+	header := make([]byte, 11)
+	if _, err := buf.Read(header); err != nil || string(header[:5]) != "DRACO" {
+		t.Fatalf("bad draco header: %v\n", header)
+	}
+	if header[5] != 2 || header[6] != 2 || header[7] != 1 || header[8] != 0 || header[9] != 0 || header[10] != 0 {
+		t.Fatalf("expected draco 2.2 sequential triangular mesh without metadata, got header %v\n", header)
+	}
+	readVarint := func() uint64 {
+		val, err := binary.ReadUvarint(buf)
+		if err != nil {
+			t.Fatalf("bad draco varint: %v\n", err)
+		}
+		return val
+	}
+	readByte := func() byte {
+		b, err := buf.ReadByte()
+		if err != nil {
+			t.Fatalf("draco mesh ended early: %v\n", err)
+		}
+		return b
+	}
+	numFaces := readVarint()
+	numPoints := readVarint()
+	if method := readByte(); method != 1 {
+		t.Fatalf("expected uncompressed draco indices, got method %d\n", method)
+	}
+	triangles = make([][3]uint32, numFaces)
+	for f := range triangles {
+		for i := 0; i < 3; i++ {
+			switch {
+			case numPoints < 1<<8:
+				triangles[f][i] = uint32(readByte())
+			case numPoints < 1<<16:
+				triangles[f][i] = uint32(readByte()) | uint32(readByte())<<8
+			case numPoints < 1<<21:
+				triangles[f][i] = uint32(readVarint())
+			default:
+				var index [4]byte
+				for j := range index {
+					index[j] = readByte()
+				}
+				triangles[f][i] = binary.LittleEndian.Uint32(index[:])
+			}
+			if uint64(triangles[f][i]) >= numPoints {
+				t.Fatalf("draco face %d has bad vertex index %d\n", f, triangles[f][i])
+			}
+		}
+	}
+	if numDecoders, numAttrs := readByte(), readVarint(); numDecoders != 1 || numAttrs != 1 {
+		t.Fatalf("expected 1 draco attribute decoder with 1 attribute, got %d and %d\n", numDecoders, numAttrs)
+	}
+	attr := []byte{readByte(), readByte(), readByte(), readByte()}
+	if !bytes.Equal(attr, []byte{0, 9, 3, 0}) || readVarint() != 0 || readByte() != 0 {
+		t.Fatalf("expected generic float32 position attribute, got %v\n", attr)
+	}
+	vertices = make([][3]float32, numPoints)
+	if err := binary.Read(buf, binary.LittleEndian, vertices); err != nil {
+		t.Fatalf("unable to read draco positions: %v\n", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("draco mesh has %d extra bytes\n", buf.Len())
+	}
+	return
+}
+
+func TestDracoMesh(t *testing.T) {
+	for _, numVertices := range []int{4, 300, 70000, 1<<21 + 10} {
+		m := new(labelMesh)
+		for i := 0; i < numVertices; i++ {
+			m.vertices = append(m.vertices, [3]float32{float32(i), float32(i) / 2, -float32(i)})
+		}
+		step := numVertices/1000 + 1
+		for i := 0; i+2 < numVertices; i += step {
+			m.triangles = append(m.triangles, [3]uint32{uint32(i), uint32(i + 1), uint32(numVertices - 1)})
+		}
+		var buf bytes.Buffer
+		if err := m.writeDraco(&buf); err != nil {
+			t.Fatal(err)
+		}
+		vertices, triangles := parseTestDraco(t, buf.Bytes())
+		if !reflect.DeepEqual(vertices, m.vertices) || !reflect.DeepEqual(triangles, m.triangles) {
+			t.Fatalf("draco mesh with %d vertices did not round trip\n", numVertices)
+		}
+		if numVertices >= 1<<21 {
+			// indices of the last face start 12 bytes before the attribute decoder section.
+			data := buf.Bytes()
+			pos := len(data) - 12*numVertices - 8 - 12
+			last := m.triangles[len(m.triangles)-1]
+			for i := 0; i < 3; i++ {
+				if index := binary.LittleEndian.Uint32(data[pos+4*i:]); index != last[i] {
+					t.Fatalf("expected raw 32-bit index %d for large draco mesh, got %d\n", last[i], index)
+				}
+			}
+		}
+	}
+}
+
+func TestMeshHTTP(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	config.Set("VoxelSize", "8,8,8")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{20, 24, 28}, dvid.Point3d{20, 10, 12}, 7)
+	vol.addSubvol(dvid.Point3d{40, 24, 28}, dvid.Point3d{10, 10, 12}, 8)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/mesh/7", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "GET", reqStr, nil)
+	if len(data) < 4 {
+		t.Fatalf("bad ngmesh response of %d bytes\n", len(data))
+	}
+	numVertices := int(binary.LittleEndian.Uint32(data[0:4]))
+	numTriangles := (len(data) - 4 - 12*numVertices) / 12
+	if numVertices == 0 || 4+12*numVertices+12*numTriangles != len(data) {
+		t.Fatalf("bad ngmesh response of %d bytes with %d vertices\n", len(data), numVertices)
+	}
+	vertices := make([][3]float32, numVertices)
+	if err := binary.Read(bytes.NewBuffer(data[4:4+12*numVertices]), binary.LittleEndian, vertices); err != nil {
+		t.Fatalf("unable to read mesh vertices: %v\n", err)
+	}
+	triangles := make([][3]uint32, numTriangles)
+	if err := binary.Read(bytes.NewBuffer(data[4+12*numVertices:]), binary.LittleEndian, triangles); err != nil {
+		t.Fatalf("unable to read mesh triangles: %v\n", err)
+	}
+	volume := checkMesh(t, vertices, triangles) / (8 * 8 * 8)
+	if volume < 19*9*11 || volume > 20*10*12 {
+		t.Fatalf("expected mesh volume near %d voxels, got %f\n", 20*10*12, volume)
+	}
+	for _, vertex := range vertices {
+		if vertex[0] < 19*8 || vertex[0] > 40*8 {
+			t.Fatalf("mesh vertex %v outside expected bounds\n", vertex)
+		}
+	}
+
+	// merged labels should mesh as one body while supervoxels are meshed separately.
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[7, 8]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/7?format=obj&scale=0", server.WebAPIPath, uuid)
+	objMerged := string(server.TestHTTP(t, "GET", reqStr, nil))
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/8?format=obj&supervoxels=true", server.WebAPIPath, uuid)
+	objSV := string(server.TestHTTP(t, "GET", reqStr, nil))
+	if !strings.HasPrefix(objSV, "v ") || !strings.Contains(objSV, "\nf ") {
+		t.Fatalf("bad obj response: %s\n", objSV)
+	}
+	if strings.Count(objMerged, "\nf ") <= strings.Count(objSV, "\nf ") {
+		t.Fatalf("expected merged body mesh to be larger than supervoxel mesh\n")
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/7?smoothing=2&decimation=0.5", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", reqStr, nil)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/8", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/7?format=ngmesh", server.WebAPIPath, uuid)
+	ngData := server.TestHTTP(t, "GET", reqStr, nil)
+	numVertices = int(binary.LittleEndian.Uint32(ngData[0:4]))
+	ngVertices := make([][3]float32, numVertices)
+	if err := binary.Read(bytes.NewBuffer(ngData[4:4+12*numVertices]), binary.LittleEndian, ngVertices); err != nil {
+		t.Fatalf("unable to read mesh vertices: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/7?format=drc", server.WebAPIPath, uuid)
+	drcVertices, drcTriangles := parseTestDraco(t, server.TestHTTP(t, "GET", reqStr, nil))
+	if !reflect.DeepEqual(drcVertices, ngVertices) || 4+12*numVertices+12*len(drcTriangles) != len(ngData) {
+		t.Fatalf("draco mesh with %d vertices and %d triangles differs from ngmesh\n", len(drcVertices), len(drcTriangles))
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/7?format=stl", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/mesh/7?decimation=2", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+type testSWCNode struct {
+	x, y, z, radius float64
+	parent          int
+}
+
+func parseTestSWC(t *testing.T, swc string) map[int]testSWCNode {
+	nodes := make(map[int]testSWCNode)
+	for _, line := range strings.Split(swc, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var id, nodeType int
+		var node testSWCNode
+		if _, err := fmt.Sscanf(line, "%d %d %g %g %g %g %d", &id, &nodeType, &node.x, &node.y, &node.z, &node.radius, &node.parent); err != nil {
+			t.Fatalf("bad SWC line %q: %v\n", line, err)
+		}
+		if node.parent != -1 {
+			if _, found := nodes[node.parent]; !found {
+				t.Fatalf("SWC node %d has parent %d that wasn't previously defined\n", id, node.parent)
+			}
+		}
+		nodes[id] = node
+	}
+	return nodes
+}
+
+func TestSkeletonThinning(t *testing.T) {
+	sv := newSkelVolume(dvid.Point3d{16, 16, 16})
+	for bx := int32(0); bx < 3; bx++ {
+		sb := &skelBlock{fg: make([]bool, 4096), dist: make([]float32, 4096)}
+		for z := 5; z < 11; z++ {
+			for y := 5; y < 11; y++ {
+				for x := 0; x < 16; x++ {
+					sb.fg[z*256+y*16+x] = bx*16+int32(x) >= 2 && bx*16+int32(x) < 46
+				}
+			}
+		}
+		sv.blocks[dvid.ChunkPoint3d{bx, 0, 0}] = sb
+	}
+	voxels := sv.foreground()
+	sv.computeDistances(voxels)
+	voxels = sv.thin(voxels)
+	if len(voxels) < 34 {
+		t.Fatalf("expected bar to thin to a line of at least 34 voxels, got %d: %v\n", len(voxels), voxels)
+	}
+	for _, pt := range voxels {
+		if pt[1] != voxels[0][1] || pt[2] != voxels[0][2] {
+			t.Fatalf("expected bar to thin to a straight line, got %v\n", voxels)
+		}
+	}
+	nodes := sv.buildSkeleton(voxels, 0)
+	var numRoots int
+	for _, node := range nodes {
+		if node.parent == -1 {
+			numRoots++
+		}
+		if node.radius < 2 || node.radius > 4 {
+			t.Fatalf("bad radius for skeleton node: %v\n", node)
+		}
+	}
+	if numRoots != 1 {
+		t.Fatalf("expected single tree for bar skeleton, got %d roots\n", numRoots)
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	// T-shaped body crossing block boundaries.
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{2, 28, 28}, dvid.Point3d{60, 6, 6}, 9)
+	vol.addSubvol(dvid.Point3d{28, 34, 28}, dvid.Point3d{6, 26, 6}, 9)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	inBody := func(node testSWCNode) bool {
+		if node.x >= 2 && node.x < 62 && node.y >= 28 && node.y < 34 && node.z >= 28 && node.z < 34 {
+			return true
+		}
+		return node.x >= 28 && node.x < 34 && node.y >= 34 && node.y < 60 && node.z >= 28 && node.z < 34
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/skeleton/9", server.WebAPIPath, uuid)
+	swc := string(server.TestHTTP(t, "GET", reqStr, nil))
+	nodes := parseTestSWC(t, swc)
+	if len(nodes) < 60 {
+		t.Fatalf("expected skeleton with at least 60 nodes, got %d: %s\n", len(nodes), swc)
+	}
+	degree := make(map[int]int)
+	var numRoots int
+	var minx, maxx, maxy float64 = 64, 0, 0
+	for id, node := range nodes {
+		if !inBody(node) {
+			t.Fatalf("skeleton node %d (%v) lies outside body\n", id, node)
+		}
+		if node.radius < 1 || node.radius > 4 {
+			t.Fatalf("skeleton node %d has bad radius %f\n", id, node.radius)
+		}
+		if node.parent == -1 {
+			numRoots++
+		} else {
+			degree[id]++
+			degree[node.parent]++
+		}
+		minx = math.Min(minx, node.x)
+		maxx = math.Max(maxx, node.x)
+		maxy = math.Max(maxy, node.y)
+	}
+	if numRoots != 1 {
+		t.Fatalf("expected a single skeleton tree, got %d roots\n", numRoots)
+	}
+	var branches int
+	for _, deg := range degree {
+		if deg > 2 {
+			branches++
+		}
+	}
+	if branches == 0 {
+		t.Fatalf("expected branch point in skeleton of T-shaped body\n")
+	}
+	if minx > 10 || maxx < 54 || maxy < 52 {
+		t.Fatalf("skeleton doesn't span body: x in [%f, %f], max y %f\n", minx, maxx, maxy)
+	}
+
+	// lower resolution skeletons are in scale 0 coordinates.
+	reqStr = fmt.Sprintf("%snode/%s/labels/skeleton/9?scale=1", server.WebAPIPath, uuid)
+	nodes = parseTestSWC(t, string(server.TestHTTP(t, "GET", reqStr, nil)))
+	if len(nodes) == 0 {
+		t.Fatalf("expected scale 1 skeleton nodes\n")
+	}
+	for id, node := range nodes {
+		if node.x < 0 || node.x > 64 || node.y < 24 || node.y > 64 {
+			t.Fatalf("scale 1 skeleton node %d (%v) not in scale 0 coordinates\n", id, node)
+		}
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/skeleton/10", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	// storing requires a synced keyvalue.
+	reqStr = fmt.Sprintf("%snode/%s/labels/skeleton/9?store=true", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	server.CreateTestInstance(t, uuid, "keyvalue", "skeletons", dvid.Config{})
+	server.CreateTestSync(t, uuid, "labels", "skeletons")
+	server.TestHTTP(t, "GET", reqStr, nil)
+
+	reqStr = fmt.Sprintf("%snode/%s/skeletons/key/9_swc", server.WebAPIPath, uuid)
+	stored := string(server.TestHTTP(t, "GET", reqStr, nil))
+	if stored != swc {
+		t.Fatalf("stored skeleton differs from returned skeleton:\n%s\n", stored)
+	}
+
+	// syncs to labelmap instances are still accepted and don't affect storing skeletons.
+	server.CreateTestInstance(t, uuid, "labelmap", "labels2", config)
+	server.CreateTestSync(t, uuid, "labels", "labels2")
+	reqStr = fmt.Sprintf("%snode/%s/labels/skeleton/9?store=true", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", reqStr, nil)
+}
+
+func TestNeighborsContact(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	// label 1 touches label 2 across a block boundary and label 3 within a block.
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{20, 10, 10}, dvid.Point3d{12, 10, 10}, 1)
+	vol.addSubvol(dvid.Point3d{32, 10, 10}, dvid.Point3d{12, 10, 10}, 2)
+	vol.addSubvol(dvid.Point3d{20, 20, 10}, dvid.Point3d{6, 5, 10}, 3)
+	vol.addSubvol(dvid.Point3d{50, 50, 50}, dvid.Point3d{5, 5, 5}, 4)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	var resp struct {
+		Label     uint64
+		Neighbors []LabelContact
+	}
+	getNeighbors := func(label uint64, query string) []LabelContact {
+		reqStr := fmt.Sprintf("%snode/%s/labels/neighbors/%d%s", server.WebAPIPath, uuid, label, query)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		if err := json.Unmarshal(r, &resp); err != nil {
+			t.Fatalf("unable to parse neighbors response %q: %v\n", string(r), err)
+		}
+		if resp.Label != label {
+			t.Fatalf("expected neighbors response for label %d, got %q\n", label, string(r))
+		}
+		return resp.Neighbors
+	}
+	expected := []LabelContact{{Label: 2, Contact: 100}, {Label: 3, Contact: 60}}
+	if got := getNeighbors(1, ""); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected neighbors %v, got %v\n", expected, got)
+	}
+	if got := getNeighbors(4, ""); len(got) != 0 {
+		t.Fatalf("expected no neighbors for label 4, got %v\n", got)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[2, 3]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	expected = []LabelContact{{Label: 2, Contact: 160}}
+	if got := getNeighbors(1, ""); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected neighbors %v after merge, got %v\n", expected, got)
+	}
+	expected = []LabelContact{{Label: 1, Contact: 160}}
+	if got := getNeighbors(2, ""); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected neighbors %v for merged body, got %v\n", expected, got)
+	}
+	expected = []LabelContact{{Label: 2, Contact: 100}, {Label: 3, Contact: 60}}
+	if got := getNeighbors(1, "?supervoxels=true"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected supervoxel neighbors %v, got %v\n", expected, got)
+	}
+	expected = []LabelContact{{Label: 1, Contact: 60}}
+	if got := getNeighbors(3, "?supervoxels=true"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected supervoxel neighbors %v, got %v\n", expected, got)
+	}
+
+	// interface between supervoxels 1 and 2 is a 2x10x10 slab across the block boundary.
+	reqStr = fmt.Sprintf("%snode/%s/labels/contact/1/2?supervoxels=true", server.WebAPIPath, uuid)
+	encoding := server.TestHTTP(t, "GET", reqStr, nil)
+	rles, err := dvid.ReadRLEs(bytes.NewBuffer(encoding))
+	if err != nil {
+		t.Fatalf("unable to read contact RLEs: %v\n", err)
+	}
+	numVoxels, numRuns := rles.Stats()
+	if numVoxels != 200 || numRuns != 100 {
+		t.Fatalf("expected 200 voxels in 100 runs for contact, got %d voxels in %d runs\n", numVoxels, numRuns)
+	}
+	for _, rle := range rles {
+		start := rle.StartPt()
+		if start[0] != 31 || rle.Length() != 2 {
+			t.Fatalf("bad contact run: %s\n", rle)
+		}
+	}
+
+	// merged body 2 contacts body 1 with both supervoxels.
+	reqStr = fmt.Sprintf("%snode/%s/labels/contact/2/1", server.WebAPIPath, uuid)
+	rles, err = dvid.ReadRLEs(bytes.NewBuffer(server.TestHTTP(t, "GET", reqStr, nil)))
+	if err != nil {
+		t.Fatalf("unable to read contact RLEs: %v\n", err)
+	}
+	if numVoxels, _ = rles.Stats(); numVoxels != 200+120 {
+		t.Fatalf("expected 320 voxels in merged body contact, got %d\n", numVoxels)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/contact/1/4", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/neighbors/5", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestComponents(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	// supervoxel 9 only touches supervoxel 7 at a corner while supervoxel 8 is separate.
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{4, 4, 4}, dvid.Point3d{10, 10, 10}, 7)
+	vol.addSubvol(dvid.Point3d{14, 14, 14}, dvid.Point3d{4, 4, 4}, 9)
+	vol.addSubvol(dvid.Point3d{30, 40, 40}, dvid.Point3d{5, 5, 5}, 8)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[7, 8, 9]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	getComponents := func(label uint64) []LabelComponent {
+		reqStr := fmt.Sprintf("%snode/%s/labels/components/%d", server.WebAPIPath, uuid, label)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var components []LabelComponent
+		if err := json.Unmarshal(r, &components); err != nil {
+			t.Fatalf("unable to parse components response %q: %v\n", string(r), err)
+		}
+		return components
+	}
+	expected := []LabelComponent{
+		{Voxels: 1064, MinVoxel: dvid.Point3d{4, 4, 4}, MaxVoxel: dvid.Point3d{17, 17, 17}, Supervoxels: []uint64{7, 9}},
+		{Voxels: 125, MinVoxel: dvid.Point3d{30, 40, 40}, MaxVoxel: dvid.Point3d{34, 44, 44}, Supervoxels: []uint64{8}},
+	}
+	if got := getComponents(7); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected components %v, got %v\n", expected, got)
+	}
+
+	// split is refused while another user holds a lease on the body.
+	lockReq := fmt.Sprintf("%snode/%s/labels/lock/7?u=alice", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", lockReq, nil)
+	splitReq := fmt.Sprintf("%snode/%s/labels/components/7/split", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", splitReq+"?u=bob", nil)
+	server.TestHTTP(t, "DELETE", lockReq, nil)
+
+	r := server.TestHTTP(t, "POST", splitReq, nil)
+	var cleaves []ComponentCleave
+	if err := json.Unmarshal(r, &cleaves); err != nil {
+		t.Fatalf("unable to parse split response %q: %v\n", string(r), err)
+	}
+	if len(cleaves) != 1 || cleaves[0].Voxels != 125 || !reflect.DeepEqual(cleaves[0].Supervoxels, []uint64{8}) {
+		t.Fatalf("unexpected components split response: %s\n", string(r))
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if got := getComponents(7); !reflect.DeepEqual(got, expected[:1]) {
+		t.Fatalf("expected components %v after split, got %v\n", expected[:1], got)
+	}
+	if got := getComponents(cleaves[0].CleavedLabel); !reflect.DeepEqual(got, expected[1:]) {
+		t.Fatalf("expected components %v for cleaved label, got %v\n", expected[1:], got)
+	}
+
+	// splitting a connected body does nothing.
+	if r = server.TestHTTP(t, "POST", splitReq, nil); string(r) != "[]" {
+		t.Fatalf("expected no cleaves for connected body, got %s\n", string(r))
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/components/5", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestPrecomputed(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	config.Set("VoxelSize", "8,8,8")
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{20, 24, 28}, dvid.Point3d{20, 10, 12}, 7)
+	vol.addSubvol(dvid.Point3d{40, 24, 28}, dvid.Point3d{10, 10, 12}, 8)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/precomputed/info", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "GET", reqStr, nil)
+	var info ngInfo
+	if err := json.Unmarshal(r, &info); err != nil {
+		t.Fatalf("bad precomputed info %q: %v\n", string(r), err)
+	}
+	if info.StoreType != "neuroglancer_multiscale_volume" || info.VolumeType != "segmentation" || info.DataType != "uint64" || len(info.Scales) != 2 {
+		t.Fatalf("bad precomputed info: %s\n", string(r))
+	}
+	expectedScale := ngScaleInfo{
+		Key:         "1",
+		Resolution:  [3]float32{16, 16, 16},
+		Size:        [3]int32{32, 32, 32},
+		ChunkSizes:  [][3]int32{{32, 32, 32}},
+		Encoding:    "compressed_segmentation",
+		CSBlockSize: [3]int32{8, 8, 8},
+	}
+	if !reflect.DeepEqual(info.Scales[1], expectedScale) {
+		t.Fatalf("expected scale 1 info %v, got %v\n", expectedScale, info.Scales[1])
+	}
+	if info.Scales[0].Size != [3]int32{64, 64, 64} || info.Scales[0].Resolution != [3]float32{8, 8, 8} {
+		t.Fatalf("bad scale 0 info: %v\n", info.Scales[0])
+	}
+
+	// merge so mapped and supervoxel chunks differ.
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[7, 8]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	checkChunk := func(chunk, size, offset string, scale uint8, supervoxels bool) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/precomputed/%d/%s?supervoxels=%t", server.WebAPIPath, uuid, scale, chunk, supervoxels)
+		got := server.TestHTTP(t, "GET", reqStr, nil)
+		reqStr = fmt.Sprintf("%snode/%s/labels/raw/0_1_2/%s/%s?compression=google&scale=%d&supervoxels=%t", server.WebAPIPath, uuid, size, offset, scale, supervoxels)
+		expected := server.TestHTTP(t, "GET", reqStr, nil)
+		if !bytes.Equal(got, expected) {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("precomputed chunk %s at scale %d not equal to compressed raw data [%s:%d]\n", chunk, scale, fn, line)
+		}
+	}
+	checkChunk("32-64_0-32_0-32", "32_32_32", "32_0_0", 0, false)
+	checkChunk("32-64_0-32_0-32", "32_32_32", "32_0_0", 0, true)
+	checkChunk("32-44_24-30_28-40", "16_8_16", "32_24_28", 0, false)
+	checkChunk("0-32_0-32_0-32", "32_32_32", "0_0_0", 1, false)
+
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/labels/precomputed/2/0-32_0-32_0-32", server.WebAPIPath, uuid), nil)
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/labels/precomputed/0/0-32_0-32", server.WebAPIPath, uuid), nil)
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/labels/precomputed/0/32-0_0-32_0-32", server.WebAPIPath, uuid), nil)
+}
+
+func TestBodyBBox(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	// L-shaped supervoxel 10 spanning blocks plus small supervoxel 20 merged into body 10.
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{5, 6, 7}, dvid.Point3d{40, 4, 3}, 10)
+	vol.addSubvol(dvid.Point3d{5, 10, 7}, dvid.Point3d{3, 40, 3}, 10)
+	vol.addSubvol(dvid.Point3d{50, 50, 50}, dvid.Point3d{4, 4, 4}, 20)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[10, 20]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	checkBBox := func(bbox *BodyBBox, voxels uint64, minPt, maxPt dvid.Point3d) {
+		if bbox == nil {
+			t.Fatalf("expected bounding box, got nil\n")
+		}
+		if bbox.Voxels != voxels || bbox.MinVoxel != minPt || bbox.MaxVoxel != maxPt {
+			t.Fatalf("expected %d voxels within %s-%s, got %v\n", voxels, minPt, maxPt, *bbox)
+		}
+		for dim := 0; dim < 3; dim++ {
+			if bbox.Centroid[dim] < float64(minPt[dim]) || bbox.Centroid[dim] > float64(maxPt[dim]) {
+				t.Fatalf("centroid %v is outside bounding box %s-%s\n", bbox.Centroid, minPt, maxPt)
+			}
+		}
+		reqStr := fmt.Sprintf("%snode/%s/labels/label/%d_%d_%d?supervoxels=true", server.WebAPIPath, uuid, bbox.Anchor[0], bbox.Anchor[1], bbox.Anchor[2])
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var jsonVal struct {
+			Label uint64
+		}
+		if err := json.Unmarshal(r, &jsonVal); err != nil {
+			t.Fatalf("unable to decode label response: %v\n", err)
+		}
+		if jsonVal.Label != 10 && jsonVal.Label != 20 {
+			t.Fatalf("anchor %s is not inside body, has supervoxel %d\n", bbox.Anchor, jsonVal.Label)
+		}
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/bbox/10", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "GET", reqStr, nil)
+	var bbox BodyBBox
+	if err := json.Unmarshal(r, &bbox); err != nil {
+		t.Fatalf("unable to decode bbox response %q: %v\n", string(r), err)
+	}
+	checkBBox(&bbox, 904, dvid.Point3d{5, 6, 7}, dvid.Point3d{53, 53, 53})
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/bbox/10?supervoxels=true", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	if err := json.Unmarshal(r, &bbox); err != nil {
+		t.Fatalf("unable to decode bbox response %q: %v\n", string(r), err)
+	}
+	checkBBox(&bbox, 840, dvid.Point3d{5, 6, 7}, dvid.Point3d{44, 49, 9})
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/bbox/20", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/bboxes", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[10, 99]"))
+	var bboxes []*BodyBBox
+	if err := json.Unmarshal(r, &bboxes); err != nil {
+		t.Fatalf("unable to decode bboxes response %q: %v\n", string(r), err)
+	}
+	if len(bboxes) != 2 || bboxes[1] != nil {
+		t.Fatalf("expected bbox for label 10 and null for label 99, got %s\n", string(r))
+	}
+	checkBBox(bboxes[0], 904, dvid.Point3d{5, 6, 7}, dvid.Point3d{53, 53, 53})
+}
+
+func TestExportZarr(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{5, 6, 7}, dvid.Point3d{4, 4, 4}, 10)
+	vol.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{4, 4, 4}, 20)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[10, 20]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// ROI that only covers the first block.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", dvid.Config{})
+	reqStr = fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[[0,0,0,0]]"))
+
+	dataservice, err := datastore.GetDataByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Can't convert dataservice %v into labelmap.Data\n", dataservice)
+	}
+
+	dir, err := ioutil.TempDir("", "dvid-zarr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	readChunk := func(path string) []byte {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("unable to open zarr chunk %s: %v\n", path, err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("unable to gunzip zarr chunk %s: %v\n", path, err)
+		}
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("unable to read zarr chunk %s: %v\n", path, err)
+		}
+		if len(data) != 32*32*32*8 {
+			t.Fatalf("expected zarr chunk %s to have %d bytes, got %d\n", path, 32*32*32*8, len(data))
+		}
+		return data
+	}
+	chunkLabel := func(data []byte, x, y, z int32) uint64 {
+		i := ((z*32+y)*32 + x) * 8
+		return binary.LittleEndian.Uint64(data[i : i+8])
+	}
+
+	if err := d.ExportZarr(v, dir, ZarrExportOptions{}); err != nil {
+		t.Fatalf("error exporting zarr: %v\n", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "s0", ".zarray"))
+	if err != nil {
+		t.Fatalf("unable to read .zarray: %v\n", err)
+	}
+	var zarray zarrArray
+	if err := json.Unmarshal(data, &zarray); err != nil {
+		t.Fatalf("unable to decode .zarray %q: %v\n", string(data), err)
+	}
+	if zarray.Shape != [3]int32{64, 64, 64} || zarray.Chunks != [3]int32{32, 32, 32} || zarray.DType != "<u8" {
+		t.Fatalf("unexpected .zarray: %s\n", string(data))
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, ".zattrs"))
+	if err != nil {
+		t.Fatalf("unable to read .zattrs: %v\n", err)
+	}
+	var attrs struct {
+		Multiscales []omeMultiscale `json:"multiscales"`
+	}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		t.Fatalf("unable to decode .zattrs %q: %v\n", string(data), err)
+	}
+	if len(attrs.Multiscales) != 1 || len(attrs.Multiscales[0].Datasets) != 1 || attrs.Multiscales[0].Datasets[0].Path != "s0" {
+		t.Fatalf("unexpected .zattrs: %s\n", string(data))
+	}
+	chunk := readChunk(filepath.Join(dir, "s0", "0", "0", "0"))
+	if label := chunkLabel(chunk, 6, 7, 8); label != 10 {
+		t.Fatalf("expected supervoxel 10 at (6,7,8), got %d\n", label)
+	}
+	if label := chunkLabel(chunk, 20, 20, 20); label != 0 {
+		t.Fatalf("expected label 0 at (20,20,20), got %d\n", label)
+	}
+	chunk = readChunk(filepath.Join(dir, "s0", "1", "1", "1"))
+	if label := chunkLabel(chunk, 9, 9, 9); label != 20 {
+		t.Fatalf("expected supervoxel 20 at (41,41,41), got %d\n", label)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "s0", "0", "1", "1")); !os.IsNotExist(err) {
+		t.Fatalf("expected no zarr chunk for empty block, got err %v\n", err)
+	}
+
+	// Mapped export within ROI should only have the first block with body labels.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ExportZarr(v, dir, ZarrExportOptions{ROI: "myroi", Mapped: true}); err != nil {
+		t.Fatalf("error exporting zarr: %v\n", err)
+	}
+	chunk = readChunk(filepath.Join(dir, "s0", "0", "0", "0"))
+	if label := chunkLabel(chunk, 6, 7, 8); label != 10 {
+		t.Fatalf("expected body 10 at (6,7,8), got %d\n", label)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "s0", "1", "1", "1")); !os.IsNotExist(err) {
+		t.Fatalf("expected no zarr chunk for block outside ROI, got err %v\n", err)
+	}
+}
+
+func TestBodyStats(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	// body 10 is a 16x10x10 box crossing a block boundary made of two supervoxels.
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{24, 4, 4}, dvid.Point3d{10, 10, 10}, 10)
+	vol.addSubvol(dvid.Point3d{34, 4, 4}, dvid.Point3d{6, 10, 10}, 20)
+	vol.addSubvol(dvid.Point3d{50, 50, 50}, dvid.Point3d{4, 4, 4}, 30)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[10, 20]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	expected := BodyStats{
+		Label:          10,
+		Voxels:         1600,
+		SurfaceArea:    2 * (16*10 + 16*10 + 10*10),
+		MinVoxel:       dvid.Point3d{24, 4, 4},
+		MaxVoxel:       dvid.Point3d{39, 13, 13},
+		NumBlocks:      2,
+		NumSupervoxels: 2,
+	}
+	for _, scale := range []uint8{0, 1} {
+		reqStr = fmt.Sprintf("%snode/%s/labels/stats/10?scale=%d", server.WebAPIPath, uuid, scale)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var stats BodyStats
+		if err := json.Unmarshal(r, &stats); err != nil {
+			t.Fatalf("unable to decode stats response %q: %v\n", string(r), err)
+		}
+		expected.Scale = scale
+		if stats != expected {
+			t.Fatalf("expected stats %v at scale %d, got %v\n", expected, scale, stats)
+		}
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/stats/99", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/stats", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[30, 99, 10]"))
+	var statsList []*BodyStats
+	if err := json.Unmarshal(r, &statsList); err != nil {
+		t.Fatalf("unable to decode stats response %q: %v\n", string(r), err)
+	}
+	if len(statsList) != 3 || statsList[0] == nil || statsList[0].SurfaceArea != 96 || statsList[1] != nil || statsList[2] == nil || statsList[2].Label != 10 {
+		t.Fatalf("unexpected batch stats: %s\n", string(r))
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/stats?sort=surface&n=1", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[30, 99, 10]"))
+	statsList = nil
+	if err := json.Unmarshal(r, &statsList); err != nil {
+		t.Fatalf("unable to decode stats response %q: %v\n", string(r), err)
+	}
+	if len(statsList) != 1 || statsList[0].Label != 10 {
+		t.Fatalf("unexpected sorted batch stats: %s\n", string(r))
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/stats?sort=color", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString("[30, 10]"))
+}
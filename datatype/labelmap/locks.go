@@ -0,0 +1,199 @@
+/*
+	This file supports per-body leases that let a proofreader check out a body so that
+	merges, cleaves and splits by other users on that body are refused.  Leases are held
+	in memory, expire after a time-to-live, and apply only to the version in which they
+	were acquired.
+*/
+
+package labelmap
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// DefaultLeaseTTL is the duration of a body lease if no time-to-live is specified.
+const DefaultLeaseTTL = time.Hour
+
+// BodyLease describes a user's checkout of a body.
+type BodyLease struct {
+	Label   uint64
+	User    string
+	Expires time.Time
+}
+
+// LeaseConflictError is returned when an operation is refused because a body is
+// leased by another user.
+type LeaseConflictError struct {
+	Label uint64
+	User  string
+}
+
+func (e LeaseConflictError) Error() string {
+	return fmt.Sprintf("body %d is currently locked by user %q", e.Label, e.User)
+}
+
+type leaseKey struct {
+	data dvid.UUID
+	v    dvid.VersionID
+}
+
+type instanceLeases struct {
+	leases map[leaseKey]map[uint64]BodyLease
+	sync.Mutex
+}
+
+var (
+	iLeases instanceLeases
+)
+
+func init() {
+	iLeases.leases = make(map[leaseKey]map[uint64]BodyLease)
+}
+
+// returns the unexpired leases for the data version, removing any expired ones.
+// The caller must hold the iLeases lock.
+func (d *Data) activeLeases(v dvid.VersionID) map[uint64]BodyLease {
+	key := leaseKey{d.DataUUID(), v}
+	leases, found := iLeases.leases[key]
+	if !found {
+		leases = make(map[uint64]BodyLease)
+		iLeases.leases[key] = leases
+		return leases
+	}
+	now := time.Now()
+	for label, lease := range leases {
+		if now.After(lease.Expires) {
+			delete(leases, label)
+		}
+	}
+	return leases
+}
+
+// LockBody acquires or renews a lease on a body for the given user.  A LeaseConflictError
+// is returned if the body is already leased by another user.
+func (d *Data) LockBody(v dvid.VersionID, label uint64, user string, ttl time.Duration) (lease BodyLease, err error) {
+	if user == "" {
+		err = fmt.Errorf("a user must be specified to lock body %d", label)
+		return
+	}
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	iLeases.Lock()
+	defer iLeases.Unlock()
+
+	leases := d.activeLeases(v)
+	if cur, found := leases[label]; found && cur.User != user {
+		err = LeaseConflictError{Label: label, User: cur.User}
+		return
+	}
+	lease = BodyLease{Label: label, User: user, Expires: time.Now().Add(ttl)}
+	leases[label] = lease
+	return
+}
+
+// UnlockBody releases the lease on a body held by the given user.  It is not an error
+// to release a body that has no lease.
+func (d *Data) UnlockBody(v dvid.VersionID, label uint64, user string) error {
+	iLeases.Lock()
+	defer iLeases.Unlock()
+
+	leases := d.activeLeases(v)
+	cur, found := leases[label]
+	if !found {
+		return nil
+	}
+	if cur.User != user {
+		return LeaseConflictError{Label: label, User: cur.User}
+	}
+	delete(leases, label)
+	return nil
+}
+
+// GetBodyLeases returns the unexpired body leases for the version sorted by label.
+func (d *Data) GetBodyLeases(v dvid.VersionID) []BodyLease {
+	iLeases.Lock()
+	leases := d.activeLeases(v)
+	out := make([]BodyLease, 0, len(leases))
+	for _, lease := range leases {
+		out = append(out, lease)
+	}
+	iLeases.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Label < out[j].Label })
+	return out
+}
+
+// checkBodyLeases returns a LeaseConflictError if any of the given bodies is leased by
+// a user other than the given user.
+func (d *Data) checkBodyLeases(v dvid.VersionID, user string, bodies ...uint64) error {
+	iLeases.Lock()
+	defer iLeases.Unlock()
+
+	leases := d.activeLeases(v)
+	for _, label := range bodies {
+		if cur, found := leases[label]; found && cur.User != user {
+			return LeaseConflictError{Label: label, User: cur.User}
+		}
+	}
+	return nil
+}
+
+// checkBodyLeaseSet returns a LeaseConflictError if any body of the set is leased by a user
+// other than the given user.
+func (d *Data) checkBodyLeaseSet(v dvid.VersionID, user string, bodies labels.Set) error {
+	labelList := make([]uint64, 0, len(bodies))
+	for label := range bodies {
+		labelList = append(labelList, label)
+	}
+	return d.checkBodyLeases(v, user, labelList...)
+}
+
+// mergeBodyLeases releases the leases of bodies merged into the target.  If the target
+// has no lease, it receives the longest-lived lease of the merged bodies so the user
+// that checked out a merged body retains the resulting body.
+func (d *Data) mergeBodyLeases(v dvid.VersionID, target uint64, merged []uint64) {
+	iLeases.Lock()
+	defer iLeases.Unlock()
+
+	leases := d.activeLeases(v)
+	var transfer *BodyLease
+	for _, label := range merged {
+		lease, found := leases[label]
+		if !found {
+			continue
+		}
+		delete(leases, label)
+		if transfer == nil || lease.Expires.After(transfer.Expires) {
+			transfer = &lease
+		}
+	}
+	if _, found := leases[target]; !found && transfer != nil {
+		transfer.Label = target
+		leases[target] = *transfer
+		dvid.Infof("Transferred lock of user %q from merged body to body %d\n", transfer.User, target)
+	}
+}
+
+// renumberBodyLeases moves the leases of renumbered bodies to their new labels.
+func (d *Data) renumberBodyLeases(v dvid.VersionID, mapping map[uint64]uint64) {
+	iLeases.Lock()
+	defer iLeases.Unlock()
+
+	key := leaseKey{d.DataUUID(), v}
+	leases := d.activeLeases(v)
+	renumbered := make(map[uint64]BodyLease, len(leases))
+	for label, lease := range leases {
+		if newLabel, found := mapping[label]; found {
+			lease.Label = newLabel
+		}
+		renumbered[lease.Label] = lease
+	}
+	iLeases.leases[key] = renumbered
+}
@@ -0,0 +1,550 @@
+/*
+	This file supports on-the-fly mesh generation for bodies and supervoxels using
+	marching cubes over the label blocks listed in a label index.
+*/
+
+package labelmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Marching cubes corner i is at offset (i&1, (i>>1)&1, (i>>2)&1) from the cell's lower corner.
+// Edges connect corners that differ in exactly one offset bit.
+var (
+	mcEdges     [12][2]uint8    // corner pair for each edge, lower corner first
+	mcEdgeIndex [8][8]int8      // edge index for a corner pair or -1
+	mcTriangles [256][][3]uint8 // triangles as edge index triples for each cube case
+	mcEdgeAxis  [12]uint8       // axis along which each edge runs
+	mcCornerOff [8][3]int32     // offset of each corner
+)
+
+func init() {
+	for i := 0; i < 8; i++ {
+		mcCornerOff[i] = [3]int32{int32(i & 1), int32((i >> 1) & 1), int32((i >> 2) & 1)}
+		for j := 0; j < 8; j++ {
+			mcEdgeIndex[i][j] = -1
+		}
+	}
+	var numEdges int
+	for a := uint8(0); a < 8; a++ {
+		for axis := uint8(0); axis < 3; axis++ {
+			b := a | (1 << axis)
+			if b == a {
+				continue
+			}
+			mcEdges[numEdges] = [2]uint8{a, b}
+			mcEdgeAxis[numEdges] = axis
+			mcEdgeIndex[a][b] = int8(numEdges)
+			mcEdgeIndex[b][a] = int8(numEdges)
+			numEdges++
+		}
+	}
+	for cube := 1; cube < 255; cube++ {
+		mcTriangles[cube] = mcTriangulate(uint8(cube))
+	}
+}
+
+// mcTriangulate computes the triangles for a cube case by tracing the iso-contour on each
+// of the cube faces and chaining the face segments into closed polygons.  Ambiguous faces
+// always separate the inside corners, so neighboring cubes agree on shared faces and the
+// resulting surface is closed.
+func mcTriangulate(cube uint8) [][3]uint8 {
+	inside := func(corner uint8) bool { return cube&(1<<corner) != 0 }
+
+	// next[e] is the edge reached by following the contour from edge e.
+	next := make(map[uint8]uint8, 12)
+	for axis := uint8(0); axis < 3; axis++ {
+		u, v := (axis+1)%3, (axis+2)%3
+		if u > v {
+			u, v = v, u
+		}
+		for side := uint8(0); side < 2; side++ {
+			base := side << axis
+			cycle := [4]uint8{base, base | 1<<u, base | 1<<u | 1<<v, base | 1<<v}
+
+			// make the cycle counter-clockwise when viewed from outside the cube.
+			ccwAxisPositive := axis != 1 // u x v is +x, -y, +z for axis x, y, z
+			if ccwAxisPositive != (side == 1) {
+				cycle[1], cycle[3] = cycle[3], cycle[1]
+			}
+			var entering, leaving []uint8
+			for k := 0; k < 4; k++ {
+				c0, c1 := cycle[k], cycle[(k+1)%4]
+				if inside(c0) == inside(c1) {
+					continue
+				}
+				edge := uint8(mcEdgeIndex[c0][c1])
+				if inside(c1) {
+					entering = append(entering, edge)
+				} else {
+					leaving = append(leaving, edge)
+				}
+			}
+			switch len(entering) {
+			case 0:
+				continue
+			case 1:
+				next[entering[0]] = leaving[0]
+				continue
+			}
+			// ambiguous face: each inside corner is cut off on its own.
+			for k := 0; k < 4; k++ {
+				if !inside(cycle[k]) {
+					continue
+				}
+				prev, cur, nxt := cycle[(k+3)%4], cycle[k], cycle[(k+1)%4]
+				next[uint8(mcEdgeIndex[prev][cur])] = uint8(mcEdgeIndex[cur][nxt])
+			}
+		}
+	}
+
+	var triangles [][3]uint8
+	visited := make(map[uint8]bool, len(next))
+	for e := uint8(0); e < 12; e++ {
+		if _, found := next[e]; !found || visited[e] {
+			continue
+		}
+		var polygon []uint8
+		for cur := e; !visited[cur]; cur = next[cur] {
+			visited[cur] = true
+			polygon = append(polygon, cur)
+		}
+		for i := 1; i+1 < len(polygon); i++ {
+			triangles = append(triangles, [3]uint8{polygon[0], polygon[i], polygon[i+1]})
+		}
+	}
+	return triangles
+}
+
+// meshVolume holds bit-packed masks of blocks that contain voxels of the meshed label.
+type meshVolume struct {
+	blockSize dvid.Point3d
+	masks     map[dvid.ChunkPoint3d][]byte
+}
+
+func newMeshVolume(blockSize dvid.Point3d) *meshVolume {
+	return &meshVolume{
+		blockSize: blockSize,
+		masks:     make(map[dvid.ChunkPoint3d][]byte),
+	}
+}
+
+// addBlock stores a mask of the voxels within the block having any of the given labels.
+func (mv *meshVolume) addBlock(bcoord dvid.ChunkPoint3d, block *labels.Block, lbls labels.Set) {
+	data, size := block.MakeLabelVolume()
+	numVoxels := int(size.Prod())
+	mask := make([]byte, (numVoxels+7)/8)
+	var found bool
+	for i := 0; i < numVoxels; i++ {
+		label := binary.LittleEndian.Uint64(data[i*8 : i*8+8])
+		if _, in := lbls[label]; in {
+			mask[i>>3] |= 1 << uint(i&7)
+			found = true
+		}
+	}
+	if found {
+		mv.masks[bcoord] = mask
+	}
+}
+
+func floorDiv(a, b int32) int32 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+func (mv *meshVolume) blockOf(x, y, z int32) dvid.ChunkPoint3d {
+	return dvid.ChunkPoint3d{floorDiv(x, mv.blockSize[0]), floorDiv(y, mv.blockSize[1]), floorDiv(z, mv.blockSize[2])}
+}
+
+func (mv *meshVolume) inside(x, y, z int32) bool {
+	bcoord := mv.blockOf(x, y, z)
+	mask, found := mv.masks[bcoord]
+	if !found {
+		return false
+	}
+	bx, by, bz := x-bcoord[0]*mv.blockSize[0], y-bcoord[1]*mv.blockSize[1], z-bcoord[2]*mv.blockSize[2]
+	i := (bz*mv.blockSize[1]+by)*mv.blockSize[0] + bx
+	return mask[i>>3]&(1<<uint(i&7)) != 0
+}
+
+// owner returns the first stored block, in corner order, touched by the cell with the
+// given lower corner.  Cells spanning block boundaries are only processed by their owner.
+func (mv *meshVolume) owner(x, y, z int32) (dvid.ChunkPoint3d, bool) {
+	for _, off := range mcCornerOff {
+		bcoord := mv.blockOf(x+off[0], y+off[1], z+off[2])
+		if _, found := mv.masks[bcoord]; found {
+			return bcoord, true
+		}
+	}
+	return dvid.ChunkPoint3d{}, false
+}
+
+type meshEdgeKey struct {
+	x, y, z int32
+	axis    uint8
+}
+
+// labelMesh is a triangle mesh with vertices in voxel coordinates.
+type labelMesh struct {
+	vertices  [][3]float32
+	triangles [][3]uint32
+}
+
+// marchingCubes returns a closed mesh of the stored mask, with vertices at the midpoints of
+// voxel edges crossing the mask boundary.
+func (mv *meshVolume) marchingCubes() *labelMesh {
+	m := new(labelMesh)
+	vertexIndex := make(map[meshEdgeKey]uint32)
+	getVertex := func(x, y, z int32, edge uint8) uint32 {
+		off := mcCornerOff[mcEdges[edge][0]]
+		key := meshEdgeKey{x + off[0], y + off[1], z + off[2], mcEdgeAxis[edge]}
+		if i, found := vertexIndex[key]; found {
+			return i
+		}
+		pos := [3]float32{float32(key.x), float32(key.y), float32(key.z)}
+		pos[key.axis] += 0.5
+		i := uint32(len(m.vertices))
+		m.vertices = append(m.vertices, pos)
+		vertexIndex[key] = i
+		return i
+	}
+
+	bcoords := make([]dvid.ChunkPoint3d, 0, len(mv.masks))
+	for bcoord := range mv.masks {
+		bcoords = append(bcoords, bcoord)
+	}
+	sort.Slice(bcoords, func(i, j int) bool {
+		a, b := bcoords[i], bcoords[j]
+		if a[2] != b[2] {
+			return a[2] < b[2]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+
+	for _, bcoord := range bcoords {
+		x0, y0, z0 := bcoord[0]*mv.blockSize[0], bcoord[1]*mv.blockSize[1], bcoord[2]*mv.blockSize[2]
+		x1, y1, z1 := x0+mv.blockSize[0]-1, y0+mv.blockSize[1]-1, z0+mv.blockSize[2]-1
+		for z := z0 - 1; z <= z1; z++ {
+			for y := y0 - 1; y <= y1; y++ {
+				for x := x0 - 1; x <= x1; x++ {
+					if x < x0 || y < y0 || z < z0 || x == x1 || y == y1 || z == z1 {
+						if owner, _ := mv.owner(x, y, z); owner != bcoord {
+							continue
+						}
+					}
+					var cube uint8
+					for corner, off := range mcCornerOff {
+						if mv.inside(x+off[0], y+off[1], z+off[2]) {
+							cube |= 1 << uint(corner)
+						}
+					}
+					for _, tri := range mcTriangles[cube] {
+						m.triangles = append(m.triangles, [3]uint32{
+							getVertex(x, y, z, tri[0]),
+							getVertex(x, y, z, tri[1]),
+							getVertex(x, y, z, tri[2]),
+						})
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+// smooth applies the given number of Laplacian smoothing iterations, moving each vertex
+// halfway toward the average of its neighbors.
+func (m *labelMesh) smooth(iterations int) {
+	if iterations <= 0 || len(m.vertices) == 0 {
+		return
+	}
+	neighbors := make([]map[uint32]struct{}, len(m.vertices))
+	for _, tri := range m.triangles {
+		for i := 0; i < 3; i++ {
+			a, b := tri[i], tri[(i+1)%3]
+			if neighbors[a] == nil {
+				neighbors[a] = make(map[uint32]struct{})
+			}
+			if neighbors[b] == nil {
+				neighbors[b] = make(map[uint32]struct{})
+			}
+			neighbors[a][b] = struct{}{}
+			neighbors[b][a] = struct{}{}
+		}
+	}
+	smoothed := make([][3]float32, len(m.vertices))
+	for iter := 0; iter < iterations; iter++ {
+		for v, pos := range m.vertices {
+			if len(neighbors[v]) == 0 {
+				smoothed[v] = pos
+				continue
+			}
+			var avg [3]float32
+			for n := range neighbors[v] {
+				for i := 0; i < 3; i++ {
+					avg[i] += m.vertices[n][i]
+				}
+			}
+			num := float32(len(neighbors[v]))
+			for i := 0; i < 3; i++ {
+				smoothed[v][i] = 0.5*pos[i] + 0.5*avg[i]/num
+			}
+		}
+		m.vertices, smoothed = smoothed, m.vertices
+	}
+}
+
+// decimate reduces the number of vertices to roughly the given fraction using vertex
+// clustering on a regular grid, removing triangles that become degenerate.
+func (m *labelMesh) decimate(fraction float64) {
+	if fraction <= 0 || fraction >= 1 || len(m.vertices) == 0 {
+		return
+	}
+	// surface vertex count scales with the square of the grid spacing.
+	spacing := float32(1.0 / math.Sqrt(fraction))
+	clusterIndex := make(map[[3]int32]uint32)
+	var sums [][3]float32
+	var counts []float32
+	remap := make([]uint32, len(m.vertices))
+	for v, pos := range m.vertices {
+		key := [3]int32{
+			int32(math.Floor(float64(pos[0] / spacing))),
+			int32(math.Floor(float64(pos[1] / spacing))),
+			int32(math.Floor(float64(pos[2] / spacing))),
+		}
+		c, found := clusterIndex[key]
+		if !found {
+			c = uint32(len(sums))
+			clusterIndex[key] = c
+			sums = append(sums, [3]float32{})
+			counts = append(counts, 0)
+		}
+		for i := 0; i < 3; i++ {
+			sums[c][i] += pos[i]
+		}
+		counts[c]++
+		remap[v] = c
+	}
+	vertices := make([][3]float32, len(sums))
+	for c, sum := range sums {
+		for i := 0; i < 3; i++ {
+			vertices[c][i] = sum[i] / counts[c]
+		}
+	}
+	seen := make(map[[3]uint32]struct{}, len(m.triangles))
+	triangles := m.triangles[:0]
+	for _, tri := range m.triangles {
+		a, b, c := remap[tri[0]], remap[tri[1]], remap[tri[2]]
+		if a == b || b == c || a == c {
+			continue
+		}
+		key := [3]uint32{a, b, c}
+		sort.Slice(key[:], func(i, j int) bool { return key[i] < key[j] })
+		if _, found := seen[key]; found {
+			continue
+		}
+		seen[key] = struct{}{}
+		triangles = append(triangles, [3]uint32{a, b, c})
+	}
+	m.vertices = vertices
+	m.triangles = triangles
+}
+
+// scaleVertices transforms vertices from voxel coordinates at the given downres scale into
+// physical coordinates using the voxel size.
+func (m *labelMesh) scaleVertices(scale uint8, voxelSize dvid.NdFloat32) {
+	mult := float32(int32(1) << scale)
+	var res [3]float32
+	for i := 0; i < 3; i++ {
+		res[i] = mult
+		if len(voxelSize) > i {
+			res[i] *= voxelSize[i]
+		}
+	}
+	for v := range m.vertices {
+		for i := 0; i < 3; i++ {
+			m.vertices[v][i] *= res[i]
+		}
+	}
+}
+
+// writeNgMesh writes the legacy neuroglancer mesh format: uint32 # vertices, then float32
+// x, y, z for each vertex, then uint32 vertex indices for each triangle, all little-endian.
+func (m *labelMesh) writeNgMesh(w io.Writer) error {
+	buf := make([]byte, 4+12*len(m.vertices)+12*len(m.triangles))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(m.vertices)))
+	pos := 4
+	for _, vertex := range m.vertices {
+		for i := 0; i < 3; i++ {
+			binary.LittleEndian.PutUint32(buf[pos:pos+4], math.Float32bits(vertex[i]))
+			pos += 4
+		}
+	}
+	for _, tri := range m.triangles {
+		for i := 0; i < 3; i++ {
+			binary.LittleEndian.PutUint32(buf[pos:pos+4], tri[i])
+			pos += 4
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Draco bitstream values for a triangular mesh using sequential connectivity with
+// uncompressed indices and a raw float32 position attribute.
+const (
+	dracoMajorVersion        = 2
+	dracoMinorVersion        = 2
+	dracoTriangularMesh      = 1 // encoder type
+	dracoMeshSequential      = 0 // encoder method
+	dracoUncompressedIndices = 1 // sequential connectivity method
+	dracoPositionAttribute   = 0 // attribute type
+	dracoFloat32             = 9 // attribute data type
+	dracoGenericEncoder      = 0 // sequential attribute encoder without prediction or quantization
+)
+
+func appendDracoVarint(buf []byte, val uint64) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(varint[:], val)
+	return append(buf, varint[:n]...)
+}
+
+// writeDraco writes the mesh in Draco 2.2 format without compression, so it is readable by
+// any Draco decoder, e.g., neuroglancer, but is about the size of the ngmesh format.  Draco
+// decoders read indices as bytes for meshes with fewer than 256 vertices, as 16-bit
+// little-endian for fewer than 65536 vertices, as varints for fewer than 2^21 vertices, and
+// as 32-bit little-endian otherwise.
+func (m *labelMesh) writeDraco(w io.Writer) error {
+	numPoints := len(m.vertices)
+	buf := make([]byte, 0, 32+12*numPoints+12*len(m.triangles))
+	buf = append(buf, "DRACO"...)
+	buf = append(buf, dracoMajorVersion, dracoMinorVersion, dracoTriangularMesh, dracoMeshSequential)
+	buf = append(buf, 0, 0) // 16-bit flags: no metadata
+
+	buf = appendDracoVarint(buf, uint64(len(m.triangles)))
+	buf = appendDracoVarint(buf, uint64(numPoints))
+	buf = append(buf, dracoUncompressedIndices)
+	for _, tri := range m.triangles {
+		for i := 0; i < 3; i++ {
+			switch {
+			case numPoints < 1<<8:
+				buf = append(buf, byte(tri[i]))
+			case numPoints < 1<<16:
+				buf = append(buf, byte(tri[i]), byte(tri[i]>>8))
+			case numPoints < 1<<21:
+				buf = appendDracoVarint(buf, uint64(tri[i]))
+			default:
+				buf = append(buf, byte(tri[i]), byte(tri[i]>>8), byte(tri[i]>>16), byte(tri[i]>>24))
+			}
+		}
+	}
+
+	// one attributes decoder holding the position attribute.
+	buf = append(buf, 1)
+	buf = appendDracoVarint(buf, 1)
+	buf = append(buf, dracoPositionAttribute, dracoFloat32, 3, 0) // type, data type, components, normalized
+	buf = appendDracoVarint(buf, 0)                               // unique id
+	buf = append(buf, dracoGenericEncoder)
+	var value [4]byte
+	for _, vertex := range m.vertices {
+		for i := 0; i < 3; i++ {
+			binary.LittleEndian.PutUint32(value[:], math.Float32bits(vertex[i]))
+			buf = append(buf, value[:]...)
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// writeOBJ writes the mesh in Wavefront OBJ text format.
+func (m *labelMesh) writeOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, vertex := range m.vertices {
+		if _, err := fmt.Fprintf(bw, "v %g %g %g\n", vertex[0], vertex[1], vertex[2]); err != nil {
+			return err
+		}
+	}
+	for _, tri := range m.triangles {
+		if _, err := fmt.Fprintf(bw, "f %d %d %d\n", tri[0]+1, tri[1]+1, tri[2]+1); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// meshOptions describe the post-processing of a generated mesh.
+type meshOptions struct {
+	scale        uint8
+	isSupervoxel bool
+	smoothing    int
+	decimation   float64
+}
+
+// getMesh returns a mesh for the given label (or supervoxel) computed via marching cubes over
+// the label blocks at the given scale.  Vertices are in physical coordinates.  If the label
+// is not found, a nil mesh is returned.
+func (d *Data) getMesh(ctx *datastore.VersionedCtx, label uint64, opts meshOptions) (*labelMesh, error) {
+	timedLog := dvid.NewTimeLog()
+	idx, err := GetLabelIndex(d, ctx.VersionID(), label, opts.isSupervoxel)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	supervoxels := idx.GetSupervoxels()
+	if opts.isSupervoxel {
+		if _, found := supervoxels[label]; !found {
+			return nil, nil
+		}
+		if idx, err = idx.LimitToSupervoxel(label); err != nil {
+			return nil, err
+		}
+		supervoxels = labels.Set{label: struct{}{}}
+	}
+	blocks, err := idx.GetProcessedBlockIndices(opts.scale, dvid.Bounds{})
+	if err != nil {
+		return nil, err
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't mesh because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	mv := newMeshVolume(blockSize)
+	for _, izyx := range blocks {
+		pb, err := d.getLabelBlock(ctx, opts.scale, izyx)
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			continue
+		}
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		mv.addBlock(bcoord, &(pb.Block), supervoxels)
+	}
+	m := mv.marchingCubes()
+	m.smooth(opts.smoothing)
+	m.decimate(opts.decimation)
+	m.scaleVertices(opts.scale, d.Properties.VoxelSize)
+	timedLog.Infof("Computed mesh for label %d at scale %d: %d blocks, %d vertices, %d triangles", label, opts.scale, len(mv.masks), len(m.vertices), len(m.triangles))
+	return m, nil
+}
@@ -20,7 +20,6 @@ import (
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/datatype/common/proto"
 	"github.com/janelia-flyem/dvid/dvid"
-	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
 )
 
@@ -44,14 +43,33 @@ type sizeChange struct {
 //
 // labels.MergeEndEvent occurs at end of merge and transmits labels.DeltaMergeEnd struct.
 //
+// The merge is refused with a LeaseConflictError if any of the labels is leased by another user.
 func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInfo) (mutID uint64, err error) {
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	bodies := make([]uint64, 0, len(op.Merged)+1)
+	bodies = append(bodies, op.Target)
+	for label := range op.Merged {
+		bodies = append(bodies, label)
+	}
+	if err = d.checkBodyLeases(v, info.User, bodies...); err != nil {
+		return
+	}
+	mutID = d.NewMutationID()
+	err = d.mergeLabels(v, op, mutID, info, nil)
+	return
+}
+
+// mergeLabels does a merge using the given mutation ID.  If evts is non-nil, events are
+// deferred until sent by the caller.
+func (d *Data) mergeLabels(v dvid.VersionID, op labels.MergeOp, mutID uint64, info dvid.ModInfo, evts *deferredEvents) (err error) {
 	dvid.Debugf("Merging %s into label %d ...\n", op.Merged, op.Target)
 
 	d.StartUpdate()
 	defer d.StopUpdate()
 
 	timedLog := dvid.NewTimeLog()
-	mutID = d.NewMutationID()
 	op.MutID = mutID
 
 	// send kafka merge event to instance-uuid topic
@@ -92,20 +110,23 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 		msginfo["App"] = info.App
 	}
 	jsonmsg, _ := json.Marshal(msginfo)
-	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+	if err := evts.produceKafkaMsg(d, jsonmsg); err != nil {
 		dvid.Errorf("can't send merge op for %q to kafka: %v\n", d.DataName(), err)
 	}
 
 	// Signal that we are starting a merge.
 	evt := datastore.SyncEvent{d.DataUUID(), labels.MergeStartEvent}
 	msg := datastore.SyncMessage{labels.MergeStartEvent, v, labels.DeltaMergeStart{op}}
-	if err = datastore.NotifySubscribers(evt, msg); err != nil {
+	if err = evts.notifySubscribers(evt, msg); err != nil {
 		return
 	}
 
 	if err = addMergeToMapping(d, v, mutID, op.Target, mergeIdx); err != nil {
 		return
 	}
+	if err = d.mergeBodyProps(v, mutID, op.Target, lbls); err != nil {
+		return
+	}
 
 	delta := labels.DeltaMerge{
 		MergeOp:      op,
@@ -127,6 +148,7 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 	for merged := range delta.Merged {
 		DeleteLabelIndex(d, v, merged)
 	}
+	d.mergeBodyLeases(v, op.Target, lbls)
 	if err = labels.LogMerge(d, v, op); err != nil {
 		return
 	}
@@ -136,23 +158,22 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 	delta.Blocks = targetIdx.GetBlockIndices()
 	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeBlockEvent}
 	msg = datastore.SyncMessage{labels.MergeBlockEvent, v, delta}
-	if err = datastore.NotifySubscribers(evt, msg); err != nil {
+	if err = evts.notifySubscribers(evt, msg); err != nil {
 		err = fmt.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
 		return
 	}
 
 	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeEndEvent}
 	msg = datastore.SyncMessage{labels.MergeEndEvent, v, labels.DeltaMergeEnd{delta.MergeOp}}
-	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+	if err := evts.notifySubscribers(evt, msg); err != nil {
 		dvid.Criticalf("can't notify subscribers for event %v: %v\n", evt, err)
 	}
 
 	timedLog.Infof("Merged %s -> %d, data %q, resulting in %d blocks", delta.Merged, delta.Target, d.DataName(), len(delta.Blocks))
+	evts.publishMutation(d, v, "merge", mutID, info.User, jsonmsg, append(lbls, op.Target)...)
 
 	// send merge information to separate mutation log file
-	if err := server.LogJSONMutation(versionuuid, d.DataUUID(), jsonmsg); err != nil {
-		dvid.Criticalf("can't log mutation to data %q, version %s: %s\n", d.DataName(), versionuuid, jsonmsg)
-	}
+	evts.logJSONMutation(d, versionuuid, jsonmsg)
 
 	// send kafka merge complete event to instance-uuid topic
 	msginfo = map[string]interface{}{
@@ -162,7 +183,7 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 		"Timestamp":  time.Now().String(),
 	}
 	jsonmsg, _ = json.Marshal(msginfo)
-	err = d.ProduceKafkaMsg(jsonmsg)
+	err = evts.produceKafkaMsg(d, jsonmsg)
 	return
 }
 
@@ -172,8 +193,16 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 // Each element of the JSON array is a supervoxel to be cleaved from the label and either
 // given a new label or the one optionally supplied via the "cleavelabel" query string.
 // A cleave label can be specified via the "toLabel" parameter, which if 0 will have an
-// automatic label ID selected for the cleaved body.
+// automatic label ID selected for the cleaved body.  The cleave is refused with a
+// LeaseConflictError if the label is leased by another user.
 func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r io.ReadCloser) (cleaveLabel, mutID uint64, err error) {
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	if err = d.checkBodyLeases(v, info.User, label); err != nil {
+		return
+	}
+
 	if r == nil {
 		err = fmt.Errorf("no cleave supervoxels JSON was POSTed")
 		return
@@ -200,9 +229,16 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 		err = fmt.Errorf("bad cleave supervoxels JSON: %v", err)
 		return
 	}
+	mutID = d.NewMutationID()
+	err = d.cleaveLabel(v, mutID, label, cleaveLabel, cleaveSupervoxels, info, nil)
+	return
+}
 
+// cleaveLabel cleaves the given supervoxels from a label into the given cleave label
+// using the given mutation ID.  If evts is non-nil, events are deferred until sent by
+// the caller.
+func (d *Data) cleaveLabel(v dvid.VersionID, mutID, label, cleaveLabel uint64, cleaveSupervoxels []uint64, info dvid.ModInfo, evts *deferredEvents) (err error) {
 	// send kafka cleave event to instance-uuid topic
-	mutID = d.NewMutationID()
 	versionuuid, _ := datastore.UUIDFromVersion(v)
 	msginfo := map[string]interface{}{
 		"Action":             "cleave",
@@ -229,7 +265,7 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 		msginfo["DataRef"] = postRef
 		jsonBytes, _ = json.Marshal(msginfo)
 	}
-	if err = d.ProduceKafkaMsg(jsonBytes); err != nil {
+	if err = evts.produceKafkaMsg(d, jsonBytes); err != nil {
 		dvid.Errorf("error on sending cleave op to kafka: %v\n", err)
 	}
 
@@ -248,6 +284,9 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 	if err = addCleaveToMapping(d, v, op); err != nil {
 		return
 	}
+	if err = d.copyBodyProps(v, label, cleaveLabel); err != nil {
+		return
+	}
 	if err = labels.LogCleave(d, v, op); err != nil {
 		return
 	}
@@ -255,10 +294,11 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 	// notify syncs after processing because downstream sync might rely on changes
 	evt := datastore.SyncEvent{d.DataUUID(), labels.CleaveLabelEvent}
 	msg := datastore.SyncMessage{labels.CleaveLabelEvent, v, op}
-	if err = datastore.NotifySubscribers(evt, msg); err != nil {
+	if err = evts.notifySubscribers(evt, msg); err != nil {
 		err = fmt.Errorf("can't notify subscribers for event %v: %v", evt, err)
 		return
 	}
+	evts.publishMutation(d, v, "cleave", mutID, info.User, jsonBytes, label, cleaveLabel)
 
 	msginfo = map[string]interface{}{
 		"Action":     "cleave-complete",
@@ -267,7 +307,7 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 		"Timestamp":  time.Now().String(),
 	}
 	jsonBytes, _ = json.Marshal(msginfo)
-	if err = d.ProduceKafkaMsg(jsonBytes); err != nil {
+	if err = evts.produceKafkaMsg(d, jsonBytes); err != nil {
 		dvid.Errorf("error on sending cleave complete op to kafka: %v\n", err)
 	}
 	return
@@ -392,6 +432,13 @@ type voxelMod struct {
 	pb       *labels.PositionedBlock
 }
 
+// mergeMod relabels supervoxels within a block, e.g., when reversing supervoxel splits.
+type mergeMod struct {
+	bcoord dvid.IZYXString
+	ops    []labels.MergeOp
+	pb     *labels.PositionedBlock
+}
+
 func (d *Data) modifyBlocks(ctx *datastore.VersionedCtx, downresMut *downres.Mutation, modCh chan interface{}, errCh chan error) {
 	var err error
 	var scale uint8
@@ -413,6 +460,16 @@ func (d *Data) modifyBlocks(ctx *datastore.VersionedCtx, downresMut *downres.Mut
 				errCh <- fmt.Errorf("issue with voxel modification, block %s: %v", bcoord, err)
 				return
 			}
+		case mergeMod:
+			bcoord = m.bcoord
+			block = &(m.pb.Block)
+			for _, op := range m.ops {
+				block, err = block.MergeLabels(op)
+				if err != nil {
+					errCh <- fmt.Errorf("issue with supervoxel merge, block %s: %v", bcoord, err)
+					return
+				}
+			}
 		default:
 			errCh <- fmt.Errorf("received bad mod type: %v", mod)
 			return
@@ -527,16 +584,16 @@ func getAffectedBlocks(idx *labels.Index, svsplit *labels.SVSplitMap) (affectedB
 // preferably be the smaller portion of a labeled region.  In other words, the caller should chose
 // to submit for relabeling the smaller portion of any split.  It is assumed that the given split
 // voxels are within the fromLabel set of voxels and will generate unspecified behavior if this is
-// not the case.
-func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser, info dvid.ModInfo) (toLabel, mutID uint64, err error) {
-	timedLog := dvid.NewTimeLog()
-
-	// Create a new label id for this version that will persist to store
-	toLabel, err = d.newLabel(v)
-	if err != nil {
+// not the case.  If scale is non-zero, the sparse volume is a mask at that scale and only the
+// fromLabel voxels within the upsampled mask are split.  The split is refused with a
+// LeaseConflictError if the label is leased by another user.
+func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser, scale uint8, info dvid.ModInfo) (toLabel, mutID uint64, err error) {
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	if err = d.checkBodyLeases(v, info.User, fromLabel); err != nil {
 		return
 	}
-	dvid.Debugf("Splitting subset of label %d into new label %d ...\n", fromLabel, toLabel)
 
 	// Read the sparse volume from reader.
 	var split dvid.RLEs
@@ -544,6 +601,23 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 	if err != nil {
 		return
 	}
+	if split, err = d.upsampleSplitMask(v, split, scale, fromLabel, true); err != nil {
+		return
+	}
+	return d.splitLabelRLEs(v, fromLabel, split, info)
+}
+
+// splitLabelRLEs splits the voxels given by RLEs from a label into a new label.
+func (d *Data) splitLabelRLEs(v dvid.VersionID, fromLabel uint64, split dvid.RLEs, info dvid.ModInfo) (toLabel, mutID uint64, err error) {
+	timedLog := dvid.NewTimeLog()
+
+	// Create a new label id for this version that will persist to store
+	toLabel, err = d.newLabel(v)
+	if err != nil {
+		return
+	}
+	dvid.Debugf("Splitting subset of label %d into new label %d ...\n", fromLabel, toLabel)
+
 	splitSize, _ := split.Stats()
 	if splitSize == 0 {
 		err = fmt.Errorf("bad split since split volume was zero voxels")
@@ -664,6 +738,9 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 	if err = addSplitToMapping(d, v, op); err != nil {
 		return
 	}
+	if err = d.copyBodyProps(v, fromLabel, toLabel); err != nil {
+		return
+	}
 	if err = labels.LogSplit(d, v, op); err != nil {
 		return
 	}
@@ -686,6 +763,7 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 	if err := datastore.NotifySubscribers(evt, msg); err != nil {
 		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
 	}
+	d.publishMutation(v, "split", mutID, info.User, jsonmsg, fromLabel, toLabel)
 
 	msginfo = map[string]interface{}{
 		"Action":     "split-complete",
@@ -704,9 +782,20 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 // optionally set to desired labels if passed in (see splitlabel and remainlabel in parameters).
 // The input is a binary sparse volume and should be totally contained by the given supervoxel.
 // The first returned label is assigned to the split voxels while the second returned label is
-// assigned to the remainder voxels.
-func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabel uint64, r io.ReadCloser, info dvid.ModInfo, downscale bool) (splitSupervoxel, remainSupervoxel, mutID uint64, err error) {
-	timedLog := dvid.NewTimeLog()
+// assigned to the remainder voxels.  If scale is non-zero, the sparse volume is a mask at that
+// scale and only the supervoxel's voxels within the upsampled mask are split.  The split is
+// refused with a LeaseConflictError if the body of the supervoxel is leased by another user.
+func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabel uint64, r io.ReadCloser, scale uint8, info dvid.ModInfo, downscale bool) (splitSupervoxel, remainSupervoxel, mutID uint64, err error) {
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	var bodies []uint64
+	if bodies, _, err = d.GetMappedLabels(v, []uint64{svlabel}); err != nil {
+		return
+	}
+	if err = d.checkBodyLeases(v, info.User, bodies...); err != nil {
+		return
+	}
 
 	// Create new labels for this split that will persist to store
 	if splitlabel != 0 {
@@ -733,9 +822,23 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 	if err != nil {
 		return
 	}
+	if split, err = d.upsampleSplitMask(v, split, scale, svlabel, false); err != nil {
+		return
+	}
+	mutID = d.NewMutationID()
+	err = d.splitSupervoxel(v, mutID, svlabel, splitSupervoxel, remainSupervoxel, split, info, downscale, nil)
+	return
+}
+
+// splitSupervoxel splits the given voxels from a supervoxel into the split supervoxel while
+// the remaining voxels are relabeled to the remain supervoxel, using the given mutation ID.
+// If evts is non-nil, events are deferred until sent by the caller.
+func (d *Data) splitSupervoxel(v dvid.VersionID, mutID, svlabel, splitSupervoxel, remainSupervoxel uint64, split dvid.RLEs, info dvid.ModInfo, downscale bool, evts *deferredEvents) (err error) {
+	timedLog := dvid.NewTimeLog()
+
 	splitSize, _ := split.Stats()
 	if splitSize == 0 {
-		dvid.Infof("split on supervoxel %d -> %d was given split size of 0\n", svlabel, remainlabel)
+		dvid.Infof("split on supervoxel %d -> %d was given split size of 0\n", svlabel, remainSupervoxel)
 	}
 
 	// read parent label index and do simple check on split size
@@ -772,7 +875,7 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		return
 	}
 	if splitSize == svSize {
-		dvid.Infof("split on supervoxel %d -> %d was given split size %d, which is entire supervoxel\n", svlabel, splitlabel, splitSize)
+		dvid.Infof("split on supervoxel %d -> %d was given split size %d, which is entire supervoxel\n", svlabel, splitSupervoxel, splitSize)
 	}
 
 	// Only do voxel-based mutations one at a time.  This lets us remove handling for block-level concurrency.
@@ -790,7 +893,6 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 	}
 
 	// send kafka split event to instance-uuid topic
-	mutID = d.NewMutationID()
 	versionuuid, _ := datastore.UUIDFromVersion(v)
 	msginfo := map[string]interface{}{
 		"Action":           "split-supervoxel",
@@ -809,7 +911,7 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		msginfo["App"] = info.App
 	}
 	jsonmsg, _ := json.Marshal(msginfo)
-	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+	if err = evts.produceKafkaMsg(d, jsonmsg); err != nil {
 		dvid.Errorf("error on sending split op to kafka: %v", err)
 	}
 
@@ -915,9 +1017,10 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 
 	evt := datastore.SyncEvent{d.DataUUID(), labels.SupervoxelSplitEvent}
 	msg := datastore.SyncMessage{labels.SupervoxelSplitEvent, v, op}
-	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+	if err := evts.notifySubscribers(evt, msg); err != nil {
 		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
 	}
+	evts.publishMutation(d, v, "split-supervoxel", mutID, info.User, jsonmsg, label)
 
 	msginfo = map[string]interface{}{
 		"Action":     "split-supervoxel-complete",
@@ -926,7 +1029,7 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		"Timestamp":  time.Now().String(),
 	}
 	jsonmsg, _ = json.Marshal(msginfo)
-	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+	if err = evts.produceKafkaMsg(d, jsonmsg); err != nil {
 		dvid.Errorf("error on sending split complete op to kafka: %v", err)
 	}
 	return
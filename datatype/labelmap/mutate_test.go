@@ -3,6 +3,8 @@ package labelmap
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"net/http"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -20,6 +23,7 @@ import (
 	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/datatype/keyvalue"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 
@@ -4542,3 +4546,1435 @@ var (
 		body1, body2, body3, body4, bodysplit, body6, body7,
 	}
 )
+
+func TestUndoRedo(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "2")
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	original := createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	newVolume := func() *testVolume {
+		volume := newTestVolume(128, 128, 128)
+		volume.addBody(body1, 1)
+		volume.addBody(body2, 2)
+		volume.addBody(body3, 3)
+		volume.addBody(body4, 4)
+		return volume
+	}
+	checkVolume := func(expected *testVolume, supervoxels bool) {
+		if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+			t.Fatalf("Error blocking on sync of labels: %v\n", err)
+		}
+		retrieved := newTestVolume(128, 128, 128)
+		retrieved.get(t, uuid, "labels", supervoxels)
+		if err := retrieved.equals(expected); err != nil {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("label volume not equal to expected volume [%s:%d]: %v\n", fn, line, err)
+		}
+		downres1 := newTestVolume(64, 64, 64)
+		downres1.getScale(t, uuid, "labels", 1, supervoxels)
+		if err := downres1.equalsDownres(expected); err != nil {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("label volume failed level 1 down-scale [%s:%d]: %v\n", fn, line, err)
+		}
+	}
+	var mutResp struct {
+		MutationID      uint64
+		UndoMutationIDs []uint64
+		RedoMutationIDs []uint64
+		Label           uint64 `json:"label"`
+	}
+	undoreq := func(action string, mutID uint64) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/%s/%d", server.WebAPIPath, uuid, action, mutID)
+		r := server.TestHTTP(t, "POST", reqStr, nil)
+		if err := json.Unmarshal(r, &mutResp); err != nil {
+			t.Fatalf("unable to parse %s response %q: %v\n", action, string(r), err)
+		}
+	}
+
+	// merge 3 into 4, then undo and redo it.
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[4, 3]"))
+	if err := json.Unmarshal(r, &mutResp); err != nil {
+		t.Fatalf("bad merge response: %v\n", err)
+	}
+	mergeID := mutResp.MutationID
+	merged := newVolume()
+	merged.addBody(body3, 4)
+	checkVolume(merged, false)
+
+	undoreq("undo", mergeID)
+	if len(mutResp.UndoMutationIDs) != 1 {
+		t.Fatalf("expected one cleave to undo merge, got %v\n", mutResp.UndoMutationIDs)
+	}
+	checkVolume(original, false)
+	reqStr = fmt.Sprintf("%snode/%s/labels/size/3", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	if string(r) != fmt.Sprintf(`{"voxels": %d}`, body3.voxelSpans.Count()) {
+		t.Errorf("bad size for label 3 after undo of merge: %s\n", string(r))
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, mergeID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+
+	undoreq("redo", mergeID)
+	checkVolume(merged, false)
+	reqStr = fmt.Sprintf("%snode/%s/labels/redo/%d", server.WebAPIPath, uuid, mergeID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+
+	// later mutation on same body should block undo of earlier one.
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/4", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[3]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+		MutationID   uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("bad cleave response: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, mutResp.RedoMutationIDs[0])
+	resp := server.TestHTTPResponse(t, "POST", reqStr, nil)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected conflict status for undo of earlier merge, got %d: %s\n", resp.Code, resp.Body.String())
+	}
+
+	// undo of the cleave should merge back.
+	undoreq("undo", cleaveResp.MutationID)
+	checkVolume(merged, false)
+
+	// split body 4 and then undo it, which should restore supervoxels as well.
+	numspans := len(bodysplit.voxelSpans)
+	rles := make(dvid.RLEs, numspans, numspans)
+	for i, span := range bodysplit.voxelSpans {
+		start := dvid.Point3d{span[2], span[1], span[0]}
+		length := span[3] - span[2] + 1
+		rles[i] = dvid.NewRLE(start, length)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))         // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))          // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                                   // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(0))        // Placeholder for # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(numspans)) // Placeholder for # spans
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/split/4", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, buf)
+	if err := json.Unmarshal(r, &mutResp); err != nil {
+		t.Fatalf("bad split response: %v\n", err)
+	}
+	splitID := mutResp.MutationID
+	split := newVolume()
+	split.addBody(body3, 4)
+	split.addBody(bodysplit, mutResp.Label)
+	checkVolume(split, false)
+
+	undoreq("undo", splitID)
+	checkVolume(merged, false)
+	checkVolume(original, true)
+
+	undoreq("redo", splitID)
+	reqStr = fmt.Sprintf("%snode/%s/labels/label/%d_%d_%d", server.WebAPIPath, uuid, bodysplit.voxelSpans[0][2], bodysplit.voxelSpans[0][1], bodysplit.voxelSpans[0][0])
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	var labelResp struct {
+		Label uint64
+	}
+	if err := json.Unmarshal(r, &labelResp); err != nil {
+		t.Fatalf("bad label response: %v\n", err)
+	}
+	redone := newVolume()
+	redone.addBody(body3, 4)
+	redone.addBody(bodysplit, labelResp.Label)
+	checkVolume(redone, false)
+
+	// supervoxel split of 1 and its undo.
+	numspans = len(body1.voxelSpans) / 2
+	rles = make(dvid.RLEs, numspans, numspans)
+	for i, span := range body1.voxelSpans[:numspans] {
+		start := dvid.Point3d{span[2], span[1], span[0]}
+		length := span[3] - span[2] + 1
+		rles[i] = dvid.NewRLE(start, length)
+	}
+	buf = new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))
+	binary.Write(buf, binary.LittleEndian, byte(0))
+	buf.WriteByte(byte(0))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(numspans))
+	if rleBytes, err = rles.MarshalBinary(); err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	reqStr = fmt.Sprintf("%snode/%s/labels/split-supervoxel/1", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, buf)
+	var svsplitResp struct {
+		SplitSupervoxel  uint64
+		RemainSupervoxel uint64
+		MutationID       uint64
+	}
+	if err := json.Unmarshal(r, &svsplitResp); err != nil {
+		t.Fatalf("bad supervoxel split response: %v\n", err)
+	}
+	undoreq("undo", svsplitResp.MutationID)
+	checkVolume(redone, false)
+	reqStr = fmt.Sprintf("%snode/%s/labels/size/1?supervoxels=true", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	if string(r) != fmt.Sprintf(`{"voxels": %d}`, body1.voxelSpans.Count()) {
+		t.Errorf("bad size for supervoxel 1 after undo of supervoxel split: %s\n", string(r))
+	}
+	undoreq("redo", svsplitResp.MutationID)
+	reqStr = fmt.Sprintf("%snode/%s/labels/size/%d?supervoxels=true", server.WebAPIPath, uuid, svsplitResp.SplitSupervoxel)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	splitVoxels, _ := rles.Stats()
+	if string(r) != fmt.Sprintf(`{"voxels": %d}`, splitVoxels) {
+		t.Errorf("bad size for split supervoxel after redo: %s\n", string(r))
+	}
+}
+
+func TestMutationsBatch(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "2")
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	checkVolume := func(expected *testVolume, supervoxels bool) {
+		if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+			t.Fatalf("Error blocking on sync of labels: %v\n", err)
+		}
+		retrieved := newTestVolume(128, 128, 128)
+		retrieved.get(t, uuid, "labels", supervoxels)
+		if err := retrieved.equals(expected); err != nil {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("label volume not equal to expected volume [%s:%d]: %v\n", fn, line, err)
+		}
+		downres1 := newTestVolume(64, 64, 64)
+		downres1.getScale(t, uuid, "labels", 1, supervoxels)
+		if err := downres1.equalsDownres(expected); err != nil {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("label volume failed level 1 down-scale [%s:%d]: %v\n", fn, line, err)
+		}
+	}
+
+	numspans := len(bodysplit.voxelSpans)
+	rles := make(dvid.RLEs, numspans, numspans)
+	for i, span := range bodysplit.voxelSpans {
+		start := dvid.Point3d{span[2], span[1], span[0]}
+		length := span[3] - span[2] + 1
+		rles[i] = dvid.NewRLE(start, length)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))
+	binary.Write(buf, binary.LittleEndian, byte(0))
+	buf.WriteByte(byte(0))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(numspans))
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	splitVol := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	// merge 3 into 4, split supervoxel 4, then cleave the split supervoxel off into its own body.
+	batch := fmt.Sprintf(`[
+		{"Action": "merge", "Target": 4, "Labels": [3]},
+		{"Action": "split-supervoxel", "Supervoxel": 4, "SplitLabel": 20, "RemainLabel": 21, "Split": %q},
+		{"Action": "cleave", "Label": 4, "Supervoxels": [20], "CleavedLabel": 22}
+	]`, splitVol)
+	reqStr := fmt.Sprintf("%snode/%s/labels/mutations-batch", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(batch))
+	var batchResp struct {
+		MutationIDs []uint64
+		Results     []BatchResult
+	}
+	if err := json.Unmarshal(r, &batchResp); err != nil {
+		t.Fatalf("bad mutations-batch response %q: %v\n", string(r), err)
+	}
+	if len(batchResp.MutationIDs) != 3 || len(batchResp.Results) != 3 {
+		t.Fatalf("expected 3 mutations in batch response, got: %s\n", string(r))
+	}
+	for i, mutID := range batchResp.MutationIDs {
+		if mutID != batchResp.MutationIDs[0]+uint64(i) || batchResp.Results[i].MutationID != mutID {
+			t.Fatalf("expected contiguous mutation ids in batch response, got: %s\n", string(r))
+		}
+	}
+	if batchResp.Results[1].SplitSupervoxel != 20 || batchResp.Results[1].RemainSupervoxel != 21 || batchResp.Results[2].CleavedLabel != 22 {
+		t.Fatalf("bad labels in batch response: %s\n", string(r))
+	}
+	expected := newTestVolume(128, 128, 128)
+	expected.addBody(body1, 1)
+	expected.addBody(body2, 2)
+	expected.addBody(body3, 4)
+	expected.addBody(body4, 4)
+	expected.addBody(bodysplit, 22)
+	checkVolume(expected, false)
+	expectedSV := newTestVolume(128, 128, 128)
+	expectedSV.addBody(body1, 1)
+	expectedSV.addBody(body2, 2)
+	expectedSV.addBody(body3, 3)
+	expectedSV.addBody(body4, 21)
+	expectedSV.addBody(bodysplit, 20)
+	checkVolume(expectedSV, true)
+
+	// a batch with an invalid later operation should not apply any operation.
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`[
+		{"Action": "merge", "Target": 2, "Labels": [1]},
+		{"Action": "cleave", "Label": 1, "Supervoxels": [1]}
+	]`))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`[
+		{"Action": "merge", "Target": 2, "Labels": [1]},
+		{"Action": "split-supervoxel", "Supervoxel": 4, "Split": "AA=="}
+	]`))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`[{"Action": "paint"}]`))
+	checkVolume(expected, false)
+
+	// rollback of applied operations should restore the state prior to the batch.
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := datastore.VersionFromUUID(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a rejected batch should not allocate new labels or raise the max label.
+	maxLabel := d.MaxLabel[v]
+	rejected := []BatchMutation{
+		{Action: "cleave", Label: 4, Supervoxels: []uint64{3}, CleavedLabel: 500},
+		{Action: "merge", Target: 500, Labels: []uint64{1}},
+		{Action: "cleave", Label: 500, Supervoxels: []uint64{3}},
+		{Action: "cleave", Label: 2, Supervoxels: []uint64{2}},
+	}
+	if _, err := d.ApplyMutationBatch(v, rejected, dvid.ModInfo{}); err == nil {
+		t.Fatalf("expected batch cleaving all supervoxels of label 2 to be rejected\n")
+	}
+	if d.MaxLabel[v] != maxLabel {
+		t.Fatalf("rejected batch changed max label from %d to %d\n", maxLabel, d.MaxLabel[v])
+	}
+
+	ops := []BatchMutation{
+		{Action: "merge", Target: 2, Labels: []uint64{1}},
+		{Action: "cleave", Label: 4, Supervoxels: []uint64{3}, CleavedLabel: 3},
+	}
+	results, err := d.ApplyMutationBatch(v, ops, dvid.ModInfo{})
+	if err != nil {
+		t.Fatalf("unable to apply batch: %v\n", err)
+	}
+	merged := newTestVolume(128, 128, 128)
+	merged.addBody(body1, 2)
+	merged.addBody(body2, 2)
+	merged.addBody(body3, 3)
+	merged.addBody(body4, 4)
+	merged.addBody(bodysplit, 22)
+	checkVolume(merged, false)
+	undoMu.Lock()
+	d.mutationMu.Lock()
+	err = d.rollbackBatch(v, results[0].MutationID, len(ops), len(ops), dvid.ModInfo{}, nil)
+	d.mutationMu.Unlock()
+	undoMu.Unlock()
+	if err != nil {
+		t.Fatalf("unable to roll back batch: %v\n", err)
+	}
+	checkVolume(expected, false)
+	checkVolume(expectedSV, true)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/size/1", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	if string(r) != fmt.Sprintf(`{"voxels": %d}`, body1.voxelSpans.Count()) {
+		t.Errorf("bad size for label 1 after batch rollback: %s\n", string(r))
+	}
+
+	// a split of supervoxel 21 under the voxels of supervoxel 20 passes validation by size yet
+	// fails when applied, so the merge applied before it should be reversed.
+	failing := []BatchMutation{
+		{Action: "merge", Target: 2, Labels: []uint64{1}},
+		{Action: "split-supervoxel", Supervoxel: 21, Split: buf.Bytes()},
+	}
+	if _, err := d.ApplyMutationBatch(v, failing, dvid.ModInfo{}); err == nil {
+		t.Fatalf("expected batch with bad supervoxel split to fail\n")
+	}
+	checkVolume(expected, false)
+	checkVolume(expectedSV, true)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	if string(r) != fmt.Sprintf(`{"voxels": %d}`, body1.voxelSpans.Count()) {
+		t.Errorf("bad size for label 1 after failed batch: %s\n", string(r))
+	}
+}
+
+func TestBodyLocks(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	lockReq := func(label uint64, user string) string {
+		return fmt.Sprintf("%snode/%s/labels/lock/%d?u=%s", server.WebAPIPath, uuid, label, user)
+	}
+	r := server.TestHTTP(t, "POST", lockReq(3, "alice")+"&ttl=600", nil)
+	var lease BodyLease
+	if err := json.Unmarshal(r, &lease); err != nil {
+		t.Fatalf("bad lock response %q: %v\n", string(r), err)
+	}
+	if lease.Label != 3 || lease.User != "alice" || lease.Expires.Sub(time.Now()) > 600*time.Second {
+		t.Fatalf("bad lease returned: %s\n", string(r))
+	}
+	server.TestHTTP(t, "POST", lockReq(3, "alice"), nil)
+	server.TestBadHTTP(t, "POST", lockReq(3, ""), nil)
+
+	checkStatus := func(method, reqStr, payload string, status int) {
+		resp := server.TestHTTPResponse(t, method, reqStr, bytes.NewBufferString(payload))
+		if resp.Code != status {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("expected status %d for %s %q, got %d: %s [%s:%d]\n", status, method, reqStr, resp.Code, resp.Body.String(), fn, line)
+		}
+	}
+	checkStatus("POST", lockReq(3, "bob"), "", http.StatusConflict)
+	checkStatus("DELETE", lockReq(3, "bob"), "", http.StatusConflict)
+
+	// mutations by other users on the locked body are refused.
+	mergeReq := fmt.Sprintf("%snode/%s/labels/merge?u=bob", server.WebAPIPath, uuid)
+	checkStatus("POST", mergeReq, "[4, 3]", http.StatusConflict)
+	checkStatus("POST", mergeReq, "[3, 4]", http.StatusConflict)
+	cleaveReq := fmt.Sprintf("%snode/%s/labels/cleave/3?u=bob", server.WebAPIPath, uuid)
+	checkStatus("POST", cleaveReq, "[3]", http.StatusConflict)
+	splitReq := fmt.Sprintf("%snode/%s/labels/split/3?u=bob", server.WebAPIPath, uuid)
+	checkStatus("POST", splitReq, "", http.StatusConflict)
+
+	// merge by the lease holder transfers the lease to the target.
+	mergeReq = fmt.Sprintf("%snode/%s/labels/merge?u=alice", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", mergeReq, bytes.NewBufferString("[4, 3]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	var mergeResp struct {
+		MutationID uint64
+	}
+	if err := json.Unmarshal(r, &mergeResp); err != nil {
+		t.Fatalf("bad merge response %q: %v\n", string(r), err)
+	}
+	locksReq := fmt.Sprintf("%snode/%s/labels/locks", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "GET", locksReq, nil)
+	var leases []BodyLease
+	if err := json.Unmarshal(r, &leases); err != nil {
+		t.Fatalf("bad locks response %q: %v\n", string(r), err)
+	}
+	if len(leases) != 1 || leases[0].Label != 4 || leases[0].User != "alice" {
+		t.Fatalf("expected lease on body 4 after merge, got: %s\n", string(r))
+	}
+	cleaveReq = fmt.Sprintf("%snode/%s/labels/cleave/4?u=bob", server.WebAPIPath, uuid)
+	checkStatus("POST", cleaveReq, "[3]", http.StatusConflict)
+	undoReq := fmt.Sprintf("%snode/%s/labels/undo/%d?u=bob", server.WebAPIPath, uuid, mergeResp.MutationID)
+	checkStatus("POST", undoReq, "", http.StatusConflict)
+	svSplitReq := fmt.Sprintf("%snode/%s/labels/split-supervoxel/3?u=bob", server.WebAPIPath, uuid)
+	checkStatus("POST", svSplitReq, "", http.StatusConflict)
+
+	// a batch touching the locked body is refused before any operation is applied.
+	batchReq := fmt.Sprintf("%snode/%s/labels/mutations-batch?u=bob", server.WebAPIPath, uuid)
+	batch := `[{"Action": "merge", "Target": 1, "Labels": [2]}, {"Action": "cleave", "Label": 4, "Supervoxels": [3]}]`
+	sizesReq := fmt.Sprintf("%snode/%s/labels/sizes", server.WebAPIPath, uuid)
+	before := server.TestHTTP(t, "GET", sizesReq, bytes.NewBufferString("[1, 2]"))
+	if string(before) == "[0,0]" {
+		t.Fatalf("expected bodies 1 and 2 to exist, got sizes %s\n", string(before))
+	}
+	checkStatus("POST", batchReq, batch, http.StatusConflict)
+	if after := server.TestHTTP(t, "GET", sizesReq, bytes.NewBufferString("[1, 2]")); string(after) != string(before) {
+		t.Fatalf("expected refused batch to leave bodies 1 and 2 unchanged, got sizes %s -> %s\n", string(before), string(after))
+	}
+
+	// after release, other users can mutate the body.
+	server.TestHTTP(t, "DELETE", lockReq(4, "alice"), nil)
+	r = server.TestHTTP(t, "GET", locksReq, nil)
+	if string(r) != "[]" {
+		t.Fatalf("expected no leases after release, got: %s\n", string(r))
+	}
+	server.TestHTTP(t, "POST", cleaveReq, bytes.NewBufferString("[3]"))
+
+	// expired leases are ignored.
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := datastore.VersionFromUUID(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.LockBody(v, 2, "alice", time.Millisecond); err != nil {
+		t.Fatalf("unable to lock body 2: %v\n", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := d.checkBodyLeases(v, "bob", 2); err != nil {
+		t.Fatalf("expected expired lease to be ignored: %v\n", err)
+	}
+}
+
+func TestBodyDiff(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	root, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, root, "labelmap", "labels", config)
+	createLabelTestVolume(t, root, "labels")
+	if err := datastore.BlockOnUpdating(root, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	commitReq := fmt.Sprintf("%snode/%s/commit", server.WebAPIPath, root)
+	server.TestHTTP(t, "POST", commitReq, bytes.NewBufferString(`{"note": "release"}`))
+	newVersionReq := fmt.Sprintf("%snode/%s/newversion", server.WebAPIPath, root)
+	respData := server.TestHTTP(t, "POST", newVersionReq, nil)
+	resp := struct {
+		Child string `json:"child"`
+	}{}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		t.Fatalf("Expected 'child' JSON response.  Got %s\n", string(respData))
+	}
+	child := dvid.UUID(resp.Child)
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, child)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[4, 3]"))
+	var mergeResp struct {
+		MutationID uint64
+	}
+	if err := json.Unmarshal(r, &mergeResp); err != nil {
+		t.Fatalf("bad merge response %q: %v\n", string(r), err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/4", server.WebAPIPath, child)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[4]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+		MutationID   uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("bad cleave response %q: %v\n", string(r), err)
+	}
+	if err := datastore.BlockOnUpdating(child, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/diff/%s/%s", server.WebAPIPath, child, root, child)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	var diffs []BodyDiff
+	if err := json.Unmarshal(r, &diffs); err != nil {
+		t.Fatalf("bad diff response %q: %v\n", string(r), err)
+	}
+	expected := []BodyDiff{
+		{Label: 3, ChangeType: "deleted", MutationIDs: []uint64{mergeResp.MutationID}, RemovedSupervoxels: []uint64{3}},
+		{Label: 4, ChangeType: "modified", MutationIDs: []uint64{mergeResp.MutationID, cleaveResp.MutationID}, AddedSupervoxels: []uint64{3}, RemovedSupervoxels: []uint64{4}},
+		{Label: cleaveResp.CleavedLabel, ChangeType: "created", MutationIDs: []uint64{cleaveResp.MutationID}, AddedSupervoxels: []uint64{4}},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("expected diff %v, got %s\n", expected, string(r))
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/diff/%s/%s", server.WebAPIPath, child, root, root)
+	if r = server.TestHTTP(t, "GET", reqStr, nil); string(r) != "[]" {
+		t.Fatalf("expected empty diff for same version, got %s\n", string(r))
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/diff/%s/%s", server.WebAPIPath, child, child, root)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestHistoricalReads(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// merge 3 into 4, split supervoxel 4, then cleave the split supervoxel off into its own body.
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[4, 3]"))
+	var mergeResp struct {
+		MutationID uint64
+	}
+	if err := json.Unmarshal(r, &mergeResp); err != nil {
+		t.Fatalf("bad merge response %q: %v\n", string(r), err)
+	}
+
+	numspans := len(bodysplit.voxelSpans)
+	rles := make(dvid.RLEs, numspans, numspans)
+	for i, span := range bodysplit.voxelSpans {
+		start := dvid.Point3d{span[2], span[1], span[0]}
+		length := span[3] - span[2] + 1
+		rles[i] = dvid.NewRLE(start, length)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))
+	binary.Write(buf, binary.LittleEndian, byte(0))
+	buf.WriteByte(byte(0))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(numspans))
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	reqStr = fmt.Sprintf("%snode/%s/labels/split-supervoxel/4?split=20&remain=21", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, buf)
+	var splitResp struct {
+		MutationID uint64
+	}
+	if err := json.Unmarshal(r, &splitResp); err != nil {
+		t.Fatalf("bad split-supervoxel response %q: %v\n", string(r), err)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/4", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[20]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+		MutationID   uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("bad cleave response %q: %v\n", string(r), err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	beforeAll := mergeResp.MutationID - 1
+
+	checkLabel := func(asof uint64, supervoxels bool, expected uint64) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/label/80_45_80?asof=%d&supervoxels=%t", server.WebAPIPath, uuid, asof, supervoxels)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		if string(r) != fmt.Sprintf(`{"Label": %d}`, expected) {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("expected label %d as of mutation %d, got %s [%s:%d]\n", expected, asof, string(r), fn, line)
+		}
+	}
+	checkLabel(beforeAll, false, 4)
+	checkLabel(beforeAll, true, 4)
+	checkLabel(splitResp.MutationID, false, 4)
+	checkLabel(splitResp.MutationID, true, 20)
+	checkLabel(cleaveResp.MutationID, false, cleaveResp.CleavedLabel)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/labels?asof=%d", server.WebAPIPath, uuid, beforeAll)
+	r = server.TestHTTP(t, "GET", reqStr, bytes.NewBufferString("[[59, 56, 39], [80, 45, 80]]"))
+	if string(r) != "[3,4]" {
+		t.Fatalf("expected labels [3,4] before mutations, got %s\n", string(r))
+	}
+
+	checkMapping := func(asof uint64, supervoxels string, expected string) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/mapping?asof=%d", server.WebAPIPath, uuid, asof)
+		r := server.TestHTTP(t, "GET", reqStr, bytes.NewBufferString(supervoxels))
+		if string(r) != expected {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("expected mapping %s as of mutation %d, got %s [%s:%d]\n", expected, asof, string(r), fn, line)
+		}
+	}
+	checkMapping(beforeAll, "[3, 4, 20]", "[3,4,0]")
+	checkMapping(mergeResp.MutationID, "[3, 4, 20]", "[4,4,0]")
+	checkMapping(splitResp.MutationID, "[3, 4, 20, 21]", "[4,0,4,4]")
+	checkMapping(cleaveResp.MutationID, "[3, 20, 21]", fmt.Sprintf("[4,%d,4]", cleaveResp.CleavedLabel))
+
+	checkSupervoxels := func(label, asof uint64, expected []uint64) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/supervoxels/%d?asof=%d", server.WebAPIPath, uuid, label, asof)
+		resp := server.TestHTTPResponse(t, "GET", reqStr, nil)
+		_, fn, line, _ := runtime.Caller(1)
+		if len(expected) == 0 {
+			if resp.Code != http.StatusNotFound {
+				t.Fatalf("expected no supervoxels for label %d as of mutation %d, got %s [%s:%d]\n", label, asof, resp.Body.String(), fn, line)
+			}
+			return
+		}
+		var supervoxels []uint64
+		if err := json.Unmarshal(resp.Body.Bytes(), &supervoxels); err != nil {
+			t.Fatalf("bad supervoxels response %q: %v [%s:%d]\n", resp.Body.String(), err, fn, line)
+		}
+		sort.Slice(supervoxels, func(i, j int) bool { return supervoxels[i] < supervoxels[j] })
+		if !reflect.DeepEqual(supervoxels, expected) {
+			t.Fatalf("expected supervoxels %v for label %d as of mutation %d, got %v [%s:%d]\n", expected, label, asof, supervoxels, fn, line)
+		}
+	}
+	checkSupervoxels(3, beforeAll, []uint64{3})
+	checkSupervoxels(3, mergeResp.MutationID, nil)
+	checkSupervoxels(4, beforeAll, []uint64{4})
+	checkSupervoxels(4, mergeResp.MutationID, []uint64{3, 4})
+	checkSupervoxels(4, splitResp.MutationID, []uint64{3, 20, 21})
+	checkSupervoxels(4, cleaveResp.MutationID, []uint64{3, 21})
+	checkSupervoxels(cleaveResp.CleavedLabel, splitResp.MutationID, nil)
+	checkSupervoxels(cleaveResp.CleavedLabel, cleaveResp.MutationID, []uint64{20})
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/supervoxels/4?asof=foo", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestPaint(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{10, 10, 10}, dvid.Point3d{20, 20, 20}, 1)
+	vol.addSubvol(dvid.Point3d{40, 10, 10}, dvid.Point3d{10, 10, 10}, 2)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	checkLabel := func(pt dvid.Point3d, expected uint64) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/label/%d_%d_%d", server.WebAPIPath, uuid, pt[0], pt[1], pt[2])
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var labelJSON struct {
+			Label uint64
+		}
+		if err := json.Unmarshal(r, &labelJSON); err != nil {
+			t.Fatalf("bad label response %q: %v\n", string(r), err)
+		}
+		if labelJSON.Label != expected {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("expected label %d at %s, got %d [%s:%d]\n", expected, pt, labelJSON.Label, fn, line)
+		}
+	}
+	checkSize := func(label, expected uint64) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/size/%d", server.WebAPIPath, uuid, label)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var sizeJSON struct {
+			Voxels uint64 `json:"voxels"`
+		}
+		if err := json.Unmarshal(r, &sizeJSON); err != nil {
+			t.Fatalf("bad size response %q: %v\n", string(r), err)
+		}
+		if sizeJSON.Voxels != expected {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("expected label %d to have %d voxels, got %d [%s:%d]\n", label, expected, sizeJSON.Voxels, fn, line)
+		}
+	}
+
+	// paint a run of label 2 across a block boundary, half over label 1 and half over background.
+	rles := dvid.RLEs{dvid.NewRLE(dvid.Point3d{25, 15, 15}, 10)}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))
+	binary.Write(buf, binary.LittleEndian, byte(0))
+	buf.WriteByte(byte(0))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(len(rles)))
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	reqStr := fmt.Sprintf("%snode/%s/labels/paint?label=2", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, buf)
+	var paintResp struct {
+		MutationID uint64
+		Voxels     uint64
+	}
+	if err := json.Unmarshal(r, &paintResp); err != nil {
+		t.Fatalf("bad paint response %q: %v\n", string(r), err)
+	}
+	if paintResp.Voxels != 10 {
+		t.Fatalf("expected 10 painted voxels, got %s\n", string(r))
+	}
+	checkLabel(dvid.Point3d{24, 15, 15}, 1)
+	checkLabel(dvid.Point3d{25, 15, 15}, 2)
+	checkLabel(dvid.Point3d{34, 15, 15}, 2)
+	checkLabel(dvid.Point3d{35, 15, 15}, 0)
+	checkLabel(dvid.Point3d{25, 16, 15}, 1)
+	checkSize(1, 8000-5)
+	checkSize(2, 1000+10)
+
+	// the paint is logged with the bodies it touched and blocks earlier as-of reads.
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	muts, err := d.readMutationLog(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, bodies, _ := findMutation(muts, paintResp.MutationID)
+	if op == nil || op.action != "paint" || len(bodies) != 2 || !bodies.Exists(1) || !bodies.Exists(2) {
+		t.Fatalf("expected logged paint of bodies 1 and 2, got %v with bodies %s\n", op, bodies)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/label/30_15_15?asof=%d", server.WebAPIPath, uuid, paintResp.MutationID-1)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, paintResp.MutationID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+
+	// paint a sphere and a voxel in a block that did not exist.
+	reqStr = fmt.Sprintf("%snode/%s/labels/paint?label=3&format=json", server.WebAPIPath, uuid)
+	payload := `{"Voxels": [[70, 5, 5]], "Spheres": [{"Center": [50, 50, 50], "Radius": 1}]}`
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(payload))
+	checkLabel(dvid.Point3d{50, 50, 51}, 3)
+	checkLabel(dvid.Point3d{51, 51, 50}, 0)
+	checkLabel(dvid.Point3d{70, 5, 5}, 3)
+	checkSize(3, 8)
+
+	// painting is refused while an overwritten body is leased by another user.
+	lockReq := fmt.Sprintf("%snode/%s/labels/lock/1?u=alice", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", lockReq, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/paint?label=3&format=json&u=bob", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "POST", reqStr, bytes.NewBufferString(`{"Voxels": [[12, 12, 12]]}`))
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected conflict painting leased body, got %d: %s\n", resp.Code, resp.Body.String())
+	}
+	checkLabel(dvid.Point3d{12, 12, 12}, 1)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/paint?label=0&format=json", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"Voxels": [[12, 12, 12]]}`))
+}
+
+func TestRenumberBodies(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	server.CreateTestInstance(t, uuid, "keyvalue", "renumbering", dvid.Config{})
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{10, 10, 10}, 10)
+	vol.addSubvol(dvid.Point3d{20, 0, 0}, dvid.Point3d{10, 10, 10}, 20)
+	vol.addSubvol(dvid.Point3d{40, 0, 0}, dvid.Point3d{5, 10, 10}, 30)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[20, 30]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.LockBody(v, 20, "alice", time.Hour); err != nil {
+		t.Fatalf("unable to lock body 20: %v\n", err)
+	}
+	source, err := datastore.GetDataByUUIDName(uuid, "renumbering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvdata, ok := source.(*keyvalue.Data)
+	if !ok {
+		t.Fatalf("renumbering instance is not keyvalue: %v\n", source)
+	}
+	if _, err := d.RenumberBodies(v, 1, false, kvdata); err == nil {
+		t.Fatalf("expected error renumbering below max label without reuse\n")
+	}
+	if _, err := d.RenumberBodies(v, 15, true, kvdata); err == nil {
+		t.Fatalf("expected error reusing labels above the smallest body label\n")
+	}
+	mapping, err := d.RenumberBodies(v, 1, true, kvdata)
+	if err != nil {
+		t.Fatalf("error renumbering bodies: %v\n", err)
+	}
+	expected := map[uint64]uint64{10: 1, 20: 2}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Fatalf("expected renumbering %v, got %v\n", expected, mapping)
+	}
+
+	var labelJSON struct {
+		Label uint64
+	}
+	for pt, label := range map[string]uint64{"5_5_5": 1, "25_5_5": 2, "42_5_5": 2, "50_5_5": 0} {
+		reqStr = fmt.Sprintf("%snode/%s/labels/label/%s", server.WebAPIPath, uuid, pt)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		if err := json.Unmarshal(r, &labelJSON); err != nil {
+			t.Fatalf("bad label response %q: %v\n", string(r), err)
+		}
+		if labelJSON.Label != label {
+			t.Fatalf("expected label %d at %s after renumbering, got %d\n", label, pt, labelJSON.Label)
+		}
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/sizes", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "GET", reqStr, bytes.NewBufferString("[1, 2, 10, 20]"))
+	if string(r) != "[1000,1500,0,0]" {
+		t.Fatalf("unexpected sizes after renumbering: %s\n", string(r))
+	}
+	supervoxels, err := d.GetSupervoxels(v, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(supervoxels) != 2 || !supervoxels.Exists(20) || !supervoxels.Exists(30) {
+		t.Fatalf("expected supervoxels 20 and 30 in renumbered body 2, got %s\n", supervoxels)
+	}
+	leases := d.GetBodyLeases(v)
+	if len(leases) != 1 || leases[0].Label != 2 || leases[0].User != "alice" {
+		t.Fatalf("expected lease moved to body 2, got %v\n", leases)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/renumbering/key/20", server.WebAPIPath, uuid)
+	if r = server.TestHTTP(t, "GET", reqStr, nil); string(r) != "2" {
+		t.Fatalf("expected renumbering table entry 20 -> 2, got %q\n", string(r))
+	}
+
+	// renumbered bodies can be mutated and new labels are above all supervoxels.
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge?u=alice", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[1, 2]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if size, err := GetLabelSize(d, v, 1, false); err != nil || size != 2500 {
+		t.Fatalf("expected merged renumbered body of 2500 voxels, got %d: %v\n", size, err)
+	}
+	newLabel, err := d.newLabel(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newLabel <= 30 {
+		t.Fatalf("expected new label above supervoxels after renumbering, got %d\n", newLabel)
+	}
+
+	// default renumbering doesn't reuse labels.
+	mapping, err = d.RenumberBodies(v, 0, false, nil)
+	if err != nil {
+		t.Fatalf("error renumbering bodies: %v\n", err)
+	}
+	expected = map[uint64]uint64{1: newLabel + 1}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Fatalf("expected renumbering %v, got %v\n", expected, mapping)
+	}
+	if size, err := GetLabelSize(d, v, newLabel+1, false); err != nil || size != 2500 {
+		t.Fatalf("expected renumbered body of 2500 voxels, got %d: %v\n", size, err)
+	}
+}
+
+// streamRecorder is a concurrency-safe http.ResponseWriter for reading streamed responses.
+type streamRecorder struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+	sync.Mutex
+}
+
+func (s *streamRecorder) Header() http.Header {
+	return s.header
+}
+
+func (s *streamRecorder) WriteHeader(status int) {
+	s.Lock()
+	s.status = status
+	s.Unlock()
+}
+
+func (s *streamRecorder) Write(b []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.buf.Write(b)
+}
+
+func (s *streamRecorder) Flush() {}
+
+func (s *streamRecorder) String() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.buf.String()
+}
+
+func TestMutationsStream(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{10, 10, 10}, 1)
+	vol.addSubvol(dvid.Point3d{20, 0, 0}, dvid.Point3d{10, 10, 10}, 2)
+	vol.addSubvol(dvid.Point3d{0, 20, 0}, dvid.Point3d{10, 10, 10}, 3)
+	vol.addSubvol(dvid.Point3d{20, 20, 0}, dvid.Point3d{10, 10, 10}, 4)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// open a stream filtered to bodies 1 and 2, and a direct subscriber filtered to user bob.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	reqStr := fmt.Sprintf("%snode/%s/labels/mutations/stream?bodies=1,2", server.WebAPIPath, uuid)
+	req, err := http.NewRequest("GET", reqStr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &streamRecorder{header: make(http.Header)}
+	done := make(chan struct{})
+	go func() {
+		server.ServeSingleHTTP(w, req.WithContext(streamCtx))
+		close(done)
+	}()
+	bobSub := &mutationSubscriber{ch: make(chan mutationEvent, 10), user: "bob"}
+	d.subscribeMutations(v, bobSub)
+	for i := 0; ; i++ {
+		mStreams.Lock()
+		numSubs := len(mStreams.subs[streamKey{d.DataUUID(), v}])
+		mStreams.Unlock()
+		if numSubs == 2 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("mutations stream never subscribed\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge?u=bob", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[3, 4]"))
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge?u=alice", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[1, 2]"))
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/1?u=alice", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[2]"))
+
+	var out string
+	for i := 0; ; i++ {
+		out = w.String()
+		if strings.Contains(out, "event: cleave") {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("never received streamed cleave, got:\n%s\n", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if w.header.Get("Content-type") != "text/event-stream" {
+		t.Fatalf("expected event stream content type, got %q\n", w.header.Get("Content-type"))
+	}
+	events := strings.Split(strings.TrimSpace(out), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("expected merge and cleave of bodies 1 and 2 in stream, got:\n%s\n", out)
+	}
+	for i, action := range []string{"merge", "cleave"} {
+		lines := strings.Split(events[i], "\n")
+		if len(lines) != 3 || lines[1] != "event: "+action || !strings.HasPrefix(lines[2], "data: ") {
+			t.Fatalf("bad streamed %s event:\n%s\n", action, events[i])
+		}
+		var msg struct {
+			Action     string
+			MutationID uint64
+			User       string
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &msg); err != nil {
+			t.Fatalf("bad JSON in streamed %s event: %v\n", action, err)
+		}
+		if msg.Action != action || msg.User != "alice" || lines[0] != fmt.Sprintf("id: %d", msg.MutationID) {
+			t.Fatalf("unexpected streamed %s event:\n%s\n", action, events[i])
+		}
+	}
+
+	d.unsubscribeMutations(v, bobSub)
+	var bobEvents []mutationEvent
+	for evt := range bobSub.ch {
+		bobEvents = append(bobEvents, evt)
+	}
+	if len(bobEvents) != 1 || bobEvents[0].action != "merge" || bobEvents[0].user != "bob" {
+		t.Fatalf("expected only bob's merge for user-filtered subscriber, got %v\n", bobEvents)
+	}
+
+	// renumbering is streamed with both the old and new labels of each body.
+	renumberSub := &mutationSubscriber{ch: make(chan mutationEvent, 10), bodies: map[uint64]struct{}{3: {}}}
+	d.subscribeMutations(v, renumberSub)
+	mapping, err := d.RenumberBodies(v, 0, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.unsubscribeMutations(v, renumberSub)
+	var renumberEvents []mutationEvent
+	for evt := range renumberSub.ch {
+		renumberEvents = append(renumberEvents, evt)
+	}
+	if len(renumberEvents) != 1 || renumberEvents[0].action != "renumber" || len(renumberEvents[0].bodies) != 2*len(mapping) {
+		t.Fatalf("expected renumber event for mapping %v, got %v\n", mapping, renumberEvents)
+	}
+	mStreams.Lock()
+	_, found := mStreams.subs[streamKey{d.DataUUID(), v}]
+	mStreams.Unlock()
+	if found {
+		t.Fatalf("expected no subscribers left after streams closed\n")
+	}
+}
+
+func TestMergeCandidates(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	for sv := uint64(1); sv <= 5; sv++ {
+		vol.addSubvol(dvid.Point3d{int32(sv-1) * 12, 0, 0}, dvid.Point3d{10, 10, 10}, sv)
+	}
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[1, 2]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	affinities := `[
+		{"Label1": 1, "Label2": 3, "Value": 0.9},
+		{"Label1": 3, "Label2": 2, "Value": 0.5},
+		{"Label1": 2, "Label2": 4, "Value": 0.7},
+		{"Label1": 1, "Label2": 5, "Value": 0.2},
+		{"Label1": 3, "Label2": 4, "Value": 0.99},
+		{"Label1": 1, "Label2": 2, "Value": 0.8}
+	]`
+	reqStr = fmt.Sprintf("%snode/%s/labels/affinities", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(affinities))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`[{"Label1": 3, "Label2": 3, "Value": 0.5}]`))
+
+	getCandidates := func(uuid dvid.UUID, query string) []MergeCandidate {
+		reqStr := fmt.Sprintf("%snode/%s/labels/merge-candidates/1%s", server.WebAPIPath, uuid, query)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var candidates []MergeCandidate
+		if err := json.Unmarshal(r, &candidates); err != nil {
+			t.Fatalf("unable to decode merge candidates %q: %v\n", string(r), err)
+		}
+		return candidates
+	}
+	expected := []MergeCandidate{
+		{Body: 3, Affinity: 0.9, Supervoxel: 1, PartnerSupervoxel: 3, Pairs: 2},
+		{Body: 4, Affinity: 0.7, Supervoxel: 2, PartnerSupervoxel: 4, Pairs: 1},
+		{Body: 5, Affinity: 0.2, Supervoxel: 1, PartnerSupervoxel: 5, Pairs: 1},
+	}
+	if candidates := getCandidates(uuid, ""); !reflect.DeepEqual(candidates, expected) {
+		t.Fatalf("expected merge candidates %v, got %v\n", expected, candidates)
+	}
+	if candidates := getCandidates(uuid, "?n=2"); !reflect.DeepEqual(candidates, expected[:2]) {
+		t.Fatalf("expected top 2 merge candidates %v, got %v\n", expected[:2], candidates)
+	}
+	if candidates := getCandidates(uuid, "?minaffinity=0.6"); !reflect.DeepEqual(candidates, expected[:2]) {
+		t.Fatalf("expected merge candidates above 0.6 %v, got %v\n", expected[:2], candidates)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge-candidates/99", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	// reject the best pair and check the decision holds in a child version.
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge-decisions?u=alice", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(`[{"Supervoxel1": 3, "Supervoxel2": 1, "Decision": "reject"}]`))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`[{"Supervoxel1": 3, "Supervoxel2": 1, "Decision": "maybe"}]`))
+
+	commitReq := fmt.Sprintf("%snode/%s/commit", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", commitReq, bytes.NewBufferString(`{"note": "affinities"}`))
+	newVersionReq := fmt.Sprintf("%snode/%s/newversion", server.WebAPIPath, uuid)
+	respData := server.TestHTTP(t, "POST", newVersionReq, nil)
+	resp := struct {
+		Child string `json:"child"`
+	}{}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		t.Fatalf("Expected 'child' JSON response.  Got %s\n", string(respData))
+	}
+	child := dvid.UUID(resp.Child)
+
+	expected = []MergeCandidate{
+		{Body: 4, Affinity: 0.7, Supervoxel: 2, PartnerSupervoxel: 4, Pairs: 1},
+		{Body: 3, Affinity: 0.5, Supervoxel: 2, PartnerSupervoxel: 3, Pairs: 1},
+		{Body: 5, Affinity: 0.2, Supervoxel: 1, PartnerSupervoxel: 5, Pairs: 1},
+	}
+	if candidates := getCandidates(child, ""); !reflect.DeepEqual(candidates, expected) {
+		t.Fatalf("expected merge candidates after rejection %v, got %v\n", expected, candidates)
+	}
+
+	// candidates are mapped through merges in the child.
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, child)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[4, 5]"))
+	if err := datastore.BlockOnUpdating(child, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	expected = []MergeCandidate{
+		{Body: 4, Affinity: 0.7, Supervoxel: 2, PartnerSupervoxel: 4, Pairs: 2},
+		{Body: 3, Affinity: 0.5, Supervoxel: 2, PartnerSupervoxel: 3, Pairs: 1},
+	}
+	if candidates := getCandidates(child, ""); !reflect.DeepEqual(candidates, expected) {
+		t.Fatalf("expected merge candidates after merge %v, got %v\n", expected, candidates)
+	}
+}
+
+func TestSplitScaledMask(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "2")
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{24, 16, 16}, 10)
+	vol.addSubvol(dvid.Point3d{24, 0, 0}, dvid.Point3d{8, 16, 16}, 20)
+	vol.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{8, 8, 8}, 30)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// scale 1 mask covering x 0-31, y 0-7, z 0-15 at scale 0, which covers both supervoxels.
+	var mask dvid.RLEs
+	for z := int32(0); z < 8; z++ {
+		for y := int32(0); y < 4; y++ {
+			mask = append(mask, dvid.NewRLE(dvid.Point3d{0, y, z}, 16))
+		}
+	}
+	encodeMask := func() *bytes.Buffer {
+		buf := new(bytes.Buffer)
+		buf.WriteByte(dvid.EncodingBinary)
+		binary.Write(buf, binary.LittleEndian, uint8(3))          // # of dimensions
+		binary.Write(buf, binary.LittleEndian, byte(0))           // dimension of run (X = 0)
+		buf.WriteByte(byte(0))                                    // reserved for later
+		binary.Write(buf, binary.LittleEndian, uint32(0))         // Placeholder for # voxels
+		binary.Write(buf, binary.LittleEndian, uint32(len(mask))) // # spans
+		maskBytes, err := mask.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Unable to serialize RLEs: %v\n", err)
+		}
+		buf.Write(maskBytes)
+		return buf
+	}
+	getLabel := func(x, y, z int32, supervoxels bool) uint64 {
+		reqStr := fmt.Sprintf("%snode/%s/labels/label/%d_%d_%d?supervoxels=%t", server.WebAPIPath, uuid, x, y, z, supervoxels)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var jsonVal struct {
+			Label uint64
+		}
+		if err := json.Unmarshal(r, &jsonVal); err != nil {
+			t.Fatalf("unable to decode label response %q: %v\n", string(r), err)
+		}
+		return jsonVal.Label
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/split-supervoxel/10?scale=1&split=40&remain=41", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, encodeMask())
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	if label := getLabel(5, 3, 5, true); label != 40 {
+		t.Errorf("expected split supervoxel 40 within mask, got %d\n", label)
+	}
+	if label := getLabel(23, 7, 15, true); label != 40 {
+		t.Errorf("expected split supervoxel 40 at mask corner, got %d\n", label)
+	}
+	if label := getLabel(5, 12, 5, true); label != 41 {
+		t.Errorf("expected remain supervoxel 41 outside mask, got %d\n", label)
+	}
+	if label := getLabel(28, 3, 5, true); label != 20 {
+		t.Errorf("expected supervoxel 20 within mask to be unchanged, got %d\n", label)
+	}
+	if label := getLabel(5, 3, 5, false); label != 10 {
+		t.Errorf("expected split supervoxel to still map to body 10, got %d\n", label)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/size/40?supervoxels=true", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "GET", reqStr, nil)
+	var sizeVal struct {
+		NumVoxels uint64 `json:"voxels"`
+	}
+	if err := json.Unmarshal(r, &sizeVal); err != nil {
+		t.Fatalf("unable to decode size response %q: %v\n", string(r), err)
+	}
+	if sizeVal.NumVoxels != 24*8*16 {
+		t.Errorf("expected %d voxels in split supervoxel, got %d\n", 24*8*16, sizeVal.NumVoxels)
+	}
+
+	// body split with the same mask after merging supervoxel 20 into body 10.
+	reqStr = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[10, 20]"))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/split/10?scale=1", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, encodeMask())
+	var splitResp struct {
+		Label uint64 `json:"label"`
+	}
+	if err := json.Unmarshal(r, &splitResp); err != nil {
+		t.Fatalf("Unable to get new label from split.  Instead got: %s\n", string(r))
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	for _, pt := range []dvid.Point3d{{5, 3, 5}, {28, 3, 5}} {
+		if label := getLabel(pt[0], pt[1], pt[2], false); label != splitResp.Label {
+			t.Errorf("expected split body %d at %s, got %d\n", splitResp.Label, pt, label)
+		}
+	}
+	if label := getLabel(5, 12, 5, false); label != 10 {
+		t.Errorf("expected body 10 outside mask, got %d\n", label)
+	}
+	if label := getLabel(42, 42, 42, false); label != 30 {
+		t.Errorf("expected body 30 to be unaffected, got %d\n", label)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/split-supervoxel/30?scale=3", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, encodeMask())
+}
+
+func TestBodyProps(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	config.Set("BodyPropsMerge", "union")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+
+	vol := newTestVolume(64, 64, 64)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{10, 10, 10}, 10)
+	vol.addSubvol(dvid.Point3d{20, 0, 0}, dvid.Point3d{20, 20, 20}, 20)
+	vol.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{4, 4, 4}, 30)
+	vol.addSubvol(dvid.Point3d{50, 50, 50}, dvid.Point3d{4, 4, 4}, 40)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	getProps := func(label uint64) map[string]interface{} {
+		reqStr := fmt.Sprintf("%snode/%s/labels/body-props/%d", server.WebAPIPath, uuid, label)
+		r := server.TestHTTP(t, "GET", reqStr, nil)
+		var props map[string]interface{}
+		if err := json.Unmarshal(r, &props); err != nil {
+			t.Fatalf("unable to decode body props %q: %v\n", string(r), err)
+		}
+		return props
+	}
+	checkProps := func(label uint64, expected map[string]interface{}) {
+		if props := getProps(label); !reflect.DeepEqual(props, expected) {
+			t.Fatalf("expected body %d props %v, got %v\n", label, expected, props)
+		}
+	}
+	postProps := func(label uint64, props string) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/body-props/%d", server.WebAPIPath, uuid, label)
+		server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(props))
+	}
+	merge := func(tuple string) uint64 {
+		reqStr := fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+		r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(tuple))
+		if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+			t.Fatalf("Error blocking on sync of labels: %v\n", err)
+		}
+		var mergeResp struct {
+			MutationID uint64
+		}
+		if err := json.Unmarshal(r, &mergeResp); err != nil {
+			t.Fatalf("unable to decode merge response %q: %v\n", string(r), err)
+		}
+		return mergeResp.MutationID
+	}
+
+	checkProps(10, map[string]interface{}{})
+	postProps(10, `{"status": "Traced", "owner": "alice"}`)
+	postProps(20, `{"status": "Orphan", "notes": "big"}`)
+	postProps(30, `{"status": "Leaves"}`)
+	checkProps(10, map[string]interface{}{"status": "Traced", "owner": "alice"})
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/body-props", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "GET", reqStr, bytes.NewBufferString("[30, 40]"))
+	if string(bytes.TrimSpace(r)) != `[{"status":"Leaves"},null]` {
+		t.Fatalf("unexpected batch body props: %s\n", string(r))
+	}
+
+	// union keeps the target's status but adds the merged body's notes.
+	merge("[10, 20]")
+	checkProps(10, map[string]interface{}{"status": "Traced", "owner": "alice", "notes": "big"})
+	checkProps(20, map[string]interface{}{})
+
+	// cleaved body gets a copy of the original's properties.
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/10", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[20]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("unable to decode cleave response %q: %v\n", string(r), err)
+	}
+	checkProps(cleaveResp.CleavedLabel, map[string]interface{}{"status": "Traced", "owner": "alice", "notes": "big"})
+
+	// with "larger", merging the cleaved body into the small body 30 keeps the larger body's props.
+	reqStr = fmt.Sprintf("%snode/%s/labels", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"BodyPropsMerge": "larger"}`))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"BodyPropsMerge": "newest"}`))
+	mergeID := merge(fmt.Sprintf("[30, %d]", cleaveResp.CleavedLabel))
+	checkProps(30, map[string]interface{}{"status": "Traced", "owner": "alice", "notes": "big"})
+	checkProps(cleaveResp.CleavedLabel, map[string]interface{}{})
+
+	// undoing the merge restores the properties of both bodies.
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, mergeID)
+	server.TestHTTP(t, "POST", reqStr, nil)
+	checkProps(30, map[string]interface{}{"status": "Leaves"})
+	checkProps(cleaveResp.CleavedLabel, map[string]interface{}{"status": "Traced", "owner": "alice", "notes": "big"})
+	merge(fmt.Sprintf("[30, %d]", cleaveResp.CleavedLabel))
+	checkProps(30, map[string]interface{}{"status": "Traced", "owner": "alice", "notes": "big"})
+
+	postProps(30, `{}`)
+	checkProps(30, map[string]interface{}{})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 
 	"github.com/janelia-flyem/dvid/datastore"
@@ -81,6 +82,137 @@ func (d *Data) GetMutationHistory(w http.ResponseWriter, fromUUID, toUUID dvid.U
 	return nil
 }
 
+// BodyDiff describes how a body changed between two versions.
+type BodyDiff struct {
+	Label              uint64
+	ChangeType         string // "created", "deleted", or "modified"
+	MutationIDs        []uint64
+	AddedSupervoxels   []uint64 `json:",omitempty"`
+	RemovedSupervoxels []uint64 `json:",omitempty"`
+}
+
+// GetBodyDiff returns the bodies that differ between the fromUUID and toUUID versions, where
+// fromUUID must be an ancestor of toUUID.  Candidate bodies are those touched by mutations
+// logged in the versions after fromUUID up to and including toUUID, and their supervoxels
+// are compared using the label indices at each version.  Bodies with identical supervoxels
+// in both versions are omitted unless they were painted.  The returned diffs are sorted by label.
+func (d *Data) GetBodyDiff(fromUUID, toUUID dvid.UUID) ([]BodyDiff, error) {
+	fromV, err := datastore.VersionFromUUID(fromUUID)
+	if err != nil {
+		return nil, err
+	}
+	toV, err := datastore.VersionFromUUID(toUUID)
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := datastore.GetAncestry(toV)
+	if err != nil {
+		return nil, err
+	}
+	var versions []dvid.VersionID // versions after fromV in order from root to toV
+	var found bool
+	for _, v := range ancestors {
+		if v == fromV {
+			found = true
+			break
+		}
+		versions = append([]dvid.VersionID{v}, versions...)
+	}
+	if !found {
+		return nil, fmt.Errorf("version %s is not an ancestor of version %s", fromUUID, toUUID)
+	}
+
+	timedLog := dvid.NewTimeLog()
+	bodyMutIDs := make(map[uint64]map[uint64]struct{})
+	painted := make(labels.Set) // bodies whose voxels changed without supervoxel changes
+	for _, v := range versions {
+		muts, err := d.readMutationLog(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, mut := range muts {
+			for label := range mut.bodies {
+				if label == 0 {
+					continue
+				}
+				if mut.paint != nil {
+					painted[label] = struct{}{}
+				}
+				mutIDs, found := bodyMutIDs[label]
+				if !found {
+					mutIDs = make(map[uint64]struct{})
+					bodyMutIDs[label] = mutIDs
+				}
+				mutIDs[mut.mutID] = struct{}{}
+			}
+		}
+	}
+
+	var diffs []BodyDiff
+	for label, mutIDs := range bodyMutIDs {
+		fromSVs, err := d.indexedSupervoxels(fromV, label)
+		if err != nil {
+			return nil, err
+		}
+		toSVs, err := d.indexedSupervoxels(toV, label)
+		if err != nil {
+			return nil, err
+		}
+		diff := BodyDiff{Label: label}
+		switch {
+		case len(fromSVs) == 0 && len(toSVs) == 0:
+			continue
+		case len(fromSVs) == 0:
+			diff.ChangeType = "created"
+		case len(toSVs) == 0:
+			diff.ChangeType = "deleted"
+		default:
+			diff.ChangeType = "modified"
+		}
+		diff.AddedSupervoxels = sortedSetDifference(toSVs, fromSVs)
+		diff.RemovedSupervoxels = sortedSetDifference(fromSVs, toSVs)
+		if len(diff.AddedSupervoxels) == 0 && len(diff.RemovedSupervoxels) == 0 {
+			if _, found := painted[label]; !found || diff.ChangeType != "modified" {
+				continue
+			}
+		}
+		diff.MutationIDs = make([]uint64, 0, len(mutIDs))
+		for mutID := range mutIDs {
+			diff.MutationIDs = append(diff.MutationIDs, mutID)
+		}
+		sort.Slice(diff.MutationIDs, func(i, j int) bool { return diff.MutationIDs[i] < diff.MutationIDs[j] })
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Label < diffs[j].Label })
+	timedLog.Infof("Computed diff of %d bodies for data %q from UUID %s to %s", len(diffs), d.DataName(), fromUUID, toUUID)
+	return diffs, nil
+}
+
+// indexedSupervoxels returns the supervoxels in the label index of a body at the given
+// version or nil if there is no index.
+func (d *Data) indexedSupervoxels(v dvid.VersionID, label uint64) (labels.Set, error) {
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	return idx.GetSupervoxels(), nil
+}
+
+// returns the sorted labels in s1 but not in s2.
+func sortedSetDifference(s1, s2 labels.Set) []uint64 {
+	var diff []uint64
+	for label := range s1 {
+		if _, found := s2[label]; !found {
+			diff = append(diff, label)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i] < diff[j] })
+	return diff
+}
+
 func processMutationLogStream(w http.ResponseWriter, v dvid.VersionID, ch chan storage.LogMessage, wg *sync.WaitGroup, origBodies, supervoxelSet labels.Set) {
 	numMsgs := 0
 	for msg := range ch { // expects channel to be closed on completion
@@ -190,6 +322,32 @@ func processMutationLogStream(w http.ResponseWriter, v dvid.VersionID, ch chan s
 				}
 			}
 
+		case proto.PaintOpType:
+			var op proto.PaintOp
+			if err := op.Unmarshal(msg.Data); err != nil {
+				dvid.Errorf("unable to unmarshal paint log message for version %d: %v\n", v, err)
+				wg.Done()
+				continue
+			}
+			for _, label := range op.Bodies {
+				if _, found := origBodies[label]; !found {
+					continue
+				}
+				out, err = json.Marshal(struct {
+					Action string
+					Label  uint64
+					Bodies []uint64
+				}{
+					Action: "paint",
+					Label:  op.Label,
+					Bodies: op.Bodies,
+				})
+				if err != nil {
+					dvid.Errorf("unable to write paint message: %v\n", err)
+				}
+				break
+			}
+
 		default:
 		}
 		if len(out) != 0 {
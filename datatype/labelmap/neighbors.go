@@ -0,0 +1,320 @@
+/*
+	This file supports queries on the adjacency of labels, e.g., which bodies touch a given
+	body and the voxels along the interface between two bodies.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// face directions in order -x, +x, -y, +y, -z, +z where direction i is along axis i/2.
+var faceOffsets = [6]dvid.Point3d{{-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}, {0, 0, -1}, {0, 0, 1}}
+
+// blockFaces holds the labels on the six faces of a block in the face direction order.
+// Each face is a 2d array of labels ordered by the two remaining axes, lower axis fastest.
+// A nil blockFaces denotes a block with no data.
+type blockFaces [6][]uint64
+
+// faceIndex returns the index into a face perpendicular to the given axis for a voxel position.
+func faceIndex(axis int, pos, size dvid.Point3d) int32 {
+	switch axis {
+	case 0:
+		return pos[2]*size[1] + pos[1]
+	case 1:
+		return pos[2]*size[0] + pos[0]
+	default:
+		return pos[1]*size[0] + pos[0]
+	}
+}
+
+func getBlockFaces(vol []uint64, size dvid.Point3d) *blockFaces {
+	var faces blockFaces
+	for dir := 0; dir < 6; dir++ {
+		axis := dir / 2
+		var fixed int32
+		if dir%2 == 1 {
+			fixed = size[axis] - 1
+		}
+		u, v := (axis+1)%3, (axis+2)%3
+		if u > v {
+			u, v = v, u
+		}
+		face := make([]uint64, size[u]*size[v])
+		var pos dvid.Point3d
+		pos[axis] = fixed
+		for pos[v] = 0; pos[v] < size[v]; pos[v]++ {
+			for pos[u] = 0; pos[u] < size[u]; pos[u]++ {
+				i := (pos[2]*size[1]+pos[1])*size[0] + pos[0]
+				face[faceIndex(axis, pos, size)] = vol[i]
+			}
+		}
+		faces[dir] = face
+	}
+	return &faces
+}
+
+func blockLabelArray(block *labels.Block) []uint64 {
+	data, size := block.MakeLabelVolume()
+	vol := make([]uint64, size.Prod())
+	for i := range vol {
+		vol[i] = binary.LittleEndian.Uint64(data[i*8 : i*8+8])
+	}
+	return vol
+}
+
+// adjacencyScanner visits the 6-connected neighbors of the voxels in a label's blocks.
+// Since blocks are visited in ZYX order, only the faces of blocks within one block of the
+// current z are cached.
+type adjacencyScanner struct {
+	d     *Data
+	ctx   *datastore.VersionedCtx
+	scale uint8
+	faces map[dvid.ChunkPoint3d]*blockFaces
+}
+
+func (s *adjacencyScanner) getFaces(bcoord dvid.ChunkPoint3d) (*blockFaces, error) {
+	if faces, found := s.faces[bcoord]; found {
+		return faces, nil
+	}
+	pb, err := s.d.getLabelBlock(s.ctx, s.scale, bcoord.ToIZYXString())
+	if err != nil {
+		return nil, err
+	}
+	var faces *blockFaces
+	if pb != nil {
+		faces = getBlockFaces(blockLabelArray(&(pb.Block)), pb.Size)
+	}
+	s.faces[bcoord] = faces
+	return faces, nil
+}
+
+func (s *adjacencyScanner) evictBefore(z int32) {
+	for bcoord := range s.faces {
+		if bcoord[2] < z {
+			delete(s.faces, bcoord)
+		}
+	}
+}
+
+// scan calls the given function for every face between a voxel with a label in the given set
+// and a voxel with a non-zero label outside the set.  The function receives the voxel
+// coordinates of both voxels and the supervoxel label of the outside voxel.
+func (s *adjacencyScanner) scan(idx *labels.Index, svs labels.Set, fn func(in, out dvid.Point3d, label uint64)) error {
+	blocks, err := idx.GetProcessedBlockIndices(s.scale, dvid.Bounds{})
+	if err != nil {
+		return err
+	}
+	sort.Sort(blocks)
+	var prevZ int32
+	for i, izyx := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return err
+		}
+		if i == 0 || bcoord[2] != prevZ {
+			s.evictBefore(bcoord[2] - 1)
+			prevZ = bcoord[2]
+		}
+		pb, err := s.d.getLabelBlock(s.ctx, s.scale, izyx)
+		if err != nil {
+			return err
+		}
+		if pb == nil {
+			continue
+		}
+		size := pb.Size
+		vol := blockLabelArray(&(pb.Block))
+		if _, found := s.faces[bcoord]; !found {
+			s.faces[bcoord] = getBlockFaces(vol, size)
+		}
+		offset := dvid.Point3d{bcoord[0] * size[0], bcoord[1] * size[1], bcoord[2] * size[2]}
+		var vi int
+		var pos dvid.Point3d
+		for pos[2] = 0; pos[2] < size[2]; pos[2]++ {
+			for pos[1] = 0; pos[1] < size[1]; pos[1]++ {
+				for pos[0] = 0; pos[0] < size[0]; pos[0]++ {
+					label := vol[vi]
+					vi++
+					if _, in := svs[label]; !in {
+						continue
+					}
+					for dir, off := range faceOffsets {
+						axis := dir / 2
+						nbr := dvid.Point3d{pos[0] + off[0], pos[1] + off[1], pos[2] + off[2]}
+						var nbrLabel uint64
+						if nbr[axis] >= 0 && nbr[axis] < size[axis] {
+							nbrLabel = vol[(nbr[2]*size[1]+nbr[1])*size[0]+nbr[0]]
+						} else {
+							nbrBlock := bcoord
+							nbrBlock[axis] += off[axis]
+							faces, err := s.getFaces(nbrBlock)
+							if err != nil {
+								return err
+							}
+							if faces == nil {
+								continue
+							}
+							nbrLabel = faces[dir^1][faceIndex(axis, pos, size)]
+						}
+						if nbrLabel == 0 {
+							continue
+						}
+						if _, in := svs[nbrLabel]; in {
+							continue
+						}
+						fn(pos.Add3d(offset), nbr.Add3d(offset), nbrLabel)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getLabelSupervoxels returns the index and supervoxels of a label or supervoxel, or a nil
+// index if the label wasn't found.
+func (d *Data) getLabelSupervoxels(v dvid.VersionID, label uint64, isSupervoxel bool) (*labels.Index, labels.Set, error) {
+	idx, err := GetLabelIndex(d, v, label, isSupervoxel)
+	if err != nil {
+		return nil, nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil, nil
+	}
+	supervoxels := idx.GetSupervoxels()
+	if isSupervoxel {
+		if _, found := supervoxels[label]; !found {
+			return nil, nil, nil
+		}
+		if idx, err = idx.LimitToSupervoxel(label); err != nil {
+			return nil, nil, err
+		}
+		supervoxels = labels.Set{label: struct{}{}}
+	}
+	return idx, supervoxels, nil
+}
+
+// LabelContact is the number of voxel faces shared between a label and an adjacent label.
+type LabelContact struct {
+	Label   uint64 `json:"label"`
+	Contact uint64 `json:"contact"`
+}
+
+// GetNeighbors returns the labels (or supervoxels if isSupervoxel is true) adjacent to the
+// given label with the number of voxel faces in contact, sorted by decreasing contact.
+// A nil slice is returned if the label isn't found.
+func (d *Data) GetNeighbors(v dvid.VersionID, label uint64, scale uint8, isSupervoxel bool) ([]LabelContact, error) {
+	idx, svs, err := d.getLabelSupervoxels(v, label, isSupervoxel)
+	if err != nil || idx == nil {
+		return nil, err
+	}
+	scanner := adjacencyScanner{
+		d:     d,
+		ctx:   datastore.NewVersionedCtx(d, v),
+		scale: scale,
+		faces: make(map[dvid.ChunkPoint3d]*blockFaces),
+	}
+	svContacts := make(map[uint64]uint64)
+	err = scanner.scan(idx, svs, func(in, out dvid.Point3d, nbrLabel uint64) {
+		svContacts[nbrLabel]++
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := svContacts
+	if !isSupervoxel {
+		contacts = make(map[uint64]uint64, len(svContacts))
+		nbrSVs := make([]uint64, 0, len(svContacts))
+		for sv := range svContacts {
+			nbrSVs = append(nbrSVs, sv)
+		}
+		mapped, _, err := d.GetMappedLabels(v, nbrSVs)
+		if err != nil {
+			return nil, err
+		}
+		for i, sv := range nbrSVs {
+			contacts[mapped[i]] += svContacts[sv]
+		}
+	}
+	neighbors := make([]LabelContact, 0, len(contacts))
+	for nbrLabel, contact := range contacts {
+		neighbors = append(neighbors, LabelContact{Label: nbrLabel, Contact: contact})
+	}
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Contact != neighbors[j].Contact {
+			return neighbors[i].Contact > neighbors[j].Contact
+		}
+		return neighbors[i].Label < neighbors[j].Label
+	})
+	return neighbors, nil
+}
+
+// GetContactRLEs returns the voxels of either label that are 6-connected to a voxel of the
+// other label, encoded as legacy RLEs like the "sparsevol" endpoint.  A nil slice is
+// returned if either label isn't found or the labels aren't in contact.
+func (d *Data) GetContactRLEs(v dvid.VersionID, label1, label2 uint64, scale uint8, isSupervoxel bool) ([]byte, error) {
+	idx1, svs1, err := d.getLabelSupervoxels(v, label1, isSupervoxel)
+	if err != nil || idx1 == nil {
+		return nil, err
+	}
+	idx2, svs2, err := d.getLabelSupervoxels(v, label2, isSupervoxel)
+	if err != nil || idx2 == nil {
+		return nil, err
+	}
+	for sv := range svs1 {
+		if _, found := svs2[sv]; found {
+			return nil, fmt.Errorf("labels %d and %d share supervoxel %d", label1, label2, sv)
+		}
+	}
+
+	scanner := adjacencyScanner{
+		d:     d,
+		ctx:   datastore.NewVersionedCtx(d, v),
+		scale: scale,
+		faces: make(map[dvid.ChunkPoint3d]*blockFaces),
+	}
+	voxels := make(map[dvid.Point3d]struct{})
+	err = scanner.scan(idx1, svs1, func(in, out dvid.Point3d, nbrLabel uint64) {
+		if _, found := svs2[nbrLabel]; found {
+			voxels[in] = struct{}{}
+			voxels[out] = struct{}{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(voxels) == 0 {
+		return nil, nil
+	}
+
+	var rles dvid.RLEs
+	for pt := range voxels {
+		rles = append(rles, dvid.NewRLE(pt, 1))
+	}
+	rles = rles.Normalize()
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	numVoxels, numRuns := rles.Stats()
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))          // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))           // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                                    // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(numVoxels)) // # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(numRuns))   // # spans
+	buf.Write(rleBytes)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,293 @@
+/*
+	This file supports painting a label into a sparse set of voxels given as RLEs, spheres or
+	individual voxels.  Only the painted voxels are rewritten in the affected blocks.
+*/
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// PaintSphere is a ball of voxels within Radius of the Center voxel.
+type PaintSphere struct {
+	Center dvid.Point3d
+	Radius int32
+}
+
+// PaintShapes is the JSON alternative to RLEs for specifying voxels to paint.
+type PaintShapes struct {
+	Voxels  []dvid.Point3d
+	Spheres []PaintSphere
+}
+
+// RLEs returns the normalized RLEs covering all voxels of the shapes.
+func (s PaintShapes) RLEs() (dvid.RLEs, error) {
+	var rles dvid.RLEs
+	for _, pt := range s.Voxels {
+		rles = append(rles, dvid.NewRLE(pt, 1))
+	}
+	for _, sphere := range s.Spheres {
+		if sphere.Radius < 0 {
+			return nil, fmt.Errorf("sphere at %s has negative radius %d", sphere.Center, sphere.Radius)
+		}
+		r := sphere.Radius
+		r2 := int64(r) * int64(r)
+		for dz := -r; dz <= r; dz++ {
+			for dy := -r; dy <= r; dy++ {
+				remain := r2 - int64(dz)*int64(dz) - int64(dy)*int64(dy)
+				if remain < 0 {
+					continue
+				}
+				var dx int32
+				for int64(dx+1)*int64(dx+1) <= remain {
+					dx++
+				}
+				start := dvid.Point3d{sphere.Center[0] - dx, sphere.Center[1] + dy, sphere.Center[2] + dz}
+				rles = append(rles, dvid.NewRLE(start, 2*dx+1))
+			}
+		}
+	}
+	return rles.Normalize(), nil
+}
+
+type paintedBlock struct {
+	bcoord dvid.IZYXString
+	prev   *labels.Block // nil if block did not exist
+	block  *labels.Block
+}
+
+// PaintLabel writes the given label into the voxels covered by the RLEs, leaving all other
+// voxels untouched.  Label indices, max label and down-resolution levels are updated as for
+// other voxel writes, and the paint is logged to the mutation log.  Painting is refused if
+// any body with overwritten voxels or the body of the painted label is leased by another
+// user.
+func (d *Data) PaintLabel(v dvid.VersionID, label uint64, rles dvid.RLEs, info dvid.ModInfo) (mutID uint64, err error) {
+	if label == 0 {
+		err = fmt.Errorf("label 0 is protected background value and cannot be painted")
+		return
+	}
+	rles = rles.Normalize()
+	numVoxels, _ := rles.Stats()
+	if numVoxels == 0 {
+		err = fmt.Errorf("no voxels were given to paint")
+		return
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		err = fmt.Errorf("can't paint because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+		return
+	}
+	var paintmap dvid.BlockRLEs
+	if paintmap, err = rles.Partition(blockSize); err != nil {
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	// Only do voxel-based mutations one at a time.  This lets us remove handling for block-level concurrency.
+	d.voxelMu.Lock()
+	defer d.voxelMu.Unlock()
+
+	// read affected blocks and paint them in memory, tracking overwritten supervoxels.
+	var scale uint8
+	ctx := datastore.NewVersionedCtx(d, v)
+	overwritten := labels.Set{label: struct{}{}}
+	var painted []paintedBlock
+	for _, bcoord := range paintmap.SortedKeys() {
+		var pb *labels.PositionedBlock
+		if pb, err = d.getLabelBlock(ctx, scale, bcoord); err != nil {
+			return
+		}
+		pblock := paintedBlock{bcoord: bcoord}
+		var data []byte
+		if pb == nil {
+			data = make([]byte, blockSize.Prod()*8)
+		} else {
+			pblock.prev = &(pb.Block)
+			data, _ = pb.Block.MakeLabelVolume()
+		}
+		var chunkPt dvid.ChunkPoint3d
+		if chunkPt, err = bcoord.ToChunkPoint3d(); err != nil {
+			return
+		}
+		offset := chunkPt.MinPoint(blockSize).(dvid.Point3d)
+		for _, rle := range paintmap[bcoord] {
+			start := rle.StartPt()
+			i := (((start[2]-offset[2])*blockSize[1]+start[1]-offset[1])*blockSize[0] + start[0] - offset[0]) * 8
+			for n := int32(0); n < rle.Length(); n++ {
+				if sv := binary.LittleEndian.Uint64(data[i : i+8]); sv != 0 {
+					overwritten[sv] = struct{}{}
+				}
+				binary.LittleEndian.PutUint64(data[i:i+8], label)
+				i += 8
+			}
+		}
+		if pblock.block, err = labels.MakeBlock(data, blockSize); err != nil {
+			return
+		}
+		painted = append(painted, pblock)
+	}
+
+	svlist := make([]uint64, 0, len(overwritten))
+	for sv := range overwritten {
+		svlist = append(svlist, sv)
+	}
+	var bodies []uint64
+	if bodies, _, err = d.GetMappedLabels(v, svlist); err != nil {
+		return
+	}
+	if err = d.checkBodyLeases(v, info.User, bodies...); err != nil {
+		return
+	}
+
+	// send kafka paint event to instance-uuid topic
+	mutID = d.NewMutationID()
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":     "paint",
+		"Label":      label,
+		"Voxels":     numVoxels,
+		"Blocks":     len(painted),
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	if info.User != "" {
+		msginfo["User"] = info.User
+	}
+	if info.App != "" {
+		msginfo["App"] = info.App
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending paint op to kafka: %v\n", err)
+	}
+
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	if err = d.adjustPaintExtents(ctx, rles); err != nil {
+		return
+	}
+
+	var svmap *SVMap
+	if svmap, err = getMapping(d, v); err != nil {
+		return
+	}
+	blockCh := make(chan blockChange, len(painted))
+	downresMut := downres.NewMutation(d, v, mutID)
+	for _, pblock := range painted {
+		pb := labels.PositionedBlock{Block: *pblock.block, BCoord: pblock.bcoord}
+		if err = d.putLabelBlock(ctx, scale, &pb); err != nil {
+			close(blockCh)
+			return
+		}
+		d.updateBlockMaxLabel(v, pblock.block)
+
+		var event string
+		var delta interface{}
+		if pblock.prev != nil {
+			event = labels.MutateBlockEvent
+			block := MutatedBlock{mutID, pblock.bcoord, pblock.prev, pblock.block}
+			d.handleBlockMutate(v, blockCh, block)
+			delta = block
+		} else {
+			event = labels.IngestBlockEvent
+			block := IngestedBlock{mutID, pblock.bcoord, pblock.block}
+			d.handleBlockIndexing(v, blockCh, block)
+			delta = block
+		}
+		if err = downresMut.BlockMutated(pblock.bcoord, pblock.block); err != nil {
+			close(blockCh)
+			return
+		}
+		evt := datastore.SyncEvent{d.DataUUID(), event}
+		msg := datastore.SyncMessage{event, v, delta}
+		if err := datastore.NotifySubscribers(evt, msg); err != nil {
+			dvid.Errorf("Unable to notify subscribers of event %s in %s\n", event, d.DataName())
+		}
+	}
+	close(blockCh)
+	d.aggregateBlockChanges(v, svmap, blockCh)
+
+	op := labels.PaintOp{
+		MutID:       mutID,
+		Label:       label,
+		RLEs:        rles,
+		Supervoxels: overwritten,
+		Bodies:      make(labels.Set, len(bodies)),
+	}
+	for _, body := range bodies {
+		if body != 0 {
+			op.Bodies[body] = struct{}{}
+		}
+	}
+	if err = labels.LogPaint(d, v, op); err != nil {
+		return
+	}
+
+	if err = downresMut.Execute(); err != nil {
+		return
+	}
+	timedLog.Infof("Painted label %d into %d voxels across %d blocks of data %q", label, numVoxels, len(painted), d.DataName())
+
+	d.publishMutation(v, "paint", mutID, info.User, jsonmsg, bodies...)
+
+	// send paint information to separate mutation log file
+	if err := server.LogJSONMutation(versionuuid, d.DataUUID(), jsonmsg); err != nil {
+		dvid.Criticalf("can't log mutation to data %q, version %s: %s\n", d.DataName(), versionuuid, jsonmsg)
+	}
+
+	msginfo = map[string]interface{}{
+		"Action":     "paint-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending paint complete op to kafka: %v\n", err)
+	}
+	return
+}
+
+// adjustPaintExtents expands the stored extents to include all painted voxels.
+func (d *Data) adjustPaintExtents(ctx *datastore.VersionedCtx, rles dvid.RLEs) error {
+	minPt := rles[0].StartPt()
+	maxPt := minPt
+	for _, rle := range rles {
+		start := rle.StartPt()
+		end := dvid.Point3d{start[0] + rle.Length() - 1, start[1], start[2]}
+		for dim := 0; dim < 3; dim++ {
+			if start[dim] < minPt[dim] {
+				minPt[dim] = start[dim]
+			}
+			if end[dim] > maxPt[dim] {
+				maxPt[dim] = end[dim]
+			}
+		}
+	}
+	extents := d.Extents()
+	if !extents.AdjustPoints(minPt, maxPt) {
+		return nil
+	}
+	if err := d.PostExtents(ctx, extents.MinPoint, extents.MaxPoint); err != nil {
+		return err
+	}
+	if err := datastore.SaveDataByVersion(ctx.VersionID(), d); err != nil {
+		dvid.Infof("Error in trying to save repo on change: %v\n", err)
+	}
+	return nil
+}
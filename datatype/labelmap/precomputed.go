@@ -0,0 +1,144 @@
+/*
+	This file supports a read-only Neuroglancer precomputed segmentation source backed by
+	the multi-scale label blocks.  Chunks are sent in the compressed_segmentation encoding.
+*/
+
+package labelmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ngBlockSize is the compressed_segmentation block size used by compressGoogle.
+const ngBlockSize = 8
+
+type ngScaleInfo struct {
+	Key         string     `json:"key"`
+	Resolution  [3]float32 `json:"resolution"`
+	Size        [3]int32   `json:"size"`
+	VoxelOffset [3]int32   `json:"voxel_offset"`
+	ChunkSizes  [][3]int32 `json:"chunk_sizes"`
+	Encoding    string     `json:"encoding"`
+	CSBlockSize [3]int32   `json:"compressed_segmentation_block_size"`
+}
+
+type ngInfo struct {
+	StoreType   string        `json:"@type"`
+	VolumeType  string        `json:"type"`
+	DataType    string        `json:"data_type"`
+	NumChannels int           `json:"num_channels"`
+	Scales      []ngScaleInfo `json:"scales"`
+}
+
+// getPrecomputedInfo returns the Neuroglancer precomputed info for this data at the given
+// version, with one scale per down-resolution level.
+func (d *Data) getPrecomputedInfo(ctx *datastore.VersionedCtx) (*ngInfo, error) {
+	extents, err := d.GetExtents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if extents.MinPoint == nil || extents.MaxPoint == nil {
+		return nil, fmt.Errorf("data %q has no stored extents", d.DataName())
+	}
+	minPt, ok := extents.MinPoint.(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("data %q extents are not 3d", d.DataName())
+	}
+	maxPt, ok := extents.MaxPoint.(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("data %q extents are not 3d", d.DataName())
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("data %q block size is not 3d", d.DataName())
+	}
+	voxelSize := d.Properties.VoxelSize
+	if len(voxelSize) < 3 {
+		return nil, fmt.Errorf("data %q voxel size is not 3d", d.DataName())
+	}
+
+	info := &ngInfo{
+		StoreType:   "neuroglancer_multiscale_volume",
+		VolumeType:  "segmentation",
+		DataType:    "uint64",
+		NumChannels: 1,
+	}
+	for scale := uint8(0); scale <= d.MaxDownresLevel; scale++ {
+		factor := int32(1) << scale
+		var s ngScaleInfo
+		s.Key = strconv.Itoa(int(scale))
+		s.Encoding = "compressed_segmentation"
+		s.CSBlockSize = [3]int32{ngBlockSize, ngBlockSize, ngBlockSize}
+		s.ChunkSizes = [][3]int32{{blockSize[0], blockSize[1], blockSize[2]}}
+		for dim := uint8(0); dim < 3; dim++ {
+			s.Resolution[dim] = voxelSize[dim] * float32(factor)
+			beg := floorDiv(minPt[dim], factor)
+			end := floorDiv(maxPt[dim], factor)
+			s.VoxelOffset[dim] = beg
+			s.Size[dim] = end - beg + 1
+		}
+		info.Scales = append(info.Scales, s)
+	}
+	return info, nil
+}
+
+// parseChunkBounds parses a precomputed chunk name of form "x0-x1_y0-y1_z0-z1" where the
+// end coordinates are exclusive, returning the offset and size of the chunk.
+func parseChunkBounds(chunk string) (offset, size dvid.Point3d, err error) {
+	ranges := strings.Split(chunk, "_")
+	if len(ranges) != 3 {
+		err = fmt.Errorf("bad chunk %q: expected x0-x1_y0-y1_z0-z1", chunk)
+		return
+	}
+	for dim, rng := range ranges {
+		var beg, end int64
+		bounds := strings.Split(rng, "-")
+		if len(bounds) != 2 {
+			err = fmt.Errorf("bad chunk %q: expected x0-x1_y0-y1_z0-z1", chunk)
+			return
+		}
+		if beg, err = strconv.ParseInt(bounds[0], 10, 32); err != nil {
+			return
+		}
+		if end, err = strconv.ParseInt(bounds[1], 10, 32); err != nil {
+			return
+		}
+		if end <= beg {
+			err = fmt.Errorf("bad chunk %q: end must be greater than start", chunk)
+			return
+		}
+		offset[dim] = int32(beg)
+		size[dim] = int32(end - beg)
+	}
+	return
+}
+
+// GetPrecomputedChunk returns a compressed_segmentation encoded chunk with the given offset
+// and size at a scale.  If supervoxels is true, the unmapped supervoxels are returned.
+func (d *Data) GetPrecomputedChunk(v dvid.VersionID, offset, size dvid.Point3d, scale uint8, supervoxels bool) ([]byte, error) {
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("scale %d exceeds maximum down-resolution level %d", scale, d.MaxDownresLevel)
+	}
+
+	// compressGoogle works on whole 8x8x8 blocks so read a padded subvolume.  Neuroglancer
+	// ignores voxels in the padding when decoding a chunk of the requested size.
+	var padded dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		padded[dim] = ((size[dim] + ngBlockSize - 1) / ngBlockSize) * ngBlockSize
+	}
+	subvol := dvid.NewSubvolume(offset, padded)
+	lbl, err := d.NewLabels(subvol, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.GetVolume(v, lbl, supervoxels, scale, "")
+	if err != nil {
+		return nil, err
+	}
+	return compressGoogle(data, subvol)
+}
@@ -0,0 +1,212 @@
+/*
+	This file supports compaction of the body label space of a version by renumbering all
+	bodies into a dense range of labels.  Supervoxel ids and voxel blocks are unchanged since
+	renumbering is done entirely through label indices and the supervoxel mapping.
+*/
+
+package labelmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/keyvalue"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// getBodyLabels returns the labels of all bodies with label indices in a version in
+// ascending order.  Only keys are read so the indices themselves can be processed one at a
+// time.
+func (d *Data) getBodyLabels(v dvid.VersionID) ([]uint64, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	tkeys, err := store.KeysInRange(ctx, NewLabelIndexTKey(0), NewLabelIndexTKey(math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+	bodies := make([]uint64, 0, len(tkeys))
+	for _, tk := range tkeys {
+		label, err := DecodeLabelIndexTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, label)
+	}
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i] < bodies[j] })
+	return bodies, nil
+}
+
+// RenumberBodies assigns labels start, start+1, ... to all bodies of a version in order of
+// their current label.  Label indices are rewritten under the new labels, every supervoxel
+// is mapped to its new body label, and synced instances are notified.  If kvdata is not nil,
+// the old-to-new table is stored with one key per renumbered body, where the key is the old
+// label and the value is the new label.  Returns the mapping of renumbered bodies.
+//
+// If start is 0, renumbering starts above the maximum label of the repo so no label is
+// reused.  A start at or below the maximum label requires reuse to be true and must be no
+// larger than the smallest body label, which guarantees every body moves to a label no
+// larger than its current one and no renumbered body collides with an unprocessed one.
+// Reused labels can still match supervoxel ids of other bodies and labels referenced by
+// earlier mutation logs or messages.
+//
+// All other label mutations of the instance wait until renumbering is complete.
+func (d *Data) RenumberBodies(v dvid.VersionID, start uint64, reuse bool, kvdata *keyvalue.Data) (map[uint64]uint64, error) {
+	timedLog := dvid.NewTimeLog()
+
+	// Block all other label mutations and voxel-based mutations.
+	d.mutationMu.Lock()
+	defer d.mutationMu.Unlock()
+	d.voxelMu.Lock()
+	defer d.voxelMu.Unlock()
+
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	bodies, err := d.getBodyLabels(v)
+	if err != nil {
+		return nil, err
+	}
+	d.mlMu.RLock()
+	maxRepoLabel := d.MaxRepoLabel
+	d.mlMu.RUnlock()
+	if start == 0 {
+		start = maxRepoLabel + 1
+	} else if start <= maxRepoLabel {
+		if !reuse {
+			return nil, fmt.Errorf("renumbering start %d is not above max label %d and reuse of labels was not requested", start, maxRepoLabel)
+		}
+		if len(bodies) != 0 && start > bodies[0] {
+			return nil, fmt.Errorf("renumbering start %d reusing labels must not exceed the smallest body label %d", start, bodies[0])
+		}
+	}
+	if start == 0 || uint64(len(bodies)) > math.MaxUint64-start+1 {
+		return nil, fmt.Errorf("cannot renumber %d bodies starting at label %d", len(bodies), start)
+	}
+	m, err := getMapping(d, v)
+	if err != nil {
+		return nil, err
+	}
+	mutID := d.NewMutationID()
+
+	// Process bodies in ascending order, storing each index under its new label before
+	// deleting the old one.  New labels are either above all old labels or, when reusing
+	// labels, no larger than the body's current label, so a new label never belongs to a
+	// body that has yet to be processed.
+	mapping := make(map[uint64]uint64)
+	newLabel := start
+	var numBodies int
+	for _, oldLabel := range bodies {
+		shard := oldLabel % numIndexShards
+		indexMu[shard].Lock()
+		idx, err := getCachedLabelIndex(d, v, oldLabel)
+		indexMu[shard].Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if idx == nil || len(idx.Blocks) == 0 {
+			continue
+		}
+		numBodies++
+		if oldLabel == newLabel {
+			newLabel++
+			continue
+		}
+		idx.Label = newLabel
+		newShard := newLabel % numIndexShards
+		indexMu[newShard].Lock()
+		err = putCachedLabelIndex(d, v, idx)
+		indexMu[newShard].Unlock()
+		if err != nil {
+			return nil, err
+		}
+		indexMu[shard].Lock()
+		err = deleteCachedLabelIndex(d, v, oldLabel)
+		indexMu[shard].Unlock()
+		if err != nil {
+			return nil, err
+		}
+		supervoxels := idx.GetSupervoxels()
+		m.Lock()
+		vid, err := m.createShortVersion(v)
+		if err != nil {
+			m.Unlock()
+			return nil, err
+		}
+		for supervoxel := range supervoxels {
+			m.setMapping(vid, supervoxel, newLabel)
+		}
+		m.Unlock()
+		op := labels.MappingOp{
+			MutID:    mutID,
+			Mapped:   newLabel,
+			Original: supervoxels,
+		}
+		if err := labels.LogMapping(d, v, op); err != nil {
+			return nil, err
+		}
+		mapping[oldLabel] = newLabel
+		newLabel++
+	}
+	if len(mapping) == 0 {
+		timedLog.Infof("No renumbering needed for %d bodies of data %q", numBodies, d.DataName())
+		return mapping, nil
+	}
+	if _, err := d.updateMaxLabel(v, newLabel-1); err != nil {
+		return nil, err
+	}
+	d.renumberBodyLeases(v, mapping)
+	if err := d.renumberBodyProps(v, mapping); err != nil {
+		return nil, err
+	}
+
+	if kvdata != nil {
+		ctx := datastore.NewVersionedCtx(kvdata, v)
+		for oldLabel, newLabel := range mapping {
+			key := strconv.FormatUint(oldLabel, 10)
+			if err := kvdata.PutData(ctx, key, []byte(strconv.FormatUint(newLabel, 10))); err != nil {
+				return nil, fmt.Errorf("unable to store renumbering of label %d in keyvalue %q: %v", oldLabel, kvdata.DataName(), err)
+			}
+		}
+	}
+
+	evt := datastore.SyncEvent{d.DataUUID(), labels.RenumberEvent}
+	msg := datastore.SyncMessage{labels.RenumberEvent, v, labels.DeltaRenumber{MutID: mutID, Mapping: mapping}}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	// send kafka renumber event to instance-uuid topic
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":     "renumber",
+		"Start":      start,
+		"Bodies":     numBodies,
+		"Renumbered": len(mapping),
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	if kvdata != nil {
+		msginfo["Table"] = string(kvdata.DataName())
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending renumber op to kafka: %v\n", err)
+	}
+	changed := make([]uint64, 0, 2*len(mapping))
+	for oldLabel, newLabel := range mapping {
+		changed = append(changed, oldLabel, newLabel)
+	}
+	d.publishMutation(v, "renumber", mutID, "", jsonmsg, changed...)
+	timedLog.Infof("Renumbered %d of %d bodies in data %q starting at label %d", len(mapping), numBodies, d.DataName(), start)
+	return mapping, nil
+}
@@ -0,0 +1,477 @@
+/*
+	This file supports skeletonization of bodies and supervoxels via topology-preserving
+	thinning of the label's sparse volume.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/keyvalue"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// skelVoxel is a voxel coordinate at the scale being skeletonized.
+type skelVoxel [3]int32
+
+// the 26 neighbor offsets and their distances.
+var (
+	skelNbrOffsets [26]skelVoxel
+	skelNbrDists   [26]float32
+)
+
+// the 6 face neighbor offsets, used as thinning directions.
+var skelDirections = [6]skelVoxel{{0, 0, -1}, {0, 0, 1}, {0, -1, 0}, {0, 1, 0}, {-1, 0, 0}, {1, 0, 0}}
+
+// adjacency within a 3x3x3 neighborhood where position i is at offset
+// (i%3 - 1, (i/3)%3 - 1, i/9 - 1) and 13 is the center.
+var (
+	nbhd26Adj [27][]uint8 // 26-adjacent positions excluding center
+	nbhd6Adj  [27][]uint8 // 6-adjacent positions in the 18-neighborhood excluding center
+	nbhdIn18  [27]bool    // true if position is in the 18-neighborhood of center
+)
+
+func init() {
+	var n int
+	for dz := int32(-1); dz <= 1; dz++ {
+		for dy := int32(-1); dy <= 1; dy++ {
+			for dx := int32(-1); dx <= 1; dx++ {
+				if dx == 0 && dy == 0 && dz == 0 {
+					continue
+				}
+				skelNbrOffsets[n] = skelVoxel{dx, dy, dz}
+				skelNbrDists[n] = float32(math.Sqrt(float64(dx*dx + dy*dy + dz*dz)))
+				n++
+			}
+		}
+	}
+	abs := func(a int) int {
+		if a < 0 {
+			return -a
+		}
+		return a
+	}
+	for i := 0; i < 27; i++ {
+		nbhdIn18[i] = i != 13 && abs(i%3-1)+abs((i/3)%3-1)+abs(i/9-1) <= 2
+	}
+	for i := 0; i < 27; i++ {
+		xi, yi, zi := i%3, (i/3)%3, i/9
+		for j := 0; j < 27; j++ {
+			if i == j || i == 13 || j == 13 {
+				continue
+			}
+			dx, dy, dz := abs(xi-j%3), abs(yi-(j/3)%3), abs(zi-j/9)
+			if dx > 1 || dy > 1 || dz > 1 {
+				continue
+			}
+			nbhd26Adj[i] = append(nbhd26Adj[i], uint8(j))
+			if dx+dy+dz == 1 && nbhdIn18[i] && nbhdIn18[j] {
+				nbhd6Adj[i] = append(nbhd6Adj[i], uint8(j))
+			}
+		}
+	}
+}
+
+// nbhdComponents returns the number of connected components of positions with the given
+// value using the given adjacency.  If seeds is non-nil, only components containing at
+// least one seed position are counted.
+func nbhdComponents(nbhd *[27]bool, value bool, adj *[27][]uint8, include *[27]bool, seeds []uint8) int {
+	var visited [27]bool
+	var stack []uint8
+	var components int
+	starts := seeds
+	if starts == nil {
+		starts = make([]uint8, 0, 27)
+		for i := uint8(0); i < 27; i++ {
+			starts = append(starts, i)
+		}
+	}
+	for _, start := range starts {
+		if start == 13 || visited[start] || nbhd[start] != value || (include != nil && !include[start]) {
+			continue
+		}
+		components++
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, next := range adj[cur] {
+				if !visited[next] && nbhd[next] == value && (include == nil || include[next]) {
+					visited[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+	}
+	return components
+}
+
+// the 6-neighbors of the center within a 3x3x3 neighborhood.
+var nbhdFaces = []uint8{4, 10, 12, 14, 16, 22}
+
+// isSimple returns true if removing the center voxel of the neighborhood doesn't change
+// the topology, i.e., the foreground has exactly one 26-connected component and the
+// background has exactly one 6-connected component adjacent to the center.
+func isSimple(nbhd *[27]bool) bool {
+	if nbhdComponents(nbhd, true, &nbhd26Adj, nil, nil) != 1 {
+		return false
+	}
+	return nbhdComponents(nbhd, false, &nbhd6Adj, &nbhdIn18, nbhdFaces) == 1
+}
+
+// MaxSkeletonBlocks is the maximum number of blocks of a label at the requested scale that
+// can be skeletonized, since the voxels and distances of all blocks are held in memory.
+const MaxSkeletonBlocks = 256
+
+type skelBlock struct {
+	fg   []bool
+	dist []float32
+}
+
+// skelVolume holds the voxels of a label in blocks along with distances to the background.
+type skelVolume struct {
+	blockSize dvid.Point3d
+	blocks    map[dvid.ChunkPoint3d]*skelBlock
+}
+
+func newSkelVolume(blockSize dvid.Point3d) *skelVolume {
+	return &skelVolume{
+		blockSize: blockSize,
+		blocks:    make(map[dvid.ChunkPoint3d]*skelBlock),
+	}
+}
+
+// addBlock adds voxels within the block having any of the given labels.
+func (sv *skelVolume) addBlock(bcoord dvid.ChunkPoint3d, block *labels.Block, lbls labels.Set) {
+	data, size := block.MakeLabelVolume()
+	numVoxels := int(size.Prod())
+	sb := &skelBlock{
+		fg:   make([]bool, numVoxels),
+		dist: make([]float32, numVoxels),
+	}
+	var found bool
+	for i := 0; i < numVoxels; i++ {
+		if _, in := lbls[binary.LittleEndian.Uint64(data[i*8:i*8+8])]; in {
+			sb.fg[i] = true
+			found = true
+		}
+	}
+	if found {
+		sv.blocks[bcoord] = sb
+	}
+}
+
+func (sv *skelVolume) locate(pt skelVoxel) (*skelBlock, int) {
+	bcoord := dvid.ChunkPoint3d{floorDiv(pt[0], sv.blockSize[0]), floorDiv(pt[1], sv.blockSize[1]), floorDiv(pt[2], sv.blockSize[2])}
+	sb, found := sv.blocks[bcoord]
+	if !found {
+		return nil, 0
+	}
+	bx, by, bz := pt[0]-bcoord[0]*sv.blockSize[0], pt[1]-bcoord[1]*sv.blockSize[1], pt[2]-bcoord[2]*sv.blockSize[2]
+	return sb, int((bz*sv.blockSize[1]+by)*sv.blockSize[0] + bx)
+}
+
+func (sv *skelVolume) isFg(pt skelVoxel) bool {
+	sb, i := sv.locate(pt)
+	return sb != nil && sb.fg[i]
+}
+
+// foreground returns all foreground voxels in a deterministic order.
+func (sv *skelVolume) foreground() []skelVoxel {
+	bcoords := make([]dvid.ChunkPoint3d, 0, len(sv.blocks))
+	for bcoord := range sv.blocks {
+		bcoords = append(bcoords, bcoord)
+	}
+	sort.Slice(bcoords, func(i, j int) bool {
+		a, b := bcoords[i], bcoords[j]
+		if a[2] != b[2] {
+			return a[2] < b[2]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[0] < b[0]
+	})
+	var voxels []skelVoxel
+	for _, bcoord := range bcoords {
+		sb := sv.blocks[bcoord]
+		x0, y0, z0 := bcoord[0]*sv.blockSize[0], bcoord[1]*sv.blockSize[1], bcoord[2]*sv.blockSize[2]
+		var i int
+		for z := int32(0); z < sv.blockSize[2]; z++ {
+			for y := int32(0); y < sv.blockSize[1]; y++ {
+				for x := int32(0); x < sv.blockSize[0]; x++ {
+					if sb.fg[i] {
+						voxels = append(voxels, skelVoxel{x0 + x, y0 + y, z0 + z})
+					}
+					i++
+				}
+			}
+		}
+	}
+	return voxels
+}
+
+type skelHeapItem struct {
+	pt   skelVoxel
+	dist float32
+}
+
+type skelHeap []skelHeapItem
+
+func (h skelHeap) Len() int            { return len(h) }
+func (h skelHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h skelHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *skelHeap) Push(x interface{}) { *h = append(*h, x.(skelHeapItem)) }
+func (h *skelHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// computeDistances sets the chamfer distance of each foreground voxel to the background,
+// where voxels on the boundary have distance 1.
+func (sv *skelVolume) computeDistances(voxels []skelVoxel) {
+	h := make(skelHeap, 0, len(voxels))
+	for _, pt := range voxels {
+		sb, i := sv.locate(pt)
+		sb.dist[i] = float32(math.Inf(1))
+		for _, dir := range skelDirections {
+			if !sv.isFg(skelVoxel{pt[0] + dir[0], pt[1] + dir[1], pt[2] + dir[2]}) {
+				sb.dist[i] = 1
+				h = append(h, skelHeapItem{pt, 1})
+				break
+			}
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		item := heap.Pop(&h).(skelHeapItem)
+		sb, i := sv.locate(item.pt)
+		if item.dist > sb.dist[i] {
+			continue
+		}
+		for n, off := range skelNbrOffsets {
+			nbr := skelVoxel{item.pt[0] + off[0], item.pt[1] + off[1], item.pt[2] + off[2]}
+			nb, ni := sv.locate(nbr)
+			if nb == nil || !nb.fg[ni] {
+				continue
+			}
+			if dist := item.dist + skelNbrDists[n]; dist < nb.dist[ni] {
+				nb.dist[ni] = dist
+				heap.Push(&h, skelHeapItem{nbr, dist})
+			}
+		}
+	}
+}
+
+func (sv *skelVolume) neighborhood(pt skelVoxel) (nbhd [27]bool, numFg int) {
+	var i int
+	for dz := int32(-1); dz <= 1; dz++ {
+		for dy := int32(-1); dy <= 1; dy++ {
+			for dx := int32(-1); dx <= 1; dx++ {
+				nbhd[i] = sv.isFg(skelVoxel{pt[0] + dx, pt[1] + dy, pt[2] + dz})
+				if nbhd[i] && i != 13 {
+					numFg++
+				}
+				i++
+			}
+		}
+	}
+	return
+}
+
+// thin removes simple border voxels in each of the 6 directions until no voxel can be
+// removed, preserving end points so the result is a curve skeleton.
+func (sv *skelVolume) thin(voxels []skelVoxel) []skelVoxel {
+	for {
+		var removed int
+		for _, dir := range skelDirections {
+			// candidates must be simple non-end points both at the start of the sub-iteration
+			// and when removed, which keeps sequential removals from cascading along thin structures.
+			var candidates []skelVoxel
+			for _, pt := range voxels {
+				if sv.isFg(skelVoxel{pt[0] + dir[0], pt[1] + dir[1], pt[2] + dir[2]}) {
+					continue
+				}
+				if nbhd, numFg := sv.neighborhood(pt); numFg > 1 && isSimple(&nbhd) {
+					candidates = append(candidates, pt)
+				}
+			}
+			for _, pt := range candidates {
+				nbhd, numFg := sv.neighborhood(pt)
+				if numFg <= 1 || !isSimple(&nbhd) {
+					continue
+				}
+				sb, i := sv.locate(pt)
+				sb.fg[i] = false
+				removed++
+			}
+			remaining := voxels[:0]
+			for _, pt := range voxels {
+				if sv.isFg(pt) {
+					remaining = append(remaining, pt)
+				}
+			}
+			voxels = remaining
+		}
+		if removed == 0 {
+			return voxels
+		}
+	}
+}
+
+// skelNode is a node of a skeleton tree in scale 0 voxel coordinates.
+type skelNode struct {
+	pos    [3]float32
+	radius float32
+	parent int // index of parent node or -1 for root
+}
+
+// buildSkeleton converts the skeleton voxels into trees, one per connected component, rooted
+// at the voxel of largest radius.  Parents always precede their children.
+func (sv *skelVolume) buildSkeleton(voxels []skelVoxel, scale uint8) []skelNode {
+	mult := float32(int32(1) << scale)
+	offset := (mult - 1) / 2
+	radius := func(pt skelVoxel) float32 {
+		sb, i := sv.locate(pt)
+		return sb.dist[i]
+	}
+	sort.SliceStable(voxels, func(i, j int) bool { return radius(voxels[i]) > radius(voxels[j]) })
+
+	nodeIndex := make(map[skelVoxel]int, len(voxels))
+	nodes := make([]skelNode, 0, len(voxels))
+	addNode := func(pt skelVoxel, parent int) {
+		nodeIndex[pt] = len(nodes)
+		nodes = append(nodes, skelNode{
+			pos:    [3]float32{float32(pt[0])*mult + offset, float32(pt[1])*mult + offset, float32(pt[2])*mult + offset},
+			radius: radius(pt) * mult,
+			parent: parent,
+		})
+	}
+	var queue []skelVoxel
+	for _, root := range voxels {
+		if _, found := nodeIndex[root]; found {
+			continue
+		}
+		addNode(root, -1)
+		queue = append(queue[:0], root)
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, off := range skelNbrOffsets {
+				nbr := skelVoxel{cur[0] + off[0], cur[1] + off[1], cur[2] + off[2]}
+				if _, found := nodeIndex[nbr]; found || !sv.isFg(nbr) {
+					continue
+				}
+				addNode(nbr, nodeIndex[cur])
+				queue = append(queue, nbr)
+			}
+		}
+	}
+	return nodes
+}
+
+// writeSWC returns the skeleton in SWC format with 1-based node ids.
+func writeSWC(label uint64, scale uint8, nodes []skelNode) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# SWC skeleton of label %d computed at scale %d in scale 0 voxel coordinates\n", label, scale)
+	fmt.Fprintf(&buf, "# id type x y z radius parent\n")
+	for i, node := range nodes {
+		parent := -1
+		if node.parent >= 0 {
+			parent = node.parent + 1
+		}
+		fmt.Fprintf(&buf, "%d 0 %g %g %g %g %d\n", i+1, node.pos[0], node.pos[1], node.pos[2], node.radius, parent)
+	}
+	return buf.Bytes()
+}
+
+// getSkeleton returns the SWC skeleton of the given label (or supervoxel) computed at the
+// given scale or nil if the label is not found.  An error is returned if the label has more
+// than MaxSkeletonBlocks blocks at the scale.
+func (d *Data) getSkeleton(ctx *datastore.VersionedCtx, label uint64, scale uint8, isSupervoxel bool) ([]byte, error) {
+	timedLog := dvid.NewTimeLog()
+	idx, err := GetLabelIndex(d, ctx.VersionID(), label, isSupervoxel)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	supervoxels := idx.GetSupervoxels()
+	if isSupervoxel {
+		if _, found := supervoxels[label]; !found {
+			return nil, nil
+		}
+		supervoxels = labels.Set{label: struct{}{}}
+	}
+	blocks, err := idx.GetProcessedBlockIndices(scale, dvid.Bounds{})
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) > MaxSkeletonBlocks {
+		return nil, fmt.Errorf("label %d has %d blocks at scale %d, more than the %d blocks allowed for skeletonization; use a coarser scale", label, len(blocks), scale, MaxSkeletonBlocks)
+	}
+	sort.Sort(blocks)
+
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't skeletonize because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	sv := newSkelVolume(blockSize)
+	for _, izyx := range blocks {
+		pb, err := d.getLabelBlock(ctx, scale, izyx)
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			continue
+		}
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		sv.addBlock(bcoord, &(pb.Block), supervoxels)
+	}
+	voxels := sv.foreground()
+	numVoxels := len(voxels)
+	sv.computeDistances(voxels)
+	voxels = sv.thin(voxels)
+	nodes := sv.buildSkeleton(voxels, scale)
+	timedLog.Infof("Skeletonized label %d at scale %d: %d voxels in %d blocks -> %d nodes", label, scale, numVoxels, len(sv.blocks), len(nodes))
+	return writeSWC(label, scale, nodes), nil
+}
+
+// getSyncedKeyvalue returns the first keyvalue instance synced to this labelmap or nil if none.
+func (d *Data) getSyncedKeyvalue() *keyvalue.Data {
+	for dataUUID := range d.SyncedData() {
+		source, err := datastore.GetDataByDataUUID(dataUUID)
+		if err != nil {
+			continue
+		}
+		if kvdata, ok := source.(*keyvalue.Data); ok {
+			return kvdata
+		}
+	}
+	return nil
+}
+
+// storeSkeleton writes the SWC skeleton to the synced keyvalue instance under the key "<label>_swc".
+func (d *Data) storeSkeleton(v dvid.VersionID, label uint64, swc []byte) error {
+	kvdata := d.getSyncedKeyvalue()
+	if kvdata == nil {
+		return fmt.Errorf("labelmap %q has no synced keyvalue instance to store skeletons", d.DataName())
+	}
+	ctx := datastore.NewVersionedCtx(kvdata, v)
+	return kvdata.PutData(ctx, fmt.Sprintf("%d_swc", label), swc)
+}
@@ -0,0 +1,104 @@
+/*
+	This file supports splits given by a mask at a coarser scale.  The coarse mask is
+	upsampled to scale 0 and intersected with the actual voxels of the split target so
+	large supervoxels painted in coarse tools don't require full-resolution RLEs.
+*/
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// upsampleSplitMask converts RLEs of a mask at the given scale into scale 0 RLEs of only
+// those voxels within the mask that have the given label.  If mapped is true, the label is
+// a body label, otherwise it is a supervoxel.
+func (d *Data) upsampleSplitMask(v dvid.VersionID, mask dvid.RLEs, scale uint8, label uint64, mapped bool) (dvid.RLEs, error) {
+	if scale == 0 {
+		return mask, nil
+	}
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("split mask scale %d exceeds maximum down-resolution level %d", scale, d.MaxDownresLevel)
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't upsample split mask because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	var svm *SVMap
+	var ancestry []uint8
+	if mapped {
+		var err error
+		if svm, err = getMapping(d, v); err != nil {
+			return nil, err
+		}
+		if ancestry, err = svm.getAncestry(v); err != nil {
+			return nil, err
+		}
+	}
+
+	// each coarse run covers factor x factor runs at scale 0.
+	factor := int32(1) << scale
+	var upsampled dvid.RLEs
+	for _, rle := range mask {
+		pt := rle.StartPt()
+		length := rle.Length() * factor
+		for dz := int32(0); dz < factor; dz++ {
+			for dy := int32(0); dy < factor; dy++ {
+				start := dvid.Point3d{pt[0] * factor, pt[1]*factor + dy, pt[2]*factor + dz}
+				upsampled = append(upsampled, dvid.NewRLE(start, length))
+			}
+		}
+	}
+	blockRLEs, err := upsampled.Partition(blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := datastore.NewVersionedCtx(d, v)
+	var split dvid.RLEs
+	for _, izyx := range blockRLEs.SortedKeys() {
+		pb, err := d.getLabelBlock(ctx, 0, izyx)
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			continue
+		}
+		if svm != nil {
+			svm.ApplyMappingToBlock(ancestry, &(pb.Block))
+		}
+		chunkPt, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		offset := dvid.Point3d{chunkPt[0] * blockSize[0], chunkPt[1] * blockSize[1], chunkPt[2] * blockSize[2]}
+		lblarray, _ := pb.MakeLabelVolume()
+		for _, rle := range blockRLEs[izyx] {
+			pt := rle.StartPt()
+			y, z := pt[1]-offset[1], pt[2]-offset[2]
+			i := (z*blockSize[1]+y)*blockSize[0] + pt[0] - offset[0]
+			var runStart, runLength int32
+			for x := pt[0]; x < pt[0]+rle.Length(); x, i = x+1, i+1 {
+				if binary.LittleEndian.Uint64(lblarray[i*8:i*8+8]) == label {
+					if runLength == 0 {
+						runStart = x
+					}
+					runLength++
+					continue
+				}
+				if runLength != 0 {
+					split = append(split, dvid.NewRLE(dvid.Point3d{runStart, pt[1], pt[2]}, runLength))
+					runLength = 0
+				}
+			}
+			if runLength != 0 {
+				split = append(split, dvid.NewRLE(dvid.Point3d{runStart, pt[1], pt[2]}, runLength))
+			}
+		}
+	}
+	return split, nil
+}
@@ -0,0 +1,222 @@
+/*
+	This file supports per-body statistics beyond voxel counts, e.g., surface area, for
+	ranking bodies.  Surface area requires reading all blocks of a body, which can be done
+	at a lower resolution scale for speed.
+*/
+
+package labelmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// BodyStats gives size and shape statistics for a body.  SurfaceArea is the number of voxel
+// faces on the boundary of the body, in scale 0 voxel face units even if computed at a lower
+// resolution Scale.
+type BodyStats struct {
+	Label          uint64
+	Voxels         uint64
+	SurfaceArea    uint64
+	MinVoxel       dvid.Point3d
+	MaxVoxel       dvid.Point3d
+	NumBlocks      int
+	NumSupervoxels int
+	Scale          uint8
+}
+
+// sortBodyStats sorts stats in descending order of the given field: "voxels", "surface",
+// "blocks" or "supervoxels".
+func sortBodyStats(stats []*BodyStats, field string) error {
+	var value func(s *BodyStats) uint64
+	switch field {
+	case "voxels":
+		value = func(s *BodyStats) uint64 { return s.Voxels }
+	case "surface":
+		value = func(s *BodyStats) uint64 { return s.SurfaceArea }
+	case "blocks":
+		value = func(s *BodyStats) uint64 { return uint64(s.NumBlocks) }
+	case "supervoxels":
+		value = func(s *BodyStats) uint64 { return uint64(s.NumSupervoxels) }
+	default:
+		return fmt.Errorf("unknown stats sort field %q, must be voxels, surface, blocks or supervoxels", field)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		vi, vj := value(stats[i]), value(stats[j])
+		if vi != vj {
+			return vi > vj
+		}
+		return stats[i].Label < stats[j].Label
+	})
+	return nil
+}
+
+// GetBodyStats returns statistics for a body with surface area computed at the given scale,
+// or nil if the body is not found.
+func (d *Data) GetBodyStats(ctx *datastore.VersionedCtx, label uint64, scale uint8) (*BodyStats, error) {
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("stats scale %d exceeds maximum down-resolution level %d", scale, d.MaxDownresLevel)
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't compute stats because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	idx, err := GetLabelIndex(d, ctx.VersionID(), label, false)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil, nil
+	}
+	bbox, err := d.GetBodyBBox(ctx, label, false)
+	if err != nil {
+		return nil, err
+	}
+	if bbox == nil {
+		return nil, nil
+	}
+	supervoxels := idx.GetSupervoxels()
+	stats := &BodyStats{
+		Label:          label,
+		Voxels:         bbox.Voxels,
+		MinVoxel:       bbox.MinVoxel,
+		MaxVoxel:       bbox.MaxVoxel,
+		NumBlocks:      len(idx.Blocks),
+		NumSupervoxels: len(supervoxels),
+		Scale:          scale,
+	}
+	if stats.SurfaceArea, err = d.surfaceArea(ctx, idx, supervoxels, scale, blockSize); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetBodiesStats returns statistics for each label in the same order, with nil for labels
+// not found.
+func (d *Data) GetBodiesStats(ctx *datastore.VersionedCtx, lbls []uint64, scale uint8) ([]*BodyStats, error) {
+	stats := make([]*BodyStats, len(lbls))
+	for i, label := range lbls {
+		var err error
+		if stats[i], err = d.GetBodyStats(ctx, label, scale); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// bodyBlockFaces holds which voxels on the high faces of a block along each dimension
+// belong to a body.
+type bodyBlockFaces struct {
+	high [3][]bool
+}
+
+// surfaceArea counts the boundary faces of a body at the given scale as six faces per voxel
+// minus two for each pair of adjacent body voxels, and returns it in scale 0 face units.
+// Blocks are visited in ZYX order, so pairs across the low faces of a block are counted
+// using the high faces of its already visited neighbors, and only the faces of blocks
+// within one block of the current z are kept.
+func (d *Data) surfaceArea(ctx *datastore.VersionedCtx, idx *labels.Index, supervoxels labels.Set, scale uint8, blockSize dvid.Point3d) (uint64, error) {
+	blocks, err := idx.GetProcessedBlockIndices(scale, dvid.Bounds{})
+	if err != nil {
+		return 0, err
+	}
+	sort.Sort(blocks)
+	nx, ny, nz := blockSize[0], blockSize[1], blockSize[2]
+	faces := make(map[dvid.ChunkPoint3d]*bodyBlockFaces)
+	var numVoxels, numPairs uint64
+	mask := make([]bool, nx*ny*nz)
+	low := [3][]bool{make([]bool, ny*nz), make([]bool, nx*nz), make([]bool, nx*ny)}
+	var prevZ int32
+	for n, izyx := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 || bcoord[2] != prevZ {
+			for fcoord := range faces {
+				if fcoord[2] < bcoord[2]-1 {
+					delete(faces, fcoord)
+				}
+			}
+			prevZ = bcoord[2]
+		}
+		pb, err := d.getLabelBlock(ctx, scale, izyx)
+		if err != nil {
+			return 0, err
+		}
+		if pb == nil {
+			return 0, fmt.Errorf("label %d index has block %s that is not stored at scale %d", idx.Label, bcoord, scale)
+		}
+		data, _ := pb.Block.MakeLabelVolume()
+		for dim := 0; dim < 3; dim++ {
+			for i := range low[dim] {
+				low[dim][i] = false
+			}
+		}
+		f := &bodyBlockFaces{
+			high: [3][]bool{make([]bool, ny*nz), make([]bool, nx*nz), make([]bool, nx*ny)},
+		}
+		var i int32
+		for z := int32(0); z < nz; z++ {
+			for y := int32(0); y < ny; y++ {
+				for x := int32(0); x < nx; x, i = x+1, i+1 {
+					_, inBody := supervoxels[binary.LittleEndian.Uint64(data[i*8:i*8+8])]
+					mask[i] = inBody
+					if !inBody {
+						continue
+					}
+					numVoxels++
+					if x > 0 && mask[i-1] {
+						numPairs++
+					}
+					if y > 0 && mask[i-nx] {
+						numPairs++
+					}
+					if z > 0 && mask[i-nx*ny] {
+						numPairs++
+					}
+					if x == 0 {
+						low[0][z*ny+y] = true
+					}
+					if x == nx-1 {
+						f.high[0][z*ny+y] = true
+					}
+					if y == 0 {
+						low[1][z*nx+x] = true
+					}
+					if y == ny-1 {
+						f.high[1][z*nx+x] = true
+					}
+					if z == 0 {
+						low[2][y*nx+x] = true
+					}
+					if z == nz-1 {
+						f.high[2][y*nx+x] = true
+					}
+				}
+			}
+		}
+		faces[bcoord] = f
+
+		// add pairs of body voxels across the low faces with visited neighbors.
+		for dim := 0; dim < 3; dim++ {
+			neighbor := bcoord
+			neighbor[dim]--
+			g, found := faces[neighbor]
+			if !found {
+				continue
+			}
+			for i, inBody := range low[dim] {
+				if inBody && g.high[dim][i] {
+					numPairs++
+				}
+			}
+		}
+	}
+	return (6*numVoxels - 2*numPairs) << (2 * scale), nil
+}
@@ -0,0 +1,223 @@
+/*
+	This file supports streaming of committed mutations to HTTP clients as server-sent events
+	or JSON lines.  Subscribers are held in memory per data instance and version, so only
+	mutations made through this server are streamed.
+*/
+
+package labelmap
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// streamBufferSize is the number of mutations that can be queued for a slow subscriber
+// before its stream is closed.
+const streamBufferSize = 1000
+
+// streamKeepAlive is the interval between keep-alive messages on an idle stream.
+const streamKeepAlive = 30 * time.Second
+
+// mutationEvent is a committed mutation sent to stream subscribers.
+type mutationEvent struct {
+	action string
+	mutID  uint64
+	user   string
+	bodies []uint64
+	msg    []byte // JSON description of the mutation, same as kafka message
+}
+
+type mutationSubscriber struct {
+	ch     chan mutationEvent
+	bodies map[uint64]struct{} // if non-nil, only mutations affecting these bodies are sent
+	user   string              // if non-empty, only mutations by this user are sent
+}
+
+func (s *mutationSubscriber) wants(evt mutationEvent) bool {
+	if s.user != "" && s.user != evt.user {
+		return false
+	}
+	if s.bodies == nil {
+		return true
+	}
+	for _, body := range evt.bodies {
+		if _, found := s.bodies[body]; found {
+			return true
+		}
+	}
+	return false
+}
+
+type streamKey struct {
+	data dvid.UUID
+	v    dvid.VersionID
+}
+
+type mutationStreams struct {
+	subs map[streamKey]map[*mutationSubscriber]struct{}
+	sync.Mutex
+}
+
+var (
+	mStreams mutationStreams
+)
+
+func init() {
+	mStreams.subs = make(map[streamKey]map[*mutationSubscriber]struct{})
+}
+
+func (d *Data) subscribeMutations(v dvid.VersionID, sub *mutationSubscriber) {
+	mStreams.Lock()
+	defer mStreams.Unlock()
+
+	key := streamKey{d.DataUUID(), v}
+	subs, found := mStreams.subs[key]
+	if !found {
+		subs = make(map[*mutationSubscriber]struct{})
+		mStreams.subs[key] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+// unsubscribeMutations removes the subscriber, closing its channel if it hasn't
+// already been closed due to overflow.
+func (d *Data) unsubscribeMutations(v dvid.VersionID, sub *mutationSubscriber) {
+	mStreams.Lock()
+	defer mStreams.Unlock()
+
+	key := streamKey{d.DataUUID(), v}
+	subs := mStreams.subs[key]
+	if _, found := subs[sub]; !found {
+		return
+	}
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(mStreams.subs, key)
+	}
+}
+
+// publishMutation sends a committed mutation to all interested subscribers of the version.
+// Subscribers that can't keep up are dropped so mutations never block on slow clients.
+func (d *Data) publishMutation(v dvid.VersionID, action string, mutID uint64, user string, msg []byte, bodies ...uint64) {
+	mStreams.Lock()
+	defer mStreams.Unlock()
+
+	key := streamKey{d.DataUUID(), v}
+	subs, found := mStreams.subs[key]
+	if !found {
+		return
+	}
+	evt := mutationEvent{action: action, mutID: mutID, user: user, bodies: bodies, msg: msg}
+	for sub := range subs {
+		if !sub.wants(evt) {
+			continue
+		}
+		select {
+		case sub.ch <- evt:
+		default:
+			dvid.Errorf("dropping mutation stream subscriber for data %q that is %d mutations behind\n", d.DataName(), streamBufferSize)
+			delete(subs, sub)
+			close(sub.ch)
+		}
+	}
+	if len(subs) == 0 {
+		delete(mStreams.subs, key)
+	}
+}
+
+func (d *Data) handleMutationsStream(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET <api URL>/node/<UUID>/<data name>/mutations/stream
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for /mutations/stream endpoint")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		server.BadRequest(w, r, "streaming is not supported by this connection")
+		return
+	}
+	queryStrings := r.URL.Query()
+	sub := &mutationSubscriber{
+		ch:   make(chan mutationEvent, streamBufferSize),
+		user: queryStrings.Get("userid"),
+	}
+	if bodiesStr := queryStrings.Get("bodies"); bodiesStr != "" {
+		sub.bodies = make(map[uint64]struct{})
+		for _, bodyStr := range strings.Split(bodiesStr, ",") {
+			body, err := strconv.ParseUint(strings.TrimSpace(bodyStr), 10, 64)
+			if err != nil {
+				server.BadRequest(w, r, "bad body id %q in bodies query string: %v", bodyStr, err)
+				return
+			}
+			sub.bodies[body] = struct{}{}
+		}
+	}
+	var sse bool
+	switch format := queryStrings.Get("format"); format {
+	case "", "sse":
+		sse = true
+		w.Header().Set("Content-type", "text/event-stream")
+	case "jsonl":
+		w.Header().Set("Content-type", "application/x-ndjson")
+	default:
+		server.BadRequest(w, r, "unknown format %q for mutations stream, use 'sse' or 'jsonl'", format)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// streams are long-lived, so the server's write timeout shouldn't close them.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		dvid.Errorf("unable to clear write deadline so mutations stream will close after %s: %v\n", server.WriteTimeout, err)
+	}
+
+	v := ctx.VersionID()
+	d.subscribeMutations(v, sub)
+	defer d.unsubscribeMutations(v, sub)
+
+	timedLog := dvid.NewTimeLog()
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	var numSent int
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			timedLog.Infof("HTTP GET mutations stream closed by client after %d mutations (%s)", numSent, r.URL)
+			return
+		case <-keepAlive.C:
+			if sse {
+				_, err = fmt.Fprintf(w, ": keep-alive\n\n")
+			} else {
+				_, err = fmt.Fprintf(w, "\n")
+			}
+		case evt, open := <-sub.ch:
+			if !open {
+				timedLog.Infof("HTTP GET mutations stream dropped for slow client after %d mutations (%s)", numSent, r.URL)
+				return
+			}
+			if sse {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.mutID, evt.action, evt.msg)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\n", evt.msg)
+			}
+			numSent++
+		}
+		if err != nil {
+			dvid.Infof("ending mutations stream for data %q after %d mutations: %v\n", d.DataName(), numSent, err)
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -6,12 +6,14 @@
 package labelmap
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/keyvalue"
 	"github.com/janelia-flyem/dvid/dvid"
 )
 
@@ -60,6 +62,18 @@ type splitSupervoxelOp struct {
 	downresMut *downres.Mutation
 }
 
+// GetSyncSubs implements the datastore.Syncer interface.  Labelmap doesn't process events from
+// synced data but can sync to keyvalue instances used to store computed skeletons.  Syncs to
+// labelvol and labelmap instances are accepted for compatibility and ignored.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	switch synced.TypeName() {
+	case keyvalue.TypeName, "labelvol", TypeName:
+		return datastore.SyncSubs{}, nil
+	default:
+		return nil, fmt.Errorf("labelmap %q can't sync with %q of datatype %q", d.DataName(), synced.DataName(), synced.TypeName())
+	}
+}
+
 // InitDataHandlers launches goroutines to handle each labelmap instance's syncs.
 func (d *Data) InitDataHandlers() error {
 	return nil
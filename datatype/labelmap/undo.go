@@ -0,0 +1,800 @@
+/*
+	This file supports undo and redo of merge, cleave and split mutations using the
+	mutation log of a version.  Reversals are done by applying inverse mutations, each
+	with its own mutation ID, so the mutation log and syncs see the usual operations.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// only one undo, redo or mutation batch at a time since each depends on scanning the mutation log.
+var undoMu sync.Mutex
+
+// MutationConflictError is returned when an undo or redo is refused because later
+// mutations touched the same bodies or supervoxels.
+type MutationConflictError struct {
+	MutID       uint64
+	LaterMutIDs []uint64
+}
+
+func (e MutationConflictError) Error() string {
+	return fmt.Sprintf("mutation %d conflicts with later mutations %v that touched the same bodies or supervoxels", e.MutID, e.LaterMutIDs)
+}
+
+// undoRecord is persisted for each undone mutation so it can be redone and so
+// repeated undos are refused.  A merge of bodies with properties also stores a record
+// when applied so the properties can be restored on undo.
+type undoRecord struct {
+	MutID      uint64   `json:"MutationID"`
+	Action     string   `json:"Action"`
+	UndoMutIDs []uint64 `json:"UndoMutationIDs"`
+	RedoMutIDs []uint64 `json:"RedoMutationIDs,omitempty"`
+
+	// sparse volume of the split supervoxel, needed to redo a supervoxel split.
+	SplitVolume []byte `json:"SplitVolume,omitempty"`
+
+	// properties of the target and merged bodies before a merge, where bodies without
+	// properties have nil values.
+	BodyProps map[uint64]BodyProps `json:"BodyProps,omitempty"`
+}
+
+func (d *Data) getUndoRecord(v dvid.VersionID, mutID uint64) (*undoRecord, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	data, err := store.Get(ctx, NewUndoTKey(mutID))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	rec := new(undoRecord)
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("bad undo record for mutation %d: %v", mutID, err)
+	}
+	return rec, nil
+}
+
+func (d *Data) putUndoRecord(v dvid.VersionID, rec *undoRecord) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	return store.Put(ctx, NewUndoTKey(rec.MutID), data)
+}
+
+// loggedMutation is a decoded entry of a version's mutation log along with the
+// bodies and supervoxels it touched.
+type loggedMutation struct {
+	mutID       uint64
+	action      string
+	bodies      labels.Set
+	supervoxels labels.Set
+
+	merge   *proto.MergeOp
+	cleave  *proto.CleaveOp
+	split   *proto.SplitOp
+	svsplit *proto.SupervoxelSplitOp
+	mapping *proto.MappingOp
+	paint   *proto.PaintOp
+}
+
+func decodeLoggedMutation(msg storage.LogMessage) (mut loggedMutation, err error) {
+	mut.bodies = make(labels.Set)
+	mut.supervoxels = make(labels.Set)
+	switch msg.EntryType {
+	case proto.MergeOpType:
+		op := new(proto.MergeOp)
+		if err = op.Unmarshal(msg.Data); err != nil {
+			return
+		}
+		mut.mutID, mut.action, mut.merge = op.Mutid, "merge", op
+		mut.bodies[op.Target] = struct{}{}
+		for _, label := range op.Merged {
+			mut.bodies[label] = struct{}{}
+		}
+	case proto.CleaveOpType:
+		op := new(proto.CleaveOp)
+		if err = op.Unmarshal(msg.Data); err != nil {
+			return
+		}
+		mut.mutID, mut.action, mut.cleave = op.Mutid, "cleave", op
+		mut.bodies[op.Target] = struct{}{}
+		mut.bodies[op.Cleavedlabel] = struct{}{}
+		for _, supervoxel := range op.Cleaved {
+			mut.supervoxels[supervoxel] = struct{}{}
+		}
+	case proto.SplitOpType:
+		op := new(proto.SplitOp)
+		if err = op.Unmarshal(msg.Data); err != nil {
+			return
+		}
+		mut.mutID, mut.action, mut.split = op.Mutid, "split", op
+		mut.bodies[op.Target] = struct{}{}
+		mut.bodies[op.Newlabel] = struct{}{}
+		for supervoxel, svsplit := range op.Svsplits {
+			mut.supervoxels[supervoxel] = struct{}{}
+			mut.supervoxels[svsplit.Splitlabel] = struct{}{}
+			mut.supervoxels[svsplit.Remainlabel] = struct{}{}
+		}
+	case proto.SupervoxelSplitType:
+		op := new(proto.SupervoxelSplitOp)
+		if err = op.Unmarshal(msg.Data); err != nil {
+			return
+		}
+		mut.mutID, mut.action, mut.svsplit = op.Mutid, "split-supervoxel", op
+		mut.supervoxels[op.Supervoxel] = struct{}{}
+		mut.supervoxels[op.Splitlabel] = struct{}{}
+		mut.supervoxels[op.Remainlabel] = struct{}{}
+	case proto.MappingOpType:
+		op := new(proto.MappingOp)
+		if err = op.Unmarshal(msg.Data); err != nil {
+			return
+		}
+		mut.mutID, mut.action, mut.mapping = op.Mutid, "mapping", op
+		if op.Mapped != 0 {
+			mut.bodies[op.Mapped] = struct{}{}
+		}
+		for _, supervoxel := range op.Original {
+			mut.supervoxels[supervoxel] = struct{}{}
+		}
+	case proto.PaintOpType:
+		op := new(proto.PaintOp)
+		if err = op.Unmarshal(msg.Data); err != nil {
+			return
+		}
+		mut.mutID, mut.action, mut.paint = op.Mutid, "paint", op
+		for _, label := range op.Bodies {
+			mut.bodies[label] = struct{}{}
+		}
+		for _, supervoxel := range op.Supervoxels {
+			mut.supervoxels[supervoxel] = struct{}{}
+		}
+	default:
+		mut.action = "unknown"
+	}
+	return
+}
+
+// checkMutationLog returns an error if the data has no readable and writable mutation log,
+// which is required to reverse mutations.
+func (d *Data) checkMutationLog() error {
+	if d.GetWriteLog() == nil || d.GetReadLog() == nil {
+		return fmt.Errorf("data %q has no mutation log so its mutations cannot be reversed", d.DataName())
+	}
+	return nil
+}
+
+// readMutationLog returns the decoded mutation log for just the given version.
+func (d *Data) readMutationLog(v dvid.VersionID) ([]loggedMutation, error) {
+	var muts []loggedMutation
+	ch := make(chan storage.LogMessage, 100)
+	wg := new(sync.WaitGroup)
+	go func() {
+		for msg := range ch { // expects channel to be closed on completion
+			mut, err := decodeLoggedMutation(msg)
+			if err != nil {
+				dvid.Errorf("unable to unmarshal log message type %d for version %d: %v\n", msg.EntryType, v, err)
+			} else if mut.action != "unknown" {
+				muts = append(muts, mut)
+			}
+			wg.Done()
+		}
+	}()
+	if err := labels.StreamLog(d, v, ch, wg); err != nil {
+		return nil, fmt.Errorf("problem loading mutation log: %v", err)
+	}
+	wg.Wait()
+	return muts, nil
+}
+
+// findMutation returns the primary (non-mapping) log entry for a mutation ID as well as
+// the union of bodies and supervoxels touched by all entries with that mutation ID.
+func findMutation(muts []loggedMutation, mutID uint64) (op *loggedMutation, bodies, supervoxels labels.Set) {
+	bodies = make(labels.Set)
+	supervoxels = make(labels.Set)
+	for i, mut := range muts {
+		if mut.mutID != mutID {
+			continue
+		}
+		if op == nil && mut.action != "mapping" {
+			op = &muts[i]
+		}
+		bodies.Merge(mut.bodies)
+		supervoxels.Merge(mut.supervoxels)
+	}
+	return
+}
+
+// checkLaterMutations returns a MutationConflictError if any mutation after mutID, excluding
+// those in the ignore set, touched the given bodies or supervoxels.
+func checkLaterMutations(muts []loggedMutation, mutID uint64, ignore map[uint64]struct{}, bodies, supervoxels labels.Set) error {
+	conflicts := make(map[uint64]struct{})
+	for _, mut := range muts {
+		if mut.mutID <= mutID {
+			continue
+		}
+		if _, found := ignore[mut.mutID]; found {
+			continue
+		}
+		if setsIntersect(mut.bodies, bodies) || setsIntersect(mut.supervoxels, supervoxels) {
+			conflicts[mut.mutID] = struct{}{}
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	laterIDs := make([]uint64, 0, len(conflicts))
+	for id := range conflicts {
+		laterIDs = append(laterIDs, id)
+	}
+	sort.Slice(laterIDs, func(i, j int) bool { return laterIDs[i] < laterIDs[j] })
+	return MutationConflictError{MutID: mutID, LaterMutIDs: laterIDs}
+}
+
+func setsIntersect(s1, s2 labels.Set) bool {
+	if len(s1) > len(s2) {
+		s1, s2 = s2, s1
+	}
+	for label := range s1 {
+		if _, found := s2[label]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// premutationLabels returns the body label of each given supervoxel just before the given
+// mutation using mappings logged earlier in the version, falling back to the mapping of
+// ancestor versions.
+func (d *Data) premutationLabels(v dvid.VersionID, muts []loggedMutation, mutID uint64, supervoxels labels.Set) (map[uint64]uint64, error) {
+	labelmap := make(map[uint64]uint64, len(supervoxels))
+	for _, mut := range muts {
+		if mut.mutID >= mutID || mut.mapping == nil {
+			continue
+		}
+		for _, supervoxel := range mut.mapping.Original {
+			if _, found := supervoxels[supervoxel]; found {
+				labelmap[supervoxel] = mut.mapping.Mapped
+			}
+		}
+	}
+	svm, err := getMapping(d, v)
+	if err != nil {
+		return nil, err
+	}
+	ancestry, err := svm.getAncestry(v)
+	if err != nil {
+		return nil, err
+	}
+	svm.RLock()
+	if vid, found := svm.versions[v]; found && len(ancestry) != 0 && ancestry[0] == vid {
+		ancestry = ancestry[1:]
+	}
+	for supervoxel := range supervoxels {
+		if _, found := labelmap[supervoxel]; found {
+			continue
+		}
+		if label, mapped := svm.mapLabel(supervoxel, ancestry); mapped {
+			labelmap[supervoxel] = label
+		} else {
+			labelmap[supervoxel] = supervoxel
+		}
+	}
+	svm.RUnlock()
+	return labelmap, nil
+}
+
+// UndoMutation reverses the merge, cleave, split or supervoxel split with the given mutation ID
+// that was done in version v.  The reversal is refused with a MutationConflictError if later
+// mutations touched the same bodies or supervoxels, or with a LeaseConflictError if any of
+// the bodies is leased by another user.  The mutation IDs of the inverse mutations
+// are returned.
+func (d *Data) UndoMutation(v dvid.VersionID, mutID uint64, info dvid.ModInfo) (undoIDs []uint64, err error) {
+	undoMu.Lock()
+	defer undoMu.Unlock()
+
+	if err = d.checkMutationLog(); err != nil {
+		return
+	}
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	return d.undoMutation(v, mutID, nil, true, info, nil)
+}
+
+// undoMutation reverses a mutation, ignoring any later mutations in the ignore set when
+// checking for conflicts.  If checkLeases is true, the reversal is refused with a
+// LeaseConflictError if any body touched by the mutation is leased by another user.  The
+// caller must hold undoMu and a lock on mutationMu.  If evts is non-nil, events are deferred
+// until sent by the caller.
+func (d *Data) undoMutation(v dvid.VersionID, mutID uint64, ignore map[uint64]struct{}, checkLeases bool, info dvid.ModInfo, evts *deferredEvents) (undoIDs []uint64, err error) {
+	timedLog := dvid.NewTimeLog()
+	var rec *undoRecord
+	if rec, err = d.getUndoRecord(v, mutID); err != nil {
+		return
+	}
+	if rec != nil && len(rec.UndoMutIDs) != 0 {
+		if len(rec.RedoMutIDs) != 0 {
+			err = fmt.Errorf("mutation %d was already undone and then redone as mutation(s) %v, which should be undone instead", mutID, rec.RedoMutIDs)
+		} else {
+			err = fmt.Errorf("mutation %d was already undone by mutation(s) %v", mutID, rec.UndoMutIDs)
+		}
+		return
+	}
+
+	var muts []loggedMutation
+	if muts, err = d.readMutationLog(v); err != nil {
+		return
+	}
+	op, bodies, supervoxels := findMutation(muts, mutID)
+	if op == nil || op.action == "paint" {
+		err = fmt.Errorf("mutation %d is not a merge, cleave or split in the mutation log of this version", mutID)
+		return
+	}
+	if err = checkLaterMutations(muts, mutID, ignore, bodies, supervoxels); err != nil {
+		return
+	}
+	if checkLeases {
+		if err = d.checkBodyLeaseSet(v, info.User, bodies); err != nil {
+			return
+		}
+	}
+
+	if rec == nil {
+		rec = &undoRecord{MutID: mutID}
+	}
+	rec.Action = op.action
+	switch op.action {
+	case "merge":
+		if undoIDs, err = d.undoMerge(v, muts, op.merge, info, evts); err == nil {
+			err = d.restoreBodyProps(v, rec.BodyProps)
+		}
+	case "cleave":
+		mergeOp := labels.MergeOp{
+			Target: op.cleave.Target,
+			Merged: labels.Set{op.cleave.Cleavedlabel: struct{}{}},
+		}
+		undoID := d.NewMutationID()
+		if err = d.mergeLabels(v, mergeOp, undoID, info, evts); err == nil {
+			undoIDs = []uint64{undoID}
+		}
+	case "split":
+		origSV := make(map[uint64]uint64, 2*len(op.split.Svsplits))
+		for supervoxel, svsplit := range op.split.Svsplits {
+			origSV[svsplit.Splitlabel] = supervoxel
+			origSV[svsplit.Remainlabel] = supervoxel
+		}
+		var undoID uint64
+		if undoID, err = d.unsplitSupervoxels(v, op.split.Target, op.split.Newlabel, origSV, info, evts); err == nil {
+			undoIDs = []uint64{undoID}
+		}
+	case "split-supervoxel":
+		var undoID uint64
+		if undoID, rec.SplitVolume, err = d.undoSupervoxelSplit(v, op.svsplit, info, evts); err == nil {
+			undoIDs = []uint64{undoID}
+		}
+	}
+	if err != nil {
+		return
+	}
+	rec.UndoMutIDs = undoIDs
+	if err = d.putUndoRecord(v, rec); err != nil {
+		return
+	}
+	d.publishUndoRedo(v, "undo", mutID, undoIDs, info, evts)
+	timedLog.Infof("Undid %s mutation %d for data %q with mutation(s) %v", op.action, mutID, d.DataName(), undoIDs)
+	return
+}
+
+// RedoMutation reapplies a mutation that was reversed via UndoMutation.  The redo is refused
+// with a MutationConflictError if mutations other than the undo touched the same bodies or
+// supervoxels, or with a LeaseConflictError if any of the bodies is leased by another user.
+// A split is redone using its logged sparse volume, so the resulting body and supervoxels
+// receive new labels.  The mutation IDs of the redo mutations are returned.
+func (d *Data) RedoMutation(v dvid.VersionID, mutID uint64, info dvid.ModInfo) (redoIDs []uint64, err error) {
+	undoMu.Lock()
+	defer undoMu.Unlock()
+
+	if err = d.checkMutationLog(); err != nil {
+		return
+	}
+	d.mutationMu.RLock()
+	defer d.mutationMu.RUnlock()
+
+	timedLog := dvid.NewTimeLog()
+	var rec *undoRecord
+	if rec, err = d.getUndoRecord(v, mutID); err != nil {
+		return
+	}
+	if rec == nil || len(rec.UndoMutIDs) == 0 {
+		err = fmt.Errorf("mutation %d has not been undone so cannot be redone", mutID)
+		return
+	}
+	if len(rec.RedoMutIDs) != 0 {
+		err = fmt.Errorf("mutation %d was already redone by mutation(s) %v", mutID, rec.RedoMutIDs)
+		return
+	}
+
+	var muts []loggedMutation
+	if muts, err = d.readMutationLog(v); err != nil {
+		return
+	}
+	op, bodies, supervoxels := findMutation(muts, mutID)
+	if op == nil {
+		err = fmt.Errorf("mutation %d was not found in the mutation log of this version", mutID)
+		return
+	}
+	ignore := make(map[uint64]struct{}, len(rec.UndoMutIDs))
+	for _, undoID := range rec.UndoMutIDs {
+		ignore[undoID] = struct{}{}
+	}
+	if err = checkLaterMutations(muts, mutID, ignore, bodies, supervoxels); err != nil {
+		return
+	}
+	if err = d.checkBodyLeaseSet(v, info.User, bodies); err != nil {
+		return
+	}
+
+	var redoID uint64
+	switch op.action {
+	case "merge":
+		mergeOp := labels.MergeOp{Target: op.merge.Target, Merged: make(labels.Set, len(op.merge.Merged))}
+		for _, label := range op.merge.Merged {
+			mergeOp.Merged[label] = struct{}{}
+		}
+		redoID = d.NewMutationID()
+		err = d.mergeLabels(v, mergeOp, redoID, info, nil)
+	case "cleave":
+		redoID = d.NewMutationID()
+		err = d.cleaveLabel(v, redoID, op.cleave.Target, op.cleave.Cleavedlabel, op.cleave.Cleaved, info, nil)
+	case "split":
+		var split dvid.RLEs
+		if err = split.UnmarshalBinary(op.split.Rles); err != nil {
+			err = fmt.Errorf("unable to decode logged split of mutation %d: %v", mutID, err)
+			return
+		}
+		_, redoID, err = d.splitLabelRLEs(v, op.split.Target, split, info)
+	case "split-supervoxel":
+		var split dvid.RLEs
+		if split, err = dvid.ReadRLEs(bytes.NewBuffer(rec.SplitVolume)); err != nil {
+			err = fmt.Errorf("unable to decode split volume of mutation %d: %v", mutID, err)
+			return
+		}
+		for _, label := range []uint64{op.svsplit.Splitlabel, op.svsplit.Remainlabel} {
+			if _, err = d.updateMaxLabel(v, label); err != nil {
+				return
+			}
+		}
+		redoID = d.NewMutationID()
+		err = d.splitSupervoxel(v, redoID, op.svsplit.Supervoxel, op.svsplit.Splitlabel, op.svsplit.Remainlabel, split, info, true, nil)
+	default:
+		err = fmt.Errorf("unable to redo mutation %d with action %q", mutID, op.action)
+	}
+	if err != nil {
+		return
+	}
+	redoIDs = []uint64{redoID}
+	rec.RedoMutIDs = redoIDs
+	if err = d.putUndoRecord(v, rec); err != nil {
+		return
+	}
+	d.publishUndoRedo(v, "redo", mutID, redoIDs, info, nil)
+	timedLog.Infof("Redid %s mutation %d for data %q with mutation %d", op.action, mutID, d.DataName(), redoID)
+	return
+}
+
+// sends kafka message noting which mutations reversed or reapplied a mutation.
+func (d *Data) publishUndoRedo(v dvid.VersionID, action string, mutID uint64, mutIDs []uint64, info dvid.ModInfo, evts *deferredEvents) {
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":      action,
+		"MutationID":  mutID,
+		"MutationIDs": mutIDs,
+		"UUID":        string(versionuuid),
+		"Timestamp":   time.Now().String(),
+	}
+	if info.User != "" {
+		msginfo["User"] = info.User
+	}
+	if info.App != "" {
+		msginfo["App"] = info.App
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err := evts.produceKafkaMsg(d, jsonmsg); err != nil {
+		dvid.Errorf("error on sending %s op to kafka: %v\n", action, err)
+	}
+}
+
+// undoMerge cleaves the supervoxels of each merged label back out of the merge target,
+// restoring the original label ids.
+func (d *Data) undoMerge(v dvid.VersionID, muts []loggedMutation, op *proto.MergeOp, info dvid.ModInfo, evts *deferredEvents) (undoIDs []uint64, err error) {
+	merged := make(labels.Set, len(op.Merged))
+	for _, label := range op.Merged {
+		merged[label] = struct{}{}
+	}
+	supervoxels := make(labels.Set)
+	for _, mut := range muts {
+		if mut.mutID == op.Mutid && mut.mapping != nil && mut.mapping.Mapped == op.Target {
+			for _, supervoxel := range mut.mapping.Original {
+				supervoxels[supervoxel] = struct{}{}
+			}
+		}
+	}
+	var labelmap map[uint64]uint64
+	if labelmap, err = d.premutationLabels(v, muts, op.Mutid, supervoxels); err != nil {
+		return
+	}
+	cleaves := make(map[uint64][]uint64, len(merged))
+	for supervoxel, label := range labelmap {
+		if _, found := merged[label]; !found {
+			err = fmt.Errorf("supervoxel %d was in label %d before merge mutation %d, which was not a merged label", supervoxel, label, op.Mutid)
+			return
+		}
+		cleaves[label] = append(cleaves[label], supervoxel)
+	}
+	cleaveLabels := make([]uint64, 0, len(cleaves))
+	for label := range cleaves {
+		cleaveLabels = append(cleaveLabels, label)
+	}
+	sort.Slice(cleaveLabels, func(i, j int) bool { return cleaveLabels[i] < cleaveLabels[j] })
+	for _, label := range cleaveLabels {
+		svs := cleaves[label]
+		sort.Slice(svs, func(i, j int) bool { return svs[i] < svs[j] })
+		undoID := d.NewMutationID()
+		if err = d.cleaveLabel(v, undoID, op.Target, label, svs, info, evts); err != nil {
+			return
+		}
+		undoIDs = append(undoIDs, undoID)
+	}
+	return
+}
+
+// undoSupervoxelSplit rejoins the split and remain supervoxels into the original supervoxel.
+// The sparse volume of the split supervoxel is returned so the split can be redone.
+func (d *Data) undoSupervoxelSplit(v dvid.VersionID, op *proto.SupervoxelSplitOp, info dvid.ModInfo, evts *deferredEvents) (undoID uint64, splitVolume []byte, err error) {
+	var svm *SVMap
+	if svm, err = getMapping(d, v); err != nil {
+		return
+	}
+	splitBody, _ := svm.MappedLabel(v, op.Splitlabel)
+	remainBody, _ := svm.MappedLabel(v, op.Remainlabel)
+	if splitBody != remainBody {
+		err = fmt.Errorf("supervoxels %d and %d from split of supervoxel %d are now in different labels %d and %d", op.Splitlabel, op.Remainlabel, op.Supervoxel, splitBody, remainBody)
+		return
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	if splitVolume, err = d.getLegacyRLEs(ctx, op.Splitlabel, 0, dvid.Bounds{}, true); err != nil {
+		return
+	}
+	origSV := map[uint64]uint64{
+		op.Splitlabel:  op.Supervoxel,
+		op.Remainlabel: op.Supervoxel,
+	}
+	undoID, err = d.unsplitSupervoxels(v, splitBody, 0, origSV, info, evts)
+	return
+}
+
+// unsplitSupervoxels relabels split-generated supervoxels back to their original supervoxels,
+// where origSV maps each split-generated supervoxel to its original.  If absorbed is non-zero,
+// that label is merged into the target label, which happens when reversing a label split.
+// If evts is non-nil, events are deferred until sent by the caller.
+func (d *Data) unsplitSupervoxels(v dvid.VersionID, target, absorbed uint64, origSV map[uint64]uint64, info dvid.ModInfo, evts *deferredEvents) (mutID uint64, err error) {
+	timedLog := dvid.NewTimeLog()
+
+	// Only do voxel-based mutations one at a time.  This lets us remove handling for block-level concurrency.
+	d.voxelMu.Lock()
+	defer d.voxelMu.Unlock()
+
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	shard := target % numIndexShards
+	indexMu[shard].Lock()
+	defer indexMu[shard].Unlock()
+
+	var idx *labels.Index
+	if idx, err = getCachedLabelIndex(d, v, target); err != nil {
+		return
+	}
+	if idx == nil {
+		err = fmt.Errorf("unable to undo split for data %q: missing label %d", d.DataName(), target)
+		return
+	}
+	if absorbed != 0 {
+		absorbedShard := absorbed % numIndexShards
+		if absorbedShard != shard {
+			indexMu[absorbedShard].Lock()
+			defer indexMu[absorbedShard].Unlock()
+		}
+		var absorbedIdx *labels.Index
+		if absorbedIdx, err = getCachedLabelIndex(d, v, absorbed); err != nil {
+			return
+		}
+		if absorbedIdx == nil {
+			err = fmt.Errorf("unable to undo split for data %q: missing label %d", d.DataName(), absorbed)
+			return
+		}
+		if err = idx.Add(absorbedIdx); err != nil {
+			return
+		}
+	}
+	present := idx.GetSupervoxels()
+	for supervoxel := range origSV {
+		if _, found := present[supervoxel]; !found {
+			err = fmt.Errorf("supervoxel %d is no longer part of label %d", supervoxel, target)
+			return
+		}
+	}
+
+	mutID = d.NewMutationID()
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":      "unsplit-supervoxels",
+		"Target":      target,
+		"Supervoxels": origSV,
+		"MutationID":  mutID,
+		"UUID":        string(versionuuid),
+		"Timestamp":   time.Now().String(),
+	}
+	if absorbed != 0 {
+		msginfo["Absorbed"] = absorbed
+	}
+	if info.User != "" {
+		msginfo["User"] = info.User
+	}
+	if info.App != "" {
+		msginfo["App"] = info.App
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err = evts.produceKafkaMsg(d, jsonmsg); err != nil {
+		dvid.Errorf("error on sending unsplit op to kafka: %v\n", err)
+	}
+
+	var mergeOp labels.MergeOp
+	if absorbed != 0 {
+		mergeOp = labels.MergeOp{MutID: mutID, Target: target, Merged: labels.Set{absorbed: struct{}{}}}
+		evt := datastore.SyncEvent{d.DataUUID(), labels.MergeStartEvent}
+		msg := datastore.SyncMessage{labels.MergeStartEvent, v, labels.DeltaMergeStart{mergeOp}}
+		if err = evts.notifySubscribers(evt, msg); err != nil {
+			return
+		}
+	}
+
+	// relabel voxels in all blocks with the split-generated supervoxels.
+	ctx := datastore.NewVersionedCtx(d, v)
+	downresMut := downres.NewMutation(d, v, mutID)
+	modCh := make(chan interface{}, len(idx.Blocks))
+	errCh := make(chan error, len(idx.Blocks))
+	numHandlers := 16
+	for i := 0; i < numHandlers; i++ {
+		go d.modifyBlocks(ctx, downresMut, modCh, errCh)
+	}
+
+	var scale uint8
+	var numMods int
+	for zyx, svc := range idx.Blocks {
+		blockMerges := make(map[uint64]labels.Set)
+		for supervoxel := range svc.Counts {
+			if orig, found := origSV[supervoxel]; found {
+				if _, found := blockMerges[orig]; !found {
+					blockMerges[orig] = make(labels.Set)
+				}
+				blockMerges[orig][supervoxel] = struct{}{}
+			}
+		}
+		if len(blockMerges) == 0 {
+			continue
+		}
+		izyx := labels.BlockIndexToIZYXString(zyx)
+		var pb *labels.PositionedBlock
+		if pb, err = d.getLabelBlock(ctx, scale, izyx); err != nil {
+			break
+		}
+		if pb == nil {
+			err = fmt.Errorf("block %s doesn't exist for undo of split", izyx)
+			break
+		}
+		ops := make([]labels.MergeOp, 0, len(blockMerges))
+		for orig, merged := range blockMerges {
+			ops = append(ops, labels.MergeOp{MutID: mutID, Target: orig, Merged: merged})
+			for supervoxel := range merged {
+				svc.Counts[orig] += svc.Counts[supervoxel]
+				delete(svc.Counts, supervoxel)
+			}
+		}
+		modCh <- mergeMod{bcoord: izyx, ops: ops, pb: pb}
+		numMods++
+	}
+	close(modCh)
+	var numErr int
+	for i := 0; i < numMods; i++ {
+		if processErr := <-errCh; processErr != nil {
+			err = processErr
+			numErr++
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("had %d errors undoing split in data %q, last one: %v", numErr, d.DataName(), err)
+		return
+	}
+
+	idx.Label = target
+	idx.LastMutId = mutID
+	idx.LastModUser = info.User
+	idx.LastModTime = info.Time
+	idx.LastModApp = info.App
+	if err = putCachedLabelIndex(d, v, idx); err != nil {
+		return
+	}
+	if absorbed != 0 {
+		if err = deleteCachedLabelIndex(d, v, absorbed); err != nil {
+			return
+		}
+	}
+	if err = addUnsplitToMapping(d, v, mutID, target, origSV); err != nil {
+		return
+	}
+	if err = downresMut.Execute(); err != nil {
+		return
+	}
+
+	if absorbed != 0 {
+		delta := labels.DeltaMerge{
+			MergeOp: mergeOp,
+			Blocks:  idx.GetBlockIndices(),
+		}
+		evt := datastore.SyncEvent{d.DataUUID(), labels.MergeBlockEvent}
+		msg := datastore.SyncMessage{labels.MergeBlockEvent, v, delta}
+		if err := evts.notifySubscribers(evt, msg); err != nil {
+			dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+		}
+		evt = datastore.SyncEvent{d.DataUUID(), labels.MergeEndEvent}
+		msg = datastore.SyncMessage{labels.MergeEndEvent, v, labels.DeltaMergeEnd{mergeOp}}
+		if err := evts.notifySubscribers(evt, msg); err != nil {
+			dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+		}
+	}
+
+	bodies := []uint64{target}
+	if absorbed != 0 {
+		bodies = append(bodies, absorbed)
+	}
+	evts.publishMutation(d, v, "unsplit-supervoxels", mutID, info.User, jsonmsg, bodies...)
+
+	msginfo = map[string]interface{}{
+		"Action":     "unsplit-supervoxels-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	if err = evts.produceKafkaMsg(d, jsonmsg); err != nil {
+		dvid.Errorf("error on sending unsplit complete op to kafka: %v\n", err)
+	}
+	timedLog.Infof("Undid split of %d supervoxels in label %d (%d blocks)", len(origSV), target, numMods)
+	return
+}
@@ -0,0 +1,388 @@
+/*
+	This file supports verification of label indices against the supervoxel counts of the
+	scale 0 blocks, and optional repair of any inconsistent indices.
+*/
+
+package labelmap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// IndexDiscrepancy describes a label index that disagrees with the stored blocks.
+type IndexDiscrepancy struct {
+	Label         uint64
+	Problem       string // "missing", "orphaned", or "counts"
+	StoredVoxels  uint64
+	ActualVoxels  uint64
+	StoredBlocks  int
+	ActualBlocks  int
+	BadBlocks     int // number of blocks with differing supervoxel counts
+	Repaired      bool
+	RepairProblem string `json:",omitempty"`
+}
+
+// IndexVerification is the result of verifying all label indices of a version.
+type IndexVerification struct {
+	Blocks        uint64
+	Indices       int
+	Discrepancies []IndexDiscrepancy
+}
+
+// labelTotals gives the number of blocks and voxels of a label found in a block scan.
+type labelTotals struct {
+	blocks int
+	voxels uint64
+}
+
+// scanBlockLabels scans all scale 0 blocks with supervoxels mapped to bodies as of the given
+// version.  If want is nil, the number of blocks and voxels of every label is returned.
+// Otherwise, label indices computed from the actual supervoxel counts are returned for just
+// the wanted labels.
+func (d *Data) scanBlockLabels(v dvid.VersionID, want labels.Set) (totals map[uint64]labelTotals, indices map[uint64]*labels.Index, numBlocks uint64, err error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return
+	}
+	svm, err := getMapping(d, v)
+	if err != nil {
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+	if want == nil {
+		totals = make(map[uint64]labelTotals)
+	} else {
+		indices = make(map[uint64]*labels.Index, len(want))
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	begTKey := NewBlockTKeyByCoord(0, dvid.MinIndexZYX.ToIZYXString())
+	endTKey := NewBlockTKeyByCoord(0, dvid.MaxIndexZYX.ToIZYXString())
+	err = store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.V == nil {
+			return nil
+		}
+		scale, idx, err := DecodeBlockTKey(c.K)
+		if err != nil {
+			return err
+		}
+		if scale != 0 {
+			return fmt.Errorf("index verification got unexpected scale %d block", scale)
+		}
+		data, _, err := dvid.DeserializeData(c.V, true)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize block %s in data %q: %v", idx, d.DataName(), err)
+		}
+		var block labels.Block
+		if err := block.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("unable to unmarshal block %s in data %q: %v", idx, d.DataName(), err)
+		}
+		numBlocks++
+		if numBlocks%10000 == 0 {
+			timedLog.Infof("Now verifying block %d for data %q", numBlocks, d.DataName())
+		}
+		counts := block.CalcNumLabels(nil)
+		if len(counts) == 0 {
+			return nil
+		}
+		supervoxels := make([]uint64, 0, len(counts))
+		for supervoxel := range counts {
+			supervoxels = append(supervoxels, supervoxel)
+		}
+		mapped, _, err := svm.MappedLabels(v, supervoxels)
+		if err != nil {
+			return err
+		}
+		if totals != nil {
+			blockVoxels := make(map[uint64]uint64, len(supervoxels))
+			for i, supervoxel := range supervoxels {
+				blockVoxels[mapped[i]] += uint64(counts[supervoxel])
+			}
+			for label, voxels := range blockVoxels {
+				t := totals[label]
+				t.blocks++
+				t.voxels += voxels
+				totals[label] = t
+			}
+			return nil
+		}
+		bx, by, bz := idx.Unpack()
+		zyx := labels.EncodeBlockIndex(bx, by, bz)
+		for i, supervoxel := range supervoxels {
+			label := mapped[i]
+			if _, found := want[label]; !found {
+				continue
+			}
+			lidx, found := indices[label]
+			if !found {
+				lidx = new(labels.Index)
+				lidx.Label = label
+				lidx.Blocks = make(map[uint64]*proto.SVCount)
+				indices[label] = lidx
+			}
+			svc, found := lidx.Blocks[zyx]
+			if !found {
+				svc = &proto.SVCount{Counts: make(map[uint64]uint32)}
+				lidx.Blocks[zyx] = svc
+			}
+			svc.Counts[supervoxel] = uint32(counts[supervoxel])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	timedLog.Infof("Scanned %d blocks of data %q for %d labels", numBlocks, d.DataName(), len(totals)+len(indices))
+	return
+}
+
+// computeBlocksIndex returns the label index computed from the actual supervoxel counts of
+// just the blocks in the given stored index.
+func (d *Data) computeBlocksIndex(ctx *datastore.VersionedCtx, svm *SVMap, stored *labels.Index) (*labels.Index, error) {
+	v := ctx.VersionID()
+	idx := new(labels.Index)
+	idx.Label = stored.Label
+	idx.Blocks = make(map[uint64]*proto.SVCount, len(stored.Blocks))
+	for zyx := range stored.Blocks {
+		pb, err := d.getLabelBlock(ctx, 0, labels.BlockIndexToIZYXString(zyx))
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			continue
+		}
+		counts := pb.CalcNumLabels(nil)
+		supervoxels := make([]uint64, 0, len(counts))
+		for supervoxel := range counts {
+			supervoxels = append(supervoxels, supervoxel)
+		}
+		mapped, _, err := svm.MappedLabels(v, supervoxels)
+		if err != nil {
+			return nil, err
+		}
+		for i, supervoxel := range supervoxels {
+			if mapped[i] != stored.Label {
+				continue
+			}
+			svc, found := idx.Blocks[zyx]
+			if !found {
+				svc = &proto.SVCount{Counts: make(map[uint64]uint32)}
+				idx.Blocks[zyx] = svc
+			}
+			svc.Counts[supervoxel] = uint32(counts[supervoxel])
+		}
+	}
+	return idx, nil
+}
+
+// countBadBlocks returns the number of blocks whose supervoxel counts differ between
+// the two indices.
+func countBadBlocks(stored, actual *labels.Index) (bad int) {
+	for zyx, svc := range actual.Blocks {
+		svc2, found := stored.Blocks[zyx]
+		if !found || svc2 == nil || len(svc.Counts) != len(svc2.Counts) {
+			bad++
+			continue
+		}
+		for supervoxel, count := range svc.Counts {
+			if count2, found := svc2.Counts[supervoxel]; !found || count != count2 {
+				bad++
+				break
+			}
+		}
+	}
+	for zyx := range stored.Blocks {
+		if _, found := actual.Blocks[zyx]; !found {
+			bad++
+		}
+	}
+	return
+}
+
+// verifyChunkSize is the number of stored label indices read at a time during verification.
+const verifyChunkSize = 1000
+
+var errChunkFull = fmt.Errorf("label index chunk is full")
+
+// getLabelIndexChunk returns up to maxIndices stored label indices with labels at or above
+// begLabel, sorted by label, along with the label at which the next chunk should start.
+// If there are no more indices, more is false.
+func (d *Data) getLabelIndexChunk(ctx *datastore.VersionedCtx, begLabel uint64, maxIndices int) (indices []*labels.Index, next uint64, more bool, err error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return
+	}
+	begTKey := NewLabelIndexTKey(begLabel)
+	endTKey := NewLabelIndexTKey(math.MaxUint64)
+	err = store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.V == nil {
+			return nil
+		}
+		label, err := DecodeLabelIndexTKey(c.K)
+		if err != nil {
+			return err
+		}
+		if len(indices) == maxIndices {
+			next, more = label, true
+			return errChunkFull
+		}
+		data, _, err := dvid.DeserializeData(c.V, true)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize label index %d in data %q: %v", label, d.DataName(), err)
+		}
+		idx := new(labels.Index)
+		if err := idx.Unmarshal(data); err != nil {
+			return fmt.Errorf("unable to unmarshal label index %d in data %q: %v", label, d.DataName(), err)
+		}
+		if idx.Label == 0 {
+			idx.Label = label
+		}
+		if len(idx.Blocks) != 0 {
+			indices = append(indices, idx)
+		}
+		return nil
+	})
+	if err == errChunkFull {
+		err = nil
+	}
+	return
+}
+
+// VerifyIndices compares every stored label index with the supervoxel counts of the scale 0
+// blocks.  If repair is true, inconsistent indices are rewritten from the block contents and
+// indices of labels without any voxels are deleted, and all other label mutations of the
+// instance wait until the repair is complete.  Without repair, mutations should not be made
+// on the version during verification.
+//
+// To bound memory, only the number of blocks and voxels of each label is kept from a scan of
+// all blocks.  Each stored index is then checked against the blocks it lists, with the totals
+// catching any blocks of the label missing from the index.  Indices to be repaired are
+// computed by a second scan for just the inconsistent labels.
+func (d *Data) VerifyIndices(v dvid.VersionID, repair bool) (*IndexVerification, error) {
+	timedLog := dvid.NewTimeLog()
+
+	// Block all other label mutations so repaired indices aren't overwritten or stale.
+	if repair {
+		d.mutationMu.Lock()
+		defer d.mutationMu.Unlock()
+	}
+
+	// Only do voxel-based mutations one at a time.  This lets us remove handling for block-level concurrency.
+	d.voxelMu.Lock()
+	defer d.voxelMu.Unlock()
+
+	if repair {
+		d.StartUpdate()
+		defer d.StopUpdate()
+	}
+
+	totals, _, numBlocks, err := d.scanBlockLabels(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	svm, err := getMapping(d, v)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	result := &IndexVerification{Blocks: numBlocks}
+	rebuild := make(map[uint64]*labels.Index) // stored index of inconsistent labels, nil if missing
+	var begLabel uint64
+	for {
+		stored, next, more, err := d.getLabelIndexChunk(ctx, begLabel, verifyChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		result.Indices += len(stored)
+		for _, idx := range stored {
+			disc := IndexDiscrepancy{
+				Label:        idx.Label,
+				StoredVoxels: idx.NumVoxels(),
+				StoredBlocks: len(idx.Blocks),
+			}
+			t, found := totals[idx.Label]
+			if !found {
+				disc.Problem = "orphaned"
+				disc.BadBlocks = len(idx.Blocks)
+				result.Discrepancies = append(result.Discrepancies, disc)
+				continue
+			}
+			delete(totals, idx.Label)
+			aidx, err := d.computeBlocksIndex(ctx, svm, idx)
+			if err != nil {
+				return nil, err
+			}
+			disc.BadBlocks = countBadBlocks(idx, aidx) + t.blocks - len(aidx.Blocks)
+			if disc.BadBlocks == 0 {
+				continue
+			}
+			disc.Problem = "counts"
+			disc.ActualVoxels = t.voxels
+			disc.ActualBlocks = t.blocks
+			result.Discrepancies = append(result.Discrepancies, disc)
+			rebuild[idx.Label] = idx
+		}
+		if !more {
+			break
+		}
+		begLabel = next
+	}
+	for label, t := range totals {
+		result.Discrepancies = append(result.Discrepancies, IndexDiscrepancy{
+			Label:        label,
+			Problem:      "missing",
+			ActualVoxels: t.voxels,
+			ActualBlocks: t.blocks,
+			BadBlocks:    t.blocks,
+		})
+		rebuild[label] = nil
+	}
+	sort.Slice(result.Discrepancies, func(i, j int) bool {
+		return result.Discrepancies[i].Label < result.Discrepancies[j].Label
+	})
+
+	if repair && len(result.Discrepancies) != 0 {
+		var actual map[uint64]*labels.Index
+		if len(rebuild) != 0 {
+			want := make(labels.Set, len(rebuild))
+			for label := range rebuild {
+				want[label] = struct{}{}
+			}
+			if _, actual, _, err = d.scanBlockLabels(v, want); err != nil {
+				return nil, err
+			}
+		}
+		modTime := time.Now().Format(time.RFC3339)
+		for i, disc := range result.Discrepancies {
+			var idx *labels.Index
+			if disc.Problem != "orphaned" {
+				idx = actual[disc.Label]
+			}
+			if idx != nil {
+				if storedIdx := rebuild[disc.Label]; storedIdx != nil {
+					idx.LastMutId = storedIdx.LastMutId
+					idx.LastModUser = storedIdx.LastModUser
+					idx.LastModApp = storedIdx.LastModApp
+				}
+				idx.LastModTime = modTime
+			}
+			if err := PutLabelIndex(d, v, disc.Label, idx); err != nil {
+				result.Discrepancies[i].RepairProblem = err.Error()
+				dvid.Errorf("unable to repair label %d index in data %q: %v\n", disc.Label, d.DataName(), err)
+				continue
+			}
+			result.Discrepancies[i].Repaired = true
+		}
+	}
+	timedLog.Infof("Verified %d label indices against %d blocks of data %q: %d discrepancies (repair %t)",
+		result.Indices, numBlocks, d.DataName(), len(result.Discrepancies), repair)
+	return result, nil
+}
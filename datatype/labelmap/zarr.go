@@ -0,0 +1,345 @@
+/*
+	This file supports export of segmentation scales into an OME-Zarr multiscale group on the
+	server's file system.  Each stored block becomes a gzip-compressed chunk of uint64 labels,
+	with all-zero chunks omitted since they equal the fill value.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ZarrExportOptions specifies what is exported by ExportZarr.
+type ZarrExportOptions struct {
+	MaxScale uint8             // scales 0 through MaxScale are exported
+	ROI      dvid.InstanceName // if not empty, voxels outside this ROI are exported as 0
+	Mapped   bool              // if true, supervoxels are mapped to bodies
+}
+
+type zarrCompressor struct {
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+}
+
+type zarrArray struct {
+	ZarrFormat         int            `json:"zarr_format"`
+	Shape              [3]int32       `json:"shape"`
+	Chunks             [3]int32       `json:"chunks"`
+	DType              string         `json:"dtype"`
+	Compressor         zarrCompressor `json:"compressor"`
+	FillValue          int            `json:"fill_value"`
+	Order              string         `json:"order"`
+	Filters            []interface{}  `json:"filters"`
+	DimensionSeparator string         `json:"dimension_separator"`
+}
+
+type omeAxis struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Unit string `json:"unit,omitempty"`
+}
+
+type omeTransform struct {
+	Type        string    `json:"type"`
+	Scale       []float64 `json:"scale,omitempty"`
+	Translation []float64 `json:"translation,omitempty"`
+}
+
+type omeDataset struct {
+	Path            string         `json:"path"`
+	Transformations []omeTransform `json:"coordinateTransformations"`
+}
+
+type omeMultiscale struct {
+	Version  string       `json:"version"`
+	Name     string       `json:"name"`
+	Axes     []omeAxis    `json:"axes"`
+	Datasets []omeDataset `json:"datasets"`
+}
+
+// omeUnit converts DVID voxel units to the singular unit names of OME-Zarr.
+func omeUnit(unit string) string {
+	unit = strings.ToLower(unit)
+	switch unit {
+	case "nanometers", "micrometers", "millimeters", "meters", "angstroms":
+		return strings.TrimSuffix(unit, "s")
+	case "nm":
+		return "nanometer"
+	case "um":
+		return "micrometer"
+	}
+	return unit
+}
+
+// zarrROI is a block-level ROI used to mask exported voxels at any scale.
+type zarrROI struct {
+	blockSize dvid.Point3d
+	blocks    map[dvid.ChunkPoint3d]struct{}
+}
+
+func getZarrROI(v dvid.VersionID, name dvid.InstanceName) (*zarrROI, error) {
+	dataservice, err := datastore.GetDataByVersionName(v, name)
+	if err != nil {
+		return nil, fmt.Errorf("can't get ROI with name %q: %v", name, err)
+	}
+	roidata, ok := dataservice.(*roi.Data)
+	if !ok {
+		return nil, fmt.Errorf("data name %q was not of roi data type", name)
+	}
+	spans, err := roidata.GetSpans(v)
+	if err != nil {
+		return nil, err
+	}
+	zr := &zarrROI{
+		blockSize: roidata.BlockSize,
+		blocks:    make(map[dvid.ChunkPoint3d]struct{}),
+	}
+	for _, span := range spans {
+		for x := span[2]; x <= span[3]; x++ {
+			zr.blocks[dvid.ChunkPoint3d{x, span[1], span[0]}] = struct{}{}
+		}
+	}
+	return zr, nil
+}
+
+// inside returns true if the given scale 0 voxel is within the ROI.
+func (zr *zarrROI) inside(pt dvid.Point3d) bool {
+	bcoord := dvid.ChunkPoint3d{floorDiv(pt[0], zr.blockSize[0]), floorDiv(pt[1], zr.blockSize[1]), floorDiv(pt[2], zr.blockSize[2])}
+	_, found := zr.blocks[bcoord]
+	return found
+}
+
+// ExportZarr writes the given scales of a version into an OME-Zarr multiscale group at the
+// directory, which is created if necessary.  The arrays are indexed in ZYX order from an
+// origin that is block-aligned at every exported scale, and the origin is recorded as an
+// OME-Zarr translation.
+func (d *Data) ExportZarr(v dvid.VersionID, dir string, opts ZarrExportOptions) error {
+	if opts.MaxScale > d.MaxDownresLevel {
+		return fmt.Errorf("scale %d exceeds maximum down-resolution level %d", opts.MaxScale, d.MaxDownresLevel)
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("can't export zarr because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	voxelSize := d.Properties.VoxelSize
+	if len(voxelSize) < 3 {
+		return fmt.Errorf("data %q voxel size is not 3d", d.DataName())
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	extents, err := d.GetExtents(ctx)
+	if err != nil {
+		return err
+	}
+	if extents.MinPoint == nil || extents.MaxPoint == nil {
+		return fmt.Errorf("data %q has no stored extents", d.DataName())
+	}
+	minPt, ok := extents.MinPoint.(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("data %q extents are not 3d", d.DataName())
+	}
+	maxPt, ok := extents.MaxPoint.(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("data %q extents are not 3d", d.DataName())
+	}
+	var zr *zarrROI
+	if opts.ROI != "" {
+		if zr, err = getZarrROI(v, opts.ROI); err != nil {
+			return err
+		}
+	}
+	var svm *SVMap
+	var ancestry []uint8
+	if opts.Mapped {
+		if svm, err = getMapping(d, v); err != nil {
+			return err
+		}
+		if ancestry, err = svm.getAncestry(v); err != nil {
+			return err
+		}
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	timedLog := dvid.NewTimeLog()
+
+	// origin at scale 0 aligned to blocks of the coarsest exported scale.
+	var origin dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		coarse := blockSize[dim] << opts.MaxScale
+		origin[dim] = floorDiv(minPt[dim], coarse) * coarse
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeZarrJSON(filepath.Join(dir, ".zgroup"), map[string]int{"zarr_format": 2}); err != nil {
+		return err
+	}
+	var unit string
+	if len(d.Properties.VoxelUnits) != 0 {
+		unit = omeUnit(d.Properties.VoxelUnits[0])
+	}
+	multiscale := omeMultiscale{
+		Version: "0.4",
+		Name:    string(d.DataName()),
+		Axes: []omeAxis{
+			{Name: "z", Type: "space", Unit: unit},
+			{Name: "y", Type: "space", Unit: unit},
+			{Name: "x", Type: "space", Unit: unit},
+		},
+	}
+
+	for scale := uint8(0); scale <= opts.MaxScale; scale++ {
+		factor := int32(1) << scale
+		path := fmt.Sprintf("s%d", scale)
+		scaleDir := filepath.Join(dir, path)
+		if err := os.MkdirAll(scaleDir, 0755); err != nil {
+			return err
+		}
+		zarray := zarrArray{
+			ZarrFormat:         2,
+			DType:              "<u8",
+			Compressor:         zarrCompressor{ID: "gzip", Level: 5},
+			Order:              "C",
+			DimensionSeparator: "/",
+		}
+		var originBlock dvid.Point3d
+		dataset := omeDataset{Path: path}
+		scaleTransform := omeTransform{Type: "scale", Scale: make([]float64, 3)}
+		translation := omeTransform{Type: "translation", Translation: make([]float64, 3)}
+		for dim := 0; dim < 3; dim++ {
+			zdim := 2 - dim
+			originBlock[dim] = origin[dim] / factor / blockSize[dim]
+			zarray.Shape[zdim] = floorDiv(maxPt[dim], factor) - origin[dim]/factor + 1
+			zarray.Chunks[zdim] = blockSize[dim]
+			res := float64(voxelSize[dim])
+			scaleTransform.Scale[zdim] = res * float64(factor)
+			translation.Translation[zdim] = res * (float64(origin[dim]) + float64(factor-1)/2)
+		}
+		dataset.Transformations = []omeTransform{scaleTransform, translation}
+		multiscale.Datasets = append(multiscale.Datasets, dataset)
+		if err := writeZarrJSON(filepath.Join(scaleDir, ".zarray"), zarray); err != nil {
+			return err
+		}
+
+		var numChunks, numBlocks int
+		begTKey := NewBlockTKeyByCoord(scale, dvid.MinIndexZYX.ToIZYXString())
+		endTKey := NewBlockTKeyByCoord(scale, dvid.MaxIndexZYX.ToIZYXString())
+		err = store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+			if c == nil || c.V == nil {
+				return nil
+			}
+			_, idx, err := DecodeBlockTKey(c.K)
+			if err != nil {
+				return err
+			}
+			numBlocks++
+			bx, by, bz := idx.Unpack()
+			bcoord := dvid.Point3d{bx, by, bz}
+			var chunkIdx dvid.Point3d
+			for dim := 0; dim < 3; dim++ {
+				chunkIdx[dim] = bcoord[dim] - originBlock[dim]
+				if chunkIdx[dim] < 0 {
+					dvid.Errorf("skipping zarr export of scale %d block %s outside extents of data %q\n", scale, bcoord, d.DataName())
+					return nil
+				}
+			}
+			data, _, err := dvid.DeserializeData(c.V, true)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize block %s in data %q: %v", bcoord, d.DataName(), err)
+			}
+			var block labels.Block
+			if err := block.UnmarshalBinary(data); err != nil {
+				return fmt.Errorf("unable to unmarshal block %s in data %q: %v", bcoord, d.DataName(), err)
+			}
+			if svm != nil {
+				svm.ApplyMappingToBlock(ancestry, &block)
+			}
+			lblarray, _ := block.MakeLabelVolume()
+			if !zarrMaskChunk(lblarray, bcoord, blockSize, factor, zr) {
+				return nil
+			}
+			var buf bytes.Buffer
+			zw, err := gzip.NewWriterLevel(&buf, zarray.Compressor.Level)
+			if err != nil {
+				return err
+			}
+			if _, err := zw.Write(lblarray); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			chunkDir := filepath.Join(scaleDir, fmt.Sprintf("%d", chunkIdx[2]), fmt.Sprintf("%d", chunkIdx[1]))
+			if err := os.MkdirAll(chunkDir, 0755); err != nil {
+				return err
+			}
+			numChunks++
+			return ioutil.WriteFile(filepath.Join(chunkDir, fmt.Sprintf("%d", chunkIdx[0])), buf.Bytes(), 0644)
+		})
+		if err != nil {
+			return fmt.Errorf("zarr export of scale %d for data %q: %v", scale, d.DataName(), err)
+		}
+		timedLog.Infof("Exported %d zarr chunks from %d blocks at scale %d of data %q to %s", numChunks, numBlocks, scale, d.DataName(), scaleDir)
+	}
+	attrs := map[string][]omeMultiscale{"multiscales": {multiscale}}
+	if err := writeZarrJSON(filepath.Join(dir, ".zattrs"), attrs); err != nil {
+		return err
+	}
+	timedLog.Infof("Finished zarr export of data %q scales 0-%d to %s", d.DataName(), opts.MaxScale, dir)
+	return nil
+}
+
+// zarrMaskChunk zeroes voxels outside the ROI, if any, and returns false if the chunk
+// has only zero labels.
+func zarrMaskChunk(lblarray []byte, bcoord, blockSize dvid.Point3d, factor int32, zr *zarrROI) bool {
+	var nonzero bool
+	var i int
+	for z := int32(0); z < blockSize[2]; z++ {
+		for y := int32(0); y < blockSize[1]; y++ {
+			for x := int32(0); x < blockSize[0]; x++ {
+				if binary.LittleEndian.Uint64(lblarray[i:i+8]) != 0 {
+					if zr != nil {
+						pt := dvid.Point3d{
+							(bcoord[0]*blockSize[0] + x) * factor,
+							(bcoord[1]*blockSize[1] + y) * factor,
+							(bcoord[2]*blockSize[2] + z) * factor,
+						}
+						if !zr.inside(pt) {
+							binary.LittleEndian.PutUint64(lblarray[i:i+8], 0)
+							i += 8
+							continue
+						}
+					}
+					nonzero = true
+				}
+				i += 8
+			}
+		}
+	}
+	return nonzero
+}
+
+func writeZarrJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -802,6 +802,19 @@ func (w *wrappedResponseWriter) Write(buf []byte) (int, error) {
 	return n, err
 }
 
+// Flush passes through flushes so streaming responses work behind the middleware.
+func (w *wrappedResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer so http.ResponseController can reach the connection.
+func (w *wrappedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func wrapResponseWriter(w http.ResponseWriter) *wrappedResponseWriter {
 	wr := wrappedResponseWriter{
 		ResponseWriter: w,